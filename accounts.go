@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errAccountExists   = errors.New("account already exists")
+	errAccountNotFound = errors.New("account not found")
+)
+
+// timeNow is swapped out in tests that exercise lockout expiry.
+var timeNow = time.Now
+
+// Account is a local Redfish user. Only the bcrypt hash of the password is
+// ever held in memory or written to disk.
+type Account struct {
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	RoleID       string `json:"role"`
+	Enabled      bool   `json:"enabled"`
+}
+
+func (a *Account) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) == nil
+}
+
+// AccountStore persists accounts to a JSON file, rewritten atomically on
+// every change.
+type AccountStore struct {
+	path string
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+	lockout  loginLockout
+}
+
+// loginLockout applies the lockout policy to the failed logins of one
+// auth backend. It is kept in memory only, so a daemon restart clears any
+// lockout.
+type loginLockout struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+}
+
+// loginFailures tracks failed logins for one username.
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+	locked      bool
+}
+
+var accountStore *AccountStore
+
+func openAccountStore(path string) (*AccountStore, error) {
+	store := &AccountStore{
+		path:     path,
+		accounts: map[string]*Account{},
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts: %w", err)
+	}
+
+	var accounts []*Account
+	if err := json.Unmarshal(content, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts: %w", err)
+	}
+	for _, account := range accounts {
+		store.accounts[account.ID] = account
+	}
+	return store, nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func generatePassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// writeInitialPassword stores the generated password of the initial
+// account next to accountsFile, readable only by root, and returns where.
+// It is kept out of the log, which ends up on the SD card for anyone to
+// read.
+func writeInitialPassword(accountsFile, password string) (string, error) {
+	path := filepath.Join(filepath.Dir(accountsFile), "initial-password")
+	if err := writeFileAtomic(path, []byte(password+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// save persists the accounts. Callers must hold s.mu.
+func (s *AccountStore) save() error {
+	content, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, content, 0o600)
+}
+
+func (s *AccountStore) listLocked() []*Account {
+	accounts := make([]*Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		a, _ := strconv.Atoi(accounts[i].ID)
+		b, _ := strconv.Atoi(accounts[j].ID)
+		return a < b
+	})
+	return accounts
+}
+
+// List returns copies of all accounts ordered by ID.
+func (s *AccountStore) List() []Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Account
+	for _, account := range s.listLocked() {
+		result = append(result, *account)
+	}
+	return result
+}
+
+func (s *AccountStore) Get(id string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return Account{}, false
+	}
+	return *account, true
+}
+
+func (s *AccountStore) FindByUsername(username string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		if account.Username == username {
+			return *account, true
+		}
+	}
+	return Account{}, false
+}
+
+func (s *AccountStore) Create(username, password, roleID string, enabled bool) (Account, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return Account{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nextID := 1
+	for _, account := range s.accounts {
+		if account.Username == username {
+			return Account{}, errAccountExists
+		}
+		if id, _ := strconv.Atoi(account.ID); id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	account := &Account{
+		ID:           strconv.Itoa(nextID),
+		Username:     username,
+		PasswordHash: hash,
+		RoleID:       roleID,
+		Enabled:      enabled,
+	}
+	s.accounts[account.ID] = account
+
+	if err := s.save(); err != nil {
+		delete(s.accounts, account.ID)
+		return Account{}, err
+	}
+	return *account, nil
+}
+
+// AccountUpdate lists the fields to change; nil fields are left alone.
+type AccountUpdate struct {
+	Username *string
+	Password *string
+	RoleID   *string
+	Enabled  *bool
+}
+
+func (s *AccountStore) Update(id string, update AccountUpdate) (Account, error) {
+	var hash string
+	if update.Password != nil {
+		var err error
+		if hash, err = hashPassword(*update.Password); err != nil {
+			return Account{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return Account{}, errAccountNotFound
+	}
+	if update.Username != nil {
+		for _, other := range s.accounts {
+			if other.ID != id && other.Username == *update.Username {
+				return Account{}, errAccountExists
+			}
+		}
+	}
+
+	previous := *account
+	if update.Username != nil {
+		account.Username = *update.Username
+	}
+	if update.Password != nil {
+		account.PasswordHash = hash
+	}
+	if update.RoleID != nil {
+		account.RoleID = *update.RoleID
+	}
+	if update.Enabled != nil {
+		account.Enabled = *update.Enabled
+	}
+
+	if err := s.save(); err != nil {
+		*account = previous
+		return Account{}, err
+	}
+	return *account, nil
+}
+
+func (s *AccountStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return errAccountNotFound
+	}
+	delete(s.accounts, id)
+
+	if err := s.save(); err != nil {
+		s.accounts[id] = account
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks a username and password against the store. A locked
+// out username is refused; authenticatePassword counts the failures.
+func (s *AccountStore) Authenticate(username, password string) (*Principal, bool) {
+	if s.IsLocked(username) {
+		return nil, false
+	}
+
+	account, ok := s.FindByUsername(username)
+	if !ok || !account.Enabled || !account.CheckPassword(password) {
+		return nil, false
+	}
+	return &Principal{Username: account.Username, RoleID: account.RoleID, Backend: s.Name()}, true
+}
+
+func (l *loginLockout) recordFailure(username string) {
+	policy := currentConfig.AccountPolicy
+	if policy.LockoutThreshold == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := timeNow()
+	if l.failures == nil {
+		l.failures = map[string]*loginFailures{}
+	}
+	f, ok := l.failures[username]
+	if !ok {
+		f = &loginFailures{}
+		l.failures[username] = f
+	}
+	if policy.LockoutCounterResetAfter > 0 && now.Sub(f.last) > time.Duration(policy.LockoutCounterResetAfter)*time.Second {
+		f.count = 0
+	}
+	f.count++
+	f.last = now
+
+	if f.count >= policy.LockoutThreshold {
+		f.locked = true
+		if policy.LockoutDuration > 0 {
+			f.lockedUntil = now.Add(time.Duration(policy.LockoutDuration) * time.Second)
+		}
+	}
+}
+
+// isLocked reports whether failed logins have locked the username out.
+func (l *loginLockout) isLocked(username string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[username]
+	if !ok || !f.locked {
+		return false
+	}
+	if !f.lockedUntil.IsZero() && timeNow().After(f.lockedUntil) {
+		delete(l.failures, username)
+		return false
+	}
+	return true
+}
+
+// clear forgets any lockout and failure count for the username.
+func (l *loginLockout) clear(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, username)
+}
+
+// Lockout counts the failed logins of local accounts.
+func (s *AccountStore) Lockout() *loginLockout {
+	return &s.lockout
+}
+
+// IsLocked reports whether failed logins have locked the username out.
+func (s *AccountStore) IsLocked(username string) bool {
+	return s.lockout.isLocked(username)
+}
+
+// Unlock clears any lockout and failure count for the username.
+func (s *AccountStore) Unlock(username string) {
+	s.lockout.clear(username)
+}
+
+// checkPassword returns a description of the first rule the password breaks,
+// or nil if it satisfies the policy.
+func (p AccountPolicy) checkPassword(password string) error {
+	if len(password) < p.MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinPasswordLength)
+	}
+	if len(password) > p.MaxPasswordLength {
+		return fmt.Errorf("password must be at most %d characters", p.MaxPasswordLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinCharacterClasses {
+		return fmt.Errorf("password must contain at least %d of lowercase, uppercase, digits and symbols", p.MinCharacterClasses)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupAccountStore points the global store at a fresh file for the
+// duration of a test.
+func setupAccountStore(t *testing.T) *AccountStore {
+	t.Helper()
+
+	store, err := openAccountStore(filepath.Join(t.TempDir(), "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := accountStore
+	accountStore = store
+	t.Cleanup(func() { accountStore = old })
+	return store
+}
+
+func TestAccountStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "accounts.json")
+	store, err := openAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin, err := store.Create("admin", "secret-password", "Administrator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("admin", "other", "ReadOnly", true); err != errAccountExists {
+		t.Errorf("Expected errAccountExists, got %v", err)
+	}
+	if _, err := store.Create("viewer", "viewer-password", "ReadOnly", true); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret-password") {
+		t.Error("Password stored in plain text")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only accounts.json in directory, found %d entries", len(entries))
+	}
+
+	reopened, err := openAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.List()) != 2 {
+		t.Fatalf("Expected 2 accounts after reopen, got %d", len(reopened.List()))
+	}
+	if _, ok := reopened.Authenticate("admin", "secret-password"); !ok {
+		t.Error("Expected admin to authenticate after reopen")
+	}
+
+	if err := reopened.Delete(admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.FindByUsername("admin"); ok {
+		t.Error("Expected admin to be deleted")
+	}
+}
+
+func TestAccountStoreAuthenticate(t *testing.T) {
+	store := setupAccountStore(t)
+
+	account, err := store.Create("operator", "correct-horse", "Operator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := store.Authenticate("operator", "correct-horse"); !ok || p.RoleID != "Operator" {
+		t.Errorf("Expected Operator principal, got %v %v", p, ok)
+	}
+	if _, ok := store.Authenticate("operator", "wrong"); ok {
+		t.Error("Expected wrong password to fail")
+	}
+	if _, ok := store.Authenticate("nobody", "correct-horse"); ok {
+		t.Error("Expected unknown user to fail")
+	}
+
+	disabled := false
+	if _, err := store.Update(account.ID, AccountUpdate{Enabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Authenticate("operator", "correct-horse"); ok {
+		t.Error("Expected disabled account to fail")
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("admin", "admin-password", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := currentConfig
+	currentConfig.AccountPolicy.LockoutThreshold = 3
+	currentConfig.AccountPolicy.LockoutDuration = 60
+	currentConfig.AccountPolicy.LockoutCounterResetAfter = 30
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+	defer func() {
+		currentConfig = oldConfig
+		timeNow = time.Now
+	}()
+
+	// Failures spread wider than the reset window never lock the account.
+	for i := 0; i < 3; i++ {
+		authenticatePassword("admin", "wrong")
+		clock = clock.Add(31 * time.Second)
+	}
+	if store.IsLocked("admin") {
+		t.Fatal("Expected failure counter to reset between attempts")
+	}
+
+	for i := 0; i < 3; i++ {
+		authenticatePassword("admin", "wrong")
+	}
+	if !store.IsLocked("admin") {
+		t.Fatal("Expected account to be locked after 3 failures")
+	}
+	if _, ok := authenticatePassword("admin", "admin-password"); ok {
+		t.Error("Expected locked account to reject the correct password")
+	}
+
+	clock = clock.Add(61 * time.Second)
+	if store.IsLocked("admin") {
+		t.Error("Expected lockout to expire")
+	}
+	if _, ok := authenticatePassword("admin", "admin-password"); !ok {
+		t.Error("Expected login to succeed after lockout expired")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	policy := AccountPolicy{
+		MinPasswordLength:   8,
+		MaxPasswordLength:   20,
+		MinCharacterClasses: 3,
+	}
+
+	tests := []struct {
+		password    string
+		expectError bool
+	}{
+		{"Sh0rt", true},
+		{"alllowercase", true},
+		{"lower-and-symbol", true},
+		{"Mixed-Case", false},
+		{"digits123AND", false},
+		{"Way-Too-Long-Password-1", true},
+	}
+
+	for _, tt := range tests {
+		err := policy.checkPassword(tt.password)
+		if tt.expectError && err == nil {
+			t.Errorf("Expected %q to be rejected", tt.password)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", tt.password, err)
+		}
+	}
+}
+
+func TestWriteInitialPassword(t *testing.T) {
+	dir := t.TempDir()
+	path, err := writeInitialPassword(filepath.Join(dir, "accounts.json"), "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "initial-password") {
+		t.Errorf("Expected the password next to the accounts, got %s", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	if content, _ := os.ReadFile(path); string(content) != "s3cret\n" {
+		t.Errorf("Expected the password in the file, got %q", content)
+	}
+}
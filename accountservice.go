@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const accountServicePath = "/redfish/v1/AccountService"
+
+type ManagerAccount struct {
+	ODataType string          `json:"@odata.type"`
+	ODataID   string          `json:"@odata.id"`
+	ODataEtag string          `json:"@odata.etag,omitempty"`
+	ID        string          `json:"Id"`
+	Name      string          `json:"Name"`
+	UserName  string          `json:"UserName"`
+	RoleID    string          `json:"RoleId"`
+	Enabled   bool            `json:"Enabled"`
+	Locked    bool            `json:"Locked"`
+	Password  *string         `json:"Password"`
+	Links     map[string]Link `json:"Links"`
+}
+
+type Link struct {
+	ODataID string `json:"@odata.id"`
+}
+
+type AccountRequest struct {
+	UserName *string `json:"UserName"`
+	Password *string `json:"Password"`
+	RoleID   *string `json:"RoleId"`
+	Enabled  *bool   `json:"Enabled"`
+	Locked   *bool   `json:"Locked"`
+}
+
+func accountPath(id string) string {
+	return accountServicePath + "/Accounts/" + id
+}
+
+func toManagerAccount(account Account) ManagerAccount {
+	return ManagerAccount{
+		ODataType: odataType("ManagerAccount"),
+		ODataID:   accountPath(account.ID),
+		ID:        account.ID,
+		Name:      "User Account",
+		UserName:  account.Username,
+		RoleID:    account.RoleID,
+		Enabled:   account.Enabled,
+		Locked:    accountStore.IsLocked(account.Username),
+		Links: map[string]Link{
+			"Role": {ODataID: accountServicePath + "/Roles/" + account.RoleID},
+		},
+	}
+}
+
+func handleAccountService(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, accountServicePath), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "":
+		handleAccountServiceRoot(w, r)
+	case len(parts) == 1 && parts[0] == "Accounts":
+		handleAccounts(w, r)
+	case len(parts) == 2 && parts[0] == "Accounts":
+		handleAccount(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "Roles":
+		handleRoles(w, r)
+	case len(parts) == 2 && parts[0] == "Roles":
+		handleRole(w, r, parts[1])
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleAccountServiceRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	policy := currentConfig.AccountPolicy
+	service := map[string]interface{}{
+		"@odata.type":                     odataType("AccountService"),
+		"@odata.id":                       accountServicePath,
+		"Id":                              "AccountService",
+		"Name":                            "Account Service",
+		"ServiceEnabled":                  accountStore != nil,
+		"MinPasswordLength":               policy.MinPasswordLength,
+		"MaxPasswordLength":               policy.MaxPasswordLength,
+		"AccountLockoutThreshold":         policy.LockoutThreshold,
+		"AccountLockoutDuration":          policy.LockoutDuration,
+		"AccountLockoutCounterResetAfter": policy.LockoutCounterResetAfter,
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+		"Accounts": map[string]string{
+			"@odata.id": accountServicePath + "/Accounts",
+		},
+		"Roles": map[string]string{
+			"@odata.id": accountServicePath + "/Roles",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service)
+}
+
+func handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if accountStore == nil {
+		if checkMethod(w, r, "GET", "POST") {
+			writeServiceNotEnabled(w, "AccountService")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleAccountsGet(w, r)
+	case http.MethodPost:
+		handleAccountsPost(w, r)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "POST")
+	}
+}
+
+func handleAccountsGet(w http.ResponseWriter, r *http.Request) {
+	accounts := accountStore.List()
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = accountPath(account.ID)
+	}
+	members, ok := filterMembers(w, r, ids, func(i int) interface{} { return toManagerAccount(accounts[i]) })
+	if !ok {
+		return
+	}
+
+	collection := SystemCollection{
+		ODataType:                 "#ManagerAccountCollection.ManagerAccountCollection",
+		ODataID:                   accountServicePath + "/Accounts",
+		Name:                      "Accounts Collection",
+		Members:                   members,
+		OperationApplyTimeSupport: immediateApplyTime(),
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func decodeAccountRequest(w http.ResponseWriter, r *http.Request) (AccountRequest, []byte, bool) {
+	var req AccountRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return req, nil, false
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return req, nil, false
+	}
+	return req, body, true
+}
+
+// validateAccountRequest checks the supplied values against the role list
+// and account policy, writing an error response if any are rejected.
+func validateAccountRequest(w http.ResponseWriter, req AccountRequest) bool {
+	if req.RoleID != nil {
+		if _, ok := roles[*req.RoleID]; !ok {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueNotInList", *req.RoleID, "RoleId").withProperty("#/RoleId"))
+			return false
+		}
+	}
+	if req.Password != nil {
+		if err := currentConfig.AccountPolicy.checkPassword(*req.Password); err != nil {
+			// Never echo the rejected password back to the client.
+			msg := newMessage("PropertyValueIncorrect", "Password", "******").withProperty("#/Password")
+			msg.Resolution = "Choose a password that meets the account policy: " + err.Error() + "."
+			writeRedfishError(w, http.StatusBadRequest, msg)
+			return false
+		}
+	}
+	if req.Locked != nil && *req.Locked {
+		// Accounts are only locked by failed logins; clients may clear
+		// the lock but not set it.
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueIncorrect", "Locked", "true").withProperty("#/Locked"))
+		return false
+	}
+	return true
+}
+
+func handleAccountsPost(w http.ResponseWriter, r *http.Request) {
+	if p := principalFromRequest(r); p != nil && !p.HasPrivilege(PrivilegeConfigureUsers) {
+		writeInsufficientPrivilege(w)
+		return
+	}
+
+	req, _, ok := decodeAccountRequest(w, r)
+	if !ok || !validateAccountRequest(w, req) {
+		return
+	}
+	var missing []MessageInfo
+	if req.UserName == nil || *req.UserName == "" {
+		missing = append(missing, newMessage("PropertyMissing", "UserName").withProperty("#/UserName"))
+	}
+	if req.Password == nil {
+		missing = append(missing, newMessage("PropertyMissing", "Password").withProperty("#/Password"))
+	}
+	if req.RoleID == nil {
+		missing = append(missing, newMessage("PropertyMissing", "RoleId").withProperty("#/RoleId"))
+	}
+	if len(missing) > 0 {
+		writeRedfishError(w, http.StatusBadRequest, missing...)
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	account, err := accountStore.Create(*req.UserName, *req.Password, *req.RoleID, enabled)
+	if errors.Is(err, errAccountExists) {
+		writeRedfishError(w, http.StatusConflict,
+			newMessage("ResourceAlreadyExists", "ManagerAccount", "UserName", *req.UserName).withProperty("#/UserName"))
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "create account", err)
+		return
+	}
+
+	// The new account comes back as GET shows it, etag included, so a
+	// client can go on to PATCH it with If-Match.
+	resource := toManagerAccount(account)
+	resource.ODataEtag = resourceETag(resource)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", accountPath(account.ID))
+	w.Header().Set("ETag", resource.ODataEtag)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resource)
+}
+
+func handleAccount(w http.ResponseWriter, r *http.Request, id string) {
+	if accountStore == nil {
+		if checkMethod(w, r, "GET", "PATCH", "DELETE") {
+			writeServiceNotEnabled(w, "AccountService")
+		}
+		return
+	}
+
+	account, ok := accountStore.Get(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		resource := toManagerAccount(account)
+		etag := resourceETag(resource)
+		if notModified(w, r, etag) {
+			return
+		}
+		resource.ODataEtag = etag
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(resource)
+	case http.MethodPatch:
+		handleAccountPatch(w, r, account)
+	case http.MethodDelete:
+		handleAccountDelete(w, r, account)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH", "DELETE")
+	}
+}
+
+func handleAccountPatch(w http.ResponseWriter, r *http.Request, account Account) {
+	req, body, ok := decodeAccountRequest(w, r)
+	if !ok {
+		return
+	}
+	if !checkPreconditions(w, r, resourceETag(toManagerAccount(account)), false) {
+		return
+	}
+
+	// Users holding only ConfigureSelf may change their own password and
+	// nothing else. A user from another backend with the same name is not
+	// the owner of the local account.
+	if p := principalFromRequest(r); p != nil && !p.HasPrivilege(PrivilegeConfigureUsers) {
+		selfPasswordChange := p.Username == account.Username && p.Backend == accountStore.Name() &&
+			req.UserName == nil && req.RoleID == nil && req.Enabled == nil && req.Locked == nil
+		if !selfPasswordChange {
+			writeInsufficientPrivilege(w)
+			return
+		}
+	}
+	get := func(w http.ResponseWriter, r *http.Request) { handleAccount(w, r, account.ID) }
+	ignored, ok := checkPatchProperties(w, r, body, &req, get)
+	if !ok {
+		return
+	}
+
+	if !validateAccountRequest(w, req) {
+		return
+	}
+	if req.UserName != nil && *req.UserName == "" {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueIncorrect", "UserName", `""`).withProperty("#/UserName"))
+		return
+	}
+
+	_, err := accountStore.Update(account.ID, AccountUpdate{
+		Username: req.UserName,
+		Password: req.Password,
+		RoleID:   req.RoleID,
+		Enabled:  req.Enabled,
+	})
+	if errors.Is(err, errAccountExists) {
+		writeRedfishError(w, http.StatusConflict,
+			newMessage("ResourceAlreadyExists", "ManagerAccount", "UserName", *req.UserName).withProperty("#/UserName"))
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "update account", err)
+		return
+	}
+	if req.Locked != nil {
+		accountStore.Unlock(account.Username)
+	}
+
+	writePatchedResource(w, r, ignored, get)
+}
+
+func handleAccountDelete(w http.ResponseWriter, r *http.Request, account Account) {
+	if p := principalFromRequest(r); p != nil && !p.HasPrivilege(PrivilegeConfigureUsers) {
+		writeInsufficientPrivilege(w)
+		return
+	}
+
+	if err := accountStore.Delete(account.ID); err != nil {
+		writeInternalError(w, "delete account", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sortedRoleIDs() []string {
+	ids := make([]string, 0, len(roles))
+	for id := range roles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func handleRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	for _, id := range sortedRoleIDs() {
+		members = append(members, map[string]string{"@odata.id": accountServicePath + "/Roles/" + id})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#RoleCollection.RoleCollection",
+		ODataID:   accountServicePath + "/Roles",
+		Name:      "Roles Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleRole(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	privileges, ok := roles[id]
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	role := map[string]interface{}{
+		"@odata.type":        odataType("Role"),
+		"@odata.id":          accountServicePath + "/Roles/" + id,
+		"Id":                 id,
+		"Name":               id + " Role",
+		"RoleId":             id,
+		"IsPredefined":       true,
+		"AssignedPrivileges": privileges,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(role)
+}
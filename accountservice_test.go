@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccountServiceCRUD(t *testing.T) {
+	setupAccountStore(t)
+	handler := newHandler()
+
+	body := `{"UserName": "ironic", "Password": "ironic-password", "RoleId": "Operator"}`
+	req, err := http.NewRequest("POST", accountServicePath+"/Accounts", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	location := rr.Header().Get("Location")
+	if location == "" {
+		t.Fatal("Expected Location header")
+	}
+
+	var created ManagerAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.UserName != "ironic" || created.RoleID != "Operator" || !created.Enabled {
+		t.Errorf("Unexpected account: %+v", created)
+	}
+	if created.Password != nil {
+		t.Error("Password must never be returned")
+	}
+	get := httptest.NewRecorder()
+	handler.ServeHTTP(get, httptest.NewRequest("GET", location, nil))
+	if etag := rr.Header().Get("ETag"); etag == "" || etag != created.ODataEtag || etag != get.Header().Get("ETag") {
+		t.Errorf("Expected the ETag of the new account, got %q and %q, GET has %q", etag, created.ODataEtag, get.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		expectCode int
+	}{
+		{"Duplicate user", "POST", accountServicePath + "/Accounts", body, http.StatusConflict},
+		{"Missing password", "POST", accountServicePath + "/Accounts", `{"UserName": "x", "RoleId": "Operator"}`, http.StatusBadRequest},
+		{"Unknown role", "POST", accountServicePath + "/Accounts", `{"UserName": "x", "Password": "y", "RoleId": "Root"}`, http.StatusBadRequest},
+		{"Get account", "GET", location, "", http.StatusOK},
+		{"Change role", "PATCH", location, `{"RoleId": "ReadOnly"}`, http.StatusOK},
+		{"Missing account", "GET", accountServicePath + "/Accounts/99", "", http.StatusNotFound},
+		{"Roles", "GET", accountServicePath + "/Roles", "", http.StatusOK},
+		{"Role", "GET", accountServicePath + "/Roles/Operator", "", http.StatusOK},
+		{"Missing role", "GET", accountServicePath + "/Roles/Root", "", http.StatusNotFound},
+		{"Delete account", "DELETE", location, "", http.StatusNoContent},
+		{"Deleted account", "GET", location, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	store := setupAccountStore(t)
+	admin, err := store.Create("admin", "admin-password", "Administrator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewer, err := store.Create("viewer", "viewer-password", "ReadOnly", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	defer func() { currentConfig = oldConfig }()
+
+	handler := newHandler()
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		method     string
+		path       string
+		body       string
+		expectCode int
+	}{
+		{
+			name:       "Service root is public",
+			method:     "GET",
+			path:       "/redfish/v1",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "No credentials",
+			method:     "GET",
+			path:       "/redfish/v1/Systems",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "Wrong password",
+			username:   "admin",
+			password:   "wrong",
+			method:     "GET",
+			path:       "/redfish/v1/Systems",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "Valid credentials",
+			username:   "viewer",
+			password:   "viewer-password",
+			method:     "GET",
+			path:       "/redfish/v1/Systems",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "ReadOnly cannot create accounts",
+			username:   "viewer",
+			password:   "viewer-password",
+			method:     "POST",
+			path:       accountServicePath + "/Accounts",
+			body:       `{"UserName": "x", "Password": "y", "RoleId": "Administrator"}`,
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "ReadOnly cannot change another account",
+			username:   "viewer",
+			password:   "viewer-password",
+			method:     "PATCH",
+			path:       accountPath(admin.ID),
+			body:       `{"Password": "hijacked"}`,
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "ReadOnly cannot change own role",
+			username:   "viewer",
+			password:   "viewer-password",
+			method:     "PATCH",
+			path:       accountPath(viewer.ID),
+			body:       `{"RoleId": "Administrator"}`,
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "ReadOnly can change own password",
+			username:   "viewer",
+			password:   "viewer-password",
+			method:     "PATCH",
+			path:       accountPath(viewer.ID),
+			body:       `{"Password": "new-viewer-password"}`,
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "New password is in effect",
+			username:   "viewer",
+			password:   "new-viewer-password",
+			method:     "GET",
+			path:       "/redfish/v1/Systems",
+			expectCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestAccountPolicyErrors(t *testing.T) {
+	store := setupAccountStore(t)
+	account, err := store.Create("admin", "admin-password", "Administrator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := currentConfig
+	currentConfig.AccountPolicy.LockoutThreshold = 1
+	defer func() { currentConfig = oldConfig }()
+
+	handler := newHandler()
+
+	req, err := http.NewRequest("POST", accountServicePath+"/Accounts",
+		bytes.NewBufferString(`{"UserName": "weak", "Password": "abc", "RoleId": "ReadOnly"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var body map[string]redfishErrorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	info := body["error"].ExtendedInfo
+	if len(info) != 1 || info[0].MessageID != "Base.1.8.PropertyValueIncorrect" {
+		t.Fatalf("Expected PropertyValueIncorrect, got %+v", info)
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte("abc")) {
+		t.Error("Rejected password must not be echoed")
+	}
+
+	authenticatePassword("admin", "wrong")
+	if !store.IsLocked("admin") {
+		t.Fatal("Expected account to be locked")
+	}
+
+	req, err = http.NewRequest("GET", accountPath(account.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var got ManagerAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Locked {
+		t.Error("Expected Locked to be reported")
+	}
+
+	for _, tt := range []struct {
+		body       string
+		expectCode int
+	}{
+		{`{"Locked": true}`, http.StatusBadRequest},
+		{`{"Locked": false}`, http.StatusOK},
+	} {
+		req, err := http.NewRequest("PATCH", accountPath(account.ID), bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.expectCode {
+			t.Errorf("PATCH %s: expected status %d, got %d", tt.body, tt.expectCode, rr.Code)
+		}
+	}
+	if store.IsLocked("admin") {
+		t.Error("Expected PATCH Locked=false to unlock the account")
+	}
+}
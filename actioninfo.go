@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ActionInfo describes the parameters of an action and the values each
+// accepts, for clients that read @Redfish.ActionInfo rather than the
+// @Redfish.AllowableValues annotations on the action.
+type ActionInfo struct {
+	ODataType  string                `json:"@odata.type"`
+	ODataID    string                `json:"@odata.id"`
+	ID         string                `json:"Id"`
+	Name       string                `json:"Name"`
+	Parameters []ActionInfoParameter `json:"Parameters"`
+}
+
+type ActionInfoParameter struct {
+	Name            string   `json:"Name"`
+	Required        bool     `json:"Required"`
+	DataType        string   `json:"DataType"`
+	AllowableValues []string `json:"AllowableValues,omitempty"`
+}
+
+func newActionInfo(path, id, name string, params ...ActionInfoParameter) ActionInfo {
+	return ActionInfo{
+		ODataType:  odataType("ActionInfo"),
+		ODataID:    path,
+		ID:         id,
+		Name:       name,
+		Parameters: params,
+	}
+}
+
+func handleActionInfo(w http.ResponseWriter, r *http.Request, info ActionInfo) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (s *hostSystem) resetActionInfoPath() string {
+	return s.path() + "/ResetActionInfo"
+}
+
+// resetActionInfo lists the reset types the system's wiring supports, the
+// same as ResetType@Redfish.AllowableValues.
+func (s *hostSystem) resetActionInfo() ActionInfo {
+	return newActionInfo(s.resetActionInfoPath(), "ResetActionInfo", "Reset Action Info",
+		ActionInfoParameter{
+			Name:            "ResetType",
+			Required:        true,
+			DataType:        "String",
+			AllowableValues: s.resetTypes(),
+		})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseAllowlistEntry accepts a CIDR or a bare address, which is treated as
+// a single-host network.
+func parseAllowlistEntry(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: entry}
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(entry)
+	return ipnet, err
+}
+
+// isStateChanging reports whether the request can change the managed host
+// or the service. Logging in and out is exempt so that read-only clients
+// outside the allowlist can still use sessions.
+func isStateChanging(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, sessionServicePath+"/Sessions")
+}
+
+// clientHost returns the address part of the request's remote address.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func clientAllowedToWrite(r *http.Request) bool {
+	if len(currentConfig.WriteAllowlist) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientHost(r))
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range currentConfig.WriteAllowlist {
+		// Entries were checked when the config was loaded.
+		if ipnet, err := parseAllowlistEntry(entry); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withWriteAllowlist refuses state-changing requests from clients outside
+// the configured networks. It runs before authentication so refused
+// clients never get to try credentials.
+func withWriteAllowlist(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStateChanging(r) && !clientAllowedToWrite(r) {
+			writeRedfishError(w, http.StatusForbidden, newMessage("AccessDenied", r.URL.Path))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteAllowlist(t *testing.T) {
+	setupAccountStore(t)
+	oldConfig := currentConfig
+	currentConfig.WriteAllowlist = []string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"}
+	defer func() { currentConfig = oldConfig }()
+
+	handler := newHandler()
+	tests := []struct {
+		name       string
+		remoteAddr string
+		method     string
+		path       string
+		expectCode int
+	}{
+		{"Read from anywhere", "203.0.113.7:5000", "GET", "/redfish/v1/Systems", http.StatusOK},
+		{"Reset from outside", "203.0.113.7:5000", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", http.StatusForbidden},
+		{"Boot override from outside", "203.0.113.7:5000", "PATCH", "/redfish/v1/Systems/System.1", http.StatusForbidden},
+		{"Login from outside", "203.0.113.7:5000", "POST", sessionServicePath + "/Sessions", http.StatusBadRequest},
+		{"Reset from provisioning network", "10.1.2.3:5000", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", http.StatusBadRequest},
+		{"Single host entry", "192.168.1.5:5000", "PATCH", "/redfish/v1/Systems/System.1", http.StatusNoContent},
+		{"Neighbour of single host", "192.168.1.6:5000", "PATCH", "/redfish/v1/Systems/System.1", http.StatusForbidden},
+		{"IPv6 network", "[fd12::1]:5000", "PATCH", "/redfish/v1/Systems/System.1", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = tt.remoteAddr
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
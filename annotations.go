@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// OperationApplyTimeSupport is the @Redfish.OperationApplyTimeSupport
+// annotation. It tells clients which @Redfish.OperationApplyTime values a
+// collection POST, PATCH or action accepts, so they don't have to find out
+// by trial and error.
+type OperationApplyTimeSupport struct {
+	ODataType       string   `json:"@odata.type"`
+	SupportedValues []string `json:"SupportedValues"`
+}
+
+// Every operation is carried out before the response is sent; there is no
+// task service or maintenance window to defer work to.
+var supportedApplyTimes = []string{"Immediate"}
+
+func immediateApplyTime() *OperationApplyTimeSupport {
+	return &OperationApplyTimeSupport{
+		ODataType:       odataTypeOf("Settings", "OperationApplyTimeSupport"),
+		SupportedValues: supportedApplyTimes,
+	}
+}
+
+// checkOperationApplyTime rejects a requested @Redfish.OperationApplyTime
+// the service cannot honour. It writes the error and returns false.
+func checkOperationApplyTime(w http.ResponseWriter, applyTime *string) bool {
+	if applyTime == nil || containsString(supportedApplyTimes, *applyTime) {
+		return true
+	}
+	writeRedfishError(w, http.StatusBadRequest,
+		newMessage("PropertyValueNotInList", *applyTime, "@Redfish.OperationApplyTime").
+			withProperty("#/@Redfish.OperationApplyTime"))
+	return false
+}
+
+// withODataAnnotations adds the annotations every resource and collection
+// carries to successful JSON responses that lack them: @odata.context,
+// from the @odata.type, and @odata.etag, for resources whose handler does
+// not version them itself. Such an etag covers the whole body, so it also
+// answers If-None-Match with 304. Members@odata.count is left to
+// writeCollection, which knows the count beyond the page.
+func withODataAnnotations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		body := buf.body.Bytes()
+		if buf.status == http.StatusOK && strings.HasPrefix(buf.header.Get("Content-Type"), "application/json") {
+			var etag string
+			body, etag = annotateResource(body)
+			if etag != "" && buf.header.Get("ETag") == "" {
+				if r.Method == http.MethodGet && notModified(w, r, etag) {
+					return
+				}
+				w.Header().Set("ETag", etag)
+			}
+		}
+		w.WriteHeader(buf.status)
+		w.Write(body)
+	})
+}
+
+// annotateResource inserts @odata.context and @odata.etag at the start of
+// a resource body that has an @odata.type and @odata.id but not them. It
+// returns the new body and the etag it added, if any.
+func annotateResource(body []byte) ([]byte, string) {
+	var resource map[string]json.RawMessage
+	if json.Unmarshal(body, &resource) != nil {
+		return body, ""
+	}
+	var odataType string
+	json.Unmarshal(resource["@odata.type"], &odataType)
+	if odataType == "" || resource["@odata.id"] == nil {
+		return body, ""
+	}
+
+	var added []string
+	if _, ok := resource["@odata.context"]; !ok {
+		if context := odataContext(odataType); context != "" {
+			value, _ := json.Marshal(context)
+			added = append(added, `"@odata.context":`+string(value))
+		}
+	}
+	var etag string
+	if _, ok := resource["@odata.etag"]; !ok {
+		etag = contentETag(body)
+		value, _ := json.Marshal(etag)
+		added = append(added, `"@odata.etag":`+string(value))
+	}
+	if len(added) == 0 {
+		return body, ""
+	}
+
+	open := bytes.IndexByte(body, '{') + 1
+	insert := strings.Join(added, ",")
+	if len(resource) > 0 {
+		insert += ","
+	}
+	annotated := append([]byte{}, body[:open]...)
+	annotated = append(annotated, insert...)
+	return append(annotated, body[open:]...), etag
+}
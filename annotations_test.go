@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOperationApplyTimeSupport(t *testing.T) {
+	setupAccountStore(t)
+	setupEventService(t)
+	setupSessionStore(t)
+
+	tmpDir := t.TempDir()
+	gpioPowerLED := filepath.Join(tmpDir, "gpio_power_led")
+	if err := os.WriteFile(gpioPowerLED, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldHardware := currentHardware
+	currentHardware = &Hardware{GPIOPowerLED: gpioPowerLED, GPIOReset: filepath.Join(tmpDir, "gpio_reset")}
+	defer func() { currentHardware = oldHardware }()
+
+	handler := newHandler()
+
+	tests := []struct {
+		path    string
+		pointer []string
+	}{
+		{"/redfish/v1/Systems/System.1", nil},
+		{"/redfish/v1/Systems/System.1", []string{"Actions", "#ComputerSystem.Reset"}},
+		{"/redfish/v1/AccountService/Accounts", nil},
+		{"/redfish/v1/EventService/Subscriptions", nil},
+		{"/redfish/v1/SessionService/Sessions", nil},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status %d, got %d", tt.path, http.StatusOK, rr.Code)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range tt.pointer {
+			body, _ = body[key].(map[string]interface{})
+		}
+		support, _ := body["@Redfish.OperationApplyTimeSupport"].(map[string]interface{})
+		if support == nil {
+			t.Errorf("%s %v: missing @Redfish.OperationApplyTimeSupport", tt.path, tt.pointer)
+			continue
+		}
+		if !reflect.DeepEqual(support["SupportedValues"], []interface{}{"Immediate"}) {
+			t.Errorf("%s %v: unexpected SupportedValues %v", tt.path, tt.pointer, support["SupportedValues"])
+		}
+	}
+}
+
+func TestOperationApplyTimeRequests(t *testing.T) {
+	oldBoot := currentBootConfig
+	defer func() { currentBootConfig = oldBoot }()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		expectCode int
+	}{
+		{
+			name:       "Patch applied immediately",
+			method:     "PATCH",
+			path:       "/redfish/v1/Systems/System.1",
+			body:       `{"Boot": {"BootSourceOverrideEnabled": "Once"}, "@Redfish.OperationApplyTime": "Immediate"}`,
+			expectCode: http.StatusNoContent,
+		},
+		{
+			name:       "Patch on reset",
+			method:     "PATCH",
+			path:       "/redfish/v1/Systems/System.1",
+			body:       `{"Boot": {"BootSourceOverrideEnabled": "Once"}, "@Redfish.OperationApplyTime": "OnReset"}`,
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Reset in maintenance window",
+			method:     "POST",
+			path:       "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+			body:       `{"ResetType": "ForceRestart", "@Redfish.OperationApplyTime": "AtMaintenanceWindowStart"}`,
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid override enabled",
+			method:     "PATCH",
+			path:       "/redfish/v1/Systems/System.1",
+			body:       `{"Boot": {"BootSourceOverrideEnabled": "Twice"}}`,
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			if tt.method == "PATCH" {
+				handleSystem(rr, req, primarySystem)
+			} else {
+				handleReset(rr, req, primarySystem)
+			}
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestODataAnnotations(t *testing.T) {
+	handler := withODataAnnotations(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"@odata.type":"#ManagerCollection.ManagerCollection","@odata.id":"/redfish/v1/Managers","Members":[]}`))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/redfish/v1/Managers", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON, got %q", rr.Body.String())
+	}
+	if body["@odata.context"] != "/redfish/v1/$metadata#ManagerCollection.ManagerCollection" {
+		t.Errorf("Unexpected @odata.context %v", body["@odata.context"])
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" || body["@odata.etag"] != etag {
+		t.Errorf("Expected @odata.etag to match the ETag header %q, got %v", etag, body["@odata.etag"])
+	}
+
+	req := httptest.NewRequest("GET", "/redfish/v1/Managers", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for the current etag, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one state-changing request as written to the audit file,
+// one JSON object per line.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Client     string    `json:"client"`
+	UserName   string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status"`
+}
+
+func (rec AuditRecord) succeeded() bool {
+	return rec.StatusCode < http.StatusBadRequest
+}
+
+func (rec AuditRecord) message() string {
+	user := rec.UserName
+	if user == "" {
+		user = "anonymous"
+	}
+	return fmt.Sprintf("%s from %s: %s %s returned %d", user, rec.Client, rec.Method, rec.Path, rec.StatusCode)
+}
+
+// AuditTrail appends records to a file that is never rewritten or
+// truncated by the service, and mirrors the most recent ones into the
+// Audit LogService.
+type AuditTrail struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var auditLog = &LogService{
+	ID:          "Audit",
+	Name:        "Audit Log",
+	Description: "Power, boot, media and configuration changes made through this service",
+	MaxEntries:  1000,
+	AppendOnly:  true,
+	nextID:      1,
+}
+
+var auditTrail *AuditTrail
+
+// openAuditTrail loads the existing records at path into the Audit
+// LogService and opens the file for appending. An empty path keeps the
+// audit log in memory only.
+func openAuditTrail(path string) (*AuditTrail, error) {
+	trail := &AuditTrail{}
+	if path == "" {
+		return trail, nil
+	}
+
+	if err := loadAuditFile(path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	trail.file = file
+	return trail, nil
+}
+
+func loadAuditFile(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A power cut can leave a partial last line; skip it rather
+			// than refusing to start.
+			log.Printf("Skipping unreadable audit log line %d: %v", line, err)
+			continue
+		}
+		addAuditEntry(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+func addAuditEntry(rec AuditRecord) {
+	ts := newTimestamp()
+	ts.Time = rec.Time
+
+	severity := "OK"
+	if !rec.succeeded() {
+		severity = "Warning"
+	}
+	auditLog.addRecord(logRecord{
+		created:  ts,
+		severity: severity,
+		message:  rec.message(),
+		audit: &LogEntryAudit{
+			ClientAddress: rec.Client,
+			UserName:      rec.UserName,
+			Method:        rec.Method,
+			Path:          rec.Path,
+			StatusCode:    rec.StatusCode,
+		},
+	})
+}
+
+// Record writes rec to the audit file and the Audit LogService. Failing to
+// write the file is logged; the request has already been served.
+func (t *AuditTrail) Record(rec AuditRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file != nil {
+		line, _ := json.Marshal(rec)
+		if _, err := t.file.Write(append(line, '\n')); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		} else if err := t.file.Sync(); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}
+	addAuditEntry(rec)
+}
+
+func (t *AuditTrail) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+type auditContextKey struct{}
+
+// auditedRequest collects what the outer audit middleware cannot see for
+// itself: the principal is only known once withAuth has run.
+type auditedRequest struct {
+	principal *Principal
+}
+
+// noteAuditPrincipal tells the audit middleware who made the request.
+func noteAuditPrincipal(r *http.Request, p *Principal) {
+	if audited, ok := r.Context().Value(auditContextKey{}).(*auditedRequest); ok {
+		audited.principal = p
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// withAudit records every state-changing request and its outcome. It runs
+// outermost so requests refused by the allowlist, the rate limiter or
+// authentication are recorded too.
+func withAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auditTrail == nil || !isStateChanging(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		audited := &auditedRequest{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, audited)))
+
+		rec := AuditRecord{
+			Time:       timeNow().UTC(),
+			Client:     clientHost(r),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: recorder.status,
+		}
+		if rec.StatusCode == 0 {
+			rec.StatusCode = http.StatusOK
+		}
+		if audited.principal != nil {
+			rec.UserName = audited.principal.Username
+		}
+		auditTrail.Record(rec)
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupAuditTrail(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog.Clear()
+	trail, err := openAuditTrail(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := auditTrail
+	auditTrail = trail
+	t.Cleanup(func() {
+		trail.Close()
+		auditTrail = old
+		auditLog.Clear()
+	})
+	return path
+}
+
+func TestAuditTrail(t *testing.T) {
+	path := setupAuditTrail(t)
+	store := setupAccountStore(t)
+	if _, err := store.Create("operator", "Passw0rd!", "Operator", true); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := currentConfig
+	oldBoot := currentBootConfig
+	currentConfig.RequireAuth = true
+	defer func() {
+		currentConfig = oldConfig
+		currentBootConfig = oldBoot
+	}()
+
+	handler := newHandler()
+	requests := []struct {
+		method   string
+		path     string
+		body     string
+		username string
+	}{
+		{"PATCH", "/redfish/v1/Systems/System.1", `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`, "operator"},
+		{"GET", "/redfish/v1/Systems", "", "operator"},
+		{"POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", `{"ResetType": "Bogus"}`, "operator"},
+		{"PATCH", "/redfish/v1/Systems/System.1", `{}`, ""},
+	}
+	for _, tt := range requests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "10.0.0.7:4000"
+		if tt.username != "" {
+			req.SetBasicAuth(tt.username, "Passw0rd!")
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	expected := []AuditRecord{
+		{Client: "10.0.0.7", UserName: "operator", Method: "PATCH", Path: "/redfish/v1/Systems/System.1", StatusCode: http.StatusNoContent},
+		{Client: "10.0.0.7", UserName: "operator", Method: "POST", Path: "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", StatusCode: http.StatusBadRequest},
+		{Client: "10.0.0.7", Method: "PATCH", Path: "/redfish/v1/Systems/System.1", StatusCode: http.StatusUnauthorized},
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d audit records, got %d: %+v", len(expected), len(records), records)
+	}
+	for i, rec := range records {
+		if rec.Time.IsZero() {
+			t.Errorf("Record %d has no timestamp", i)
+		}
+		rec.Time = expected[i].Time
+		if rec != expected[i] {
+			t.Errorf("Record %d: expected %+v, got %+v", i, expected[i], rec)
+		}
+	}
+
+	entries := auditLog.Entries()
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d audit log entries, got %d", len(expected), len(entries))
+	}
+	if entries[1].Severity != "Warning" || entries[1].Oem.NanoKVM.Audit.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected entry for failed reset: %+v", entries[1])
+	}
+
+	// Reopening picks up the records already on disk.
+	auditTrail.Close()
+	auditLog.Clear()
+	trail, err := openAuditTrail(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.Close()
+	if got := len(auditLog.Entries()); got != len(expected) {
+		t.Errorf("Expected %d entries after reopening, got %d", len(expected), got)
+	}
+}
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	setupAuditTrail(t)
+	auditTrail.Record(AuditRecord{Client: "10.0.0.7", Method: "PATCH", Path: "/redfish/v1/Systems/System.1", StatusCode: http.StatusNoContent})
+
+	req := httptest.NewRequest("POST", logServicesPath+"/Audit/Actions/LogService.ClearLog", nil)
+	rr := httptest.NewRecorder()
+	handleLogServices(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if got := len(auditLog.Entries()); got != 1 {
+		t.Errorf("Expected the audit log to keep its entry, got %d entries", got)
+	}
+
+	req = httptest.NewRequest("GET", logServicesPath+"/Audit", nil)
+	rr = httptest.NewRecorder()
+	handleLogServices(rr, req)
+	var service map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&service); err != nil {
+		t.Fatal(err)
+	}
+	if actions, _ := service["Actions"].(map[string]interface{}); len(actions) != 0 {
+		t.Errorf("Expected no actions on the audit log, got %v", actions)
+	}
+}
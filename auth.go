@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type Privilege string
+
+const (
+	PrivilegeLogin               Privilege = "Login"
+	PrivilegeConfigureComponents Privilege = "ConfigureComponents"
+	PrivilegeConfigureManager    Privilege = "ConfigureManager"
+	PrivilegeConfigureUsers      Privilege = "ConfigureUsers"
+	PrivilegeConfigureSelf       Privilege = "ConfigureSelf"
+)
+
+// Standard Redfish roles and the privileges they grant.
+var roles = map[string][]Privilege{
+	"Administrator": {
+		PrivilegeLogin,
+		PrivilegeConfigureComponents,
+		PrivilegeConfigureManager,
+		PrivilegeConfigureUsers,
+		PrivilegeConfigureSelf,
+	},
+	"Operator": {
+		PrivilegeLogin,
+		PrivilegeConfigureComponents,
+		PrivilegeConfigureSelf,
+	},
+	"ReadOnly": {
+		PrivilegeLogin,
+		PrivilegeConfigureSelf,
+	},
+}
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	Username string
+	RoleID   string
+	// Backend names the AuthBackend that accepted the credentials, if any.
+	Backend string
+}
+
+func (p *Principal) HasPrivilege(priv Privilege) bool {
+	for _, granted := range roles[p.RoleID] {
+		if granted == priv {
+			return true
+		}
+	}
+	return false
+}
+
+// cappedTo returns p with no more privileges than role grants. Without
+// auth there is no p, and the request gets role itself.
+func (p *Principal) cappedTo(role string) *Principal {
+	limit := &Principal{RoleID: role}
+	if p == nil {
+		return limit
+	}
+	capped := *p
+	for _, priv := range roles[p.RoleID] {
+		if !limit.HasPrivilege(priv) {
+			capped.RoleID = role
+			break
+		}
+	}
+	return &capped
+}
+
+type contextKey int
+
+const (
+	principalContextKey contextKey = iota
+	// privilegeCapContextKey holds the role withPrivilegeCap limits
+	// requests to.
+	privilegeCapContextKey
+)
+
+func principalFromRequest(r *http.Request) *Principal {
+	p, _ := r.Context().Value(principalContextKey).(*Principal)
+	return p
+}
+
+// requiredPrivilege returns the privilege needed to perform the request.
+func requiredPrivilege(r *http.Request) Privilege {
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return PrivilegeLogin
+	case strings.HasPrefix(r.URL.Path, accountServicePath):
+		// The account handlers decide between ConfigureUsers and
+		// ConfigureSelf once they know which account is being changed.
+		return PrivilegeConfigureSelf
+	case r.URL.Path == maintenanceActionPath || r.URL.Path == managerResetPath ||
+		r.URL.Path == "/redfish/v1/Managers/BMC" || r.URL.Path == networkProtocolPath ||
+		strings.HasPrefix(r.URL.Path, ethernetInterfacesPath):
+		return PrivilegeConfigureManager
+	case strings.HasPrefix(r.URL.Path, sessionServicePath):
+		// Logging out only needs a session; the handler checks whose.
+		return PrivilegeLogin
+	default:
+		return PrivilegeConfigureComponents
+	}
+}
+
+// isPublicPath reports whether the request may be served without
+// credentials. The spec requires the service root and the OData documents
+// to be readable anonymously so clients can discover how to authenticate, and
+// logging in must not itself require a login.
+func isPublicPath(r *http.Request) bool {
+	if isSessionLogin(r) {
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	switch r.URL.Path {
+	case "/redfish", "/redfish/v1", metadataPath, odataServicePath, oemSchemaPath:
+		return true
+	}
+	return false
+}
+
+// authenticate identifies the caller. When no authentication method is
+// configured it returns a nil principal and every request is allowed.
+func authenticate(r *http.Request) (*Principal, bool) {
+	if currentConfig.TLS.RequireClientCert {
+		return authenticateClientCert(r)
+	}
+	if currentConfig.RequireAuth {
+		if token := r.Header.Get("X-Auth-Token"); token != "" {
+			return authenticateSession(token)
+		}
+		return authenticateBasic(r)
+	}
+	return nil, true
+}
+
+// authenticateSession accepts a live session token. The account is looked
+// up again so that disabling or deleting it ends its sessions, and role
+// changes apply immediately.
+func authenticateSession(token string) (*Principal, bool) {
+	session, ok := sessionStore.Lookup(token)
+	if !ok {
+		return nil, false
+	}
+
+	backend := findAuthBackend(session.Backend)
+	if backend == nil {
+		sessionStore.Delete(session.ID)
+		return nil, false
+	}
+	principal, ok := backend.Lookup(session.Username)
+	if !ok {
+		sessionStore.Delete(session.ID)
+		return nil, false
+	}
+	return principal, true
+}
+
+func authenticateBasic(r *http.Request) (*Principal, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+	return authenticatePassword(username, password)
+}
+
+func authenticateClientCert(r *http.Request) (*Principal, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, false
+	}
+
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	role, ok := currentConfig.TLS.ClientCertRoles[cn]
+	if !ok {
+		return nil, false
+	}
+	return &Principal{Username: cn, RoleID: role}, true
+}
+
+// writeUnauthorized rejects a request without valid credentials. Basic
+// auth clients need the WWW-Authenticate challenge to know to retry with a
+// username and password.
+func writeUnauthorized(w http.ResponseWriter) {
+	if currentConfig.RequireAuth {
+		w.Header().Set("WWW-Authenticate", `Basic realm="NanoKVM Redfish"`)
+	}
+	writeRedfishError(w, http.StatusUnauthorized, newMessage("NoValidSession"))
+}
+
+func writeInsufficientPrivilege(w http.ResponseWriter) {
+	writeRedfishError(w, http.StatusForbidden, newMessage("InsufficientPrivilege"))
+}
+
+func withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, ok := authenticate(r)
+		if !ok {
+			writeUnauthorized(w)
+			return
+		}
+		// Capping the principal also caps the checks handlers make
+		// themselves, such as for creating accounts.
+		if role, ok := r.Context().Value(privilegeCapContextKey).(string); ok {
+			principal = principal.cappedTo(role)
+		}
+
+		if principal != nil {
+			if !principal.HasPrivilege(requiredPrivilege(r)) {
+				writeInsufficientPrivilege(w)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), principalContextKey, principal))
+			noteAuditPrincipal(r, principal)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
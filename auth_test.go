@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issueClientCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestHasPrivilege(t *testing.T) {
+	tests := []struct {
+		role     string
+		priv     Privilege
+		expected bool
+	}{
+		{"Administrator", PrivilegeConfigureUsers, true},
+		{"Operator", PrivilegeConfigureComponents, true},
+		{"Operator", PrivilegeConfigureUsers, false},
+		{"ReadOnly", PrivilegeLogin, true},
+		{"ReadOnly", PrivilegeConfigureComponents, false},
+		{"Unknown", PrivilegeLogin, false},
+	}
+
+	for _, tt := range tests {
+		p := &Principal{Username: "test", RoleID: tt.role}
+		if got := p.HasPrivilege(tt.priv); got != tt.expected {
+			t.Errorf("%s.HasPrivilege(%s) = %v, expected %v", tt.role, tt.priv, got, tt.expected)
+		}
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	ca := newTestCA(t)
+
+	oldConfig := currentConfig
+	currentConfig.TLS = TLSConfig{
+		RequireClientCert: true,
+		ClientCertRoles: map[string]string{
+			"ironic":  "Operator",
+			"monitor": "ReadOnly",
+		},
+	}
+	defer func() { currentConfig = oldConfig }()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(newHandler())
+	server.TLS = &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	clientFor := func(cn string) *http.Client {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = []tls.Certificate{ca.issueClientCert(t, cn)}
+		return &http.Client{Transport: transport}
+	}
+
+	tests := []struct {
+		name       string
+		cn         string
+		method     string
+		path       string
+		expectCode int
+	}{
+		{
+			name:       "Mapped CN can read",
+			cn:         "monitor",
+			method:     "GET",
+			path:       "/redfish/v1/Systems",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "Unmapped CN is rejected",
+			cn:         "stranger",
+			method:     "GET",
+			path:       "/redfish/v1/Systems",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "ReadOnly role cannot reset",
+			cn:         "monitor",
+			method:     "POST",
+			path:       "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "Operator role passes authorization",
+			cn:         "ironic",
+			method:     "POST",
+			path:       "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := clientFor(tt.cn).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, resp.StatusCode)
+			}
+		})
+	}
+
+	t.Run("No client certificate", func(t *testing.T) {
+		_, err := server.Client().Get(server.URL + "/redfish/v1")
+		if err == nil {
+			t.Error("Expected TLS handshake to fail without a client certificate")
+		}
+	})
+}
+
+func TestAuthErrorResponses(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("viewer", "viewer-password", "ReadOnly", true); err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	defer func() { currentConfig = oldConfig }()
+
+	tests := []struct {
+		name          string
+		username      string
+		method        string
+		expectCode    int
+		expectID      string
+		expectWWWAuth bool
+	}{
+		{
+			name:          "No credentials",
+			method:        "GET",
+			expectCode:    http.StatusUnauthorized,
+			expectID:      "Base.1.8.NoValidSession",
+			expectWWWAuth: true,
+		},
+		{
+			name:       "Insufficient privilege",
+			username:   "viewer",
+			method:     "POST",
+			expectCode: http.StatusForbidden,
+			expectID:   "Base.1.8.InsufficientPrivilege",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, "viewer-password")
+			}
+
+			rr := httptest.NewRecorder()
+			newHandler().ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); (got != "") != tt.expectWWWAuth {
+				t.Errorf("Unexpected WWW-Authenticate header %q", got)
+			}
+			var body map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["error"].Code != tt.expectID {
+				t.Errorf("Expected %s, got %s", tt.expectID, body["error"].Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthBackend checks username/password credentials against one source of
+// accounts.
+type AuthBackend interface {
+	Name() string
+	Authenticate(username, password string) (*Principal, bool)
+	// Lookup returns the principal for a username that authenticated
+	// earlier, or false if the account has since gone or been disabled.
+	// Sessions use it to notice such changes.
+	Lookup(username string) (*Principal, bool)
+	// Lockout counts the failed logins of the backend's users.
+	Lockout() *loginLockout
+}
+
+// authBackends returns the configured backends in the order they are tried.
+func authBackends() []AuthBackend {
+	var backends []AuthBackend
+	for _, name := range currentConfig.AuthBackends {
+		switch name {
+		case "local":
+			if accountStore != nil {
+				backends = append(backends, accountStore)
+			}
+		case "nanokvm":
+			backends = append(backends, nanoKVMBackend{cfg: currentConfig.NanoKVMAuth})
+		}
+	}
+	return backends
+}
+
+// authenticatePassword tries each backend in turn; the first to accept the
+// credentials decides the role. Failed logins are counted against every
+// backend that knows the username, under the one account_policy, and a
+// username locked out of any backend is refused by all of them, so that
+// guessing cannot carry on in another.
+func authenticatePassword(username, password string) (*Principal, bool) {
+	backends := authBackends()
+	for _, backend := range backends {
+		if backend.Lockout().isLocked(username) {
+			return nil, false
+		}
+	}
+	for _, backend := range backends {
+		if p, ok := backend.Authenticate(username, password); ok {
+			backend.Lockout().clear(username)
+			return p, true
+		}
+	}
+
+	// Only a login no backend accepts is a failure, so that a web UI user
+	// sharing a local account's name does not lock it by logging in.
+	// Unknown names are not tracked so that guessing usernames cannot grow
+	// the failure tables without bound.
+	for _, backend := range backends {
+		if _, ok := backend.Lookup(username); ok {
+			backend.Lockout().recordFailure(username)
+		}
+	}
+	return nil, false
+}
+
+func findAuthBackend(name string) AuthBackend {
+	for _, backend := range authBackends() {
+		if backend.Name() == name {
+			return backend
+		}
+	}
+	return nil
+}
+
+func (s *AccountStore) Name() string {
+	return "local"
+}
+
+func (s *AccountStore) Lookup(username string) (*Principal, bool) {
+	account, ok := s.FindByUsername(username)
+	if !ok || !account.Enabled {
+		return nil, false
+	}
+	return &Principal{Username: account.Username, RoleID: account.RoleID, Backend: s.Name()}, true
+}
+
+// nanoKVMBackend accepts the single account of the NanoKVM web UI, read
+// from the file the web application keeps it in. The file is re-read on
+// every attempt so password changes made in the web UI apply immediately.
+type nanoKVMBackend struct {
+	cfg NanoKVMAuthConfig
+}
+
+// nanoKVMLockout counts failed logins to the web UI account under the same
+// account_policy as local accounts.
+var nanoKVMLockout = &loginLockout{}
+
+type nanoKVMAccount struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (b nanoKVMBackend) Name() string {
+	return "nanokvm"
+}
+
+func (b nanoKVMBackend) account() (nanoKVMAccount, bool) {
+	var account nanoKVMAccount
+	content, err := os.ReadFile(b.cfg.AccountFile)
+	if err != nil {
+		return account, false
+	}
+	if err := json.Unmarshal(content, &account); err != nil || account.Username == "" || account.Password == "" {
+		return account, false
+	}
+	return account, true
+}
+
+func (b nanoKVMBackend) Authenticate(username, password string) (*Principal, bool) {
+	if nanoKVMLockout.isLocked(username) {
+		return nil, false
+	}
+
+	account, ok := b.account()
+	if !ok || account.Username != username {
+		return nil, false
+	}
+
+	// Current web UI releases store a bcrypt hash; older ones stored the
+	// password itself.
+	var match bool
+	if strings.HasPrefix(account.Password, "$2") {
+		match = bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)) == nil
+	} else {
+		match = subtle.ConstantTimeCompare([]byte(account.Password), []byte(password)) == 1
+	}
+	if !match {
+		return nil, false
+	}
+	return &Principal{Username: account.Username, RoleID: b.cfg.Role, Backend: b.Name()}, true
+}
+
+func (b nanoKVMBackend) Lookup(username string) (*Principal, bool) {
+	account, ok := b.account()
+	if !ok || account.Username != username {
+		return nil, false
+	}
+	return &Principal{Username: account.Username, RoleID: b.cfg.Role, Backend: b.Name()}, true
+}
+
+func (b nanoKVMBackend) Lockout() *loginLockout {
+	return nanoKVMLockout
+}
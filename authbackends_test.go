@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeNanoKVMAccount(t *testing.T, path, username, password string) {
+	t.Helper()
+	content := `{"username": "` + username + `", "password": "` + password + `"}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNanoKVMBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwd")
+	backend := nanoKVMBackend{cfg: NanoKVMAuthConfig{AccountFile: path, Role: "Operator"}}
+
+	if _, ok := backend.Authenticate("admin", "admin"); ok {
+		t.Error("Expected missing account file to reject everyone")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("web-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeNanoKVMAccount(t, path, "admin", string(hash))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		expectOK bool
+	}{
+		{"Correct password", "admin", "web-password", true},
+		{"Wrong password", "admin", "admin", false},
+		{"Wrong username", "root", "web-password", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := backend.Authenticate(tt.username, tt.password)
+			if ok != tt.expectOK {
+				t.Fatalf("Expected %v, got %v", tt.expectOK, ok)
+			}
+			if ok && (p.RoleID != "Operator" || p.Backend != "nanokvm") {
+				t.Errorf("Unexpected principal %+v", p)
+			}
+		})
+	}
+
+	t.Run("Plain text password", func(t *testing.T) {
+		writeNanoKVMAccount(t, path, "admin", "legacy")
+		if _, ok := backend.Authenticate("admin", "legacy"); !ok {
+			t.Error("Expected plain text password to be accepted")
+		}
+	})
+}
+
+func TestAuthBackendChain(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("ironic", "ironic-password", "Operator", true); err != nil {
+		t.Fatal(err)
+	}
+	setupSessionStore(t)
+
+	path := filepath.Join(t.TempDir(), "pwd")
+	writeNanoKVMAccount(t, path, "admin", "web-password")
+
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	currentConfig.AuthBackends = []string{"local", "nanokvm"}
+	currentConfig.NanoKVMAuth = NanoKVMAuthConfig{AccountFile: path, Role: "Administrator"}
+	defer func() { currentConfig = oldConfig }()
+
+	handler := newHandler()
+	get := func(setAuth func(*http.Request)) int {
+		req, err := http.NewRequest("GET", "/redfish/v1/Systems", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setAuth(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := get(func(r *http.Request) { r.SetBasicAuth("ironic", "ironic-password") }); code != http.StatusOK {
+		t.Errorf("Local account: expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := get(func(r *http.Request) { r.SetBasicAuth("admin", "web-password") }); code != http.StatusOK {
+		t.Errorf("Web UI account: expected status %d, got %d", http.StatusOK, code)
+	}
+
+	p, ok := authenticatePassword("admin", "web-password")
+	if !ok {
+		t.Fatal("Expected web UI account to authenticate")
+	}
+	session, err := sessionStore.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withToken := func(r *http.Request) { r.Header.Set("X-Auth-Token", session.Token) }
+	if code := get(withToken); code != http.StatusOK {
+		t.Errorf("Web UI session: expected status %d, got %d", http.StatusOK, code)
+	}
+
+	// Renaming the web UI account ends sessions opened under the old name.
+	writeNanoKVMAccount(t, path, "operator", "web-password")
+	if code := get(withToken); code != http.StatusUnauthorized {
+		t.Errorf("Stale session: expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+// TestNanoKVMPrincipalCannotChangeLocalAccount checks that a web UI user
+// cannot take over the local account that shares its name.
+func TestNanoKVMPrincipalCannotChangeLocalAccount(t *testing.T) {
+	store := setupAccountStore(t)
+	admin, err := store.Create("admin", "local-password", "Administrator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pwd")
+	writeNanoKVMAccount(t, path, "admin", "web-password")
+
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	currentConfig.AuthBackends = []string{"local", "nanokvm"}
+	currentConfig.NanoKVMAuth = NanoKVMAuthConfig{AccountFile: path, Role: "ReadOnly"}
+	defer func() { currentConfig = oldConfig }()
+
+	req := httptest.NewRequest("PATCH", accountServicePath+"/Accounts/"+admin.ID,
+		bytes.NewBufferString(`{"Password": "Taken-over-1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("admin", "web-password")
+	rr := httptest.NewRecorder()
+	newHandler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+	if _, ok := store.Authenticate("admin", "local-password"); !ok {
+		t.Error("Expected the local password unchanged")
+	}
+}
+
+// TestAuthBackendLockout checks that the lockout policy covers the web UI
+// account too, and that a username locked out of one backend cannot carry
+// on guessing in another.
+func TestAuthBackendLockout(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("admin", "local-password", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pwd")
+	writeNanoKVMAccount(t, path, "admin", "web-password")
+
+	oldConfig := currentConfig
+	oldLockout := nanoKVMLockout
+	currentConfig.AuthBackends = []string{"local", "nanokvm"}
+	currentConfig.NanoKVMAuth = NanoKVMAuthConfig{AccountFile: path, Role: "ReadOnly"}
+	currentConfig.AccountPolicy.LockoutThreshold = 3
+	currentConfig.AccountPolicy.LockoutDuration = 60
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+	defer func() {
+		currentConfig = oldConfig
+		nanoKVMLockout = oldLockout
+		timeNow = time.Now
+	}()
+
+	t.Run("Web UI logins do not lock the local account", func(t *testing.T) {
+		nanoKVMLockout = &loginLockout{}
+		for i := 0; i < 3; i++ {
+			if _, ok := authenticatePassword("admin", "web-password"); !ok {
+				t.Fatalf("Login %d: expected the web UI password to be accepted", i+1)
+			}
+		}
+		if store.IsLocked("admin") {
+			t.Error("Expected the local account not to be locked")
+		}
+	})
+
+	t.Run("Web UI account", func(t *testing.T) {
+		nanoKVMLockout = &loginLockout{}
+		currentConfig.AuthBackends = []string{"nanokvm"}
+		defer func() { currentConfig.AuthBackends = []string{"local", "nanokvm"} }()
+
+		for i := 0; i < 3; i++ {
+			authenticatePassword("admin", "wrong")
+		}
+		if _, ok := authenticatePassword("admin", "web-password"); ok {
+			t.Error("Expected the locked web UI account to reject the correct password")
+		}
+		clock = clock.Add(61 * time.Second)
+		if _, ok := authenticatePassword("admin", "web-password"); !ok {
+			t.Error("Expected login to succeed after lockout expired")
+		}
+	})
+
+	t.Run("Locked local account", func(t *testing.T) {
+		nanoKVMLockout = &loginLockout{}
+		for i := 0; i < 3; i++ {
+			store.Lockout().recordFailure("admin")
+		}
+		if _, ok := authenticatePassword("admin", "web-password"); ok {
+			t.Error("Expected the web UI password refused while the local account is locked")
+		}
+		store.Unlock("admin")
+		if _, ok := authenticatePassword("admin", "web-password"); !ok {
+			t.Error("Expected the web UI password accepted once unlocked")
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const auxGPIOsPath = "/redfish/v1/Managers/BMC/Oem/NanoKVM/GPIOs"
+
+// auxPulse is how long an auxiliary output is pulsed when the request does
+// not say.
+const auxPulse = 200 * time.Millisecond
+
+// heldLines holds the character device lines of the auxiliary outputs that
+// have been set, by GPIO name. A released line may float or revert, so an
+// output stays requested once it has been driven. Guarded by gpioReadMu,
+// like watchedLines.
+var heldLines = map[string]*gpioLineHandle{}
+
+// auxGPIOMu serialises writes to the auxiliary outputs, so a pulse is not
+// cut short by another write. It is separate from gpioMu so that a long
+// pulse does not hold up the power buttons.
+var auxGPIOMu sync.Mutex
+
+// setGPIO drives an output GPIO to value and leaves it there.
+func setGPIO(path string, value int) error {
+	if !auxGPIOMu.TryLock() {
+		return &HardwareError{Kind: errBusy, Op: "write GPIO"}
+	}
+	defer auxGPIOMu.Unlock()
+	return driveGPIO(path, value)
+}
+
+// pulseGPIO drives an output GPIO to 1 for duration, then to 0.
+func pulseGPIO(path string, duration time.Duration) error {
+	if !auxGPIOMu.TryLock() {
+		return &HardwareError{Kind: errBusy, Op: "write GPIO"}
+	}
+	defer auxGPIOMu.Unlock()
+
+	if err := driveGPIO(path, 1); err != nil {
+		return err
+	}
+	time.Sleep(duration)
+	return driveGPIO(path, 0)
+}
+
+func driveGPIO(path string, value int) error {
+	gpioReadMu.Lock()
+	defer gpioReadMu.Unlock()
+
+	if line, ok := heldLines[path]; ok {
+		if err := line.set(value); err != nil {
+			return &HardwareError{Kind: errIOFailure, Op: "write GPIO", Err: err}
+		}
+		return nil
+	}
+	switch line := resolveGPIO(path).(type) {
+	case cdevLine:
+		handle, err := requestGPIOLine(line.chip, line.offset, gpioLineOutput, value)
+		if err != nil {
+			if line.fallback(err) {
+				return sysfsLine(line.sysfs).set(value)
+			}
+			return &HardwareError{Kind: errIOFailure, Op: "write GPIO", Err: err}
+		}
+		heldLines[path] = handle
+		return nil
+	case sysfsLine:
+		return line.set(value)
+	}
+	return nil
+}
+
+// readAuxGPIO returns the value of an auxiliary GPIO, or nil if it cannot
+// be read without disturbing it: requesting an output's character device
+// line to read it would turn it into an input, so an output not yet set
+// through the API is only read where sysfs has it exported.
+func readAuxGPIO(g AuxGPIOConfig) (*int, error) {
+	path := g.GPIO
+	if g.Direction == "output" {
+		gpioReadMu.Lock()
+		_, held := heldLines[path]
+		gpioReadMu.Unlock()
+		if line, ok := resolveGPIO(path).(cdevLine); ok && !held {
+			if line.sysfs == "" {
+				return nil, nil
+			}
+			if _, err := os.Stat(line.sysfs); err != nil {
+				return nil, nil
+			}
+			path = line.sysfs
+		}
+	}
+	value, err := readGPIO(path)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func findAuxGPIO(name string) (AuxGPIOConfig, bool) {
+	for _, g := range currentConfig.AuxGPIOs {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return AuxGPIOConfig{}, false
+}
+
+func handleAuxGPIOs(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, auxGPIOsPath), "/")
+	if rest == "" {
+		handleAuxGPIOCollection(w, r)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	g, ok := findAuxGPIO(parts[0])
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		handleAuxGPIO(w, r, g)
+	case len(parts) == 3 && parts[1] == "Actions" && parts[2] == "NanoKVM.SetValue":
+		handleAuxGPIOSetValue(w, r, g)
+	case len(parts) == 3 && parts[1] == "Actions" && parts[2] == "NanoKVM.Pulse":
+		handleAuxGPIOPulse(w, r, g)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleAuxGPIOCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	for _, g := range currentConfig.AuxGPIOs {
+		members = append(members, map[string]string{"@odata.id": auxGPIOsPath + "/" + g.Name})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#NanoKVMGPIOCollection.NanoKVMGPIOCollection",
+		ODataID:   auxGPIOsPath,
+		Name:      "Auxiliary GPIO Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleAuxGPIO(w http.ResponseWriter, r *http.Request, g AuxGPIOConfig) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	odataID := auxGPIOsPath + "/" + g.Name
+	value, err := readAuxGPIO(g)
+	status := map[string]string{"State": "Enabled", "Health": "OK"}
+	if err != nil {
+		log.Printf("Failed to read GPIO %s: %v", g.Name, err)
+		status["Health"] = "Warning"
+	}
+
+	direction := "Input"
+	actions := map[string]interface{}{}
+	if g.Direction == "output" {
+		direction = "Output"
+		actions["#NanoKVM.SetValue"] = map[string]string{"target": odataID + "/Actions/NanoKVM.SetValue"}
+		actions["#NanoKVM.Pulse"] = map[string]string{"target": odataID + "/Actions/NanoKVM.Pulse"}
+	}
+
+	gpio := map[string]interface{}{
+		"@odata.type": "#NanoKVMGPIO.v1_0_0.NanoKVMGPIO",
+		"@odata.id":   odataID,
+		"Id":          g.Name,
+		"Name":        g.Name,
+		"Description": g.Description,
+		"Direction":   direction,
+		"Value":       value,
+		"Status":      status,
+		"Actions":     actions,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gpio)
+}
+
+// readAuxGPIOAction decodes the body of an action on an output into req,
+// writing the error response and returning false if it cannot be.
+func readAuxGPIOAction(w http.ResponseWriter, r *http.Request, g AuxGPIOConfig, action string, req interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return false
+	}
+	if g.Direction != "output" {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("ActionNotSupported", action))
+		return false
+	}
+
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return false
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, req); err != nil {
+			writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+			return false
+		}
+	}
+	return checkActionParameters(w, body, action, req)
+}
+
+func handleAuxGPIOSetValue(w http.ResponseWriter, r *http.Request, g AuxGPIOConfig) {
+	var req struct {
+		Value *int `json:"Value"`
+	}
+	if !readAuxGPIOAction(w, r, g, "NanoKVM.SetValue", &req) {
+		return
+	}
+	if req.Value == nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterMissing", "NanoKVM.SetValue", "Value").withProperty("#/Value"))
+		return
+	}
+	if *req.Value != 0 && *req.Value != 1 {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", fmt.Sprint(*req.Value), "Value", "NanoKVM.SetValue").
+				withProperty("#/Value"))
+		return
+	}
+
+	if err := setGPIO(g.GPIO, *req.Value); err != nil {
+		writeHardwareError(w, err, "NanoKVM.SetValue")
+		return
+	}
+	message := fmt.Sprintf("GPIO %s set to %d", g.Name, *req.Value)
+	log.Print(message)
+	emitEvent("OK", message, resourceEventPrefix+"ResourceChanged", auxGPIOsPath+"/"+g.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAuxGPIOPulse(w http.ResponseWriter, r *http.Request, g AuxGPIOConfig) {
+	var req struct {
+		DurationMs *int `json:"DurationMs"`
+	}
+	if !readAuxGPIOAction(w, r, g, "NanoKVM.Pulse", &req) {
+		return
+	}
+	duration := auxPulse
+	if req.DurationMs != nil {
+		if *req.DurationMs <= 0 || *req.DurationMs > maxPressMs {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("ActionParameterValueFormatError", fmt.Sprint(*req.DurationMs), "DurationMs", "NanoKVM.Pulse").
+					withProperty("#/DurationMs"))
+			return
+		}
+		duration = time.Duration(*req.DurationMs) * time.Millisecond
+	}
+
+	if err := pulseGPIO(g.GPIO, duration); err != nil {
+		writeHardwareError(w, err, "NanoKVM.Pulse")
+		return
+	}
+	message := fmt.Sprintf("GPIO %s pulsed for %d ms", g.Name, duration/time.Millisecond)
+	log.Print(message)
+	emitEvent("OK", message, resourceEventPrefix+"ResourceChanged", auxGPIOsPath+"/"+g.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuxGPIOs(t *testing.T) {
+	setupGPIOChips(t, nil, nil)
+	dir := t.TempDir()
+	relay, button := filepath.Join(dir, "relay"), filepath.Join(dir, "button")
+	os.WriteFile(relay, []byte("0\n"), 0644)
+	os.WriteFile(button, []byte("1\n"), 0644)
+
+	oldConfig := currentConfig
+	defer func() { currentConfig = oldConfig }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	currentConfig.AuxGPIOs = []AuxGPIOConfig{
+		{Name: "relay", GPIO: relay, Direction: "output", Description: "KVM switch"},
+		{Name: "button", GPIO: button, Direction: "input"},
+	}
+
+	handler := newHandler()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(name string) map[string]interface{} {
+		t.Helper()
+		rr := do("GET", auxGPIOsPath+"/"+name, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d: %s", name, rr.Code, rr.Body.String())
+		}
+		var gpio map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &gpio)
+		return gpio
+	}
+
+	var collection SystemCollection
+	json.Unmarshal(do("GET", auxGPIOsPath, "").Body.Bytes(), &collection)
+	if len(collection.Members) != 2 {
+		t.Errorf("Expected both GPIOs listed, got %v", collection.Members)
+	}
+	if gpio := get("button"); gpio["Direction"] != "Input" || gpio["Value"] != 1.0 || len(gpio["Actions"].(map[string]interface{})) != 0 {
+		t.Errorf("Expected an input reading 1 without actions, got %v", gpio)
+	}
+	if gpio := get("relay"); gpio["Direction"] != "Output" || gpio["Value"] != 0.0 {
+		t.Errorf("Expected an output reading 0, got %v", gpio)
+	}
+
+	setValue := auxGPIOsPath + "/relay/Actions/NanoKVM.SetValue"
+	pulse := auxGPIOsPath + "/relay/Actions/NanoKVM.Pulse"
+	for _, tt := range []struct {
+		name       string
+		path       string
+		body       string
+		expectCode int
+		expectFile string
+	}{
+		{"Set", setValue, `{"Value": 1}`, http.StatusNoContent, "1"},
+		{"Set without value", setValue, `{}`, http.StatusBadRequest, "1"},
+		{"Set out of range", setValue, `{"Value": 2}`, http.StatusBadRequest, "1"},
+		{"Pulse", pulse, `{"DurationMs": 10}`, http.StatusNoContent, "0"},
+		{"Pulse too long", pulse, `{"DurationMs": 60000}`, http.StatusBadRequest, "0"},
+		{"Input", auxGPIOsPath + "/button/Actions/NanoKVM.SetValue", `{"Value": 0}`, http.StatusBadRequest, "0"},
+		{"Unknown GPIO", auxGPIOsPath + "/lamp/Actions/NanoKVM.SetValue", `{"Value": 1}`, http.StatusNotFound, "0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do("POST", tt.path, tt.body); rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			if content, _ := os.ReadFile(relay); strings.TrimSpace(string(content)) != tt.expectFile {
+				t.Errorf("Expected the relay at %s, got %q", tt.expectFile, content)
+			}
+		})
+	}
+
+	// The action reads its own body too, so it is bounded without the
+	// middleware in front.
+	req := httptest.NewRequest("POST", setValue, strings.NewReader(strings.Repeat(" ", maxRequestBody+1)))
+	rr := httptest.NewRecorder()
+	var action struct{}
+	if readAuxGPIOAction(rr, req, AuxGPIOConfig{Direction: "output"}, "NanoKVM.SetValue", &action) || rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for a large body, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// bootStateFile is where saveBootState writes System.1's settings; see
+// Config.BootStateFile.
+var bootStateFile string
+
+// savedBoot is the part of Boot written to bootStateFile.
+type savedBoot struct {
+	BootSourceOverrideEnabled    string   `json:"BootSourceOverrideEnabled"`
+	BootSourceOverrideMode       string   `json:"BootSourceOverrideMode"`
+	BootSourceOverrideTarget     string   `json:"BootSourceOverrideTarget"`
+	UefiTargetBootSourceOverride string   `json:"UefiTargetBootSourceOverride,omitempty"`
+	BootNext                     *string  `json:"BootNext,omitempty"`
+	BootOrder                    []string `json:"BootOrder,omitempty"`
+	// Pending is what the system's Settings object has staged for the
+	// next reset.
+	Pending *savedBoot `json:"Pending,omitempty"`
+}
+
+func newSavedBoot(b *Boot) savedBoot {
+	return savedBoot{
+		BootSourceOverrideEnabled:    b.BootSourceOverrideEnabled,
+		BootSourceOverrideMode:       b.BootSourceOverrideMode,
+		BootSourceOverrideTarget:     b.BootSourceOverrideTarget,
+		UefiTargetBootSourceOverride: b.UefiTargetBootSourceOverride,
+		BootNext:                     b.BootNext,
+		BootOrder:                    b.BootOrder,
+	}
+}
+
+// restore copies the saved settings into b, if they are valid for it.
+func (saved savedBoot) restore(b *Boot) bool {
+	if !containsString(bootOverrideEnabledValues, saved.BootSourceOverrideEnabled) ||
+		!containsString(bootOverrideModeValues, saved.BootSourceOverrideMode) ||
+		!containsString(b.BootSourceOverrideTargetAllowableValues, saved.BootSourceOverrideTarget) {
+		return false
+	}
+	b.BootSourceOverrideEnabled = saved.BootSourceOverrideEnabled
+	b.BootSourceOverrideMode = saved.BootSourceOverrideMode
+	b.BootSourceOverrideTarget = saved.BootSourceOverrideTarget
+	b.UefiTargetBootSourceOverride = saved.UefiTargetBootSourceOverride
+	b.BootNext = saved.BootNext
+	b.BootOrder = saved.BootOrder
+	return true
+}
+
+// loadBootState restores the settings saved in path, if any, and makes
+// later changes save there.
+func (s *hostSystem) loadBootState(path string) error {
+	*s.bootStateFile = path
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var saved savedBoot
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if !saved.restore(s.boot) {
+		return fmt.Errorf("%s: invalid boot override %s/%s/%s", path,
+			saved.BootSourceOverrideEnabled, saved.BootSourceOverrideMode, saved.BootSourceOverrideTarget)
+	}
+	if p := saved.Pending; p != nil {
+		pending := *s.boot
+		if !p.restore(&pending) {
+			return fmt.Errorf("%s: invalid pending boot override %s/%s/%s", path,
+				p.BootSourceOverrideEnabled, p.BootSourceOverrideMode, p.BootSourceOverrideTarget)
+		}
+		s.settings.pending = &pending
+	}
+	return nil
+}
+
+// saveBootState writes the system's Boot settings to its state file.
+func (s *hostSystem) saveBootState() error {
+	if *s.bootStateFile == "" {
+		return nil
+	}
+	saved := newSavedBoot(s.boot)
+	if s.settings.pending != nil {
+		pending := newSavedBoot(s.settings.pending)
+		saved.Pending = &pending
+	}
+	content, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(*s.bootStateFile, content, 0o600)
+}
+
+// applyBootPatch validates the Boot object of a ComputerSystem PATCH and
+// applies it to the system's settings. Nothing changes unless every property
+// is acceptable; on error the response has been written and it returns
+// false.
+func (s *hostSystem) applyBootPatch(w http.ResponseWriter, patch *Boot) bool {
+	next, ok := mergeBootPatch(w, *s.boot, patch)
+	if !ok {
+		return false
+	}
+	if err := s.setBoot(next); err != nil {
+		writeInternalError(w, "save boot settings", err)
+		return false
+	}
+	return true
+}
+
+// mergeBootPatch returns next with the Boot object of a PATCH applied, or
+// writes the error and returns false if any property is unacceptable.
+func mergeBootPatch(w http.ResponseWriter, next Boot, patch *Boot) (Boot, bool) {
+	if patch.BootSourceOverrideEnabled != "" {
+		if !containsString(bootOverrideEnabledValues, patch.BootSourceOverrideEnabled) {
+			writeBootValueNotInList(w, "BootSourceOverrideEnabled", patch.BootSourceOverrideEnabled)
+			return Boot{}, false
+		}
+		next.BootSourceOverrideEnabled = patch.BootSourceOverrideEnabled
+	}
+	if patch.BootSourceOverrideTarget != "" {
+		if !containsString(next.BootSourceOverrideTargetAllowableValues, patch.BootSourceOverrideTarget) {
+			writeBootValueNotInList(w, "BootSourceOverrideTarget", patch.BootSourceOverrideTarget)
+			return Boot{}, false
+		}
+		if patch.BootSourceOverrideTarget != next.BootSourceOverrideTarget {
+			// A device path only means something for the UefiTarget it
+			// was given with.
+			next.UefiTargetBootSourceOverride = ""
+		}
+		next.BootSourceOverrideTarget = patch.BootSourceOverrideTarget
+	}
+	if patch.BootSourceOverrideMode != "" {
+		if !containsString(bootOverrideModeValues, patch.BootSourceOverrideMode) {
+			writeBootValueNotInList(w, "BootSourceOverrideMode", patch.BootSourceOverrideMode)
+			return Boot{}, false
+		}
+		next.BootSourceOverrideMode = patch.BootSourceOverrideMode
+	}
+	if patch.UefiTargetBootSourceOverride != "" {
+		if next.BootSourceOverrideTarget != "UefiTarget" {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueConflict", "UefiTargetBootSourceOverride", "BootSourceOverrideTarget").
+					withProperty("#/Boot/UefiTargetBootSourceOverride"))
+			return Boot{}, false
+		}
+		next.UefiTargetBootSourceOverride = patch.UefiTargetBootSourceOverride
+	}
+
+	if patch.BootNext != nil {
+		next.BootNext = patch.BootNext
+		if *patch.BootNext == "" {
+			next.BootNext = nil
+		}
+	}
+	if patch.BootOrder != nil {
+		next.BootOrder = append([]string{}, patch.BootOrder...)
+	}
+
+	return next, true
+}
+
+// setBoot makes next the system's Boot settings and saves them.
+func (s *hostSystem) setBoot(next Boot) error {
+	previous := *s.boot
+	*s.boot = next
+	if err := s.saveBootState(); err != nil {
+		*s.boot = previous
+		return err
+	}
+	emitEvent("OK", fmt.Sprintf("Boot override set to %s (%s)",
+		s.boot.BootSourceOverrideTarget, s.boot.BootSourceOverrideEnabled),
+		resourceEventPrefix+"ResourceChanged", s.path())
+	return nil
+}
+
+func writeBootValueNotInList(w http.ResponseWriter, property, value string) {
+	writeRedfishError(w, http.StatusBadRequest,
+		newMessage("PropertyValueNotInList", value, property).withProperty("#/Boot/"+property))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// patchSystem sends a ComputerSystem PATCH and returns the response.
+func patchSystem(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("PATCH", "/redfish/v1/Systems/System.1", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleSystemPatch(rr, req, primarySystem)
+	return rr
+}
+
+func TestPatchUefiTargetBootSourceOverride(t *testing.T) {
+	oldBoot := currentBootConfig
+	defer func() { currentBootConfig = oldBoot }()
+
+	const path = "PciRoot(0x0)/Pci(0x1D,0x0)/USB(0x0,0x0)"
+	tests := []struct {
+		name         string
+		start        string
+		body         string
+		expectCode   int
+		expectError  string
+		expectTarget string
+		expectPath   string
+	}{
+		{
+			name:         "With UefiTarget",
+			start:        "None",
+			body:         `{"Boot": {"BootSourceOverrideTarget": "UefiTarget", "UefiTargetBootSourceOverride": "` + path + `"}}`,
+			expectCode:   http.StatusNoContent,
+			expectTarget: "UefiTarget",
+			expectPath:   path,
+		},
+		{
+			name:         "Target already UefiTarget",
+			start:        "UefiTarget",
+			body:         `{"Boot": {"UefiTargetBootSourceOverride": "` + path + `"}}`,
+			expectCode:   http.StatusNoContent,
+			expectTarget: "UefiTarget",
+			expectPath:   path,
+		},
+		{
+			name:         "Other target",
+			start:        "None",
+			body:         `{"Boot": {"BootSourceOverrideTarget": "Pxe", "UefiTargetBootSourceOverride": "` + path + `"}}`,
+			expectCode:   http.StatusBadRequest,
+			expectError:  "Base.1.8.PropertyValueConflict",
+			expectTarget: "None",
+		},
+		{
+			name:         "Current target is not UefiTarget",
+			start:        "Cd",
+			body:         `{"Boot": {"UefiTargetBootSourceOverride": "` + path + `"}}`,
+			expectCode:   http.StatusBadRequest,
+			expectError:  "Base.1.8.PropertyValueConflict",
+			expectTarget: "Cd",
+		},
+		{
+			name:         "Changing target clears the path",
+			start:        "UefiTarget",
+			body:         `{"Boot": {"BootSourceOverrideTarget": "Hdd"}}`,
+			expectCode:   http.StatusNoContent,
+			expectTarget: "Hdd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentBootConfig = oldBoot
+			currentBootConfig.BootSourceOverrideTarget = tt.start
+			if tt.start == "UefiTarget" {
+				currentBootConfig.UefiTargetBootSourceOverride = "PciRoot(0x0)"
+			}
+
+			rr := patchSystem(t, tt.body)
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectError != "" {
+				var body map[string]redfishErrorBody
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body["error"].Code != tt.expectError {
+					t.Errorf("Expected %s, got %s", tt.expectError, body["error"].Code)
+				}
+			}
+
+			if currentBootConfig.BootSourceOverrideTarget != tt.expectTarget {
+				t.Errorf("Expected target %s, got %s", tt.expectTarget, currentBootConfig.BootSourceOverrideTarget)
+			}
+			if currentBootConfig.UefiTargetBootSourceOverride != tt.expectPath {
+				t.Errorf("Expected path %q, got %q", tt.expectPath, currentBootConfig.UefiTargetBootSourceOverride)
+			}
+		})
+	}
+}
+
+func TestPatchBootNextAndOrder(t *testing.T) {
+	oldBoot := currentBootConfig
+	defer func() { currentBootConfig = oldBoot }()
+
+	rr := patchSystem(t, `{"Boot": {"BootSourceOverrideEnabled": "Once", "BootSourceOverrideTarget": "UefiBootNext",
+		"BootSourceOverrideMode": "UEFI", "BootNext": "0003", "BootOrder": ["0003", "0001", "0000"]}}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	content, err := json.Marshal(currentBootConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var boot map[string]interface{}
+	if err := json.Unmarshal(content, &boot); err != nil {
+		t.Fatal(err)
+	}
+	if boot["BootNext"] != "0003" {
+		t.Errorf("Expected BootNext 0003, got %v", boot["BootNext"])
+	}
+	if order, _ := boot["BootOrder"].([]interface{}); len(order) != 3 || order[0] != "0003" {
+		t.Errorf("Expected BootOrder to round-trip, got %v", boot["BootOrder"])
+	}
+
+	// Other fields leave BootNext and BootOrder alone; an empty BootNext
+	// clears it.
+	patchSystem(t, `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`)
+	if currentBootConfig.BootNext == nil || len(currentBootConfig.BootOrder) != 3 {
+		t.Error("Expected BootNext and BootOrder to be kept")
+	}
+	patchSystem(t, `{"Boot": {"BootNext": "", "BootOrder": []}}`)
+	if currentBootConfig.BootNext != nil || len(currentBootConfig.BootOrder) != 0 {
+		t.Errorf("Expected BootNext and BootOrder to be cleared, got %v %v",
+			currentBootConfig.BootNext, currentBootConfig.BootOrder)
+	}
+}
+
+func TestBootStatePersistence(t *testing.T) {
+	oldBoot, oldFile := currentBootConfig, bootStateFile
+	defer func() { currentBootConfig, bootStateFile = oldBoot, oldFile }()
+
+	path := filepath.Join(t.TempDir(), "boot.json")
+	if err := primarySystem.loadBootState(path); err != nil {
+		t.Fatalf("Expected a missing file to be fine, got %v", err)
+	}
+
+	rr := patchSystem(t, `{"Boot": {"BootSourceOverrideEnabled": "Continuous", "BootSourceOverrideTarget": "Cd",
+		"BootSourceOverrideMode": "Legacy", "BootNext": "0001", "BootOrder": ["0001", "0002"]}}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	saved := currentBootConfig
+
+	currentBootConfig = oldBoot
+	if err := primarySystem.loadBootState(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(currentBootConfig, saved) {
+		t.Errorf("Expected %+v after reload, got %+v", saved, currentBootConfig)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"BootSourceOverrideEnabled": "Sometimes", "BootSourceOverrideTarget": "Cd"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := primarySystem.loadBootState(path); err == nil {
+		t.Error("Expected an invalid saved override to be rejected")
+	}
+
+	// A failed save leaves the settings as they were.
+	bootStateFile = filepath.Join(path, "not-a-dir", "boot.json")
+	currentBootConfig = saved
+	if rr := patchSystem(t, `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`); rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if currentBootConfig.BootSourceOverrideTarget != "Cd" {
+		t.Errorf("Expected target Cd after a failed save, got %s", currentBootConfig.BootSourceOverrideTarget)
+	}
+}
+
+func TestPatchBootValidation(t *testing.T) {
+	oldBoot := currentBootConfig
+	defer func() { currentBootConfig = oldBoot }()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectProperty string
+	}{
+		{"Enabled", `{"Boot": {"BootSourceOverrideEnabled": "Always", "BootSourceOverrideTarget": "Pxe"}}`, "#/Boot/BootSourceOverrideEnabled"},
+		{"Enabled is case sensitive", `{"Boot": {"BootSourceOverrideEnabled": "once"}}`, "#/Boot/BootSourceOverrideEnabled"},
+		{"Mode", `{"Boot": {"BootSourceOverrideEnabled": "Once", "BootSourceOverrideMode": "BIOS"}}`, "#/Boot/BootSourceOverrideMode"},
+		{"Target", `{"Boot": {"BootSourceOverrideEnabled": "Once", "BootSourceOverrideTarget": "Floppy"}}`, "#/Boot/BootSourceOverrideTarget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentBootConfig = oldBoot
+			rr := patchSystem(t, tt.body)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+
+			var body map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			info := body["error"].ExtendedInfo
+			if len(info) != 1 || info[0].MessageID != "Base.1.8.PropertyValueNotInList" ||
+				len(info[0].RelatedProperties) != 1 || info[0].RelatedProperties[0] != tt.expectProperty {
+				t.Errorf("Expected PropertyValueNotInList for %s, got %+v", tt.expectProperty, info)
+			}
+			if !reflect.DeepEqual(currentBootConfig, oldBoot) {
+				t.Errorf("Expected no change, got %+v", currentBootConfig)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hidKeyCodes maps the key names used in boot profiles to USB HID keyboard
+// usage IDs.
+var hidKeyCodes = map[string]byte{
+	"Enter":     0x28,
+	"Escape":    0x29,
+	"Backspace": 0x2a,
+	"Tab":       0x2b,
+	"Space":     0x2c,
+	"F1":        0x3a,
+	"F2":        0x3b,
+	"F3":        0x3c,
+	"F4":        0x3d,
+	"F5":        0x3e,
+	"F6":        0x3f,
+	"F7":        0x40,
+	"F8":        0x41,
+	"F9":        0x42,
+	"F10":       0x43,
+	"F11":       0x44,
+	"F12":       0x45,
+	"Insert":    0x49,
+	"Home":      0x4a,
+	"PageUp":    0x4b,
+	"Delete":    0x4c,
+	"End":       0x4d,
+	"PageDown":  0x4e,
+	"Right":     0x4f,
+	"Left":      0x50,
+	"Down":      0x51,
+	"Up":        0x52,
+}
+
+func init() {
+	for c := byte('a'); c <= 'z'; c++ {
+		hidKeyCodes[string(c)] = 0x04 + c - 'a'
+	}
+	for c := byte('1'); c <= '9'; c++ {
+		hidKeyCodes[string(c)] = 0x1e + c - '1'
+	}
+	hidKeyCodes["0"] = 0x27
+}
+
+// keyPressMs is how long a key is held, and menuStepDelayMs the pause after
+// a menu key when its step sets no delay of its own.
+const (
+	keyPressMs      = 50
+	menuStepDelayMs = 200
+)
+
+// powerOnWait bounds how long injection waits for the power LED before
+// starting the tap window anyway.
+var powerOnWait = 10 * time.Second
+
+// tapKey types one key on the HID keyboard: a boot protocol report with
+// the key down, then an empty report to release it.
+func tapKey(w io.Writer, key string) error {
+	code, ok := hidKeyCodes[key]
+	if !ok {
+		return fmt.Errorf("unknown key %q", key)
+	}
+	if _, err := w.Write([]byte{0, 0, code, 0, 0, 0, 0, 0}); err != nil {
+		return &HardwareError{Kind: errIOFailure, Op: "write HID report", Err: err}
+	}
+	time.Sleep(keyPressMs * time.Millisecond)
+	if _, err := w.Write(make([]byte, 8)); err != nil {
+		return &HardwareError{Kind: errIOFailure, Op: "write HID report", Err: err}
+	}
+	return nil
+}
+
+// describeKeySequence renders a key sequence for dry-run reports and logs.
+func describeKeySequence(profile BootKeyProfile, key string, steps []KeyStep) string {
+	desc := fmt.Sprintf("Tap %s every %d ms for %d ms", key, profile.TapIntervalMs, profile.TapDurationMs)
+	if len(steps) == 0 {
+		return desc
+	}
+	var typed []string
+	for _, step := range steps {
+		if step.Repeat > 1 {
+			typed = append(typed, fmt.Sprintf("%s x%d", step.Key, step.Repeat))
+		} else {
+			typed = append(typed, step.Key)
+		}
+	}
+	return desc + ", then type " + strings.Join(typed, ", ")
+}
+
+// bootKeysStop and bootKeysDone track the sequence currently being typed.
+// A new power-on cancels it, so only one sequence drives the keyboard.
+var (
+	bootKeysMu   sync.Mutex
+	bootKeysStop chan struct{}
+	bootKeysDone chan struct{}
+)
+
+// startBootKeys types the profile's sequence for target in the background
+// once the host powers on. Only a host on the NanoKVM's USB port has a
+// keyboard to type on.
+func (s *hostSystem) startBootKeys(profile BootKeyProfile, target string) error {
+	key, steps, err := profile.KeySequence(target)
+	if err != nil {
+		return err
+	}
+	if s.hw().HIDKeyboard == "" {
+		return &HardwareError{Kind: errNotSupported, Op: "type boot keys"}
+	}
+
+	bootKeysMu.Lock()
+	defer bootKeysMu.Unlock()
+	if bootKeysStop != nil {
+		close(bootKeysStop)
+		<-bootKeysDone
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	bootKeysStop, bootKeysDone = stop, done
+
+	log.Printf("Boot override %s: %s", target, describeKeySequence(profile, key, steps))
+	go func() {
+		defer close(done)
+		if err := s.typeBootKeys(profile, key, steps, stop); err != nil {
+			log.Printf("Boot override %s failed: %v", target, err)
+			emitEvent("Warning", fmt.Sprintf("Boot override to %s failed: %v", target, err),
+				resourceEventPrefix+"ResourceErrorsDetected", s.path(),
+				"Boot/BootSourceOverrideTarget", err.Error())
+		}
+	}()
+	return nil
+}
+
+// stopBootKeys cancels any sequence in progress and waits for it to end.
+func stopBootKeys() {
+	bootKeysMu.Lock()
+	defer bootKeysMu.Unlock()
+	if bootKeysStop != nil {
+		close(bootKeysStop)
+		<-bootKeysDone
+		bootKeysStop, bootKeysDone = nil, nil
+	}
+}
+
+// sleepOrStop waits for d and reports false if stop closed first.
+func sleepOrStop(d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// typeBootKeys waits for the host to power on, taps key for the profile's
+// tap window so one press lands while the firmware polls the keyboard,
+// then types steps to pick the entry in the boot menu.
+func (s *hostSystem) typeBootKeys(profile BootKeyProfile, key string, steps []KeyStep, stop <-chan struct{}) error {
+	f, err := os.OpenFile(s.hw().HIDKeyboard, os.O_WRONLY, 0)
+	if err != nil {
+		return &HardwareError{Kind: errIOFailure, Op: "open HID keyboard", Err: err}
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(powerOnWait)
+	for {
+		if state, _ := s.getPowerState(); state == "On" || time.Now().After(deadline) {
+			break
+		}
+		if !sleepOrStop(100*time.Millisecond, stop) {
+			return nil
+		}
+	}
+
+	interval := time.Duration(profile.TapIntervalMs) * time.Millisecond
+	end := time.Now().Add(time.Duration(profile.TapDurationMs) * time.Millisecond)
+	for time.Now().Before(end) {
+		if err := tapKey(f, key); err != nil {
+			return err
+		}
+		if !sleepOrStop(interval, stop) {
+			return nil
+		}
+	}
+
+	for _, step := range steps {
+		delay := time.Duration(step.DelayMs) * time.Millisecond
+		if step.DelayMs == 0 {
+			delay = menuStepDelayMs * time.Millisecond
+		}
+		for i := 0; i < step.Repeat || i == 0; i++ {
+			if err := tapKey(f, step.Key); err != nil {
+				return err
+			}
+			if !sleepOrStop(delay, stop) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
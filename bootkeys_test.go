@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTapKey(t *testing.T) {
+	var buf bytes.Buffer
+	if err := tapKey(&buf, "F12"); err != nil {
+		t.Fatal(err)
+	}
+	expect := []byte{0, 0, 0x45, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("Expected press and release reports, got %v", buf.Bytes())
+	}
+	if err := tapKey(&buf, "Hyper"); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+}
+
+func TestBootProfileKeysKnown(t *testing.T) {
+	for name, profile := range bootKeyProfiles {
+		keys := []string{profile.SetupKey, profile.BootMenuKey}
+		for _, steps := range profile.MenuSteps {
+			for _, step := range steps {
+				keys = append(keys, step.Key)
+			}
+		}
+		for _, key := range keys {
+			if _, ok := hidKeyCodes[key]; !ok {
+				t.Errorf("Profile %s uses unknown key %q", name, key)
+			}
+		}
+	}
+}
+
+// pressedKeys returns the usage IDs of the key-down reports written to the
+// fake HID keyboard.
+func pressedKeys(t *testing.T, path string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []byte
+	for i := 0; i+8 <= len(content); i += 8 {
+		if content[i+2] != 0 {
+			keys = append(keys, content[i+2])
+		}
+	}
+	return keys
+}
+
+func TestResetTypesBootKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	hw := Hardware{
+		GPIOPower:    filepath.Join(tmpDir, "gpio_power"),
+		GPIOReset:    filepath.Join(tmpDir, "gpio_reset"),
+		GPIOPowerLED: filepath.Join(tmpDir, "gpio_power_led"),
+		HIDKeyboard:  filepath.Join(tmpDir, "hidg0"),
+	}
+	// Power LED is inverted: 0 means the host is on.
+	for path, value := range map[string]string{hw.GPIOPower: "0", hw.GPIOReset: "0", hw.GPIOPowerLED: "0"} {
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldHardware, oldBoot, oldProfile := currentHardware, currentBootConfig, getBootProfile()
+	currentHardware = &hw
+	bootKeyProfiles["test"] = BootKeyProfile{
+		SetupKey:      "Delete",
+		BootMenuKey:   "F12",
+		TapIntervalMs: 10,
+		TapDurationMs: 30,
+		MenuSteps: map[string][]KeyStep{
+			"Pxe": {{Key: "Down", Repeat: 2, DelayMs: 1}, {Key: "Enter", DelayMs: 1}},
+		},
+	}
+	setBootProfile("test")
+	defer func() {
+		stopBootKeys()
+		currentHardware, currentBootConfig = oldHardware, oldBoot
+		setBootProfile(oldProfile)
+		delete(bootKeyProfiles, "test")
+	}()
+
+	tests := []struct {
+		name       string
+		enabled    string
+		target     string
+		resetType  string
+		expectMenu []byte
+		expectTaps bool
+		// expectAfter is BootSourceOverrideEnabled after the reset.
+		expectAfter string
+	}{
+		{"Pxe on restart", "Once", "Pxe", "ForceRestart", []byte{0x51, 0x51, 0x28}, true, "Disabled"},
+		{"BiosSetup on restart", "Continuous", "BiosSetup", "ForceRestart", nil, true, "Continuous"},
+		{"Override disabled", "Disabled", "Pxe", "ForceRestart", nil, false, "Disabled"},
+		{"No target", "Once", "None", "ForceRestart", nil, false, "Once"},
+		{"Unsupported target", "Once", "SDCard", "ForceRestart", nil, false, "Disabled"},
+		{"Powering off", "Once", "Pxe", "ForceOff", nil, false, "Once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(hw.HIDKeyboard, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			currentBootConfig.BootSourceOverrideEnabled = tt.enabled
+			currentBootConfig.BootSourceOverrideTarget = tt.target
+
+			body := `{"ResetType": "` + tt.resetType + `"}`
+			req := httptest.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", bytes.NewBufferString(body))
+			rr := httptest.NewRecorder()
+			handleReset(rr, req, primarySystem)
+			if rr.Code != http.StatusNoContent {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+			}
+
+			expectTarget := tt.target
+			if tt.expectAfter != tt.enabled {
+				expectTarget = "None"
+			}
+			if got := currentBootConfig; got.BootSourceOverrideEnabled != tt.expectAfter || got.BootSourceOverrideTarget != expectTarget {
+				t.Errorf("Expected override %s/%s after reset, got %s/%s", tt.expectAfter, expectTarget,
+					got.BootSourceOverrideEnabled, got.BootSourceOverrideTarget)
+			}
+
+			bootKeysMu.Lock()
+			done := bootKeysDone
+			bootKeysMu.Unlock()
+			if done != nil {
+				<-done
+			}
+			stopBootKeys()
+
+			keys := pressedKeys(t, hw.HIDKeyboard)
+			if !tt.expectTaps {
+				if len(keys) != 0 {
+					t.Errorf("Expected no keys, got %v", keys)
+				}
+				return
+			}
+			tapKey := hidKeyCodes["F12"]
+			if tt.target == "BiosSetup" {
+				tapKey = hidKeyCodes["Delete"]
+			}
+			menu := len(keys) - len(tt.expectMenu)
+			if menu < 1 || !bytes.Equal(keys[menu:], tt.expectMenu) {
+				t.Fatalf("Expected taps then %v, got %v", tt.expectMenu, keys)
+			}
+			for _, key := range keys[:menu] {
+				if key != tapKey {
+					t.Errorf("Expected only %#x during the tap window, got %v", tapKey, keys)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestResetDryRunBootKeys(t *testing.T) {
+	oldHardware, oldBoot, oldProfile := currentHardware, currentBootConfig, getBootProfile()
+	defer func() {
+		currentHardware, currentBootConfig = oldHardware, oldBoot
+		setBootProfile(oldProfile)
+	}()
+	currentHardware = &Hardware{GPIOReset: "gpiochip0:1"}
+	currentBootConfig.BootSourceOverrideEnabled = "Once"
+	currentBootConfig.BootSourceOverrideTarget = "Pxe"
+	setBootProfile("dell")
+
+	req := httptest.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+		bytes.NewBufferString(`{"ResetType": "ForceRestart", "Oem": {"NanoKVM": {"DryRun": true}}}`))
+	rr := httptest.NewRecorder()
+	handleReset(rr, req, primarySystem)
+
+	var report DryRunReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"Press reset button for 800 ms",
+		"Tap F12 every 300 ms for 30000 ms, then type Down x2, Enter",
+		"Clear the one-time boot override",
+	}
+	if !reflect.DeepEqual(report.WouldPerform, expect) {
+		t.Errorf("Expected %v, got %v", expect, report.WouldPerform)
+	}
+	if currentBootConfig.BootSourceOverrideEnabled != "Once" {
+		t.Error("Expected a dry run to leave the override alone")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// KeyStep is one key in a boot override sequence, typed Repeat times with
+// DelayMs between presses.
+type KeyStep struct {
+	Key     string `json:"key"`
+	Repeat  int    `json:"repeat,omitempty"`
+	DelayMs int    `json:"delay_ms,omitempty"`
+}
+
+// BootKeyProfile describes how a family of firmware is steered into a boot
+// target from the keyboard: which key to tap during POST and what to type
+// once the boot menu is up. Operators can add their own in the config's
+// boot_profiles.
+type BootKeyProfile struct {
+	Description string `json:"description,omitempty"`
+	// SetupKey enters firmware setup; BootMenuKey opens the one-time boot
+	// menu. Either is tapped every TapIntervalMs for TapDurationMs after
+	// power-on so the press lands inside the POST window.
+	SetupKey      string `json:"setup_key"`
+	BootMenuKey   string `json:"boot_menu_key"`
+	TapIntervalMs int    `json:"tap_interval_ms"`
+	TapDurationMs int    `json:"tap_duration_ms"`
+	// TargetKeys taps a key of its own instead of BootMenuKey for a
+	// target, for firmware with a hotkey straight to e.g. network boot.
+	TargetKeys map[string]string `json:"target_keys,omitempty"`
+	// MenuSteps selects each target in the factory-default boot menu
+	// layout. Targets without an entry here or in TargetKeys are not
+	// supported by the profile.
+	MenuSteps map[string][]KeyStep `json:"menu_steps,omitempty"`
+}
+
+var bootKeyProfiles = map[string]BootKeyProfile{
+	"generic-uefi": {
+		Description:   "Generic UEFI firmware (EDK2-based)",
+		SetupKey:      "Escape",
+		BootMenuKey:   "F12",
+		TapIntervalMs: 250,
+		TapDurationMs: 15000,
+		MenuSteps: map[string][]KeyStep{
+			"Pxe":       {{Key: "Down", Repeat: 2}, {Key: "Enter"}},
+			"Cd":        {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Usb":       {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Hdd":       {{Key: "Enter"}},
+			"UefiShell": {{Key: "Down", Repeat: 3}, {Key: "Enter"}},
+		},
+	},
+	"asus": {
+		Description:   "ASUS consumer and workstation boards (AMI Aptio)",
+		SetupKey:      "Delete",
+		BootMenuKey:   "F8",
+		TapIntervalMs: 200,
+		TapDurationMs: 20000,
+		MenuSteps: map[string][]KeyStep{
+			"Pxe":       {{Key: "Down", Repeat: 2}, {Key: "Enter"}},
+			"Cd":        {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Usb":       {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Hdd":       {{Key: "Enter"}},
+			"UefiShell": {{Key: "Down", Repeat: 3}, {Key: "Enter"}},
+		},
+	},
+	"dell": {
+		Description:   "Dell OptiPlex, Precision and PowerEdge",
+		SetupKey:      "F2",
+		BootMenuKey:   "F12",
+		TapIntervalMs: 300,
+		TapDurationMs: 30000,
+		MenuSteps: map[string][]KeyStep{
+			"Pxe":         {{Key: "Down", Repeat: 2}, {Key: "Enter"}},
+			"Cd":          {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Usb":         {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Hdd":         {{Key: "Enter"}},
+			"Diags":       {{Key: "Down", Repeat: 4}, {Key: "Enter"}},
+			"Utilities":   {{Key: "Down", Repeat: 5}, {Key: "Enter"}},
+			"UefiShell":   {{Key: "Down", Repeat: 3}, {Key: "Enter"}},
+			"UefiHttp":    {{Key: "Down", Repeat: 6}, {Key: "Enter"}},
+			"RemoteDrive": {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+		},
+	},
+	"supermicro": {
+		Description:   "Supermicro server boards (AMI Aptio)",
+		SetupKey:      "Delete",
+		BootMenuKey:   "F11",
+		TapIntervalMs: 300,
+		TapDurationMs: 60000,
+		MenuSteps: map[string][]KeyStep{
+			"Pxe":       {{Key: "Down", Repeat: 2}, {Key: "Enter"}},
+			"Cd":        {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Usb":       {{Key: "Down", Repeat: 1}, {Key: "Enter"}},
+			"Hdd":       {{Key: "Enter"}},
+			"UefiShell": {{Key: "Down", Repeat: 3}, {Key: "Enter"}},
+		},
+	},
+}
+
+var (
+	bootProfileMu      sync.Mutex
+	currentBootProfile = "generic-uefi"
+)
+
+func bootProfileNames() []string {
+	names := make([]string, 0, len(bootKeyProfiles))
+	for name := range bootKeyProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getBootProfile() string {
+	bootProfileMu.Lock()
+	defer bootProfileMu.Unlock()
+	return currentBootProfile
+}
+
+func setBootProfile(name string) error {
+	if _, ok := bootKeyProfiles[name]; !ok {
+		return fmt.Errorf("unknown boot profile %q", name)
+	}
+
+	bootProfileMu.Lock()
+	defer bootProfileMu.Unlock()
+	currentBootProfile = name
+	return nil
+}
+
+// registerBootProfiles adds the profiles from the config, replacing any
+// built-in profile of the same name.
+func registerBootProfiles(profiles map[string]BootKeyProfile) {
+	for name, profile := range profiles {
+		bootKeyProfiles[name] = profile
+	}
+}
+
+// validate checks that a profile only uses keys the HID keyboard can type
+// and targets ComputerSystem knows.
+func (p BootKeyProfile) validate() error {
+	if p.TapIntervalMs <= 0 || p.TapDurationMs < p.TapIntervalMs {
+		return fmt.Errorf("tap_interval_ms must be positive and no longer than tap_duration_ms")
+	}
+	for _, key := range []string{p.SetupKey, p.BootMenuKey} {
+		if _, ok := hidKeyCodes[key]; !ok {
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	for target, key := range p.TargetKeys {
+		if !validBootTarget(target) {
+			return fmt.Errorf("unknown boot target %q", target)
+		}
+		if _, ok := hidKeyCodes[key]; !ok {
+			return fmt.Errorf("%s: unknown key %q", target, key)
+		}
+	}
+	for target, steps := range p.MenuSteps {
+		if !validBootTarget(target) {
+			return fmt.Errorf("unknown boot target %q", target)
+		}
+		for _, step := range steps {
+			if _, ok := hidKeyCodes[step.Key]; !ok {
+				return fmt.Errorf("%s: unknown key %q", target, step.Key)
+			}
+			if step.Repeat < 0 || step.DelayMs < 0 {
+				return fmt.Errorf("%s: repeat and delay_ms must not be negative", target)
+			}
+		}
+	}
+	return nil
+}
+
+func validBootTarget(target string) bool {
+	return target != "None" && containsString(currentBootConfig.BootSourceOverrideTargetAllowableValues, target)
+}
+
+// KeySequence returns the key to tap during POST and the steps to type once
+// the menu is up to reach target. BiosSetup needs no menu steps, and
+// neither does a target with a key of its own unless the profile adds some.
+func (p BootKeyProfile) KeySequence(target string) (string, []KeyStep, error) {
+	if key, ok := p.TargetKeys[target]; ok {
+		return key, p.MenuSteps[target], nil
+	}
+	if target == "BiosSetup" {
+		return p.SetupKey, nil, nil
+	}
+
+	steps, ok := p.MenuSteps[target]
+	if !ok {
+		return "", nil, &HardwareError{Kind: errNotSupported, Op: "boot to " + target}
+	}
+	return p.BootMenuKey, steps, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBootKeyProfiles(t *testing.T) {
+	for name, profile := range bootKeyProfiles {
+		t.Run(name, func(t *testing.T) {
+			if profile.SetupKey == "" || profile.BootMenuKey == "" {
+				t.Error("Expected setup and boot menu keys")
+			}
+			if profile.TapIntervalMs <= 0 || profile.TapDurationMs < profile.TapIntervalMs {
+				t.Error("Expected a usable tap interval and duration")
+			}
+
+			key, steps, err := profile.KeySequence("BiosSetup")
+			if err != nil || key != profile.SetupKey || len(steps) != 0 {
+				t.Errorf("BiosSetup: got %q %v %v", key, steps, err)
+			}
+			key, steps, err = profile.KeySequence("Pxe")
+			if err != nil || key != profile.BootMenuKey || len(steps) == 0 {
+				t.Errorf("Pxe: got %q %v %v", key, steps, err)
+			}
+			if _, _, err := profile.KeySequence("SDCard"); !errors.Is(err, errNotSupported) {
+				t.Errorf("Expected errNotSupported for SDCard, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPatchBootProfile(t *testing.T) {
+	old := getBootProfile()
+	oldBoot := currentBootConfig
+	defer func() {
+		setBootProfile(old)
+		currentBootConfig = oldBoot
+	}()
+
+	tests := []struct {
+		name       string
+		body       string
+		expectCode int
+		expect     string
+	}{
+		{"Select profile", `{"Oem": {"NanoKVM": {"BootProfile": "dell"}}}`, http.StatusNoContent, "dell"},
+		{"Unknown profile", `{"Oem": {"NanoKVM": {"BootProfile": "acme"}}}`, http.StatusBadRequest, "dell"},
+		{"Other fields leave profile alone", `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`, http.StatusNoContent, "dell"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("PATCH", "/redfish/v1/Systems/System.1", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(handleSystems).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+			if got := getBootProfile(); got != tt.expect {
+				t.Errorf("Expected profile %s, got %s", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestBootKeyProfileValidate(t *testing.T) {
+	valid := func() BootKeyProfile {
+		return BootKeyProfile{
+			SetupKey:      "F2",
+			BootMenuKey:   "F11",
+			TapIntervalMs: 200,
+			TapDurationMs: 20000,
+			TargetKeys:    map[string]string{"Pxe": "F12"},
+			MenuSteps:     map[string][]KeyStep{"Cd": {{Key: "Down", Repeat: 3, DelayMs: 500}, {Key: "Enter"}}},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(p *BootKeyProfile)
+		expectError bool
+	}{
+		{"Valid", func(p *BootKeyProfile) {}, false},
+		{"No tap interval", func(p *BootKeyProfile) { p.TapIntervalMs = 0 }, true},
+		{"Tap window shorter than interval", func(p *BootKeyProfile) { p.TapDurationMs = 100 }, true},
+		{"Missing setup key", func(p *BootKeyProfile) { p.SetupKey = "" }, true},
+		{"Unknown target key", func(p *BootKeyProfile) { p.TargetKeys["Pxe"] = "F13" }, true},
+		{"Unknown target", func(p *BootKeyProfile) { p.TargetKeys["Floppy"] = "F12" }, true},
+		{"None target", func(p *BootKeyProfile) { p.MenuSteps["None"] = nil }, true},
+		{"Unknown step key", func(p *BootKeyProfile) { p.MenuSteps["Cd"][0].Key = "Jump" }, true},
+		{"Negative delay", func(p *BootKeyProfile) { p.MenuSteps["Cd"][0].DelayMs = -1 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.modify(&p)
+			err := p.validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySequenceTargetKeys(t *testing.T) {
+	p := BootKeyProfile{
+		SetupKey:    "Delete",
+		BootMenuKey: "F11",
+		TargetKeys:  map[string]string{"Pxe": "F12", "BiosSetup": "F2"},
+		MenuSteps: map[string][]KeyStep{
+			"Cd":  {{Key: "Down"}, {Key: "Enter"}},
+			"Pxe": {{Key: "Enter", DelayMs: 2000}},
+		},
+	}
+
+	tests := []struct {
+		target      string
+		expectKey   string
+		expectSteps int
+	}{
+		{"Pxe", "F12", 1},
+		{"BiosSetup", "F2", 0},
+		{"Cd", "F11", 2},
+	}
+	for _, tt := range tests {
+		key, steps, err := p.KeySequence(tt.target)
+		if err != nil || key != tt.expectKey || len(steps) != tt.expectSteps {
+			t.Errorf("%s: got %q %v %v", tt.target, key, steps, err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 #!/bin/bash
 
-echo "Building for RISC-V 64-bit architecture..."
-GOOS=linux GOARCH=riscv64 CGO_ENABLED=0 go build -o nanokvm-redfish -ldflags="-s -w" main.go
+VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo dev)
+
+echo "Building $VERSION for RISC-V 64-bit architecture..."
+GOOS=linux GOARCH=riscv64 CGO_ENABLED=0 go build -o nanokvm-redfish -ldflags="-s -w -X main.serviceVersion=$VERSION" .
 
 if [ $? -eq 0 ]; then
     echo "Build successful!"
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+var errChecksumMismatch = errors.New("image checksum mismatch")
+
+// checksumAlgorithms are the digests InsertMedia can verify an image
+// against, keyed by the name clients pass.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"SHA256": sha256.New,
+	"MD5":    md5.New,
+}
+
+// imageChecksum is the digest an image must have before it is attached.
+type imageChecksum struct {
+	algorithm string
+	sum       []byte
+}
+
+// newImageChecksum checks a hex digest against the algorithm's size.
+// The caller has already checked the algorithm is known.
+func newImageChecksum(algorithm, digest string) (*imageChecksum, error) {
+	sum, err := hex.DecodeString(strings.TrimSpace(digest))
+	if err != nil {
+		return nil, err
+	}
+	if size := checksumAlgorithms[algorithm]().Size(); len(sum) != size {
+		return nil, fmt.Errorf("%s digest must be %d bytes, got %d", algorithm, size, len(sum))
+	}
+	return &imageChecksum{algorithm: algorithm, sum: sum}, nil
+}
+
+func (c *imageChecksum) newHash() hash.Hash {
+	return checksumAlgorithms[c.algorithm]()
+}
+
+// verify compares a hash that has been fed the whole image.
+func (c *imageChecksum) verify(h hash.Hash) error {
+	if got := h.Sum(nil); !bytes.Equal(got, c.sum) {
+		return fmt.Errorf("%w: %s is %x, expected %x", errChecksumMismatch, c.algorithm, got, c.sum)
+	}
+	return nil
+}
+
+// verifyFile reads the image at path in full, for images that were not
+// downloaded and so were never hashed on the way in.
+func (c *imageChecksum) verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errImageNotFound, err)
+	}
+	defer f.Close()
+
+	h := c.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("%w: %v", errImageUnreachable, err)
+	}
+	return c.verify(h)
+}
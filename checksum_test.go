@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageChecksum(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "installer.iso")
+	if err := os.WriteFile(image, []byte("ISO image contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		algorithm   string
+		digest      string
+		expectParse bool
+		expectErr   error
+	}{
+		{"SHA256 match", "SHA256", "d56781ab226a124b583488849697968211ba81745ccf98295e46314eeeb965a2", true, nil},
+		{"SHA256 uppercase", "SHA256", "D56781AB226A124B583488849697968211BA81745CCF98295E46314EEEB965A2", true, nil},
+		{"SHA256 mismatch", "SHA256", "a8e4f8a2bd27b3b7be3b1b0f31836ab27b5f2bd0b0f9e2ed0347c7dc8c35c0b8", true, errChecksumMismatch},
+		{"MD5 match", "MD5", "b4d6e01dee9f2fad4ff4247b2e0c5587", true, nil},
+		{"MD5 mismatch", "MD5", "8b1a9953c4611296a827abf8c47804d7", true, errChecksumMismatch},
+		{"Wrong length", "SHA256", "8b1a9953c4611296a827abf8c47804d7", false, nil},
+		{"Not hex", "MD5", "not-a-digest", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newImageChecksum(tt.algorithm, tt.digest)
+			if (err == nil) != tt.expectParse {
+				t.Fatalf("Expected parse success %v, got %v", tt.expectParse, err)
+			}
+			if err != nil {
+				return
+			}
+			if err := c.verifyFile(image); !errors.Is(err, tt.expectErr) {
+				t.Errorf("Expected %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var configFile = "/etc/nanokvm-redfish/config.json"
+
+// Config holds the daemon settings read from the JSON config file.
+type Config struct {
+	ListenAddress string    `json:"listen_address"`
+	TLS           TLSConfig `json:"tls"`
+
+	// SchemaValidation checks outgoing payloads against the embedded
+	// schemas: "off" (default), "log" or "strict".
+	SchemaValidation SchemaValidationMode `json:"schema_validation"`
+
+	// RequireAuth turns on HTTP Basic authentication against the local
+	// account store kept in AccountsFile.
+	RequireAuth   bool          `json:"require_auth"`
+	AccountsFile  string        `json:"accounts_file"`
+	AccountPolicy AccountPolicy `json:"account_policy"`
+
+	// Timezone is an IANA zone name used to display log and event
+	// timestamps. Defaults to UTC.
+	Timezone string `json:"timezone"`
+
+	// AuditLogFile receives one line per state-changing request. The
+	// service only ever appends to it; rotate it externally if needed.
+	// Empty keeps the audit log in memory only.
+	AuditLogFile string `json:"audit_log_file"`
+
+	Events EventsConfig `json:"events"`
+
+	Sessions SessionsConfig `json:"sessions"`
+
+	HostInterface HostInterfaceConfig `json:"host_interface"`
+
+	VirtualMedia VirtualMediaConfig `json:"virtual_media"`
+
+	// WriteAllowlist limits POST, PATCH, PUT and DELETE requests to
+	// clients in these networks (CIDRs or single addresses). Empty allows
+	// everyone.
+	WriteAllowlist []string `json:"write_allowlist"`
+
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	// MaintenanceMode starts the service refusing every state-changing
+	// request with 503. It can be toggled at runtime through the manager's
+	// NanoKVM.SetMaintenanceMode action.
+	MaintenanceMode bool `json:"maintenance_mode"`
+
+	// AuthBackends lists where username/password credentials are checked,
+	// in order: "local" for the account store, "nanokvm" for the NanoKVM
+	// web UI account.
+	AuthBackends []string          `json:"auth_backends"`
+	NanoKVMAuth  NanoKVMAuthConfig `json:"nanokvm_auth"`
+
+	// BootProfile names the keystroke profile used for boot overrides on
+	// this host's firmware, e.g. "dell" or "supermicro". BootProfiles adds
+	// profiles for boards the built-in ones do not fit.
+	BootProfile  string                    `json:"boot_profile"`
+	BootProfiles map[string]BootKeyProfile `json:"boot_profiles"`
+
+	// BootStateFile keeps the Boot settings of the ComputerSystem across
+	// restarts. Empty keeps them in memory only.
+	BootStateFile string `json:"boot_state_file"`
+
+	// PowerStateFile keeps the PowerRestorePolicy and the host's last
+	// power state across restarts. Empty keeps them in memory only.
+	PowerStateFile string `json:"power_state_file"`
+
+	// ServiceUUIDFile keeps the UUID of the service, created on first
+	// boot. Empty derives it from the machine ID on every start.
+	ServiceUUIDFile string `json:"service_uuid_file"`
+
+	// HardwareProfilesDir holds extra board profiles; see
+	// loadHardwareProfiles.
+	HardwareProfilesDir string `json:"hardware_profiles_dir"`
+
+	// GPIO overrides the GPIOs of the detected board revision, so a board
+	// spin the built-in profiles do not know can be used without a code
+	// change.
+	GPIO GPIOConfig `json:"gpio"`
+
+	// AuxGPIOs are spare GPIOs wired to something other than the host's
+	// buttons and LEDs, such as an identify light or a relay board, and
+	// offered under the manager's Oem; see auxgpio.go.
+	AuxGPIOs []AuxGPIOConfig `json:"aux_gpios"`
+
+	// Systems are further hosts whose buttons and power LED are wired to
+	// other GPIOs, such as through a relay board, each listed as its own
+	// ComputerSystem after System.1.
+	Systems []SystemConfig `json:"systems"`
+
+	// SoCThermalZone is the sysfs thermal zone of the NanoKVM's own SoC,
+	// reported as a chassis sensor. Empty leaves it out.
+	SoCThermalZone string `json:"soc_thermal_zone"`
+
+	// PowerMeter is an I2C power monitor on the host's supply, reported
+	// as chassis sensors.
+	PowerMeter PowerMeterConfig `json:"power_meter"`
+
+	// ChassisIntrusion maps a spare GPIO input to a chassis intrusion
+	// switch, reported as the chassis's PhysicalSecurity.
+	ChassisIntrusion IntrusionConfig `json:"chassis_intrusion"`
+
+	// PowerPollInterval is how often, in milliseconds, the power LED is
+	// sampled in the background; see powerMonitor. Zero disables polling
+	// and every request reads the LED itself.
+	PowerPollInterval int `json:"power_poll_interval"`
+
+	// GracefulShutdownTimeout, if set, forces the host off when the OS
+	// has not shut it down this many seconds after a GracefulShutdown.
+	GracefulShutdownTimeout int `json:"graceful_shutdown_timeout"`
+
+	// SynchronousReset makes ComputerSystem.Reset hold the request while
+	// it presses a button and answer 204, for a client that cannot follow
+	// a task. By default every press runs as a task.
+	SynchronousReset bool `json:"synchronous_reset"`
+
+	// Compatibility adjusts behaviour for a client whose call sequence
+	// strict Redfish would break. "metal3" is the only profile: see
+	// metal3Compatible.
+	Compatibility string `json:"compatibility"`
+
+	// NTP is the device's NTP client, configured through the manager's
+	// NetworkProtocol.
+	NTP NTPConfig `json:"ntp"`
+
+	// Network is where the addressing of the NanoKVM's own interfaces is
+	// configured, through the manager's EthernetInterfaces.
+	Network NetworkConfig `json:"network"`
+}
+
+// NTPConfig locates the device's NTP client. Its server lines in
+// ConfigFile are rewritten and InitScript restarts or stops it; StateFile
+// remembers whether it was turned off.
+type NTPConfig struct {
+	ConfigFile string `json:"config_file"`
+	InitScript string `json:"init_script"`
+	StateFile  string `json:"state_file"`
+}
+
+// NetworkConfig locates the device's network configuration. An interface
+// listed in StaticFiles has the static IPv4 addresses in its file, one
+// "address/prefix [gateway]" per line, or uses DHCP when there is no file;
+// InitScript restarts networking to apply them. A change is undone unless
+// confirmed within ConfirmTimeout seconds, and StateFile keeps what to go
+// back to until then. VLANs on those interfaces are set up with IPCommand
+// and kept in VLANFile. Static name servers and search domains are written
+// to ResolvConf and kept in DNSFile.
+type NetworkConfig struct {
+	StaticFiles    map[string]string `json:"static_files"`
+	InitScript     string            `json:"init_script"`
+	StateFile      string            `json:"state_file"`
+	ConfirmTimeout int               `json:"confirm_timeout"`
+	IPCommand      string            `json:"ip_command"`
+	VLANFile       string            `json:"vlan_file"`
+	ResolvConf     string            `json:"resolv_conf"`
+	DNSFile        string            `json:"dns_file"`
+}
+
+func (c NetworkConfig) validate() error {
+	for name, path := range c.StaticFiles {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("network: static_files: %s must be an absolute path, got %q", name, path)
+		}
+	}
+	if c.ConfirmTimeout <= 0 {
+		return fmt.Errorf("network: confirm_timeout must be positive")
+	}
+	if !filepath.IsAbs(c.ResolvConf) {
+		return fmt.Errorf("network: resolv_conf must be an absolute path, got %q", c.ResolvConf)
+	}
+	return nil
+}
+
+// SessionsConfig controls how long SessionService logins stay valid, in
+// seconds. A session ends after IdleTimeout without requests or MaxLifetime
+// after it was created, whichever comes first; a zero MaxLifetime disables
+// the absolute limit.
+type SessionsConfig struct {
+	IdleTimeout int `json:"idle_timeout"`
+	MaxLifetime int `json:"max_lifetime"`
+}
+
+func (s SessionsConfig) validate() error {
+	// Redfish allows SessionTimeout values from 30 to 86400 seconds.
+	if s.IdleTimeout < 30 || s.IdleTimeout > 86400 {
+		return fmt.Errorf("sessions: idle_timeout must be between 30 and 86400")
+	}
+	if s.MaxLifetime < 0 {
+		return fmt.Errorf("sessions: max_lifetime must not be negative")
+	}
+	return nil
+}
+
+// EventsConfig controls event subscriptions and delivery. RetryInterval is
+// in seconds.
+type EventsConfig struct {
+	SubscriptionsFile string `json:"subscriptions_file"`
+
+	// BufferDir holds one file per subscription with the events that could
+	// not be delivered, replayed once the subscriber is reachable again.
+	// BufferLimit caps each file; the oldest events are dropped first.
+	BufferDir   string `json:"buffer_dir"`
+	BufferLimit int    `json:"buffer_limit"`
+
+	RetryAttempts int `json:"retry_attempts"`
+	RetryInterval int `json:"retry_interval"`
+}
+
+func (e EventsConfig) validate() error {
+	if e.SubscriptionsFile == "" || e.BufferDir == "" {
+		return fmt.Errorf("events: subscriptions_file and buffer_dir must be set")
+	}
+	if e.BufferLimit < 1 {
+		return fmt.Errorf("events: buffer_limit must be at least 1")
+	}
+	if e.RetryAttempts < 0 || e.RetryInterval < 1 {
+		return fmt.Errorf("events: retry_attempts must not be negative and retry_interval must be at least 1")
+	}
+	return nil
+}
+
+// AccountPolicy controls failed-login lockout and password rules for local
+// accounts. Durations are in seconds.
+type AccountPolicy struct {
+	// LockoutThreshold is the number of consecutive failed logins that
+	// locks an account. Zero disables lockout.
+	LockoutThreshold int `json:"lockout_threshold"`
+	// LockoutDuration is how long an account stays locked. Zero keeps it
+	// locked until an administrator clears Locked.
+	LockoutDuration int `json:"lockout_duration"`
+	// LockoutCounterResetAfter forgets earlier failures once this long has
+	// passed since the last one.
+	LockoutCounterResetAfter int `json:"lockout_counter_reset_after"`
+
+	MinPasswordLength int `json:"min_password_length"`
+	MaxPasswordLength int `json:"max_password_length"`
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and
+	// symbols a password must contain.
+	MinCharacterClasses int `json:"min_character_classes"`
+}
+
+func (p AccountPolicy) validate() error {
+	if p.LockoutThreshold < 0 || p.LockoutDuration < 0 || p.LockoutCounterResetAfter < 0 {
+		return fmt.Errorf("account_policy: lockout settings must not be negative")
+	}
+	// bcrypt only looks at the first 72 bytes of a password.
+	if p.MaxPasswordLength < 1 || p.MaxPasswordLength > 72 {
+		return fmt.Errorf("account_policy: max_password_length must be between 1 and 72")
+	}
+	if p.MinPasswordLength > p.MaxPasswordLength {
+		return fmt.Errorf("account_policy: min_password_length exceeds max_password_length")
+	}
+	if p.MinCharacterClasses < 0 || p.MinCharacterClasses > 4 {
+		return fmt.Errorf("account_policy: min_character_classes must be between 0 and 4")
+	}
+	return nil
+}
+
+// HostInterfaceConfig controls the Redfish Host Interface: an in-band
+// listener on the USB network gadget through which the host OS can reach
+// its own BMC.
+type HostInterfaceConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Interface string `json:"interface"`
+	Port      int    `json:"port"`
+	// GadgetDir is the configfs directory of the USB gadget, read for the
+	// USB IDs reported in the SMBIOS Type 42 device descriptor.
+	GadgetDir string `json:"gadget_dir"`
+	// Role caps what in-band requests may do, whatever credentials they
+	// carry.
+	Role string `json:"role"`
+}
+
+func (c HostInterfaceConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interface == "" {
+		return fmt.Errorf("host_interface: interface must be set")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("host_interface: port must be between 1 and 65535")
+	}
+	if _, ok := roles[c.Role]; !ok {
+		return fmt.Errorf("host_interface: unknown role %q", c.Role)
+	}
+	return nil
+}
+
+// RateLimitConfig throttles action requests (POSTs to .../Actions/...) per
+// client address with a token bucket: a client may send Burst actions at
+// once and then Rate actions per second. A zero Burst disables the limit.
+type RateLimitConfig struct {
+	Burst int     `json:"burst"`
+	Rate  float64 `json:"rate"`
+}
+
+func (c RateLimitConfig) validate() error {
+	if c.Burst < 0 {
+		return fmt.Errorf("rate_limit: burst must not be negative")
+	}
+	if c.Burst > 0 && c.Rate <= 0 {
+		return fmt.Errorf("rate_limit: rate must be positive")
+	}
+	return nil
+}
+
+// VirtualMediaConfig locates the USB gadget mass storage LUN that
+// VirtualMedia images are presented through, ImageDir, where InsertMedia
+// caches downloaded images, and MountDir, where NFS and CIFS shares are
+// mounted. The cache is trimmed to CacheSizeMB, least recently used
+// first; with 0 nothing is cached and images are deleted on EjectMedia.
+// LocalImageDirs limits which files on the SD card InsertMedia may
+// attach by path. GadgetLockFile is flocked around every change to the
+// LUN; see lockGadget.
+type VirtualMediaConfig struct {
+	LUNDir         string   `json:"lun_dir"`
+	ImageDir       string   `json:"image_dir"`
+	MountDir       string   `json:"mount_dir"`
+	CacheSizeMB    int      `json:"cache_size_mb"`
+	LocalImageDirs []string `json:"local_image_dirs"`
+	GadgetLockFile string   `json:"gadget_lock_file"`
+}
+
+func (c VirtualMediaConfig) validate() error {
+	if c.CacheSizeMB < 0 {
+		return fmt.Errorf("virtual_media: cache_size_mb must not be negative")
+	}
+	for _, dir := range c.LocalImageDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("virtual_media: local_image_dirs entry %q must be an absolute path", dir)
+		}
+	}
+	return nil
+}
+
+// GPIOConfig names GPIOs by their sysfs value file or as
+// "gpiochipN:offset"; see resolveGPIO. Empty fields keep the board's own.
+type GPIOConfig struct {
+	Reset    string `json:"reset"`
+	Power    string `json:"power"`
+	PowerLED string `json:"power_led"`
+	HDDLED   string `json:"hdd_led"`
+	NMI      string `json:"nmi"`
+}
+
+func (c GPIOConfig) validate() error {
+	for name, value := range map[string]string{
+		"reset": c.Reset, "power": c.Power, "power_led": c.PowerLED, "hdd_led": c.HDDLED, "nmi": c.NMI,
+	} {
+		if _, _, ok := parseChipLine(value); value != "" && !ok && !filepath.IsAbs(value) {
+			return fmt.Errorf("gpio: %s must be an absolute path or gpiochipN:offset, got %q", name, value)
+		}
+	}
+	return nil
+}
+
+// complete reports whether the map names every GPIO the service needs, so
+// that it can run on a board whose revision is not recognised.
+func (c GPIOConfig) complete() bool {
+	return c.Reset != "" && c.Power != "" && c.PowerLED != ""
+}
+
+// apply returns hw with the configured GPIOs in place of its own.
+func (c GPIOConfig) apply(hw Hardware) Hardware {
+	for _, o := range []struct {
+		value string
+		field *string
+	}{
+		{c.Reset, &hw.GPIOReset},
+		{c.Power, &hw.GPIOPower},
+		{c.PowerLED, &hw.GPIOPowerLED},
+		{c.HDDLED, &hw.GPIOHDDLed},
+		{c.NMI, &hw.GPIONMI},
+	} {
+		if o.value != "" {
+			*o.field = o.value
+		}
+	}
+	return hw
+}
+
+// AuxGPIOConfig is one auxiliary GPIO. Name is its Id in the API; GPIO is
+// named as in GPIOConfig. Direction is "input" or "output".
+type AuxGPIOConfig struct {
+	Name        string `json:"name"`
+	GPIO        string `json:"gpio"`
+	Direction   string `json:"direction"`
+	Description string `json:"description"`
+}
+
+var auxGPIONamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func validateAuxGPIOs(gpios []AuxGPIOConfig) error {
+	seen := map[string]bool{}
+	for _, g := range gpios {
+		if !auxGPIONamePattern.MatchString(g.Name) {
+			return fmt.Errorf("aux_gpios: name %q must be letters, digits, - and _", g.Name)
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("aux_gpios: %s is listed twice", g.Name)
+		}
+		seen[g.Name] = true
+		if _, _, ok := parseChipLine(g.GPIO); !ok && !filepath.IsAbs(g.GPIO) {
+			return fmt.Errorf("aux_gpios: %s: gpio must be an absolute path or gpiochipN:offset, got %q", g.Name, g.GPIO)
+		}
+		if g.Direction != "input" && g.Direction != "output" {
+			return fmt.Errorf("aux_gpios: %s: direction must be input or output, got %q", g.Name, g.Direction)
+		}
+	}
+	return nil
+}
+
+// SystemConfig is one further host. ID is its Id in the API and GPIO
+// names all of its GPIOs, as the board's own only reach System.1.
+// BootStateFile is as Config.BootStateFile for this host.
+type SystemConfig struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	GPIO          GPIOConfig `json:"gpio"`
+	BootStateFile string     `json:"boot_state_file"`
+}
+
+var systemIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func validateSystems(systems []SystemConfig) error {
+	seen := map[string]bool{primarySystem.ID: true}
+	for _, s := range systems {
+		if !systemIDPattern.MatchString(s.ID) {
+			return fmt.Errorf("systems: id %q must be letters, digits, ., - and _", s.ID)
+		}
+		if seen[s.ID] {
+			return fmt.Errorf("systems: %s is listed twice", s.ID)
+		}
+		seen[s.ID] = true
+		if !s.GPIO.complete() {
+			return fmt.Errorf("systems: %s: gpio needs reset, power and power_led", s.ID)
+		}
+		if err := s.GPIO.validate(); err != nil {
+			return fmt.Errorf("systems: %s: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// IntrusionConfig names the GPIO of the chassis intrusion switch as in
+// GPIOConfig; empty means there is none. The switch reads 1 while the
+// chassis is open, or 0 with ActiveLow. ReArm is "Manual", where an
+// intrusion is reported until cleared through the API, or "Automatic",
+// where the sensor follows the switch.
+type IntrusionConfig struct {
+	GPIO      string `json:"gpio"`
+	ActiveLow bool   `json:"active_low"`
+	ReArm     string `json:"rearm"`
+}
+
+func (c IntrusionConfig) validate() error {
+	if _, _, ok := parseChipLine(c.GPIO); c.GPIO != "" && !ok && !filepath.IsAbs(c.GPIO) {
+		return fmt.Errorf("chassis_intrusion: gpio must be an absolute path or gpiochipN:offset, got %q", c.GPIO)
+	}
+	if c.ReArm != "Manual" && c.ReArm != "Automatic" {
+		return fmt.Errorf("chassis_intrusion: rearm must be Manual or Automatic, got %q", c.ReArm)
+	}
+	return nil
+}
+
+// PowerMeterConfig describes an INA219 or INA226 power monitor on an I2C
+// bus, read through the bus's i2c-dev device. Address is the chip's 7-bit
+// address and ShuntMilliohms the resistance of the shunt it measures the
+// current across. An empty Chip means there is none.
+type PowerMeterConfig struct {
+	Chip           string  `json:"chip"`
+	Bus            string  `json:"bus"`
+	Address        int     `json:"address"`
+	ShuntMilliohms float64 `json:"shunt_milliohms"`
+}
+
+func (c PowerMeterConfig) validate() error {
+	switch {
+	case c.Chip == "":
+		return nil
+	case c.Chip != "ina219" && c.Chip != "ina226":
+		return fmt.Errorf("power_meter: unknown chip %q", c.Chip)
+	case !filepath.IsAbs(c.Bus):
+		return fmt.Errorf("power_meter: bus must be an absolute path, got %q", c.Bus)
+	case c.Address < 0x03 || c.Address > 0x77:
+		return fmt.Errorf("power_meter: address must be a 7-bit I2C address, got %d", c.Address)
+	case c.ShuntMilliohms <= 0:
+		return fmt.Errorf("power_meter: shunt_milliohms must be positive")
+	}
+	return nil
+}
+
+// NanoKVMAuthConfig points at the NanoKVM web application's account file.
+// Its single user has no Redfish role of its own, so Role is granted.
+type NanoKVMAuthConfig struct {
+	AccountFile string `json:"account_file"`
+	Role        string `json:"role"`
+}
+
+// TLSConfig controls HTTPS serving and client certificate authentication.
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// ClientCAFile is a PEM bundle used to verify client certificates.
+	// When RequireClientCert is set, every connection must present a
+	// certificate signed by one of these CAs.
+	ClientCAFile      string `json:"client_ca_file"`
+	RequireClientCert bool   `json:"require_client_cert"`
+
+	// ClientCertRoles maps a certificate subject CN to a Redfish role.
+	// Certificates whose CN is not listed are rejected.
+	ClientCertRoles map[string]string `json:"client_cert_roles"`
+}
+
+var currentConfig = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		ListenAddress:    ":8080",
+		SchemaValidation: SchemaValidationOff,
+		Timezone:         "UTC",
+		AccountsFile:     "/etc/nanokvm-redfish/accounts.json",
+		AccountPolicy: AccountPolicy{
+			LockoutThreshold:         5,
+			LockoutDuration:          300,
+			LockoutCounterResetAfter: 60,
+			MinPasswordLength:        8,
+			MaxPasswordLength:        64,
+			MinCharacterClasses:      2,
+		},
+		AuditLogFile: "/var/lib/nanokvm-redfish/audit.log",
+		Events: EventsConfig{
+			SubscriptionsFile: "/var/lib/nanokvm-redfish/subscriptions.json",
+			BufferDir:         "/var/lib/nanokvm-redfish/event-buffer",
+			BufferLimit:       100,
+			RetryAttempts:     3,
+			RetryInterval:     5,
+		},
+		Sessions: SessionsConfig{
+			IdleTimeout: 1800,
+			MaxLifetime: 86400,
+		},
+		HostInterface: HostInterfaceConfig{
+			Interface: "usb0",
+			Port:      8080,
+			GadgetDir: "/sys/kernel/config/usb_gadget/g0",
+			Role:      "ReadOnly",
+		},
+		RateLimit: RateLimitConfig{
+			Burst: 5,
+			Rate:  1,
+		},
+		VirtualMedia: VirtualMediaConfig{
+			LUNDir:      "/sys/kernel/config/usb_gadget/g0/functions/mass_storage.disk0/lun.0",
+			ImageDir:    "/data/nanokvm-redfish/images",
+			MountDir:    "/run/nanokvm-redfish/mnt",
+			CacheSizeMB: 2048,
+			// The NanoKVM web UI keeps uploaded images in /data.
+			LocalImageDirs: []string{"/data"},
+			GadgetLockFile: "/run/nanokvm-usb-gadget.lock",
+		},
+		AuthBackends: []string{"local"},
+		NanoKVMAuth: NanoKVMAuthConfig{
+			AccountFile: "/etc/kvm/pwd",
+			Role:        "Administrator",
+		},
+		BootProfile:         "generic-uefi",
+		BootStateFile:       "/var/lib/nanokvm-redfish/boot.json",
+		PowerStateFile:      "/var/lib/nanokvm-redfish/power.json",
+		ServiceUUIDFile:     "/var/lib/nanokvm-redfish/uuid",
+		HardwareProfilesDir: "/etc/nanokvm-redfish/profiles",
+		PowerPollInterval:   1000,
+		SoCThermalZone:      "/sys/class/thermal/thermal_zone0",
+		ChassisIntrusion:    IntrusionConfig{ReArm: "Manual"},
+		NTP: NTPConfig{
+			ConfigFile: "/etc/ntp.conf",
+			InitScript: "/etc/init.d/S49ntp",
+			StateFile:  "/var/lib/nanokvm-redfish/ntp.json",
+		},
+		Network: NetworkConfig{
+			// The NanoKVM's network init script takes eth0's static
+			// addresses from /boot, where they can also be edited with
+			// the SD card in another machine.
+			StaticFiles:    map[string]string{"eth0": "/boot/eth.nodhcp"},
+			InitScript:     "/etc/init.d/S30eth",
+			StateFile:      "/var/lib/nanokvm-redfish/network.json",
+			ConfirmTimeout: 120,
+			IPCommand:      "/sbin/ip",
+			VLANFile:       "/var/lib/nanokvm-redfish/vlans.json",
+			ResolvConf:     "/etc/resolv.conf",
+			DNSFile:        "/var/lib/nanokvm-redfish/dns.json",
+		},
+	}
+}
+
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+	if c.TLS.RequireClientCert {
+		if c.TLS.CertFile == "" {
+			return fmt.Errorf("tls: require_client_cert needs cert_file and key_file")
+		}
+		if c.TLS.ClientCAFile == "" {
+			return fmt.Errorf("tls: require_client_cert needs client_ca_file")
+		}
+	}
+	switch c.SchemaValidation {
+	case SchemaValidationOff, SchemaValidationLog, SchemaValidationStrict:
+	default:
+		return fmt.Errorf("unknown schema_validation mode %q", c.SchemaValidation)
+	}
+	if err := c.AccountPolicy.validate(); err != nil {
+		return err
+	}
+	if err := c.Events.validate(); err != nil {
+		return err
+	}
+	if err := c.Sessions.validate(); err != nil {
+		return err
+	}
+	if err := c.Network.validate(); err != nil {
+		return err
+	}
+	for _, entry := range c.WriteAllowlist {
+		if _, err := parseAllowlistEntry(entry); err != nil {
+			return fmt.Errorf("write_allowlist: %w", err)
+		}
+	}
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+	if err := c.VirtualMedia.validate(); err != nil {
+		return err
+	}
+	for _, backend := range c.AuthBackends {
+		if backend != "local" && backend != "nanokvm" {
+			return fmt.Errorf("unknown auth backend %q", backend)
+		}
+	}
+	if _, ok := roles[c.NanoKVMAuth.Role]; !ok {
+		return fmt.Errorf("nanokvm_auth: unknown role %q", c.NanoKVMAuth.Role)
+	}
+	for name, profile := range c.BootProfiles {
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("boot_profiles: %s: %w", name, err)
+		}
+	}
+	_, custom := c.BootProfiles[c.BootProfile]
+	if _, builtin := bootKeyProfiles[c.BootProfile]; !custom && !builtin {
+		return fmt.Errorf("unknown boot_profile %q", c.BootProfile)
+	}
+	if err := c.GPIO.validate(); err != nil {
+		return err
+	}
+	if err := validateAuxGPIOs(c.AuxGPIOs); err != nil {
+		return err
+	}
+	if err := validateSystems(c.Systems); err != nil {
+		return err
+	}
+	if err := c.ChassisIntrusion.validate(); err != nil {
+		return err
+	}
+	if err := c.PowerMeter.validate(); err != nil {
+		return err
+	}
+	if c.SoCThermalZone != "" && !filepath.IsAbs(c.SoCThermalZone) {
+		return fmt.Errorf("soc_thermal_zone must be an absolute path, got %q", c.SoCThermalZone)
+	}
+	if c.PowerPollInterval < 0 {
+		return fmt.Errorf("power_poll_interval must not be negative")
+	}
+	if c.GracefulShutdownTimeout < 0 {
+		return fmt.Errorf("graceful_shutdown_timeout must not be negative")
+	}
+	if c.Compatibility != "" && c.Compatibility != "metal3" {
+		return fmt.Errorf("unknown compatibility profile %q", c.Compatibility)
+	}
+	if err := c.HostInterface.validate(); err != nil {
+		return err
+	}
+	if c.HostInterface.Enabled && c.TLS.RequireClientCert {
+		// The in-band listener is plain HTTP, so no request on it could
+		// ever present a client certificate.
+		return fmt.Errorf("host_interface cannot be enabled with tls.require_client_cert")
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	for cn, role := range c.TLS.ClientCertRoles {
+		if _, ok := roles[role]; !ok {
+			return fmt.Errorf("tls: unknown role %q for client certificate %q", role, cn)
+		}
+	}
+	return nil
+}
+
+// location returns the configured display timezone. The value has already
+// been checked by validate, so an error here falls back to UTC.
+func (c Config) location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("Missing file uses defaults", func(t *testing.T) {
+		cfg, err := loadConfig(filepath.Join(tmpDir, "missing.json"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.ListenAddress != ":8080" {
+			t.Errorf("Expected default listen address, got %s", cfg.ListenAddress)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{
+			name:    "Client cert auth",
+			content: `{"tls": {"cert_file": "a", "key_file": "b", "client_ca_file": "c", "require_client_cert": true, "client_cert_roles": {"ironic": "Operator"}}}`,
+		},
+		{
+			name:        "Client cert auth without CA",
+			content:     `{"tls": {"cert_file": "a", "key_file": "b", "require_client_cert": true}}`,
+			expectError: true,
+		},
+		{
+			name:        "Unknown role",
+			content:     `{"tls": {"cert_file": "a", "key_file": "b", "client_ca_file": "c", "require_client_cert": true, "client_cert_roles": {"ironic": "Root"}}}`,
+			expectError: true,
+		},
+		{
+			name:        "Zero event buffer limit",
+			content:     `{"events": {"buffer_limit": 0}}`,
+			expectError: true,
+		},
+		{
+			name:        "Idle timeout below Redfish minimum",
+			content:     `{"sessions": {"idle_timeout": 10}}`,
+			expectError: true,
+		},
+		{
+			name:        "Host interface with client certs",
+			content:     `{"host_interface": {"enabled": true}, "tls": {"cert_file": "a", "key_file": "b", "client_ca_file": "c", "require_client_cert": true}}`,
+			expectError: true,
+		},
+		{
+			name:    "Boot profile",
+			content: `{"boot_profile": "supermicro"}`,
+		},
+		{
+			name:        "Unknown boot profile",
+			content:     `{"boot_profile": "acme"}`,
+			expectError: true,
+		},
+		{
+			name:    "NanoKVM auth backend",
+			content: `{"auth_backends": ["nanokvm", "local"], "nanokvm_auth": {"role": "Operator"}}`,
+		},
+		{
+			name:        "Unknown auth backend",
+			content:     `{"auth_backends": ["ldap"]}`,
+			expectError: true,
+		},
+		{
+			name:    "Write allowlist",
+			content: `{"write_allowlist": ["10.0.0.0/8", "192.168.1.5", "fd00::/8"]}`,
+		},
+		{
+			name:        "Invalid write allowlist entry",
+			content:     `{"write_allowlist": ["10.0.0.0/33"]}`,
+			expectError: true,
+		},
+		{
+			name:    "Rate limit disabled",
+			content: `{"rate_limit": {"burst": 0}}`,
+		},
+		{
+			name:        "Rate limit without rate",
+			content:     `{"rate_limit": {"burst": 5, "rate": 0}}`,
+			expectError: true,
+		},
+		{
+			name:    "Local image directories",
+			content: `{"virtual_media": {"local_image_dirs": ["/data", "/mnt/usb"]}}`,
+		},
+		{
+			name:        "Relative local image directory",
+			content:     `{"virtual_media": {"local_image_dirs": ["isos"]}}`,
+			expectError: true,
+		},
+		{
+			name:    "Image cache disabled",
+			content: `{"virtual_media": {"cache_size_mb": 0}}`,
+		},
+		{
+			name:        "Negative image cache size",
+			content:     `{"virtual_media": {"cache_size_mb": -1}}`,
+			expectError: true,
+		},
+		{
+			name: "Custom boot profile",
+			content: `{"boot_profile": "lab", "boot_profiles": {"lab": {"setup_key": "F2", "boot_menu_key": "F11",
+				"tap_interval_ms": 200, "tap_duration_ms": 20000, "target_keys": {"Pxe": "F12"},
+				"menu_steps": {"Cd": [{"key": "Down", "repeat": 3, "delay_ms": 500}, {"key": "Enter"}]}}}}`,
+		},
+		{
+			name:        "Boot profile with unknown key",
+			content:     `{"boot_profiles": {"lab": {"setup_key": "F13", "boot_menu_key": "F11", "tap_interval_ms": 200, "tap_duration_ms": 20000}}}`,
+			expectError: true,
+		},
+		{
+			name:        "Unknown boot profile",
+			content:     `{"boot_profile": "lab"}`,
+			expectError: true,
+		},
+		{
+			name:    "GPIO map",
+			content: `{"gpio": {"reset": "gpiochip1:27", "power": "/dev/gpiochip1:23", "power_led": "/sys/class/gpio/gpio504/value"}}`,
+		},
+		{
+			name:        "GPIO map with relative path",
+			content:     `{"gpio": {"power": "gpio503/value"}}`,
+			expectError: true,
+		},
+		{
+			name:    "GPIO map with NMI",
+			content: `{"gpio": {"nmi": "gpiochip0:12"}}`,
+		},
+		{
+			name:        "GPIO map with bad offset",
+			content:     `{"gpio": {"hdd_led": "gpiochip1:x"}}`,
+			expectError: true,
+		},
+		{
+			name:    "Auxiliary GPIOs",
+			content: `{"aux_gpios": [{"name": "identify", "gpio": "gpiochip0:14", "direction": "output"}, {"name": "intrusion", "gpio": "/sys/class/gpio/gpio500/value", "direction": "input"}]}`,
+		},
+		{
+			name:        "Auxiliary GPIO listed twice",
+			content:     `{"aux_gpios": [{"name": "relay", "gpio": "gpiochip0:14", "direction": "output"}, {"name": "relay", "gpio": "gpiochip0:15", "direction": "output"}]}`,
+			expectError: true,
+		},
+		{
+			name:        "Auxiliary GPIO without direction",
+			content:     `{"aux_gpios": [{"name": "relay", "gpio": "gpiochip0:14"}]}`,
+			expectError: true,
+		},
+		{
+			name:    "Further systems",
+			content: `{"systems": [{"id": "Host2", "name": "Build server", "gpio": {"reset": "gpiochip1:0", "power": "gpiochip1:1", "power_led": "gpiochip1:2"}, "boot_state_file": "/var/lib/nanokvm-redfish/boot-host2.json"}]}`,
+		},
+		{
+			name:        "Further system reusing System.1",
+			content:     `{"systems": [{"id": "System.1", "gpio": {"reset": "gpiochip1:0", "power": "gpiochip1:1", "power_led": "gpiochip1:2"}}]}`,
+			expectError: true,
+		},
+		{
+			name:        "Further system without a power LED",
+			content:     `{"systems": [{"id": "Host2", "gpio": {"reset": "gpiochip1:0", "power": "gpiochip1:1"}}]}`,
+			expectError: true,
+		},
+		{
+			name:    "Chassis intrusion switch",
+			content: `{"chassis_intrusion": {"gpio": "gpiochip0:16", "active_low": true, "rearm": "Automatic"}}`,
+		},
+		{
+			name:        "Chassis intrusion with unknown rearm",
+			content:     `{"chassis_intrusion": {"gpio": "gpiochip0:16", "rearm": "Never"}}`,
+			expectError: true,
+		},
+		{
+			name:    "Power polling disabled",
+			content: `{"power_poll_interval": 0}`,
+		},
+		{
+			name:    "GracefulShutdown escalation",
+			content: `{"graceful_shutdown_timeout": 300}`,
+		},
+		{
+			name:        "Negative GracefulShutdown timeout",
+			content:     `{"graceful_shutdown_timeout": -1}`,
+			expectError: true,
+		},
+		{
+			name:        "Negative power poll interval",
+			content:     `{"power_poll_interval": -5}`,
+			expectError: true,
+		},
+		{
+			name:    "metal3 compatibility",
+			content: `{"compatibility": "metal3"}`,
+		},
+		{
+			name:        "Unknown compatibility profile",
+			content:     `{"compatibility": "openshift"}`,
+			expectError: true,
+		},
+		{
+			name:        "Invalid JSON",
+			content:     `{`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "config.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := loadConfig(path)
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGPIOConfigApply(t *testing.T) {
+	gpio := GPIOConfig{Power: "gpiochip1:23", HDDLED: "gpiochip1:25"}
+	if gpio.complete() {
+		t.Error("Expected a map without reset and power LED to be incomplete")
+	}
+
+	hw := gpio.apply(HWBeta)
+	expect := HWBeta
+	expect.GPIOPower, expect.GPIOHDDLed = "gpiochip1:23", "gpiochip1:25"
+	if hw != expect {
+		t.Errorf("Expected %+v, got %+v", expect, hw)
+	}
+	if HWBeta.GPIOPower != "/sys/class/gpio/gpio503/value" {
+		t.Errorf("Expected the built-in profile unchanged, got %s", HWBeta.GPIOPower)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// crawlResources GETs every URI reachable from the service root through
+// @odata.id and action target links, once each, and calls visit with the
+// response.
+func crawlResources(handler http.Handler, visit func(path string, rr *httptest.ResponseRecorder)) {
+	seen := map[string]bool{"/redfish/v1": true}
+	queue := []string{"/redfish/v1"}
+	var links func(v interface{})
+	links = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				if path, ok := value.(string); ok && (key == "@odata.id" || key == "target" || key == "@Redfish.ActionInfo") &&
+					strings.HasPrefix(path, "/redfish/v1") && !strings.Contains(path, "#") && !seen[path] {
+					seen[path] = true
+					queue = append(queue, path)
+				}
+				links(value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				links(value)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		var resource interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resource)
+		links(resource)
+		visit(path, rr)
+	}
+}
+
+// TestResourceConformance checks what the Redfish Service Validator checks
+// of every resource before it gets to the schemas: that it is where its
+// @odata.id says, that $metadata resolves its @odata.type, and that it has
+// the properties and annotations every resource or collection must.
+func TestResourceConformance(t *testing.T) {
+	startFakeHost(t, false)
+	setupTaskStore(t)
+	setupSessionStore(t)
+	setupGPIOChips(t, nil, nil)
+	setupLUN(t)
+	events := setupEventService(t)
+	accounts := setupAccountStore(t)
+	oldConfig := currentConfig
+	defer func() { currentConfig = oldConfig }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	relay := filepath.Join(t.TempDir(), "relay")
+	os.WriteFile(relay, []byte("0\n"), 0644)
+	currentConfig.AuxGPIOs = []AuxGPIOConfig{{Name: "relay", GPIO: relay, Direction: "output"}}
+
+	if _, err := accounts.Create("admin", "admin-password", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := events.Create(EventSubscription{Destination: "http://127.0.0.1:9/events", Protocol: "Redfish"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessionStore.Create(&Principal{Username: "admin", RoleID: "Administrator"}); err != nil {
+		t.Fatal(err)
+	}
+	taskStore.Start("Conformance", func(task *task) { task.Finish(http.StatusOK, nil) })
+	handler := newHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", metadataPath, nil))
+	var metadata struct {
+		Includes []struct {
+			Namespace string `xml:"Namespace,attr"`
+		} `xml:"Reference>Include"`
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	included := map[string]bool{}
+	for _, include := range metadata.Includes {
+		included[include.Namespace] = true
+	}
+
+	crawlResources(handler, func(path string, rr *httptest.ResponseRecorder) {
+		if strings.Contains(path, "/Actions/") {
+			return
+		}
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, rr.Code)
+			return
+		}
+		var resource map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resource); err != nil {
+			t.Errorf("GET %s: expected JSON, got %q", path, rr.Body.String())
+			return
+		}
+
+		if resource["@odata.id"] != path {
+			t.Errorf("GET %s: @odata.id is %v", path, resource["@odata.id"])
+		}
+		odataType, _ := resource["@odata.type"].(string)
+		if i := strings.LastIndex(odataType, "."); i < 0 || !included[strings.TrimPrefix(odataType[:i], "#")] {
+			t.Errorf("GET %s: $metadata does not include the namespace of %q", path, odataType)
+		}
+		if _, ok := resource["Name"]; !ok {
+			t.Errorf("GET %s: no Name", path)
+		}
+		if context := odataContext(odataType); resource["@odata.context"] != context {
+			t.Errorf("GET %s: expected @odata.context %q, got %v", path, context, resource["@odata.context"])
+		}
+		if etag, _ := resource["@odata.etag"].(string); etag == "" {
+			t.Errorf("GET %s: no @odata.etag", path)
+		}
+		if members, collection := resource["Members"].([]interface{}); collection {
+			if count, _ := resource["Members@odata.count"].(float64); int(count) != len(members) {
+				t.Errorf("GET %s: Members@odata.count is %v for %d members", path, resource["Members@odata.count"], len(members))
+			}
+		} else if id, _ := resource["Id"].(string); id == "" || (path != "/redfish/v1" && id != path[strings.LastIndex(path, "/")+1:]) {
+			t.Errorf("GET %s: Id %q does not match the URI", path, id)
+		}
+	})
+}
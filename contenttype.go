@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// maxRequestBody bounds the bodies read into memory. The largest requests
+// the service takes, such as a PATCH of a whole resource, are a few
+// kilobytes.
+const maxRequestBody = 1 << 20
+
+// readRequestBody reads the body of r, refusing one larger than
+// maxRequestBody with 413. It writes the error response and returns false
+// if the body cannot be read.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeRedfishError(w, http.StatusRequestEntityTooLarge, newMessage("GeneralError"))
+		return nil, false
+	}
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return nil, false
+	}
+	return body, true
+}
+
+// withContentType refuses a POST, PATCH or PUT whose body is not JSON
+// with 415. An empty body needs no Content-Type and reaches the handler
+// as {}, so an action without parameters works either way and one with
+// parameters reports what is missing rather than malformed JSON.
+func withContentType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPatch && r.Method != http.MethodPut {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var ok bool
+			if body, ok = readRequestBody(w, r); !ok {
+				return
+			}
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			body = []byte("{}")
+		} else if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			writeRedfishError(w, http.StatusUnsupportedMediaType,
+				newOemMessage("UnsupportedMediaType", r.Header.Get("Content-Type"), "application/json"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
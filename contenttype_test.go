@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	startFakeHost(t, false)
+	oldConfig, oldAccounts := currentConfig, accountStore
+	defer func() { currentConfig, accountStore = oldConfig, oldAccounts }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	accountStore = nil
+	handler := newHandler()
+
+	resetPath := "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expectCode  int
+		expectID    string
+	}{
+		{"Plain text", "text/plain", `{"ResetType": "Bogus"}`, http.StatusUnsupportedMediaType, "NanoKVM.1.3.UnsupportedMediaType"},
+		{"No Content-Type", "", `{"ResetType": "Bogus"}`, http.StatusUnsupportedMediaType, "NanoKVM.1.3.UnsupportedMediaType"},
+		{"Form", "application/x-www-form-urlencoded", "ResetType=On", http.StatusUnsupportedMediaType, "NanoKVM.1.3.UnsupportedMediaType"},
+		{"JSON with charset", "application/json; charset=utf-8", `{"ResetType": "Bogus"}`, http.StatusBadRequest, "Base.1.8.ActionParameterValueNotInList"},
+		{"Empty body", "", "", http.StatusBadRequest, "Base.1.8.ActionParameterMissing"},
+		{"Too large", "application/json", `{"ResetType": "` + strings.Repeat("x", maxRequestBody) + `"}`, http.StatusRequestEntityTooLarge, "Base.1.8.GeneralError"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", resetPath, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			var body map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected a Redfish error body, got %q", rr.Body.String())
+			}
+			if body["error"].Code != tt.expectID {
+				t.Errorf("Expected %s, got %s", tt.expectID, body["error"].Code)
+			}
+		})
+	}
+}
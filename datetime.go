@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// setSystemClock sets the NanoKVM's clock to t and copies it to the RTC,
+// so it survives a reboot on boards that have one. A failure to write the
+// RTC is only logged.
+var setSystemClock = func(t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	if err := syscall.Settimeofday(&tv); err != nil {
+		return err
+	}
+	if output, err := runCommand(nil, "hwclock", "-w", "-u"); err != nil {
+		log.Printf("Failed to write the RTC: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+type ManagerPatchRequest struct {
+	DateTime *string `json:"DateTime,omitempty"`
+}
+
+// addManagerDateTime adds the NanoKVM's clock to the Manager, shown in the
+// configured timezone.
+func addManagerDateTime(manager map[string]interface{}) {
+	now := time.Now().In(displayLocation)
+	manager["DateTime"] = now.Format(time.RFC3339)
+	manager["DateTimeLocalOffset"] = now.Format("-07:00")
+}
+
+// handleManagerPatch sets the NanoKVM's clock, for devices without network
+// time. DateTimeLocalOffset follows the "timezone" in the config and is not
+// writable.
+func handleManagerPatch(w http.ResponseWriter, r *http.Request) {
+	var req ManagerPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkPreconditions(w, r, resourceETag(managerResource()), false) {
+		return
+	}
+	ignored, ok := checkPatchProperties(w, r, body, &req, handleManagerGet)
+	if !ok {
+		return
+	}
+
+	if req.DateTime != nil {
+		t, err := time.Parse(time.RFC3339, *req.DateTime)
+		if err != nil {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueFormatError", *req.DateTime, "DateTime").withProperty("#/DateTime"))
+			return
+		}
+		// ntpd would step the clock straight back.
+		if ntpEnabled() {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueConflict", "DateTime", "NTP/ProtocolEnabled").withProperty("#/DateTime"))
+			return
+		}
+		if err := setSystemClock(t); err != nil {
+			writeInternalError(w, "set the clock", err)
+			return
+		}
+		log.Printf("Clock set to %s", t.Format(time.RFC3339))
+		emitEvent("OK", fmt.Sprintf("NanoKVM clock set to %s", t.Format(time.RFC3339)),
+			resourceEventPrefix+"ResourceChanged", "/redfish/v1/Managers/BMC")
+	}
+
+	writePatchResult(w, r, ignored, handleManagerGet)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManagerDateTime(t *testing.T) {
+	oldClock, oldSettings := setSystemClock, ntpSettings
+	defer func() { setSystemClock, ntpSettings = oldClock, oldSettings }()
+	var set []time.Time
+	setSystemClock = func(t time.Time) error {
+		set = append(set, t)
+		return nil
+	}
+
+	rr := httptest.NewRecorder()
+	handleManager(rr, httptest.NewRequest("GET", "/redfish/v1/Managers/BMC", nil))
+	var manager struct {
+		DateTime            string
+		DateTimeLocalOffset string
+	}
+	json.Unmarshal(rr.Body.Bytes(), &manager)
+	if _, err := time.Parse(time.RFC3339, manager.DateTime); err != nil || manager.DateTimeLocalOffset == "" {
+		t.Errorf("Expected the manager's clock, got %q %q", manager.DateTime, manager.DateTimeLocalOffset)
+	}
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleManager(rr, httptest.NewRequest("PATCH", "/redfish/v1/Managers/BMC", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	ntpSettings = savedNTP{ProtocolEnabled: true}
+	if rr := patch(`{"DateTime": "2024-05-01T12:00:00+02:00"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 while NTP is on, got %d", rr.Code)
+	}
+	ntpSettings = savedNTP{}
+	if rr := patch(`{"DateTime": "yesterday"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed time, got %d", rr.Code)
+	}
+	if rr := patch(`{"DateTime": "2024-05-01T12:00:00+02:00"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(set) != 1 || !set[0].Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the clock set to 10:00 UTC, got %v", set)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// dnsTag marks the lines of resolv.conf the service wrote, the way the
+// NanoKVM's DHCP client marks its own with the interface name, so that
+// each only replaces its own lines.
+const dnsTag = "# nanokvm-redfish"
+
+// savedDNS is the static resolver configuration NetworkConfig.DNSFile
+// keeps. The device has a single resolver, so it is shared by every
+// interface.
+type savedDNS struct {
+	StaticNameServers []string `json:"StaticNameServers"`
+	SearchDomains     []string `json:"SearchDomains"`
+}
+
+var (
+	dnsMu       sync.Mutex
+	dnsSettings = savedDNS{StaticNameServers: []string{}, SearchDomains: []string{}}
+)
+
+var domainPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
+
+// loadDNS restores the static resolver configuration saved in
+// cfg.DNSFile.
+func loadDNS(cfg NetworkConfig) error {
+	dnsMu.Lock()
+	defer dnsMu.Unlock()
+	dnsSettings = savedDNS{StaticNameServers: []string{}, SearchDomains: []string{}}
+	if cfg.DNSFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(cfg.DNSFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", cfg.DNSFile, err)
+	}
+	if err := json.Unmarshal(content, &dnsSettings); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", cfg.DNSFile, err)
+	}
+	return nil
+}
+
+// writeResolvConf replaces the lines the service wrote to resolv.conf
+// with settings, ahead of the rest so that the static name servers are
+// asked before those from a DHCP lease.
+func writeResolvConf(path string, settings savedDNS) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var b bytes.Buffer
+	if len(settings.SearchDomains) > 0 {
+		fmt.Fprintf(&b, "search %s %s\n", strings.Join(settings.SearchDomains, " "), dnsTag)
+	}
+	for _, server := range settings.StaticNameServers {
+		fmt.Fprintf(&b, "nameserver %s %s\n", server, dnsTag)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if !strings.HasSuffix(scanner.Text(), dnsTag) {
+			b.WriteString(scanner.Text() + "\n")
+		}
+	}
+	return writeFileAtomic(path, b.Bytes(), 0o644)
+}
+
+// readNameServers returns the name servers the resolver uses, static or
+// not.
+func readNameServers(path string) []string {
+	servers := []string{}
+	readProcTable(path, func(fields []string) {
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	})
+	return servers
+}
+
+// applyDNS puts the saved resolver configuration back into resolv.conf
+// when the service starts, in case it was regenerated at boot.
+func applyDNS() {
+	dnsMu.Lock()
+	defer dnsMu.Unlock()
+	if len(dnsSettings.StaticNameServers) == 0 && len(dnsSettings.SearchDomains) == 0 {
+		return
+	}
+	if err := writeResolvConf(currentConfig.Network.ResolvConf, dnsSettings); err != nil {
+		log.Printf("Failed to write %s: %v", currentConfig.Network.ResolvConf, err)
+	}
+}
+
+// setDNS saves next and writes it to resolv.conf.
+func setDNS(next savedDNS) error {
+	dnsMu.Lock()
+	defer dnsMu.Unlock()
+	cfg := currentConfig.Network
+	if err := writeResolvConf(cfg.ResolvConf, next); err != nil {
+		return fmt.Errorf("failed to write %s: %w", cfg.ResolvConf, err)
+	}
+	if cfg.DNSFile != "" {
+		content, err := json.MarshalIndent(next, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(cfg.DNSFile, content, 0o600); err != nil {
+			return err
+		}
+	}
+	dnsSettings = next
+	return nil
+}
+
+// addDNSSettings adds the resolver configuration to the resource of a
+// configurable interface.
+func addDNSSettings(resource map[string]interface{}) {
+	dnsMu.Lock()
+	settings := dnsSettings
+	dnsMu.Unlock()
+	resource["NameServers"] = readNameServers(currentConfig.Network.ResolvConf)
+	resource["StaticNameServers"] = settings.StaticNameServers
+	nanoKVMOem(resource)["SearchDomains"] = settings.SearchDomains
+}
+
+// checkDNSPatch returns the resolver configuration req asks for, or nil
+// if it asks for no change. Empty entries are dropped, so [""] clears a
+// list. It writes an error and returns false if req is not valid.
+func checkDNSPatch(w http.ResponseWriter, req EthernetInterfacePatchRequest) (*savedDNS, bool) {
+	var domains []string
+	if req.Oem != nil && req.Oem.NanoKVM != nil {
+		domains = req.Oem.NanoKVM.SearchDomains
+	}
+	if req.StaticNameServers == nil && domains == nil {
+		return nil, true
+	}
+
+	dnsMu.Lock()
+	next := dnsSettings
+	dnsMu.Unlock()
+	if req.StaticNameServers != nil {
+		next.StaticNameServers = []string{}
+		for i, server := range req.StaticNameServers {
+			if server == "" {
+				continue
+			}
+			if net.ParseIP(server) == nil {
+				writeRedfishError(w, http.StatusBadRequest,
+					newMessage("PropertyValueFormatError", server, "StaticNameServers").
+						withProperty(fmt.Sprintf("#/StaticNameServers/%d", i)))
+				return nil, false
+			}
+			next.StaticNameServers = append(next.StaticNameServers, server)
+		}
+	}
+	if domains != nil {
+		next.SearchDomains = []string{}
+		for i, domain := range domains {
+			if domain == "" {
+				continue
+			}
+			if !domainPattern.MatchString(domain) {
+				writeRedfishError(w, http.StatusBadRequest,
+					newMessage("PropertyValueFormatError", domain, "SearchDomains").
+						withProperty(fmt.Sprintf("#/Oem/NanoKVM/SearchDomains/%d", i)))
+				return nil, false
+			}
+			next.SearchDomains = append(next.SearchDomains, domain)
+		}
+	}
+	return &next, true
+}
+
+// changeDNS puts the resolver configuration checkDNSPatch returned into
+// effect. It writes an error and returns false if it cannot.
+func changeDNS(w http.ResponseWriter, name string, next savedDNS) bool {
+	if err := setDNS(next); err != nil {
+		writeInternalError(w, "configure DNS", err)
+		return false
+	}
+	log.Printf("Name servers set to [%s], search domains to [%s]",
+		strings.Join(next.StaticNameServers, ", "), strings.Join(next.SearchDomains, ", "))
+	emitEvent("OK", fmt.Sprintf("Static name servers: %s; search domains: %s",
+		strings.Join(next.StaticNameServers, ", "), strings.Join(next.SearchDomains, ", ")),
+		resourceEventPrefix+"ResourceChanged", ethernetInterfacesPath+"/"+name)
+	return true
+}
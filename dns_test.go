@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEthernetInterfaceNameServers(t *testing.T) {
+	fakeNetSysfs(t, map[string]map[string]string{
+		"eth0": {"type": "1", "ifindex": "2", "flags": "0x1003", "carrier": "1"},
+		"usb0": {"type": "1", "ifindex": "3", "flags": "0x1003"},
+	})
+	dir := t.TempDir()
+	currentConfig.Network = NetworkConfig{
+		StaticFiles:    map[string]string{"eth0": filepath.Join(dir, "eth.nodhcp")},
+		StateFile:      filepath.Join(dir, "network.json"),
+		ConfirmTimeout: 60,
+		ResolvConf:     filepath.Join(dir, "resolv.conf"),
+		DNSFile:        filepath.Join(dir, "dns.json"),
+	}
+	// As the DHCP client leaves it.
+	leased := "nameserver 192.168.1.1 # eth0\n"
+	if err := os.WriteFile(currentConfig.Network.ResolvConf, []byte(leased), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadDNS(currentConfig.Network); err != nil {
+		t.Fatal(err)
+	}
+	defer loadDNS(NetworkConfig{})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handleEthernetInterfaces(rr, req)
+		return rr
+	}
+	eth0 := ethernetInterfacesPath + "/eth0"
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"bad name server", `{"StaticNameServers": ["dns.example.com"]}`, http.StatusBadRequest},
+		{"bad search domain", `{"Oem": {"NanoKVM": {"SearchDomains": ["bad domain"]}}}`, http.StatusBadRequest},
+		{"set", `{"StaticNameServers": ["9.9.9.9", "", "2620:fe::fe"], "Oem": {"NanoKVM": {"SearchDomains": ["example.com"]}}}`, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if rr := do("PATCH", eth0, tt.body); rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	content, _ := os.ReadFile(currentConfig.Network.ResolvConf)
+	want := "search example.com # nanokvm-redfish\n" +
+		"nameserver 9.9.9.9 # nanokvm-redfish\n" +
+		"nameserver 2620:fe::fe # nanokvm-redfish\n" + leased
+	if string(content) != want {
+		t.Errorf("Expected resolv.conf\n%s\ngot\n%s", want, content)
+	}
+
+	var resource struct {
+		NameServers       []string
+		StaticNameServers []string
+		Oem               struct {
+			NanoKVM struct{ SearchDomains []string }
+		}
+	}
+	json.Unmarshal(do("GET", eth0, "").Body.Bytes(), &resource)
+	if len(resource.NameServers) != 3 || resource.NameServers[2] != "192.168.1.1" ||
+		len(resource.StaticNameServers) != 2 || len(resource.Oem.NanoKVM.SearchDomains) != 1 {
+		t.Errorf("Expected the name servers served, got %+v", resource)
+	}
+
+	// The settings survive a restart, and clearing them leaves the DHCP
+	// client's lines alone.
+	if err := loadDNS(currentConfig.Network); err != nil {
+		t.Fatal(err)
+	}
+	if dnsSettings.StaticNameServers[0] != "9.9.9.9" {
+		t.Errorf("Expected the name servers reloaded, got %v", dnsSettings.StaticNameServers)
+	}
+	if rr := do("PATCH", eth0, `{"StaticNameServers": [""], "Oem": {"NanoKVM": {"SearchDomains": []}}}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected the name servers cleared, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if content, _ := os.ReadFile(currentConfig.Network.ResolvConf); string(content) != leased {
+		t.Errorf("Expected only the leased name server left, got\n%s", content)
+	}
+
+	// A PATCH refused for its addressing leaves the name servers alone.
+	mixed := []struct {
+		name    string
+		pending bool
+		body    string
+		want    int
+	}{
+		{"bad address", false, `{"StaticNameServers": ["9.9.9.9"], "DHCPv4": {"DHCPEnabled": false},
+			"IPv4StaticAddresses": [{"Address": "192.168.1.300", "SubnetMask": "255.255.255.0"}]}`, http.StatusBadRequest},
+		{"change pending", true, `{"StaticNameServers": ["9.9.9.9"], "DHCPv4": {"DHCPEnabled": true}}`, http.StatusConflict},
+	}
+	for _, tt := range mixed {
+		networkPending = nil
+		if tt.pending {
+			networkPending = &pendingNetworkChange{Interface: "eth0"}
+		}
+		if rr := do("PATCH", eth0, tt.body); rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body.String())
+		}
+		if content, _ := os.ReadFile(currentConfig.Network.ResolvConf); string(content) != leased {
+			t.Errorf("%s: expected resolv.conf unchanged, got\n%s", tt.name, content)
+		}
+		if len(dnsSettings.StaticNameServers) != 0 {
+			t.Errorf("%s: expected no static name servers, got %v", tt.name, dnsSettings.StaticNameServers)
+		}
+	}
+	networkPending = nil
+
+	// Only configurable interfaces have them.
+	if rr := do("PATCH", ethernetInterfacesPath+"/usb0", `{"StaticNameServers": ["9.9.9.9"]}`); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for usb0, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// dryRunHeader asks for a dry run on any action without changing its body.
+const dryRunHeader = "X-NanoKVM-Dry-Run"
+
+// ActionOem carries NanoKVM-specific action parameters.
+type ActionOem struct {
+	NanoKVM struct {
+		// DryRun validates the request and reports what the action would
+		// do without touching the hardware.
+		DryRun bool `json:"DryRun"`
+
+		// LocalPath names an image already on the SD card for
+		// VirtualMedia.InsertMedia, in place of Image.
+		LocalPath string `json:"LocalPath,omitempty"`
+
+		// Checksum is the hex digest InsertMedia checks the image against
+		// before attaching it, using ChecksumAlgorithm (SHA256 if unset).
+		Checksum          string `json:"Checksum,omitempty"`
+		ChecksumAlgorithm string `json:"ChecksumAlgorithm,omitempty"`
+
+		// PressDurations overrides the board's button press lengths for
+		// ComputerSystem.Reset.
+		PressDurations *PressDurations `json:"PressDurations,omitempty"`
+	} `json:"NanoKVM"`
+}
+
+// DryRunReport is returned instead of performing an action.
+type DryRunReport struct {
+	DryRun       bool              `json:"DryRun"`
+	Action       string            `json:"Action"`
+	Parameters   map[string]string `json:"Parameters"`
+	CurrentState map[string]string `json:"CurrentState"`
+	// WouldPerform lists the hardware operations, in order. It is empty
+	// when the action would be a no-op in the current state.
+	WouldPerform []string `json:"WouldPerform"`
+}
+
+func dryRunRequested(r *http.Request, oem *ActionOem) bool {
+	if oem != nil && oem.NanoKVM.DryRun {
+		return true
+	}
+	requested, _ := strconv.ParseBool(r.Header.Get(dryRunHeader))
+	return requested
+}
+
+func writeDryRunReport(w http.ResponseWriter, report DryRunReport) {
+	report.DryRun = true
+	if report.WouldPerform == nil {
+		report.WouldPerform = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
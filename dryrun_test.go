@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResetDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	gpioPower := filepath.Join(tmpDir, "gpio_power")
+	gpioReset := filepath.Join(tmpDir, "gpio_reset")
+	gpioPowerLED := filepath.Join(tmpDir, "gpio_power_led")
+	for _, path := range []string{gpioPower, gpioReset} {
+		if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Power LED is inverted: 0 means the host is on.
+	if err := os.WriteFile(gpioPowerLED, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldHardware := currentHardware
+	currentHardware = &Hardware{
+		GPIOPower:    gpioPower,
+		GPIOReset:    gpioReset,
+		GPIOPowerLED: gpioPowerLED,
+	}
+	defer func() { currentHardware = oldHardware }()
+	// An earlier test's reset may still be waiting for the LED.
+	primarySystem.setPowerTransition("")
+
+	tests := []struct {
+		name         string
+		body         string
+		header       string
+		expectCode   int
+		expectAction []string
+	}{
+		{
+			name:         "ForceRestart via Oem",
+			body:         `{"ResetType": "ForceRestart", "Oem": {"NanoKVM": {"DryRun": true}}}`,
+			expectCode:   http.StatusOK,
+			expectAction: []string{"Press reset button for 800 ms"},
+		},
+		{
+			name:         "ForceOff via header",
+			body:         `{"ResetType": "ForceOff"}`,
+			header:       "true",
+			expectCode:   http.StatusOK,
+			expectAction: []string{"Hold power button for 1000 ms"},
+		},
+		{
+			name:         "On when already on",
+			body:         `{"ResetType": "On"}`,
+			header:       "1",
+			expectCode:   http.StatusOK,
+			expectAction: []string{},
+		},
+		{
+			name:         "ForceOff with a longer hold",
+			body:         `{"ResetType": "ForceOff", "Oem": {"NanoKVM": {"DryRun": true, "PressDurations": {"LongPressMs": 6000}}}}`,
+			expectCode:   http.StatusOK,
+			expectAction: []string{"Hold power button for 6000 ms"},
+		},
+		{
+			name:       "Press too long",
+			body:       `{"ResetType": "ForceRestart", "Oem": {"NanoKVM": {"DryRun": true, "PressDurations": {"ResetMs": 60000}}}}`,
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid reset type",
+			body:       `{"ResetType": "Invalid", "Oem": {"NanoKVM": {"DryRun": true}}}`,
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", bytes.NewBufferString(tt.body))
+			if tt.header != "" {
+				req.Header.Set(dryRunHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handleReset(rr, req, primarySystem)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			for _, path := range []string{gpioPower, gpioReset} {
+				if content, _ := os.ReadFile(path); string(content) != "1" {
+					t.Errorf("Dry run wrote %q to %s", content, filepath.Base(path))
+				}
+			}
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+
+			var report DryRunReport
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if !report.DryRun || report.Action != "ComputerSystem.Reset" {
+				t.Errorf("Unexpected report header: %+v", report)
+			}
+			if report.CurrentState["PowerState"] != "On" {
+				t.Errorf("Expected current PowerState On, got %q", report.CurrentState["PowerState"])
+			}
+			if !reflect.DeepEqual(report.WouldPerform, tt.expectAction) {
+				t.Errorf("Expected WouldPerform %v, got %v", tt.expectAction, report.WouldPerform)
+			}
+		})
+	}
+}
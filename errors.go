@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const baseRegistryPrefix = "Base.1.8."
+
+type MessageInfo struct {
+	ODataType         string   `json:"@odata.type"`
+	MessageID         string   `json:"MessageId"`
+	Message           string   `json:"Message"`
+	MessageArgs       []string `json:"MessageArgs"`
+	Severity          string   `json:"Severity"`
+	Resolution        string   `json:"Resolution"`
+	RelatedProperties []string `json:"RelatedProperties,omitempty"`
+}
+
+type messageDefinition struct {
+	Message    string
+	Severity   string
+	Resolution string
+}
+
+// baseMessages is the subset of the DMTF Base registry used by this service.
+var baseMessages = map[string]messageDefinition{
+	"AccessDenied": {
+		Message:    "While attempting to establish a connection to %1, the service denied access.",
+		Severity:   "Critical",
+		Resolution: "Attempt to ensure that the URI is correct and that the service has the appropriate credentials.",
+	},
+	"ActionNotSupported": {
+		Message:    "The action %1 is not supported by the resource.",
+		Severity:   "Critical",
+		Resolution: "The action supplied cannot be resubmitted to the implementation. Perhaps the action was invalid, the wrong resource was the target or the implementation documentation may be of assistance.",
+	},
+	"ActionParameterMissing": {
+		Message:    "The action %1 requires the parameter %2 to be present in the request body.",
+		Severity:   "Critical",
+		Resolution: "Supply the action with the required parameter in the request body when the request is resubmitted.",
+	},
+	"ActionParameterNotSupported": {
+		Message:    "The parameter %1 for the action %2 is not supported on the target resource.",
+		Severity:   "Warning",
+		Resolution: "Remove the parameter supplied and resubmit the request if the operation failed.",
+	},
+	"ActionParameterUnknown": {
+		Message:    "The action %1 was submitted with the invalid parameter %2.",
+		Severity:   "Warning",
+		Resolution: "Correct the invalid parameter and resubmit the request if the operation failed.",
+	},
+	"ActionParameterValueFormatError": {
+		Message:    "The value %1 for the parameter %2 in the action %3 is of a different format than the parameter can accept.",
+		Severity:   "Warning",
+		Resolution: "Correct the value for the parameter in the request body and resubmit the request if the operation failed.",
+	},
+	"ActionParameterValueNotInList": {
+		Message:    "The value %1 for the parameter %2 in the action %3 is not in the list of acceptable values.",
+		Severity:   "Warning",
+		Resolution: "Choose a value from the enumeration list that the implementation can support and resubmit the request if the operation failed.",
+	},
+	"CouldNotEstablishConnection": {
+		Message:    "The service failed to establish a connection with the URI %1.",
+		Severity:   "Critical",
+		Resolution: "Ensure that the URI contains a valid and reachable node name, protocol information and other URI components.",
+	},
+	"GeneralError": {
+		Message:    "A general error has occurred. See Resolution for information on how to resolve the error, or if Resolution is not provided, see ExtendedInfo for more information.",
+		Severity:   "Critical",
+		Resolution: "None.",
+	},
+	"InsufficientPrivilege": {
+		Message:    "There are insufficient privileges for the account or credentials associated with the current session to perform the requested operation.",
+		Severity:   "Critical",
+		Resolution: "Either abandon the operation or change the associated access rights and resubmit the request if the operation failed.",
+	},
+	"InternalError": {
+		Message:    "The request failed due to an internal service error. The service is still operational.",
+		Severity:   "Critical",
+		Resolution: "Resubmit the request. If the problem persists, consider resetting the service.",
+	},
+	"InvalidObject": {
+		Message:    "The object at %1 is invalid.",
+		Severity:   "Critical",
+		Resolution: "Either the object is malformed or the URI is not correct.  Correct the condition and resubmit the request if it failed.",
+	},
+	"MalformedJSON": {
+		Message:    "The request body submitted was malformed JSON and could not be parsed by the receiving service.",
+		Severity:   "Critical",
+		Resolution: "Ensure that the request body is valid JSON and resubmit the request.",
+	},
+	"NoValidSession": {
+		Message:    "There is no valid session established with the implementation.",
+		Severity:   "Critical",
+		Resolution: "Establish a session before attempting any operations.",
+	},
+	"PreconditionFailed": {
+		Message:    "The ETag supplied did not match the ETag required to change this resource.",
+		Severity:   "Critical",
+		Resolution: "Try the operation again using the appropriate ETag.",
+	},
+	"PropertyMissing": {
+		Message:    "The property %1 is a required property and must be included in the request.",
+		Severity:   "Warning",
+		Resolution: "Ensure that the property is in the request body and has a valid value and resubmit the request if the operation failed.",
+	},
+	"PropertyNotWritable": {
+		Message:    "The property %1 is a read only property and cannot be assigned a value.",
+		Severity:   "Warning",
+		Resolution: "Remove the property from the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyUnknown": {
+		Message:    "The property %1 is not in the list of valid properties for the resource.",
+		Severity:   "Warning",
+		Resolution: "Remove the unknown property from the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyValueIncorrect": {
+		Message:    "The property %1 with the requested value of %2 could not be written because the value does not meet the constraints of the implementation.",
+		Severity:   "Warning",
+		Resolution: "No resolution is required.",
+	},
+	"PropertyValueConflict": {
+		Message:    "The property %1 could not be written because its value would conflict with the value of the %2 property.",
+		Severity:   "Warning",
+		Resolution: "No resolution is required.",
+	},
+	"PropertyValueFormatError": {
+		Message:    "The value %1 for the property %2 is of a different format than the property can accept.",
+		Severity:   "Warning",
+		Resolution: "Correct the value for the property in the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyValueNotInList": {
+		Message:    "The value %1 for the property %2 is not in the list of acceptable values.",
+		Severity:   "Warning",
+		Resolution: "Choose a value from the enumeration list that the implementation can support and resubmit the request if the operation failed.",
+	},
+	"QueryParameterOutOfRange": {
+		Message:    "The value %1 for the query parameter %2 is out of range %3.",
+		Severity:   "Warning",
+		Resolution: "Reduce the value for the query parameter to a value that is within range, such as a start or count value that is within bounds of the number of resources in a collection or a page that is within the range of valid pages.",
+	},
+	"QueryParameterValueFormatError": {
+		Message:    "The value %1 for the parameter %2 is of a different format than the parameter can accept.",
+		Severity:   "Warning",
+		Resolution: "Correct the value for the query parameter in the request and resubmit the request if the operation failed.",
+	},
+	"QueryParameterValueTypeError": {
+		Message:    "The value %1 for the query parameter %2 is of a different type than the parameter can accept.",
+		Severity:   "Warning",
+		Resolution: "Correct the value for the query parameter in the request and resubmit the request if the operation failed.",
+	},
+	"ResourceAtUriUnauthorized": {
+		Message:    "While accessing the resource at %1, the service received an authorization error %2.",
+		Severity:   "Critical",
+		Resolution: "Ensure that the appropriate access is provided for the service in order for it to access the URI.",
+	},
+	"ResourceExhaustion": {
+		Message:    "The resource %1 was unable to satisfy the request due to unavailability of resources.",
+		Severity:   "Critical",
+		Resolution: "Ensure that the resources are available and resubmit the request.",
+	},
+	"ResourceInStandby": {
+		Message:    "The request could not be performed because the resource is in standby.",
+		Severity:   "Critical",
+		Resolution: "Ensure that the resource is in the correct power state and resubmit the request.",
+	},
+	"ResourceInUse": {
+		Message:    "The change to the requested resource failed because the resource is in use or in transition.",
+		Severity:   "Warning",
+		Resolution: "Remove the condition and resubmit the request if the operation failed.",
+	},
+	"ResourceMissingAtURI": {
+		Message:    "The resource at the URI %1 was not found.",
+		Severity:   "Critical",
+		Resolution: "Place a valid resource at the URI or correct the URI and resubmit the request.",
+	},
+	"ServiceTemporarilyUnavailable": {
+		Message:    "The service is temporarily unavailable. Retry in %1 seconds.",
+		Severity:   "Critical",
+		Resolution: "Wait for the indicated retry duration and retry the operation.",
+	},
+	"ResourceAlreadyExists": {
+		Message:    "The requested resource of type %1 with the property %2 with the value %3 already exists.",
+		Severity:   "Critical",
+		Resolution: "Do not repeat the create operation as the resource has already been created.",
+	},
+	"Success": {
+		Message:    "The request completed successfully.",
+		Severity:   "OK",
+		Resolution: "None",
+	},
+}
+
+// newMessage builds an extended info entry from the Base registry,
+// substituting %1, %2, ... with args.
+func newMessage(id string, args ...string) MessageInfo {
+	return registryMessage(baseRegistryPrefix, baseMessages[id], id, args...)
+}
+
+// newOemMessage builds an extended info entry from the NanoKVM registry.
+func newOemMessage(id string, args ...string) MessageInfo {
+	return registryMessage(oemRegistryPrefix, oemMessages[id], id, args...)
+}
+
+func registryMessage(prefix string, def messageDefinition, id string, args ...string) MessageInfo {
+	text := def.Message
+	for i := len(args); i > 0; i-- {
+		text = strings.ReplaceAll(text, "%"+strconv.Itoa(i), args[i-1])
+	}
+	if args == nil {
+		args = []string{}
+	}
+	return MessageInfo{
+		ODataType:   odataType("Message"),
+		MessageID:   prefix + id,
+		Message:     text,
+		MessageArgs: args,
+		Severity:    def.Severity,
+		Resolution:  def.Resolution,
+	}
+}
+
+// withProperty marks the JSON pointer of the property a message relates to.
+func (m MessageInfo) withProperty(pointer string) MessageInfo {
+	m.RelatedProperties = append(m.RelatedProperties, pointer)
+	return m
+}
+
+type redfishErrorBody struct {
+	Code         string        `json:"code"`
+	Message      string        `json:"message"`
+	ExtendedInfo []MessageInfo `json:"@Message.ExtendedInfo"`
+}
+
+// writeNotFound rejects a request for a resource that does not exist.
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeRedfishError(w, http.StatusNotFound, newMessage("ResourceMissingAtURI", r.URL.Path))
+}
+
+// checkResourcePath reports whether the request is for the resource at
+// path, with or without a trailing slash, and writes a 404 otherwise. A
+// handler registered for a subtree calls it so an unknown child is not
+// served as its parent.
+func checkResourcePath(w http.ResponseWriter, r *http.Request, path string) bool {
+	if strings.TrimSuffix(r.URL.Path, "/") != path {
+		writeNotFound(w, r)
+		return false
+	}
+	return true
+}
+
+// checkMethod rejects r with 405 unless its method is one of allowed.
+func checkMethod(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	for _, method := range allowed {
+		if r.Method == method {
+			return true
+		}
+	}
+	writeMethodNotAllowed(w, r, allowed...)
+	return false
+}
+
+// writeMethodNotAllowed rejects a method the resource does not support,
+// listing the methods it does in the Allow header. OPTIONS is answered
+// for every resource by withOptions.
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+	writeRedfishError(w, http.StatusMethodNotAllowed, newOemMessage("MethodNotAllowed", r.Method, r.URL.Path))
+}
+
+// writeInternalError logs a failure the client cannot do anything about
+// and reports it as InternalError.
+func writeInternalError(w http.ResponseWriter, what string, err error) {
+	log.Printf("Failed to %s: %v", what, err)
+	writeRedfishError(w, http.StatusInternalServerError, newMessage("InternalError"))
+}
+
+// writeServiceNotEnabled rejects a request to a service turned off in the
+// configuration. Callers check the method first, so a method the resource
+// never supports is still reported as such.
+func writeServiceNotEnabled(w http.ResponseWriter, service string) {
+	writeRedfishError(w, http.StatusServiceUnavailable, newOemMessage("ServiceNotEnabled", service))
+}
+
+// checkActionParameters rejects an action body carrying a parameter that
+// the action's request struct req has no field for, so a misspelt
+// parameter fails instead of being ignored. Annotations such as
+// @Redfish.OperationApplyTime are left to the handler.
+func checkActionParameters(w http.ResponseWriter, body []byte, action string, req interface{}) bool {
+	var params map[string]json.RawMessage
+	if len(body) == 0 || json.Unmarshal(body, &params) != nil {
+		return true
+	}
+	known := jsonFields(reflect.TypeOf(req))
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := known[name]; !ok && !strings.Contains(name, "@") {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("ActionParameterUnknown", action, name).withProperty("#/"+name))
+			return false
+		}
+	}
+	return true
+}
+
+// writeRedfishError sends a Redfish extended error response. The top-level
+// code and message are taken from the first message.
+func writeRedfishError(w http.ResponseWriter, status int, messages ...MessageInfo) {
+	if len(messages) == 0 {
+		messages = []MessageInfo{newMessage("GeneralError")}
+	}
+
+	body := map[string]redfishErrorBody{
+		"error": {
+			Code:         messages[0].MessageID,
+			Message:      messages[0].Message,
+			ExtendedInfo: messages,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewMessage(t *testing.T) {
+	msg := newMessage("PropertyValueNotInList", "Bogus", "RoleId")
+
+	if msg.MessageID != "Base.1.8.PropertyValueNotInList" {
+		t.Errorf("Unexpected MessageId %s", msg.MessageID)
+	}
+	expected := "The value Bogus for the property RoleId is not in the list of acceptable values."
+	if msg.Message != expected {
+		t.Errorf("Expected message %q, got %q", expected, msg.Message)
+	}
+	if len(msg.MessageArgs) != 2 {
+		t.Errorf("Expected 2 MessageArgs, got %d", len(msg.MessageArgs))
+	}
+}
+
+func TestWriteRedfishError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeRedfishError(rr, http.StatusBadRequest,
+		newMessage("PropertyMissing", "UserName").withProperty("#/UserName"),
+		newMessage("PropertyMissing", "Password").withProperty("#/Password"))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", ct)
+	}
+
+	var body map[string]redfishErrorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	e := body["error"]
+	if e.Code != "Base.1.8.PropertyMissing" {
+		t.Errorf("Expected code from first message, got %s", e.Code)
+	}
+	if len(e.ExtendedInfo) != 2 || e.ExtendedInfo[1].RelatedProperties[0] != "#/Password" {
+		t.Errorf("Unexpected extended info: %+v", e.ExtendedInfo)
+	}
+}
+
+func TestErrorBodies(t *testing.T) {
+	startFakeHost(t, false)
+	oldConfig, oldAccounts := currentConfig, accountStore
+	defer func() { currentConfig, accountStore = oldConfig, oldAccounts }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	accountStore = nil
+	handler := newHandler()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		expectCode int
+		expectID   string
+	}{
+		{"Method not allowed", "DELETE", "/redfish/v1/Managers/BMC", "", http.StatusMethodNotAllowed, oemRegistryPrefix + "MethodNotAllowed"},
+		{"Unknown system", "GET", "/redfish/v1/Systems/DoesNotExist", "", http.StatusNotFound, "Base.1.8.ResourceMissingAtURI"},
+		{"Unknown system child", "GET", "/redfish/v1/Systems/System.1/Bogus", "", http.StatusNotFound, "Base.1.8.ResourceMissingAtURI"},
+		{"Unknown manager child", "GET", "/redfish/v1/Managers/BMC/Bogus", "", http.StatusNotFound, "Base.1.8.ResourceMissingAtURI"},
+		{"Unknown root child", "GET", "/redfish/v1/Bogus", "", http.StatusNotFound, "Base.1.8.ResourceMissingAtURI"},
+		{"Outside the service", "GET", "/bogus", "", http.StatusNotFound, "Base.1.8.ResourceMissingAtURI"},
+		{"Missing log entry", "GET", logServicesPath + "/Log/Entries/999999", "", http.StatusNotFound, "Base.1.8.ResourceMissingAtURI"},
+		{"Service not enabled", "GET", accountServicePath + "/Accounts", "", http.StatusServiceUnavailable, oemRegistryPrefix + "ServiceNotEnabled"},
+		{"Malformed action body", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", `{"ResetType":`, http.StatusBadRequest, "Base.1.8.MalformedJSON"},
+		{"Unknown ResetType", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", `{"ResetType": "Explode"}`, http.StatusBadRequest, "Base.1.8.ActionParameterValueNotInList"},
+		{"Unknown parameter", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", `{"ResetType": "On", "Force": true}`, http.StatusBadRequest, "Base.1.8.ActionParameterUnknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			var body map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected a Redfish error body, got %q", rr.Body.String())
+			}
+			if body["error"].Code != tt.expectID {
+				t.Errorf("Expected %s, got %s", tt.expectID, body["error"].Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystemETag(t *testing.T) {
+	startFakeHost(t, false)
+	oldBoot := currentBootConfig
+	defer func() { currentBootConfig = oldBoot }()
+
+	get := func() (string, ComputerSystem) {
+		rr := httptest.NewRecorder()
+		handleSystemGet(rr, httptest.NewRequest("GET", "/redfish/v1/Systems/System.1", nil), primarySystem)
+		var system ComputerSystem
+		if err := json.Unmarshal(rr.Body.Bytes(), &system); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("ETag"), system
+	}
+
+	etag, system := get()
+	if etag == "" || etag != system.ODataEtag {
+		t.Fatalf("Expected the ETag header to match @odata.etag, got %q and %q", etag, system.ODataEtag)
+	}
+	if again, _ := get(); again != etag {
+		t.Errorf("Expected the etag to be stable, got %q then %q", etag, again)
+	}
+
+	if rr := patchSystem(t, `{"Boot": {"BootSourceOverrideTarget": "Cd"}}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	if changed, _ := get(); changed == etag {
+		t.Errorf("Expected the etag to change with the boot override, still %q", etag)
+	}
+}
+
+func TestPatchIfMatch(t *testing.T) {
+	oldBoot, oldConfig := currentBootConfig, currentConfig
+	defer func() { currentBootConfig, currentConfig = oldBoot, oldConfig }()
+
+	const bootPatch = `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`
+	const profilePatch = `{"Oem": {"NanoKVM": {"BootProfile": "generic-uefi"}}}`
+	tests := []struct {
+		name          string
+		compatibility string
+		ifMatch       func(current string) string
+		body          string
+		expectCode    int
+	}{
+		{"No If-Match", "", func(string) string { return "" }, bootPatch, http.StatusNoContent},
+		{"Current etag", "", func(current string) string { return current }, bootPatch, http.StatusNoContent},
+		{"Weak current etag", "", func(current string) string { return "W/" + current }, bootPatch, http.StatusNoContent},
+		{"Any", "", func(string) string { return "*" }, bootPatch, http.StatusNoContent},
+		{"Stale etag", "", func(string) string { return `"0000"` }, bootPatch, http.StatusPreconditionFailed},
+		{"Stale etag, metal3", "metal3", func(string) string { return `"0000"` }, bootPatch, http.StatusNoContent},
+		{"Stale etag, metal3, not Boot", "metal3", func(string) string { return `"0000"` }, profilePatch, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentBootConfig = oldBoot
+			currentBootConfig.BootSourceOverrideTarget = "None"
+			currentConfig.Compatibility = tt.compatibility
+
+			req := httptest.NewRequest("PATCH", "/redfish/v1/Systems/System.1", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if value := tt.ifMatch(systemETag(primarySystem)); value != "" {
+				req.Header.Set("If-Match", value)
+			}
+			rr := httptest.NewRecorder()
+			handleSystemPatch(rr, req, primarySystem)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectCode != http.StatusPreconditionFailed {
+				return
+			}
+			var body map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["error"].Code != "Base.1.8.PreconditionFailed" {
+				t.Errorf("Expected PreconditionFailed, got %s", body["error"].Code)
+			}
+			if currentBootConfig.BootSourceOverrideTarget != "None" {
+				t.Errorf("Expected the override unchanged, got %s", currentBootConfig.BootSourceOverrideTarget)
+			}
+		})
+	}
+}
+
+func TestResourceETags(t *testing.T) {
+	store := setupAccountStore(t)
+	account, err := store.Create("ironic", "ironic-password", "Operator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newHandler()
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("GET", "/redfish/v1/Managers/BMC", "")
+	var manager map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &manager); err != nil {
+		t.Fatal(err)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" || manager["@odata.etag"] != etag {
+		t.Fatalf("Expected the manager's ETag header to match @odata.etag, got %q and %v", etag, manager["@odata.etag"])
+	}
+	// The etag leaves out the clock, so the current one still gets a body
+	// with the time now.
+	if rr := do("GET", "/redfish/v1/Managers/BMC", "", "If-None-Match", etag); rr.Code != http.StatusOK || rr.Header().Get("ETag") != etag {
+		t.Errorf("Expected 200 with the same etag, got %d with %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	path := accountPath(account.ID)
+	etag = do("GET", path, "").Header().Get("ETag")
+	tests := []struct {
+		name       string
+		header     []string
+		expectCode int
+	}{
+		{"Stale If-Match", []string{"If-Match", `"0000"`}, http.StatusPreconditionFailed},
+		{"Current If-None-Match", []string{"If-None-Match", etag}, http.StatusPreconditionFailed},
+		{"Any If-None-Match", []string{"If-None-Match", "*"}, http.StatusPreconditionFailed},
+		{"Current If-Match", []string{"If-Match", etag}, http.StatusOK},
+		// The role change above moved the etag on.
+		{"Reused If-Match", []string{"If-Match", etag}, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do("PATCH", path, `{"RoleId": "ReadOnly"}`, tt.header...)
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if updated, _ := store.Get(account.ID); updated.RoleID != "ReadOnly" {
+		t.Errorf("Expected only the current If-Match to apply, got role %s", updated.RoleID)
+	}
+}
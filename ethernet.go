@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const ethernetInterfacesPath = "/redfish/v1/Managers/BMC/EthernetInterfaces"
+
+var (
+	netSysfsDir = "/sys/class/net"
+	procNetDir  = "/proc/net"
+)
+
+// arphrdEther is the sysfs type of an Ethernet-like interface, wired,
+// Wi-Fi or USB gadget, as opposed to the loopback or a tunnel.
+const arphrdEther = 1
+
+// interfaceAddress is an address assigned to a network interface, as
+// netlink reports it.
+type interfaceAddress struct {
+	IP           net.IP
+	PrefixLength int
+	// Permanent is set for an address without a lifetime, that is not
+	// leased from a DHCP server or autoconfigured.
+	Permanent bool
+}
+
+// readInterfaceAddresses returns the addresses of every network interface,
+// by interface index.
+var readInterfaceAddresses = func() (map[int][]interfaceAddress, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+	addresses := map[int][]interfaceAddress{}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		// struct ifaddrmsg: family, prefix length, flags, scope, index.
+		addr := interfaceAddress{
+			PrefixLength: int(m.Data[1]),
+			Permanent:    m.Data[2]&syscall.IFA_F_PERMANENT != 0,
+		}
+		index := int(binary.NativeEndian.Uint32(m.Data[4:8]))
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.IFA_ADDRESS:
+				if addr.IP == nil {
+					addr.IP = net.IP(attr.Value)
+				}
+			case syscall.IFA_LOCAL:
+				// The local end of a point-to-point link.
+				addr.IP = net.IP(attr.Value)
+			}
+		}
+		if addr.IP != nil {
+			addresses[index] = append(addresses[index], addr)
+		}
+	}
+	return addresses, nil
+}
+
+// readNetAttr returns an attribute of a network interface from sysfs, or
+// "" if it cannot be read, as happens for the speed of a link that is down.
+func readNetAttr(name, attr string) string {
+	content, err := os.ReadFile(filepath.Join(netSysfsDir, name, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// managerInterfaceNames returns the NanoKVM's Ethernet-like interfaces,
+// sorted by name.
+func managerInterfaceNames() []string {
+	entries, err := os.ReadDir(netSysfsDir)
+	if err != nil {
+		log.Printf("Failed to list network interfaces: %v", err)
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if readNetAttr(entry.Name(), "type") == strconv.Itoa(arphrdEther) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isManagerInterface(name string) bool {
+	return containsString(managerInterfaceNames(), name)
+}
+
+// defaultGateways returns the IPv4 and IPv6 default gateways of an
+// interface from the kernel's routing tables, or "" for none.
+func defaultGateways(name string) (string, string) {
+	var ipv4, ipv6 string
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ..., with the
+	// addresses in hex in host byte order.
+	readProcTable(filepath.Join(procNetDir, "route"), func(fields []string) {
+		if ipv4 != "" || len(fields) < 8 || fields[0] != name || fields[1] != "00000000" || fields[7] != "00000000" {
+			return
+		}
+		gateway, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gateway == 0 {
+			return
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.NativeEndian.PutUint32(ip, uint32(gateway))
+		ipv4 = ip.String()
+	})
+	// Destination PrefixLength Source PrefixLength NextHop Metric RefCnt
+	// Use Flags Iface, with the addresses in hex in network byte order.
+	readProcTable(filepath.Join(procNetDir, "ipv6_route"), func(fields []string) {
+		if ipv6 != "" || len(fields) < 10 || fields[9] != name || fields[1] != "00" ||
+			strings.Trim(fields[0], "0") != "" {
+			return
+		}
+		nextHop, err := hex.DecodeString(fields[4])
+		if err != nil || len(nextHop) != net.IPv6len || net.IP(nextHop).IsUnspecified() {
+			return
+		}
+		ipv6 = net.IP(nextHop).String()
+	})
+	return ipv4, ipv6
+}
+
+// readProcTable calls row with the fields of each line of a /proc table.
+// A missing table, as on a kernel without IPv6, has no rows.
+func readProcTable(path string, row func(fields []string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		row(strings.Fields(scanner.Text()))
+	}
+}
+
+// ipv4Origin is the Redfish AddressOrigin of an IPv4 address on an
+// interface that uses DHCP or not.
+func ipv4Origin(addr interfaceAddress, dhcp bool) string {
+	switch {
+	case addr.IP.IsLinkLocalUnicast():
+		return "IPv4LinkLocal"
+	case dhcp:
+		return "DHCP"
+	default:
+		return "Static"
+	}
+}
+
+// ipv6Origin is the Redfish AddressOrigin of an IPv6 address. Addresses
+// with a lifetime come from router advertisements; DHCPv6 is not used on
+// the NanoKVM.
+func ipv6Origin(addr interfaceAddress) string {
+	switch {
+	case addr.IP.IsLinkLocalUnicast():
+		return "LinkLocal"
+	case addr.Permanent:
+		return "Static"
+	default:
+		return "SLAAC"
+	}
+}
+
+func ethernetInterfaceResource(name string) map[string]interface{} {
+	flags, _ := strconv.ParseUint(strings.TrimPrefix(readNetAttr(name, "flags"), "0x"), 16, 32)
+	enabled := flags&syscall.IFF_UP != 0
+
+	state, linkStatus := "Disabled", "LinkDown"
+	if enabled {
+		state = "Enabled"
+	}
+	if readNetAttr(name, "carrier") == "1" {
+		linkStatus = "LinkUp"
+	}
+
+	// Where the addressing is configured it says whether DHCP is used;
+	// elsewhere a leased address is told by its lifetime.
+	var settings *ipv4Settings
+	if isConfigurableInterface(name) {
+		if current, err := readIPv4Settings(name); err != nil {
+			log.Printf("Failed to read the network settings of %s: %v", name, err)
+		} else {
+			settings = &current
+		}
+	}
+
+	ipv4 := []map[string]interface{}{}
+	ipv6 := []map[string]interface{}{}
+	gateway4, gateway6 := defaultGateways(name)
+	index, _ := strconv.Atoi(readNetAttr(name, "ifindex"))
+	addresses, err := readInterfaceAddresses()
+	if err != nil {
+		log.Printf("Failed to read the addresses of %s: %v", name, err)
+	}
+	for _, addr := range addresses[index] {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			dhcp := !addr.Permanent
+			if settings != nil {
+				dhcp = settings.DHCPEnabled
+			}
+			entry := map[string]interface{}{
+				"Address":       ip4.String(),
+				"SubnetMask":    net.IP(net.CIDRMask(addr.PrefixLength, 8*net.IPv4len)).String(),
+				"AddressOrigin": ipv4Origin(addr, dhcp),
+			}
+			if gateway4 != "" {
+				entry["Gateway"] = gateway4
+			}
+			ipv4 = append(ipv4, entry)
+			continue
+		}
+		ipv6 = append(ipv6, map[string]interface{}{
+			"Address":       addr.IP.String(),
+			"PrefixLength":  addr.PrefixLength,
+			"AddressOrigin": ipv6Origin(addr),
+		})
+	}
+
+	resource := map[string]interface{}{
+		"@odata.type":      odataType("EthernetInterface"),
+		"@odata.id":        ethernetInterfacesPath + "/" + name,
+		"Id":               name,
+		"Name":             "Manager Ethernet Interface " + name,
+		"InterfaceEnabled": enabled,
+		"LinkStatus":       linkStatus,
+		"MACAddress":       readNetAttr(name, "address"),
+		"IPv4Addresses":    ipv4,
+		"IPv6Addresses":    ipv6,
+		"Status":           map[string]string{"State": state, "Health": "OK"},
+	}
+	if mtu, err := strconv.Atoi(readNetAttr(name, "mtu")); err == nil {
+		resource["MTUSize"] = mtu
+	}
+	// A link that is down, or has no fixed speed such as Wi-Fi, reports
+	// -1 or nothing.
+	if speed, err := strconv.Atoi(readNetAttr(name, "speed")); err == nil && speed > 0 {
+		resource["SpeedMbps"] = speed
+		resource["FullDuplex"] = readNetAttr(name, "duplex") == "full"
+	}
+	if gateway6 != "" {
+		resource["IPv6DefaultGateway"] = gateway6
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		resource["HostName"] = hostname
+	}
+	if settings != nil {
+		addIPv4Settings(resource, name, *settings)
+		addDNSSettings(resource)
+	}
+	addVLANLinks(resource, name)
+	return resource
+}
+
+// nanoKVMOem returns the NanoKVM's Oem section of resource, adding it if
+// it has none yet.
+func nanoKVMOem(resource map[string]interface{}) map[string]interface{} {
+	oem, ok := resource["Oem"].(map[string]interface{})
+	if !ok {
+		oem = map[string]interface{}{}
+		resource["Oem"] = oem
+	}
+	nanoKVM, ok := oem["NanoKVM"].(map[string]interface{})
+	if !ok {
+		nanoKVM = map[string]interface{}{}
+		oem["NanoKVM"] = nanoKVM
+	}
+	return nanoKVM
+}
+
+func handleEthernetInterfaces(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, ethernetInterfacesPath), "/")
+
+	name, sub, _ := strings.Cut(rest, "/")
+
+	switch {
+	case rest == "":
+		handleEthernetInterfaceCollection(w, r)
+	case !isManagerInterface(name):
+		writeNotFound(w, r)
+	case sub == "":
+		handleEthernetInterface(w, r, name)
+	case sub == "VLANs" || strings.HasPrefix(sub, "VLANs/"):
+		handleVLANs(w, r, name, strings.TrimPrefix(strings.TrimPrefix(sub, "VLANs"), "/"))
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleEthernetInterfaceCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	for _, name := range managerInterfaceNames() {
+		members = append(members, map[string]string{"@odata.id": ethernetInterfacesPath + "/" + name})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		ODataID:   ethernetInterfacesPath,
+		Name:      "Manager Ethernet Interface Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleEthernetInterface(w http.ResponseWriter, r *http.Request, name string) {
+	switch {
+	case r.Method == http.MethodGet:
+		handleEthernetInterfaceGet(w, r, name)
+	case !isConfigurableInterface(name):
+		writeMethodNotAllowed(w, r, "GET")
+	case r.Method == http.MethodPatch:
+		handleEthernetInterfacePatch(w, r, name)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
+	}
+}
+
+// handleEthernetInterfaceGet serves one of the NanoKVM's own network
+// interfaces, read from sysfs and netlink each time so that a new DHCP
+// lease or a cable being pulled shows up straight away. Reaching it
+// through the addresses an unconfirmed change gave the interface
+// confirms the change.
+func handleEthernetInterfaceGet(w http.ResponseWriter, r *http.Request, name string) {
+	confirmNetworkChange(r, name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ethernetInterfaceResource(name))
+}
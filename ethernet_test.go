@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fakeNetSysfs(t *testing.T, interfaces map[string]map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, attrs := range interfaces {
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+		for attr, value := range attrs {
+			os.WriteFile(filepath.Join(dir, name, attr), []byte(value+"\n"), 0644)
+		}
+	}
+	oldSysfs, oldProc, oldNetwork := netSysfsDir, procNetDir, currentConfig.Network
+	netSysfsDir, procNetDir = dir, t.TempDir()
+	currentConfig.Network.StaticFiles = map[string]string{}
+	t.Cleanup(func() { netSysfsDir, procNetDir, currentConfig.Network = oldSysfs, oldProc, oldNetwork })
+}
+
+func TestManagerEthernetInterfaces(t *testing.T) {
+	fakeNetSysfs(t, map[string]map[string]string{
+		"eth0": {"type": "1", "ifindex": "2", "flags": "0x1003", "carrier": "1", "address": "48:da:35:6e:01:02",
+			"mtu": "1500", "speed": "100", "duplex": "full"},
+		"usb0": {"type": "1", "ifindex": "3", "flags": "0x1002", "address": "02:00:00:00:00:01", "speed": "-1"},
+		"lo":   {"type": "772", "ifindex": "1"},
+	})
+	os.WriteFile(filepath.Join(procNetDir, "route"), []byte(
+		"Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"+
+			"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"+
+			"eth0\t0001A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"), 0644)
+	os.WriteFile(filepath.Join(procNetDir, "ipv6_route"), []byte(
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00450003     eth0\n"), 0644)
+
+	oldAddresses := readInterfaceAddresses
+	defer func() { readInterfaceAddresses = oldAddresses }()
+	readInterfaceAddresses = func() (map[int][]interfaceAddress, error) {
+		return map[int][]interfaceAddress{2: {
+			{IP: net.ParseIP("192.168.1.50"), PrefixLength: 24},
+			{IP: net.ParseIP("fe80::4ada:35ff:fe6e:102"), PrefixLength: 64, Permanent: true},
+			{IP: net.ParseIP("2001:db8::50"), PrefixLength: 64},
+		}}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	handleEthernetInterfaces(rr, httptest.NewRequest("GET", ethernetInterfacesPath, nil))
+	var collection SystemCollection
+	json.Unmarshal(rr.Body.Bytes(), &collection)
+	if len(collection.Members) != 2 || collection.Members[0]["@odata.id"] != ethernetInterfacesPath+"/eth0" {
+		t.Errorf("Expected eth0 and usb0 without the loopback, got %v", collection.Members)
+	}
+
+	rr = httptest.NewRecorder()
+	handleEthernetInterfaces(rr, httptest.NewRequest("GET", ethernetInterfacesPath+"/eth0", nil))
+	var eth0 struct {
+		MACAddress    string
+		LinkStatus    string
+		SpeedMbps     int
+		FullDuplex    bool
+		IPv4Addresses []struct {
+			Address, SubnetMask, AddressOrigin, Gateway string
+		}
+		IPv6Addresses []struct {
+			Address, AddressOrigin string
+			PrefixLength           int
+		}
+		IPv6DefaultGateway string
+	}
+	json.Unmarshal(rr.Body.Bytes(), &eth0)
+	if eth0.MACAddress != "48:da:35:6e:01:02" || eth0.LinkStatus != "LinkUp" || eth0.SpeedMbps != 100 || !eth0.FullDuplex {
+		t.Errorf("Expected eth0's link read from sysfs, got %s", rr.Body.String())
+	}
+	if len(eth0.IPv4Addresses) != 1 || eth0.IPv4Addresses[0].SubnetMask != "255.255.255.0" ||
+		eth0.IPv4Addresses[0].AddressOrigin != "DHCP" || eth0.IPv4Addresses[0].Gateway != "192.168.1.1" {
+		t.Errorf("Expected a DHCP address with the default gateway, got %+v", eth0.IPv4Addresses)
+	}
+	if len(eth0.IPv6Addresses) != 2 || eth0.IPv6Addresses[0].AddressOrigin != "LinkLocal" ||
+		eth0.IPv6Addresses[1].AddressOrigin != "SLAAC" || eth0.IPv6DefaultGateway != "fe80::1" {
+		t.Errorf("Expected link-local and SLAAC addresses, got %+v via %s", eth0.IPv6Addresses, eth0.IPv6DefaultGateway)
+	}
+
+	rr = httptest.NewRecorder()
+	handleEthernetInterfaces(rr, httptest.NewRequest("GET", ethernetInterfacesPath+"/usb0", nil))
+	var usb0 map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &usb0)
+	if usb0["InterfaceEnabled"] != false || usb0["LinkStatus"] != "LinkDown" || usb0["SpeedMbps"] != nil {
+		t.Errorf("Expected usb0 down with no speed, got %s", rr.Body.String())
+	}
+
+	for _, path := range []string{ethernetInterfacesPath + "/lo", ethernetInterfacesPath + "/eth0/VLANs"} {
+		rr = httptest.NewRecorder()
+		handleEthernetInterfaces(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", path, rr.Code)
+		}
+	}
+}
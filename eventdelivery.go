@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// retryUnit scales the configured retry interval; tests shorten it.
+var retryUnit = time.Second
+
+var eventHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// eventBuffer holds events that could not be delivered to a subscriber. It
+// is mirrored to a file on flash so a daemon restart during a collector
+// outage does not lose the record of what happened.
+type eventBuffer struct {
+	path  string
+	limit int
+
+	mu      sync.Mutex
+	records []EventRecord
+}
+
+func openEventBuffer(path string, limit int) *eventBuffer {
+	b := &eventBuffer{path: path, limit: limit}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to read event buffer %s: %v", path, err)
+		}
+		return b
+	}
+	if err := json.Unmarshal(content, &b.records); err != nil {
+		log.Printf("Discarding unreadable event buffer %s: %v", path, err)
+		b.records = nil
+	}
+	return b
+}
+
+// saveLocked writes the buffer to disk, removing the file once it is empty.
+// Callers must hold b.mu.
+func (b *eventBuffer) saveLocked() {
+	if len(b.records) == 0 {
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove event buffer %s: %v", b.path, err)
+		}
+		return
+	}
+
+	content, err := json.Marshal(b.records)
+	if err == nil {
+		err = writeFileAtomic(b.path, content, 0o600)
+	}
+	if err != nil {
+		log.Printf("Failed to save event buffer %s: %v", b.path, err)
+	}
+}
+
+func (b *eventBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.records)
+}
+
+func (b *eventBuffer) Records() []EventRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]EventRecord(nil), b.records...)
+}
+
+// Append adds a record, discarding the oldest one if the buffer is full.
+func (b *eventBuffer) Append(record EventRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit > 0 && len(b.records) >= b.limit {
+		log.Printf("Event buffer %s is full, dropping event %s", b.path, b.records[0].EventID)
+		b.records = b.records[1:]
+	}
+	b.records = append(b.records, record)
+	b.saveLocked()
+}
+
+// DropFirst removes the n oldest records after they have been delivered.
+func (b *eventBuffer) DropFirst(n int) {
+	if n == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > len(b.records) {
+		n = len(b.records)
+	}
+	b.records = b.records[n:]
+	b.saveLocked()
+}
+
+func (b *eventBuffer) Remove() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.records = nil
+	b.saveLocked()
+}
+
+// deliveryWorker sends events to one subscriber in order. While the
+// subscriber is unreachable, events go to the buffer; once a buffered event
+// is accepted again the backlog is replayed before any new events.
+type deliveryWorker struct {
+	sub    EventSubscription
+	queue  chan EventRecord
+	stop   chan struct{}
+	done   chan struct{}
+	buffer *eventBuffer
+}
+
+func startDeliveryWorker(sub EventSubscription) *deliveryWorker {
+	cfg := currentConfig.Events
+	d := &deliveryWorker{
+		sub:    sub,
+		queue:  make(chan EventRecord, 64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		buffer: openEventBuffer(filepath.Join(cfg.BufferDir, "subscription-"+sub.ID+".json"), cfg.BufferLimit),
+	}
+	go d.run()
+	return d
+}
+
+func (d *deliveryWorker) Enqueue(record EventRecord) {
+	select {
+	case d.queue <- record:
+	default:
+		// The worker is stuck retrying; park the event straight in the
+		// buffer rather than blocking the publisher.
+		d.buffer.Append(record)
+	}
+}
+
+func (d *deliveryWorker) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *deliveryWorker) retryInterval() time.Duration {
+	return time.Duration(currentConfig.Events.RetryInterval) * retryUnit
+}
+
+func (d *deliveryWorker) run() {
+	defer close(d.done)
+
+	for {
+		if d.buffer.Len() > 0 {
+			d.replay()
+			if d.buffer.Len() == 0 {
+				continue
+			}
+			select {
+			case record := <-d.queue:
+				d.buffer.Append(record)
+			case <-time.After(d.retryInterval()):
+			case <-d.stop:
+				return
+			}
+			continue
+		}
+
+		select {
+		case record := <-d.queue:
+			if !d.deliverWithRetry(record) {
+				log.Printf("Subscriber %s unreachable, buffering event %s", d.sub.Destination, record.EventID)
+				d.buffer.Append(record)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// stopped reports whether Stop has been called.
+func (d *deliveryWorker) stopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// replay sends buffered events oldest first, stopping at the first failure
+// or once the worker is stopped, so a long buffer does not hold up Stop.
+func (d *deliveryWorker) replay() {
+	delivered := 0
+	for _, record := range d.buffer.Records() {
+		if d.stopped() {
+			break
+		}
+		if record.Oem != nil {
+			oem := *record.Oem
+			oem.NanoKVM.Replayed = true
+			record.Oem = &oem
+		}
+		if err := d.deliver(record); err != nil {
+			break
+		}
+		delivered++
+	}
+
+	if delivered > 0 {
+		log.Printf("Replayed %d buffered events to %s", delivered, d.sub.Destination)
+	}
+	d.buffer.DropFirst(delivered)
+}
+
+func (d *deliveryWorker) deliverWithRetry(record EventRecord) bool {
+	attempts := 1 + currentConfig.Events.RetryAttempts
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(d.retryInterval()):
+			case <-d.stop:
+				return false
+			}
+		}
+
+		err := d.deliver(record)
+		if err == nil {
+			return true
+		}
+		log.Printf("Event delivery to %s failed (attempt %d/%d): %v", d.sub.Destination, i+1, attempts, err)
+	}
+	return false
+}
+
+func (d *deliveryWorker) deliver(record EventRecord) error {
+	event := Event{
+		ODataType: odataType("Event"),
+		ID:        record.EventID,
+		Name:      "NanoKVM Event",
+		Context:   d.sub.Context,
+		Events:    []EventRecord{record},
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := eventHTTPClient.Post(d.sub.Destination, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCollector is an event subscriber that can be taken down and brought
+// back up.
+type testCollector struct {
+	mu       sync.Mutex
+	up       bool
+	received []EventRecord
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.up {
+		http.Error(w, "Collector down", http.StatusServiceUnavailable)
+		return
+	}
+	var event Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, "Bad event", http.StatusBadRequest)
+		return
+	}
+	c.received = append(c.received, event.Events...)
+}
+
+func (c *testCollector) setUp(up bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.up = up
+}
+
+func (c *testCollector) events() []EventRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]EventRecord(nil), c.received...)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventBufferReplay(t *testing.T) {
+	es := setupEventService(t)
+	eventLog.Clear()
+
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	sub, err := es.Create(EventSubscription{Destination: server.URL, Protocol: "Redfish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bufferFile := filepath.Join(currentConfig.Events.BufferDir, "subscription-"+sub.ID+".json")
+
+	for _, message := range []string{"first", "second", "third"} {
+		emitEvent("Critical", message, "", "/redfish/v1/Systems/System.1")
+	}
+	waitFor(t, "events to be buffered", func() bool {
+		return len(openEventBuffer(bufferFile, 0).Records()) == 3
+	})
+	original := openEventBuffer(bufferFile, 0).Records()
+
+	// Restart the service while the collector is still down; the buffer
+	// must survive and be replayed once it comes back.
+	es.Close()
+	es, err = openEventService(currentConfig.Events.SubscriptionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+	eventService = es
+	collector.setUp(true)
+
+	waitFor(t, "buffered events to be replayed", func() bool {
+		return len(collector.events()) == 3
+	})
+	for i, got := range collector.events() {
+		if got.Message != original[i].Message {
+			t.Errorf("Event %d: expected %q, got %q", i, original[i].Message, got.Message)
+		}
+		if got.EventTimestamp != original[i].EventTimestamp {
+			t.Errorf("Event %d: expected original timestamp %s, got %s", i, original[i].EventTimestamp, got.EventTimestamp)
+		}
+		if got.Oem == nil || !got.Oem.NanoKVM.Replayed {
+			t.Errorf("Event %d: expected Replayed to be set", i)
+		}
+	}
+	waitFor(t, "buffer file to be removed", func() bool {
+		_, err := os.Stat(bufferFile)
+		return os.IsNotExist(err)
+	})
+
+	emitEvent("OK", "live", "", "/redfish/v1/Systems/System.1")
+	waitFor(t, "live event", func() bool {
+		return len(collector.events()) == 4
+	})
+	if live := collector.events()[3]; live.Message != "live" || live.Oem.NanoKVM.Replayed {
+		t.Errorf("Expected live event without Replayed, got %+v", live)
+	}
+}
+
+func TestEventBufferLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.json")
+	buffer := openEventBuffer(path, 2)
+
+	for _, message := range []string{"oldest", "middle", "newest"} {
+		buffer.Append(newEventRecord(newTimestamp(), "OK", message, "", ""))
+	}
+
+	records := openEventBuffer(path, 2).Records()
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 buffered events, got %d", len(records))
+	}
+	if records[0].Message != "middle" || records[1].Message != "newest" {
+		t.Errorf("Expected oldest event to be dropped, got %q, %q", records[0].Message, records[1].Message)
+	}
+
+	buffer.DropFirst(2)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected empty buffer file to be removed")
+	}
+}
+
+// TestEventSubscriptionDeleteSlowSubscriber checks that deleting a
+// subscription whose subscriber is slow to answer does not hold up other
+// events.
+func TestEventSubscriptionDeleteSlowSubscriber(t *testing.T) {
+	es := setupEventService(t)
+
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+	}))
+	defer server.Close()
+	defer releaseOnce.Do(func() { close(release) })
+
+	sub, err := es.Create(EventSubscription{Destination: server.URL, Protocol: "Redfish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitEvent("OK", "first", "", "/redfish/v1/Systems/System.1")
+	waitFor(t, "delivery to start", func() bool { return requests.Load() == 1 })
+
+	deleted := make(chan error)
+	go func() { deleted <- es.Delete(sub.ID) }()
+	waitFor(t, "the subscription to be removed", func() bool {
+		content, _ := os.ReadFile(currentConfig.Events.SubscriptionsFile)
+		return !strings.Contains(string(content), server.URL)
+	})
+	published := make(chan struct{})
+	go func() {
+		emitEvent("OK", "second", "", "/redfish/v1/Systems/System.1")
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Error("Expected events published while the subscription is being deleted")
+	}
+
+	releaseOnce.Do(func() { close(release) })
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := es.Get(sub.ID); ok {
+		t.Error("Expected the subscription deleted")
+	}
+}
+
+// TestEventBufferReplayStops checks that a worker replaying a long buffer
+// to a slow subscriber stops between events when its subscription goes.
+func TestEventBufferReplayStops(t *testing.T) {
+	es := setupEventService(t)
+
+	buffer := openEventBuffer(filepath.Join(currentConfig.Events.BufferDir, "subscription-1.json"), 0)
+	for i := 0; i < 50; i++ {
+		buffer.Append(EventRecord{EventID: strconv.Itoa(i), Message: "buffered"})
+	}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	sub, err := es.Create(EventSubscription{Destination: server.URL, Protocol: "Redfish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.ID != "1" {
+		t.Fatalf("Expected subscription 1, got %s", sub.ID)
+	}
+	waitFor(t, "replay to start", func() bool { return requests.Load() > 0 })
+	if err := es.Delete(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n >= 50 {
+		t.Errorf("Expected the replay stopped early, got %d events delivered", n)
+	}
+}
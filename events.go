@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// resourceEventPrefix is the DMTF ResourceEvent registry used for the
+// events this service emits.
+const resourceEventPrefix = "ResourceEvent.1.3."
+
+// Registries and resource types subscribers can filter on.
+var (
+	eventRegistryPrefixes = []string{"ResourceEvent"}
+	eventResourceTypes    = []string{"ComputerSystem", "Manager", "Chassis"}
+)
+
+// EventRecord is a single entry in the Events array of a Redfish Event.
+type EventRecord struct {
+	EventType         string          `json:"EventType"`
+	EventID           string          `json:"EventId"`
+	EventTimestamp    string          `json:"EventTimestamp"`
+	Severity          string          `json:"Severity"`
+	Message           string          `json:"Message"`
+	MessageID         string          `json:"MessageId,omitempty"`
+	MessageArgs       []string        `json:"MessageArgs,omitempty"`
+	OriginOfCondition *Link           `json:"OriginOfCondition,omitempty"`
+	Oem               *EventRecordOem `json:"Oem,omitempty"`
+}
+
+type EventRecordOem struct {
+	NanoKVM EventRecordOemNanoKVM `json:"NanoKVM"`
+}
+
+type EventRecordOemNanoKVM struct {
+	Sequence uint64 `json:"Sequence"`
+	// Replayed is set on events delivered from the offline buffer after
+	// the subscriber was unreachable.
+	Replayed bool `json:"Replayed,omitempty"`
+}
+
+// Event is the payload POSTed to subscribers.
+type Event struct {
+	ODataType string        `json:"@odata.type"`
+	ID        string        `json:"Id"`
+	Name      string        `json:"Name"`
+	Context   string        `json:"Context,omitempty"`
+	Events    []EventRecord `json:"Events"`
+}
+
+func newEventRecord(ts Timestamp, severity, message, messageID, origin string, messageArgs ...string) EventRecord {
+	record := EventRecord{
+		EventType:      "Alert",
+		EventID:        strconv.FormatUint(ts.Sequence, 10),
+		EventTimestamp: ts.String(),
+		Severity:       severity,
+		Message:        message,
+		MessageID:      messageID,
+		MessageArgs:    messageArgs,
+		Oem: &EventRecordOem{
+			NanoKVM: EventRecordOemNanoKVM{Sequence: ts.Sequence},
+		},
+	}
+	if origin != "" {
+		record.OriginOfCondition = &Link{ODataID: origin}
+	}
+	return record
+}
+
+// resourceTypeOf returns the schema name of the resource at path, used to
+// match ResourceTypes filters.
+func resourceTypeOf(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/redfish/v1/Systems/"):
+		return "ComputerSystem"
+	case strings.HasPrefix(path, "/redfish/v1/Managers/"):
+		return "Manager"
+	case strings.HasPrefix(path, "/redfish/v1/Chassis/"):
+		return "Chassis"
+	}
+	return ""
+}
+
+// registryPrefixOf returns the registry part of a MessageId such as
+// "ResourceEvent.1.3.ResourceChanged".
+func registryPrefixOf(messageID string) string {
+	prefix, _, _ := strings.Cut(messageID, ".")
+	return prefix
+}
+
+// emitEvent records something that happened to the managed system in the
+// event log and sends it to every event subscriber.
+func emitEvent(severity, message, messageID, origin string, messageArgs ...string) {
+	ts := newTimestamp()
+	eventLog.AddAt(ts, severity, message, messageID, messageArgs...)
+	if eventService != nil {
+		eventService.Publish(newEventRecord(ts, severity, message, messageID, origin, messageArgs...))
+	}
+}
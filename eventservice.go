@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const eventServicePath = "/redfish/v1/EventService"
+
+// EventSubscription is a persisted EventDestination.
+type EventSubscription struct {
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+	Context     string `json:"context"`
+	Protocol    string `json:"protocol"`
+
+	// Filters; an empty list matches everything.
+	RegistryPrefixes     []string `json:"registry_prefixes,omitempty"`
+	ResourceTypes        []string `json:"resource_types,omitempty"`
+	OriginResources      []string `json:"origin_resources,omitempty"`
+	SubordinateResources bool     `json:"subordinate_resources,omitempty"`
+}
+
+// Matches reports whether record passes every filter on the subscription.
+func (sub *EventSubscription) Matches(record EventRecord) bool {
+	origin := ""
+	if record.OriginOfCondition != nil {
+		origin = record.OriginOfCondition.ODataID
+	}
+
+	if len(sub.RegistryPrefixes) > 0 && !containsString(sub.RegistryPrefixes, registryPrefixOf(record.MessageID)) {
+		return false
+	}
+	if len(sub.ResourceTypes) > 0 && !containsString(sub.ResourceTypes, resourceTypeOf(origin)) {
+		return false
+	}
+	if len(sub.OriginResources) > 0 {
+		for _, resource := range sub.OriginResources {
+			if origin == resource || (sub.SubordinateResources && strings.HasPrefix(origin, resource+"/")) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// EventService owns the subscriptions and a delivery worker for each.
+type EventService struct {
+	path string
+
+	mu            sync.Mutex
+	subscriptions map[string]*EventSubscription
+	workers       map[string]*deliveryWorker
+}
+
+var eventService *EventService
+
+func openEventService(path string) (*EventService, error) {
+	es := &EventService{
+		path:          path,
+		subscriptions: map[string]*EventSubscription{},
+		workers:       map[string]*deliveryWorker{},
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+	if err == nil {
+		var subs []*EventSubscription
+		if err := json.Unmarshal(content, &subs); err != nil {
+			return nil, fmt.Errorf("failed to parse subscriptions: %w", err)
+		}
+		for _, sub := range subs {
+			es.subscriptions[sub.ID] = sub
+		}
+	}
+
+	for _, sub := range es.subscriptions {
+		es.workers[sub.ID] = startDeliveryWorker(*sub)
+	}
+	return es, nil
+}
+
+// save persists the subscriptions. Callers must hold es.mu.
+func (es *EventService) save() error {
+	content, err := json.MarshalIndent(es.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(es.path, content, 0o600)
+}
+
+func (es *EventService) listLocked() []*EventSubscription {
+	subs := make([]*EventSubscription, 0, len(es.subscriptions))
+	for _, sub := range es.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		a, _ := strconv.Atoi(subs[i].ID)
+		b, _ := strconv.Atoi(subs[j].ID)
+		return a < b
+	})
+	return subs
+}
+
+func (es *EventService) List() []EventSubscription {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	var result []EventSubscription
+	for _, sub := range es.listLocked() {
+		result = append(result, *sub)
+	}
+	return result
+}
+
+func (es *EventService) Get(id string) (EventSubscription, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	sub, ok := es.subscriptions[id]
+	if !ok {
+		return EventSubscription{}, false
+	}
+	return *sub, true
+}
+
+func (es *EventService) Create(sub EventSubscription) (EventSubscription, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	nextID := 1
+	for _, existing := range es.subscriptions {
+		if id, _ := strconv.Atoi(existing.ID); id >= nextID {
+			nextID = id + 1
+		}
+	}
+	sub.ID = strconv.Itoa(nextID)
+	es.subscriptions[sub.ID] = &sub
+
+	if err := es.save(); err != nil {
+		delete(es.subscriptions, sub.ID)
+		return EventSubscription{}, err
+	}
+
+	es.workers[sub.ID] = startDeliveryWorker(sub)
+	return sub, nil
+}
+
+// Delete removes a subscription. Its worker is stopped after es.mu is
+// released, since it may be waiting on a slow subscriber and Publish needs
+// the lock.
+func (es *EventService) Delete(id string) error {
+	es.mu.Lock()
+	sub, ok := es.subscriptions[id]
+	if !ok {
+		es.mu.Unlock()
+		return errors.New("subscription not found")
+	}
+	delete(es.subscriptions, id)
+
+	if err := es.save(); err != nil {
+		es.subscriptions[id] = sub
+		es.mu.Unlock()
+		return err
+	}
+
+	worker, ok := es.workers[id]
+	delete(es.workers, id)
+	es.mu.Unlock()
+
+	if ok {
+		worker.Stop()
+		worker.buffer.Remove()
+	}
+	return nil
+}
+
+// Publish queues the record for every subscriber whose filters match.
+func (es *EventService) Publish(record EventRecord) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	for _, worker := range es.workers {
+		if worker.sub.Matches(record) {
+			worker.Enqueue(record)
+		}
+	}
+}
+
+// Close stops all delivery workers, outside es.mu as Delete does.
+func (es *EventService) Close() {
+	es.mu.Lock()
+	workers := es.workers
+	es.workers = map[string]*deliveryWorker{}
+	es.mu.Unlock()
+
+	for _, worker := range workers {
+		worker.Stop()
+	}
+}
+
+func subscriptionPath(id string) string {
+	return eventServicePath + "/Subscriptions/" + id
+}
+
+func toEventDestination(sub EventSubscription) map[string]interface{} {
+	origins := []Link{}
+	for _, origin := range sub.OriginResources {
+		origins = append(origins, Link{ODataID: origin})
+	}
+
+	return map[string]interface{}{
+		"@odata.type":          odataType("EventDestination"),
+		"@odata.id":            subscriptionPath(sub.ID),
+		"Id":                   sub.ID,
+		"Name":                 "Event Subscription " + sub.ID,
+		"Destination":          sub.Destination,
+		"Context":              sub.Context,
+		"Protocol":             sub.Protocol,
+		"SubscriptionType":     "RedfishEvent",
+		"RegistryPrefixes":     nonNil(sub.RegistryPrefixes),
+		"ResourceTypes":        nonNil(sub.ResourceTypes),
+		"OriginResources":      origins,
+		"SubordinateResources": sub.SubordinateResources,
+	}
+}
+
+// nonNil makes empty filter lists serialise as [] rather than null.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func handleEventService(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, eventServicePath), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "":
+		handleEventServiceRoot(w, r)
+	case len(parts) == 1 && parts[0] == "Subscriptions":
+		handleSubscriptions(w, r)
+	case len(parts) == 2 && parts[0] == "Subscriptions":
+		handleSubscription(w, r, parts[1])
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleEventServiceRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	cfg := currentConfig.Events
+	service := map[string]interface{}{
+		"@odata.type":                  odataType("EventService"),
+		"@odata.id":                    eventServicePath,
+		"Id":                           "EventService",
+		"Name":                         "Event Service",
+		"ServiceEnabled":               eventService != nil,
+		"DeliveryRetryAttempts":        cfg.RetryAttempts,
+		"DeliveryRetryIntervalSeconds": cfg.RetryInterval,
+		"EventFormatTypes":             []string{"Event"},
+		"RegistryPrefixes":             eventRegistryPrefixes,
+		"ResourceTypes":                eventResourceTypes,
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+		"Subscriptions": map[string]string{
+			"@odata.id": eventServicePath + "/Subscriptions",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service)
+}
+
+func handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if eventService == nil {
+		if checkMethod(w, r, "GET", "POST") {
+			writeServiceNotEnabled(w, "EventService")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		subs := eventService.List()
+		ids := make([]string, len(subs))
+		for i, sub := range subs {
+			ids[i] = subscriptionPath(sub.ID)
+		}
+		members, ok := filterMembers(w, r, ids, func(i int) interface{} { return toEventDestination(subs[i]) })
+		if !ok {
+			return
+		}
+
+		collection := SystemCollection{
+			ODataType:                 "#EventDestinationCollection.EventDestinationCollection",
+			ODataID:                   eventServicePath + "/Subscriptions",
+			Name:                      "Event Subscriptions Collection",
+			Members:                   members,
+			OperationApplyTimeSupport: immediateApplyTime(),
+		}
+
+		writeCollection(w, r, collection)
+	case http.MethodPost:
+		handleSubscriptionsPost(w, r)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "POST")
+	}
+}
+
+type SubscriptionRequest struct {
+	Destination          *string  `json:"Destination"`
+	Context              string   `json:"Context"`
+	Protocol             string   `json:"Protocol"`
+	RegistryPrefixes     []string `json:"RegistryPrefixes"`
+	ResourceTypes        []string `json:"ResourceTypes"`
+	OriginResources      []Link   `json:"OriginResources"`
+	SubordinateResources bool     `json:"SubordinateResources"`
+}
+
+func handleSubscriptionsPost(w http.ResponseWriter, r *http.Request) {
+	var req SubscriptionRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+
+	if req.Destination == nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyMissing", "Destination").withProperty("#/Destination"))
+		return
+	}
+	dest, err := url.Parse(*req.Destination)
+	if err != nil || (dest.Scheme != "http" && dest.Scheme != "https") || dest.Host == "" {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueFormatError", *req.Destination, "Destination").withProperty("#/Destination"))
+		return
+	}
+	if req.Protocol == "" {
+		req.Protocol = "Redfish"
+	}
+	if req.Protocol != "Redfish" {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueNotInList", req.Protocol, "Protocol").withProperty("#/Protocol"))
+		return
+	}
+
+	for i, prefix := range req.RegistryPrefixes {
+		if !containsString(eventRegistryPrefixes, prefix) {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueNotInList", prefix, "RegistryPrefixes").withProperty(fmt.Sprintf("#/RegistryPrefixes/%d", i)))
+			return
+		}
+	}
+	for i, resourceType := range req.ResourceTypes {
+		if !containsString(eventResourceTypes, resourceType) {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueNotInList", resourceType, "ResourceTypes").withProperty(fmt.Sprintf("#/ResourceTypes/%d", i)))
+			return
+		}
+	}
+	var origins []string
+	for i, origin := range req.OriginResources {
+		if !strings.HasPrefix(origin.ODataID, "/redfish/v1/") {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueFormatError", origin.ODataID, "OriginResources").withProperty(fmt.Sprintf("#/OriginResources/%d", i)))
+			return
+		}
+		origins = append(origins, strings.TrimSuffix(origin.ODataID, "/"))
+	}
+
+	sub, err := eventService.Create(EventSubscription{
+		Destination:          *req.Destination,
+		Context:              req.Context,
+		Protocol:             req.Protocol,
+		RegistryPrefixes:     req.RegistryPrefixes,
+		ResourceTypes:        req.ResourceTypes,
+		OriginResources:      origins,
+		SubordinateResources: req.SubordinateResources,
+	})
+	if err != nil {
+		writeInternalError(w, "create subscription", err)
+		return
+	}
+	log.Printf("Created event subscription %s for %s", sub.ID, sub.Destination)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", subscriptionPath(sub.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toEventDestination(sub))
+}
+
+func handleSubscription(w http.ResponseWriter, r *http.Request, id string) {
+	if eventService == nil {
+		if checkMethod(w, r, "GET", "DELETE") {
+			writeServiceNotEnabled(w, "EventService")
+		}
+		return
+	}
+
+	sub, ok := eventService.Get(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toEventDestination(sub))
+	case http.MethodDelete:
+		if err := eventService.Delete(sub.ID); err != nil {
+			writeInternalError(w, "delete subscription", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "DELETE")
+	}
+}
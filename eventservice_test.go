@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupEventService points the event configuration at a temporary
+// directory, shortens retries and installs a fresh EventService.
+func setupEventService(t *testing.T) *EventService {
+	t.Helper()
+
+	dir := t.TempDir()
+	oldConfig := currentConfig
+	currentConfig.Events.SubscriptionsFile = filepath.Join(dir, "subscriptions.json")
+	currentConfig.Events.BufferDir = filepath.Join(dir, "buffer")
+	currentConfig.Events.RetryAttempts = 0
+	currentConfig.Events.RetryInterval = 10
+
+	oldUnit := retryUnit
+	retryUnit = time.Millisecond
+
+	es, err := openEventService(currentConfig.Events.SubscriptionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := eventService
+	eventService = es
+	t.Cleanup(func() {
+		es.Close()
+		eventService = old
+		retryUnit = oldUnit
+		currentConfig = oldConfig
+	})
+	return es
+}
+
+func TestEventSubscriptionCRUD(t *testing.T) {
+	setupEventService(t)
+	handler := newHandler()
+
+	body := `{"Destination": "https://collector.example.com/events", "Context": "rack-12"}`
+	req, err := http.NewRequest("POST", eventServicePath+"/Subscriptions", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	location := rr.Header().Get("Location")
+	if location == "" {
+		t.Fatal("Expected Location header")
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		expectCode int
+	}{
+		{"Event service", "GET", eventServicePath, "", http.StatusOK},
+		{"Missing destination", "POST", eventServicePath + "/Subscriptions", `{"Context": "x"}`, http.StatusBadRequest},
+		{"Invalid destination", "POST", eventServicePath + "/Subscriptions", `{"Destination": "ftp://example.com"}`, http.StatusBadRequest},
+		{"Unsupported protocol", "POST", eventServicePath + "/Subscriptions", `{"Destination": "http://example.com", "Protocol": "SMTP"}`, http.StatusBadRequest},
+		{"Unknown registry", "POST", eventServicePath + "/Subscriptions", `{"Destination": "http://example.com", "RegistryPrefixes": ["Nope"]}`, http.StatusBadRequest},
+		{"Unknown resource type", "POST", eventServicePath + "/Subscriptions", `{"Destination": "http://example.com", "ResourceTypes": ["Nope"]}`, http.StatusBadRequest},
+		{"Invalid origin", "POST", eventServicePath + "/Subscriptions", `{"Destination": "http://example.com", "OriginResources": [{"@odata.id": "Systems"}]}`, http.StatusBadRequest},
+		{"Filtered subscription", "POST", eventServicePath + "/Subscriptions", `{"Destination": "http://example.com", "RegistryPrefixes": ["ResourceEvent"], "OriginResources": [{"@odata.id": "/redfish/v1/Systems/System.1"}]}`, http.StatusCreated},
+		{"Malformed JSON", "POST", eventServicePath + "/Subscriptions", `{`, http.StatusBadRequest},
+		{"Get subscription", "GET", location, "", http.StatusOK},
+		{"Missing subscription", "GET", eventServicePath + "/Subscriptions/99", "", http.StatusNotFound},
+		{"Delete subscription", "DELETE", location, "", http.StatusNoContent},
+		{"Deleted subscription", "GET", location, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestEventSubscriptionPersistence(t *testing.T) {
+	es := setupEventService(t)
+
+	sub, err := es.Create(EventSubscription{Destination: "http://127.0.0.1:9/events", Protocol: "Redfish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	es.Close()
+
+	reopened, err := openEventService(currentConfig.Events.SubscriptionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	got, ok := reopened.Get(sub.ID)
+	if !ok || got.Destination != sub.Destination {
+		t.Errorf("Expected subscription %+v after reopen, got %+v", sub, got)
+	}
+}
+
+func TestEventSubscriptionMatches(t *testing.T) {
+	record := newEventRecord(newTimestamp(), "OK", "Reset", resourceEventPrefix+"ResourcePowerStateChanged",
+		"/redfish/v1/Systems/System.1/Bios")
+
+	tests := []struct {
+		name   string
+		sub    EventSubscription
+		expect bool
+	}{
+		{"No filters", EventSubscription{}, true},
+		{"Matching registry", EventSubscription{RegistryPrefixes: []string{"ResourceEvent"}}, true},
+		{"Other registry", EventSubscription{RegistryPrefixes: []string{"Base"}}, false},
+		{"Matching resource type", EventSubscription{ResourceTypes: []string{"Manager", "ComputerSystem"}}, true},
+		{"Other resource type", EventSubscription{ResourceTypes: []string{"Chassis"}}, false},
+		{"Exact origin", EventSubscription{OriginResources: []string{"/redfish/v1/Systems/System.1/Bios"}}, true},
+		{"Parent origin", EventSubscription{OriginResources: []string{"/redfish/v1/Systems/System.1"}}, false},
+		{"Parent origin with subordinates", EventSubscription{OriginResources: []string{"/redfish/v1/Systems/System.1"}, SubordinateResources: true}, true},
+		{"Sibling origin with subordinates", EventSubscription{OriginResources: []string{"/redfish/v1/Systems/System.10"}, SubordinateResources: true}, false},
+		{"All filters must match", EventSubscription{RegistryPrefixes: []string{"ResourceEvent"}, ResourceTypes: []string{"Chassis"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.Matches(record); got != tt.expect {
+				t.Errorf("Expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const thermalSubsystemPath = "/redfish/v1/Chassis/System/ThermalSubsystem"
+
+// pwmSysfsDir is where the PWM class lives; tests replace it.
+var pwmSysfsDir = "/sys/class/pwm"
+
+var pwmChannelPattern = regexp.MustCompile(`^(pwmchip\d+):(\d+)$`)
+
+// validPWM reports whether name is a PWM channel as Hardware.FanPWM takes
+// it.
+func validPWM(name string) bool {
+	return pwmChannelPattern.MatchString(name) || filepath.IsAbs(name)
+}
+
+// pwmDir returns the sysfs directory of a PWM channel and, for a channel
+// named "pwmchipN:channel", its chip directory and channel number, which
+// it is exported with.
+func pwmDir(name string) (dir, chip, channel string) {
+	if m := pwmChannelPattern.FindStringSubmatch(name); m != nil {
+		chip = filepath.Join(pwmSysfsDir, m[1])
+		return filepath.Join(chip, "pwm"+m[2]), chip, m[2]
+	}
+	return name, "", ""
+}
+
+func fanConfigured() bool {
+	return currentHardware != nil && currentHardware.FanPWM != ""
+}
+
+func readPWMAttr(dir, name string) (int, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "read PWM", Err: err}
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "parse PWM " + name, Err: err}
+	}
+	return value, nil
+}
+
+func writePWMAttr(dir, name string, value int) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(strconv.Itoa(value)), 0o644); err != nil {
+		return &HardwareError{Kind: errIOFailure, Op: "write PWM " + name, Err: err}
+	}
+	return nil
+}
+
+// readFanDuty returns the fan's duty cycle in percent.
+func readFanDuty() (int, error) {
+	dir, _, _ := pwmDir(currentHardware.FanPWM)
+	period, err := readPWMAttr(dir, "period")
+	if err != nil {
+		return 0, err
+	}
+	duty, err := readPWMAttr(dir, "duty_cycle")
+	if err != nil {
+		return 0, err
+	}
+	if period <= 0 {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "read PWM", Err: fmt.Errorf("period is %d", period)}
+	}
+	return (duty*100 + period/2) / period, nil
+}
+
+// setFanDuty sets the fan's duty cycle in percent, which the caller has
+// checked against the board's bounds.
+func setFanDuty(percent int) error {
+	dir, _, _ := pwmDir(currentHardware.FanPWM)
+	period, err := readPWMAttr(dir, "period")
+	if err != nil {
+		return err
+	}
+	return writePWMAttr(dir, "duty_cycle", period*percent/100)
+}
+
+// readFanRPM returns the fan's speed from its tachometer.
+func readFanRPM() (int, error) {
+	content, err := os.ReadFile(currentHardware.FanTach)
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "read tachometer", Err: err}
+	}
+	rpm, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "parse tachometer", Err: err}
+	}
+	return rpm, nil
+}
+
+// setupFan exports and enables the fan's PWM channel with the board's
+// period. A duty cycle outside the board's bounds, as a freshly exported
+// channel's zero usually is, is raised to full speed, the safe choice for
+// a fan whose needs are unknown. Failures are logged; the fan then reports
+// them when it is read.
+func setupFan() {
+	dir, chip, channel := pwmDir(currentHardware.FanPWM)
+	if _, err := os.Stat(dir); err != nil && chip != "" {
+		if err := os.WriteFile(filepath.Join(chip, "export"), []byte(channel), 0o200); err != nil {
+			log.Printf("Failed to export PWM %s: %v", currentHardware.FanPWM, err)
+			return
+		}
+	}
+
+	if period := currentHardware.FanPeriodNs; period > 0 {
+		// The duty cycle may never exceed the period, so one that would
+		// is lowered first.
+		if duty, err := readPWMAttr(dir, "duty_cycle"); err == nil && duty > period {
+			writePWMAttr(dir, "duty_cycle", period)
+		}
+		if err := writePWMAttr(dir, "period", period); err != nil {
+			log.Printf("Failed to set up the fan: %v", err)
+			return
+		}
+	}
+	if duty, err := readFanDuty(); err != nil || duty < currentHardware.FanMinDuty || duty > currentHardware.FanMaxDuty {
+		if err := setFanDuty(currentHardware.FanMaxDuty); err != nil {
+			log.Printf("Failed to set up the fan: %v", err)
+			return
+		}
+	}
+	if err := writePWMAttr(dir, "enable", 1); err != nil {
+		log.Printf("Failed to set up the fan: %v", err)
+	}
+}
+
+func handleThermalSubsystem(w http.ResponseWriter, r *http.Request) {
+	if !fanConfigured() {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, thermalSubsystemPath), "/") {
+	case "":
+		handleThermalSubsystemRoot(w, r)
+	case "Fans":
+		handleFans(w, r)
+	case "Fans/Fan1":
+		handleFan(w, r)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleThermalSubsystemRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	subsystem := map[string]interface{}{
+		"@odata.type": odataType("ThermalSubsystem"),
+		"@odata.id":   thermalSubsystemPath,
+		"Id":          "ThermalSubsystem",
+		"Name":        "Thermal Subsystem",
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+		"Fans": map[string]string{
+			"@odata.id": thermalSubsystemPath + "/Fans",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subsystem)
+}
+
+func handleFans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	collection := SystemCollection{
+		ODataType: "#FanCollection.FanCollection",
+		ODataID:   thermalSubsystemPath + "/Fans",
+		Name:      "Fan Collection",
+		Members:   []map[string]string{{"@odata.id": thermalSubsystemPath + "/Fans/Fan1"}},
+	}
+
+	writeCollection(w, r, collection)
+}
+
+type FanPatchRequest struct {
+	Oem *struct {
+		NanoKVM struct {
+			DutyCyclePercent *int `json:"DutyCyclePercent"`
+		} `json:"NanoKVM"`
+	} `json:"Oem"`
+}
+
+func handleFan(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		handlePatchFan(w, r)
+		return
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
+		return
+	}
+
+	status := map[string]string{"State": "Enabled", "Health": "OK"}
+	speed := map[string]interface{}{}
+	oem := map[string]interface{}{
+		"MinDutyCyclePercent": currentHardware.FanMinDuty,
+		"MaxDutyCyclePercent": currentHardware.FanMaxDuty,
+	}
+	if duty, err := readFanDuty(); err != nil {
+		log.Printf("Failed to read the fan's duty cycle: %v", err)
+		status["Health"] = "Warning"
+	} else {
+		// The commanded duty cycle stands in for the speed in percent;
+		// only the tachometer measures it.
+		speed["Reading"] = duty
+		oem["DutyCyclePercent"] = duty
+	}
+	if currentHardware.FanTach != "" {
+		if rpm, err := readFanRPM(); err != nil {
+			log.Printf("Failed to read the fan's speed: %v", err)
+			status["Health"] = "Warning"
+		} else {
+			speed["SpeedRPM"] = rpm
+		}
+	}
+
+	fan := map[string]interface{}{
+		"@odata.type":  odataType("Fan"),
+		"@odata.id":    thermalSubsystemPath + "/Fans/Fan1",
+		"Id":           "Fan1",
+		"Name":         "Chassis Fan",
+		"SpeedPercent": speed,
+		"Status":       status,
+		"Oem": map[string]interface{}{
+			"NanoKVM": oem,
+		},
+	}
+
+	if etag := fanETag(); etag != "" {
+		fan["@odata.etag"] = etag
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fan)
+}
+
+// fanETag versions the fan's duty cycle, its only writable property; the
+// tachometer reading is left out as it changes on every GET.
+func fanETag() string {
+	duty, err := readFanDuty()
+	if err != nil {
+		return ""
+	}
+	return resourceETag(duty)
+}
+
+// handlePatchFan sets the fan's duty cycle, within the board's bounds.
+func handlePatchFan(w http.ResponseWriter, r *http.Request) {
+	var req FanPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkPreconditions(w, r, fanETag(), false) {
+		return
+	}
+	ignored, ok := checkPatchProperties(w, r, body, &req, handleFan)
+	if !ok {
+		return
+	}
+	if req.Oem == nil || req.Oem.NanoKVM.DutyCyclePercent == nil {
+		writePatchResult(w, r, ignored, handleFan)
+		return
+	}
+
+	duty := *req.Oem.NanoKVM.DutyCyclePercent
+	if duty < currentHardware.FanMinDuty || duty > currentHardware.FanMaxDuty {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueIncorrect", "DutyCyclePercent", strconv.Itoa(duty)).
+				withProperty("#/Oem/NanoKVM/DutyCyclePercent"))
+		return
+	}
+	if err := setFanDuty(duty); err != nil {
+		writeHardwareError(w, err, "set fan duty cycle")
+		return
+	}
+	log.Printf("Fan duty cycle set to %d%%", duty)
+	emitEvent("OK", fmt.Sprintf("Fan duty cycle set to %d%%", duty),
+		resourceEventPrefix+"ResourceChanged", thermalSubsystemPath+"/Fans/Fan1")
+	writePatchResult(w, r, ignored, handleFan)
+}
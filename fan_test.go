@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFan(t *testing.T) {
+	oldDir, oldHardware := pwmSysfsDir, currentHardware
+	defer func() { pwmSysfsDir, currentHardware = oldDir, oldHardware }()
+	pwmSysfsDir = t.TempDir()
+	chip := filepath.Join(pwmSysfsDir, "pwmchip0")
+	// The kernel would create pwm1 on export.
+	channel := filepath.Join(chip, "pwm1")
+	os.MkdirAll(channel, 0755)
+	for name, value := range map[string]string{"period": "100000", "duty_cycle": "0", "enable": "0"} {
+		os.WriteFile(filepath.Join(channel, name), []byte(value+"\n"), 0644)
+	}
+	tach := filepath.Join(t.TempDir(), "fan1_input")
+	os.WriteFile(tach, []byte("2400\n"), 0644)
+	readAttr := func(name string) string {
+		content, _ := os.ReadFile(filepath.Join(channel, name))
+		return strings.TrimSpace(string(content))
+	}
+
+	currentHardware = &Hardware{}
+	rr := httptest.NewRecorder()
+	handleThermalSubsystem(rr, httptest.NewRequest("GET", thermalSubsystemPath, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a fan, got %d", rr.Code)
+	}
+
+	currentHardware = &Hardware{FanPWM: "pwmchip0:1", FanPeriodNs: 40000, FanMinDuty: 30, FanMaxDuty: 90, FanTach: tach}
+	setupFan()
+	if readAttr("period") != "40000" || readAttr("duty_cycle") != "36000" || readAttr("enable") != "1" {
+		t.Errorf("Expected the fan enabled at its maximum, got period %s, duty cycle %s, enable %s",
+			readAttr("period"), readAttr("duty_cycle"), readAttr("enable"))
+	}
+
+	handler := http.HandlerFunc(handleThermalSubsystem)
+	for _, tt := range []struct {
+		body       string
+		expectCode int
+		expectDuty string
+	}{
+		{`{"Oem": {"NanoKVM": {"DutyCyclePercent": 50}}}`, http.StatusNoContent, "20000"},
+		{`{"Oem": {"NanoKVM": {"DutyCyclePercent": 20}}}`, http.StatusBadRequest, "20000"},
+		{`{"Oem": {"NanoKVM": {"DutyCyclePercent": 100}}}`, http.StatusBadRequest, "20000"},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("PATCH", thermalSubsystemPath+"/Fans/Fan1", bytes.NewBufferString(tt.body)))
+		if rr.Code != tt.expectCode {
+			t.Errorf("Expected %d for %s, got %d: %s", tt.expectCode, tt.body, rr.Code, rr.Body.String())
+		}
+		if got := readAttr("duty_cycle"); got != tt.expectDuty {
+			t.Errorf("Expected duty cycle %s after %s, got %s", tt.expectDuty, tt.body, got)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", thermalSubsystemPath+"/Fans/Fan1", nil))
+	var fan struct {
+		SpeedPercent struct {
+			Reading  int
+			SpeedRPM int
+		}
+		Oem struct {
+			NanoKVM map[string]int
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &fan); err != nil {
+		t.Fatal(err)
+	}
+	if fan.SpeedPercent.Reading != 50 || fan.SpeedPercent.SpeedRPM != 2400 {
+		t.Errorf("Expected 50%% at 2400 RPM, got %+v", fan.SpeedPercent)
+	}
+	if n := fan.Oem.NanoKVM; n["DutyCyclePercent"] != 50 || n["MinDutyCyclePercent"] != 30 || n["MaxDutyCyclePercent"] != 90 {
+		t.Errorf("Expected the duty cycle and its bounds, got %v", n)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filterExpr is a parsed $filter expression, evaluated against a member
+// resource decoded into generic JSON.
+type filterExpr interface {
+	eval(resource map[string]interface{}) bool
+}
+
+type filterAnd struct{ left, right filterExpr }
+type filterOr struct{ left, right filterExpr }
+type filterNot struct{ expr filterExpr }
+
+// filterCompare compares the property at path, such as Severity or
+// Oem/NanoKVM/Sequence, with a literal.
+type filterCompare struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (f filterAnd) eval(resource map[string]interface{}) bool {
+	return f.left.eval(resource) && f.right.eval(resource)
+}
+
+func (f filterOr) eval(resource map[string]interface{}) bool {
+	return f.left.eval(resource) || f.right.eval(resource)
+}
+
+func (f filterNot) eval(resource map[string]interface{}) bool {
+	return !f.expr.eval(resource)
+}
+
+func (f filterCompare) eval(resource map[string]interface{}) bool {
+	var value interface{} = resource
+	for _, name := range f.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = object[name]
+	}
+
+	switch f.op {
+	case "eq":
+		return value == f.value
+	case "ne":
+		return value != f.value
+	}
+	// Ordering only applies to two numbers or two strings. Timestamps such
+	// as Created are compared as times, since the same instant can be
+	// written with different offsets.
+	var cmp int
+	switch a := value.(type) {
+	case float64:
+		b, ok := f.value.(float64)
+		if !ok {
+			return false
+		}
+		cmp = compareFloats(a, b)
+	case string:
+		b, ok := f.value.(string)
+		if !ok {
+			return false
+		}
+		ta, errA := time.Parse(time.RFC3339, a)
+		tb, errB := time.Parse(time.RFC3339, b)
+		switch {
+		case errA == nil && errB == nil:
+			cmp = ta.Compare(tb)
+		case f.path[len(f.path)-1] == "Created":
+			return false
+		default:
+			cmp = strings.Compare(a, b)
+		}
+	default:
+		return false
+	}
+	switch f.op {
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// filterParser is a recursive descent parser for the subset of $filter
+// that Redfish services commonly support: the comparison operators eq, ne,
+// gt, ge, lt and le between a property and a literal, combined with and,
+// or, not and parentheses. Literals are 'quoted strings', numbers, true,
+// false and null.
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseFilter(query string) (filterExpr, error) {
+	tokens, err := tokenizeFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func tokenizeFilter(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			// A quote inside a string is doubled.
+			j := i + 1
+			for ; j < len(query); j++ {
+				if query[j] != '\'' {
+					continue
+				}
+				if j+1 < len(query) && query[j+1] == '\'' {
+					j++
+					continue
+				}
+				break
+			}
+			if j == len(query) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, query[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(query) && !strings.ContainsRune(" ()'", rune(query[j])) {
+				j++
+			}
+			tokens = append(tokens, query[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() (string, error) {
+	if p.pos == len(p.tokens) {
+		return "", fmt.Errorf("unexpected end of filter")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "or" {
+		p.pos++
+		var right filterExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = filterOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek() == "and" {
+		p.pos++
+		var right filterExpr
+		if right, err = p.parseUnary(); err == nil {
+			left = filterAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{expr}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, err := p.next(); err != nil || token != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return expr, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *filterParser) parseCompare() (filterExpr, error) {
+	property, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if property == ")" || strings.HasPrefix(property, "'") {
+		return nil, fmt.Errorf("expected a property, got %q", property)
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "eq", "ne", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", op)
+	}
+	literal, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseFilterLiteral(literal)
+	if err != nil {
+		return nil, err
+	}
+	return filterCompare{path: strings.Split(property, "/"), op: op, value: value}, nil
+}
+
+func parseFilterLiteral(literal string) (interface{}, error) {
+	switch literal {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(literal, "'") {
+		return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'"), nil
+	}
+	number, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal %q", literal)
+	}
+	return number, nil
+}
+
+// filterMembers links the members of a collection, keeping only those
+// that match the request's $filter when it has one. ids are the members'
+// @odata.id, and resource builds member i, only called while filtering. It
+// writes the error and returns false when the filter does not parse.
+func filterMembers(w http.ResponseWriter, r *http.Request, ids []string, resource func(i int) interface{}) ([]map[string]string, bool) {
+	members := []map[string]string{}
+	query, filtering := r.URL.Query()["$filter"]
+	var expr filterExpr
+	if filtering {
+		var err error
+		if expr, err = parseFilter(query[0]); err != nil {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("QueryParameterValueFormatError", query[0], "$filter"))
+			return nil, false
+		}
+	}
+
+	for i, id := range ids {
+		if expr != nil {
+			var generic map[string]interface{}
+			content, _ := json.Marshal(resource(i))
+			if json.Unmarshal(content, &generic) != nil || !expr.eval(generic) {
+				continue
+			}
+		}
+		members = append(members, map[string]string{"@odata.id": id})
+	}
+	return members, true
+}
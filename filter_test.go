@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	resource := map[string]interface{}{
+		"Severity":  "Warning",
+		"EntryType": "Event",
+		"Message":   "Host's power button pressed",
+		"Oem": map[string]interface{}{
+			"NanoKVM": map[string]interface{}{"Sequence": float64(42)},
+		},
+		"Enabled": true,
+		"Created": "2024-01-01T12:00:00+02:00",
+	}
+
+	tests := []struct {
+		filter      string
+		expectMatch bool
+		expectError bool
+	}{
+		{"Severity eq 'Warning'", true, false},
+		{"Severity ne 'Warning'", false, false},
+		{"Severity eq 'Warning' and EntryType eq 'Event'", true, false},
+		{"Severity eq 'OK' or EntryType eq 'Event'", true, false},
+		{"not (Severity eq 'Warning')", false, false},
+		{"(Severity eq 'OK' or Severity eq 'Warning') and Enabled eq true", true, false},
+		{"Oem/NanoKVM/Sequence gt 41", true, false},
+		{"Oem/NanoKVM/Sequence le 41", false, false},
+		{"Oem/NanoKVM/Sequence ge '41'", false, false},
+		{"Message eq 'Host''s power button pressed'", true, false},
+		{"Missing eq null", true, false},
+		// 10:00Z is the same instant as Created; as strings it sorts after.
+		{"Created ge '2024-01-01T10:00:00Z'", true, false},
+		{"Created gt '2024-01-01T10:00:00Z'", false, false},
+		{"Created lt '2024-01-01T11:00:00+00:00'", true, false},
+		{"Created gt '2024-01-01T13:30:00+05:00'", true, false},
+		{"Created gt 'yesterday'", false, false},
+		{"Severity", false, true},
+		{"Severity has 'Warning'", false, true},
+		{"Severity eq 'Warning", false, true},
+		{"(Severity eq 'Warning'", false, true},
+		{"Severity eq Warning", false, true},
+		{"Severity eq 'Warning' Severity", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			expr, err := parseFilter(tt.filter)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected a parse error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := expr.eval(resource); got != tt.expectMatch {
+				t.Errorf("Expected match %v, got %v", tt.expectMatch, got)
+			}
+		})
+	}
+}
+
+func TestFilterLogEntries(t *testing.T) {
+	eventLog.Clear()
+	defer eventLog.Clear()
+	eventLog.Add("OK", "Host powered on", "")
+	eventLog.Add("Warning", "Boot override not applied", "")
+	eventLog.Add("OK", "Host powered off", "")
+
+	get := func(filter string) *httptest.ResponseRecorder {
+		path := eventLog.odataID() + "/Entries?$filter=" + url.QueryEscape(filter)
+		rr := httptest.NewRecorder()
+		handleLogServices(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	rr := get("Severity eq 'Warning'")
+	var collection SystemCollection
+	if err := json.Unmarshal(rr.Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	warning := eventLog.Entries()[1].ODataID
+	if len(collection.Members) != 1 || collection.Members[0]["@odata.id"] != warning {
+		t.Errorf("Expected only %s, got %v", warning, collection.Members)
+	}
+
+	if rr := get("Severity eq"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed filter, got %d", rr.Code)
+	}
+}
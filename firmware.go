@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// serviceVersion is the version of this service, set when it is built
+// with -ldflags "-X main.serviceVersion=...".
+var serviceVersion = "dev"
+
+// The NanoKVM image records the version of its application and of the
+// image itself in these files.
+var (
+	appVersionFile   = "/kvmapp/version"
+	imageVersionFile = "/boot/ver"
+)
+
+// readVersionFile returns the version in path, or "" if it cannot be read.
+func readVersionFile(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// addManagerInventory adds what inventory systems read off the manager:
+// the NanoKVM application version as its FirmwareVersion, or the image's
+// if the application has none, the board's Model and PartNumber from its
+// hardware profile, and every version under Oem.NanoKVM.
+func addManagerInventory(manager map[string]interface{}) {
+	appVersion, imageVersion := readVersionFile(appVersionFile), readVersionFile(imageVersionFile)
+	if version := appVersion; version != "" || imageVersion != "" {
+		if version == "" {
+			version = imageVersion
+		}
+		manager["FirmwareVersion"] = version
+	}
+	if hw := currentHardware; hw != nil {
+		if hw.Model != "" {
+			manager["Model"] = hw.Model
+		}
+		if hw.PartNumber != "" {
+			manager["PartNumber"] = hw.PartNumber
+		}
+	}
+
+	oem := manager["Oem"].(map[string]interface{})["NanoKVM"].(map[string]interface{})
+	oem["ServiceVersion"] = serviceVersion
+	if appVersion != "" {
+		oem["ApplicationVersion"] = appVersion
+	}
+	if imageVersion != "" {
+		oem["ImageVersion"] = imageVersion
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerInventory(t *testing.T) {
+	dir := t.TempDir()
+	oldApp, oldImage, oldHardware := appVersionFile, imageVersionFile, currentHardware
+	defer func() { appVersionFile, imageVersionFile, currentHardware = oldApp, oldImage, oldHardware }()
+	appVersionFile, imageVersionFile = filepath.Join(dir, "version"), filepath.Join(dir, "ver")
+	currentHardware = &Hardware{Model: "NanoKVM Lite", PartNumber: "SKU-1234"}
+
+	get := func() map[string]interface{} {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleManager(rr, httptest.NewRequest("GET", "/redfish/v1/Managers/BMC", nil))
+		var manager map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &manager); err != nil {
+			t.Fatal(err)
+		}
+		return manager
+	}
+
+	manager := get()
+	if _, ok := manager["FirmwareVersion"]; ok {
+		t.Errorf("Expected no FirmwareVersion without version files, got %v", manager["FirmwareVersion"])
+	}
+	if manager["Model"] != "NanoKVM Lite" || manager["PartNumber"] != "SKU-1234" {
+		t.Errorf("Expected the profile's Model and PartNumber, got %v and %v", manager["Model"], manager["PartNumber"])
+	}
+
+	os.WriteFile(imageVersionFile, []byte("v1.4.0\n"), 0644)
+	if manager := get(); manager["FirmwareVersion"] != "v1.4.0" {
+		t.Errorf("Expected the image version without an application version, got %v", manager["FirmwareVersion"])
+	}
+
+	os.WriteFile(appVersionFile, []byte("2.1.6\n"), 0644)
+	manager = get()
+	if manager["FirmwareVersion"] != "2.1.6" {
+		t.Errorf("Expected the application version, got %v", manager["FirmwareVersion"])
+	}
+	oem := manager["Oem"].(map[string]interface{})["NanoKVM"].(map[string]interface{})
+	if oem["ApplicationVersion"] != "2.1.6" || oem["ImageVersion"] != "v1.4.0" || oem["ServiceVersion"] != serviceVersion {
+		t.Errorf("Expected every version under Oem.NanoKVM, got %v", oem)
+	}
+}
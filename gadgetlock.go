@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// gadgetLockTimeout is how long to wait for another process to finish
+// reconfiguring the USB gadget before giving up with errBusy.
+var gadgetLockTimeout = 5 * time.Second
+
+// lockGadget takes an advisory flock on the configured gadget lock file,
+// which the NanoKVM web application's image mounting takes as well, so
+// that only one of them rewrites the mass storage LUN at a time. Changing
+// the LUN while the other side is halfway through can leave the composite
+// gadget, HID included, wedged until reboot. With no lock file configured
+// it does nothing.
+func lockGadget() (unlock func(), err error) {
+	path := currentConfig.VirtualMedia.GadgetLockFile
+	if path == "" {
+		return func() {}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, &HardwareError{Kind: errIOFailure, Op: "open USB gadget lock", Err: err}
+	}
+
+	deadline := time.Now().Add(gadgetLockTimeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+				f.Close()
+			}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			f.Close()
+			kind := errIOFailure
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				kind = errBusy
+			}
+			return nil, &HardwareError{Kind: kind, Op: "lock USB gadget", Err: err}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
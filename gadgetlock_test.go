@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLockGadget(t *testing.T) {
+	lun := setupLUN(t)
+	oldTimeout := gadgetLockTimeout
+	gadgetLockTimeout = 100 * time.Millisecond
+	defer func() { gadgetLockTimeout = oldTimeout }()
+
+	// Stand in for the web application holding the lock.
+	other, err := os.OpenFile(currentConfig.VirtualMedia.GadgetLockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	fd := int(other.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lun.Attach("/data/installer.iso", true, true); !errors.Is(err, errBusy) {
+		t.Fatalf("Expected errBusy while the gadget is locked, got %v", err)
+	}
+	if state, _ := lun.State(); state.File != "" {
+		t.Fatalf("LUN changed while locked: %+v", state)
+	}
+
+	gadgetLockTimeout = 5 * time.Second
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(100 * time.Millisecond)
+		syscall.Flock(fd, syscall.LOCK_UN)
+	}()
+	defer func() { <-released }()
+	if err := lun.Attach("/data/installer.iso", true, true); err != nil {
+		t.Fatalf("Expected Attach to succeed once the lock is released, got %v", err)
+	}
+
+	currentConfig.VirtualMedia.GadgetLockFile = ""
+	if err := lun.Detach(); err != nil {
+		t.Fatalf("Expected Detach without a lock file to succeed, got %v", err)
+	}
+}
@@ -1,3 +1,5 @@
 module nanokvm-redfish
 
-go 1.21
\ No newline at end of file
+go 1.21
+
+require golang.org/x/crypto v0.31.0
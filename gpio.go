@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A Hardware GPIO is named either by its sysfs value file, as on the
+// kernels NanoKVM ships with, or as "gpiochipN:offset" for a line on a GPIO
+// character device. Sysfs GPIO is deprecated and newer kernels may not have
+// /sys/class/gpio at all, so a sysfs name is translated to its chip and
+// offset and driven through the character device where one exists.
+
+// gpioDevDir and gpioSysfsDir are where the GPIO character devices and the
+// sysfs GPIO class live.
+var (
+	gpioDevDir   = "/dev"
+	gpioSysfsDir = "/sys/class/gpio"
+)
+
+var sysfsGPIOPattern = regexp.MustCompile(`^/sys/class/gpio/gpio(\d+)/value$`)
+
+// gpioLine is a resolved GPIO.
+type gpioLine interface {
+	read() (int, error)
+	// press drives the line to 1 for duration, then back to 0.
+	press(duration time.Duration) error
+}
+
+// parseChipLine splits a "gpiochipN:offset" name; the chip may also be
+// given as a path.
+func parseChipLine(name string) (chip string, offset uint32, ok bool) {
+	chip, number, ok := strings.Cut(name, ":")
+	if !ok || chip == "" {
+		return "", 0, false
+	}
+	n, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return "", 0, false
+	}
+	if !strings.Contains(chip, "/") {
+		chip = filepath.Join(gpioDevDir, chip)
+	}
+	return chip, uint32(n), true
+}
+
+// resolveGPIO turns a Hardware GPIO name into the line to drive.
+func resolveGPIO(name string) gpioLine {
+	if chip, offset, ok := parseChipLine(name); ok {
+		return cdevLine{chip: chip, offset: offset}
+	}
+	if m := sysfsGPIOPattern.FindStringSubmatch(name); m != nil {
+		number, _ := strconv.Atoi(m[1])
+		if chip, offset, err := findGPIOLine(number); err == nil {
+			return cdevLine{chip: chip, offset: offset, sysfs: name}
+		}
+	}
+	return sysfsLine(name)
+}
+
+// gpioChipInfo reads a character device's label and line count; tests
+// replace it.
+var gpioChipInfo = readChipInfo
+
+// findGPIOLine maps a global sysfs GPIO number to a chip and offset. The
+// sysfs gpiochip entries give each chip's base where they exist; without
+// them the bases are assumed to be allocated downwards from 512 in chip
+// order, as the kernels NanoKVM ships with number them.
+func findGPIOLine(number int) (chip string, offset uint32, err error) {
+	chips, err := filepath.Glob(filepath.Join(gpioDevDir, "gpiochip*"))
+	if err != nil || len(chips) == 0 {
+		return "", 0, fmt.Errorf("no GPIO character devices")
+	}
+	sort.Slice(chips, func(i, j int) bool { return chipIndex(chips[i]) < chipIndex(chips[j]) })
+
+	sysfsBases := map[string]int{}
+	entries, _ := filepath.Glob(filepath.Join(gpioSysfsDir, "gpiochip*"))
+	for _, entry := range entries {
+		label, err1 := os.ReadFile(filepath.Join(entry, "label"))
+		base, err2 := os.ReadFile(filepath.Join(entry, "base"))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(string(base))); err == nil {
+			sysfsBases[strings.TrimSpace(string(label))] = n
+		}
+	}
+
+	next := 512
+	for _, path := range chips {
+		label, lines, err := gpioChipInfo(path)
+		if err != nil {
+			continue
+		}
+		base, ok := sysfsBases[label]
+		if !ok {
+			base = next - lines
+		}
+		next = base
+		if number >= base && number < base+lines {
+			return path, uint32(number - base), nil
+		}
+	}
+	return "", 0, fmt.Errorf("GPIO %d is on no GPIO chip", number)
+}
+
+func chipIndex(path string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "gpiochip"))
+	return n
+}
+
+// sysfsLine is a GPIO value file.
+type sysfsLine string
+
+func (l sysfsLine) read() (int, error) {
+	content, err := os.ReadFile(string(l))
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "read GPIO", Err: err}
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "parse GPIO value", Err: err}
+	}
+
+	return value, nil
+}
+
+func (l sysfsLine) set(value int) error {
+	if err := os.WriteFile(string(l), []byte(strconv.Itoa(value&1)), 0o666); err != nil {
+		return &HardwareError{Kind: errIOFailure, Op: "write GPIO", Err: err}
+	}
+	return nil
+}
+
+func (l sysfsLine) press(duration time.Duration) error {
+	if err := l.set(1); err != nil {
+		return err
+	}
+
+	if duration > 0 {
+		time.Sleep(duration)
+	}
+
+	return l.set(0)
+}
+
+// cdevLine is a line on a GPIO character device. sysfs, if set, is the
+// same GPIO's sysfs value file, used when the line is exported there (the
+// NanoKVM web application exports the buttons) and so busy on the chip.
+type cdevLine struct {
+	chip   string
+	offset uint32
+	sysfs  string
+}
+
+// fallback reports whether err from requesting the line means the sysfs
+// file should be used instead.
+func (l cdevLine) fallback(err error) bool {
+	return l.sysfs != "" && (errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ENOTTY))
+}
+
+func (l cdevLine) read() (int, error) {
+	line, err := requestGPIOLine(l.chip, l.offset, gpioLineInput, 0)
+	if err != nil {
+		if l.fallback(err) {
+			return sysfsLine(l.sysfs).read()
+		}
+		return 0, &HardwareError{Kind: errIOFailure, Op: "read GPIO", Err: err}
+	}
+	defer line.Close()
+
+	value, err := line.get()
+	if err != nil {
+		return 0, &HardwareError{Kind: errIOFailure, Op: "read GPIO", Err: err}
+	}
+	return value, nil
+}
+
+func (l cdevLine) press(duration time.Duration) error {
+	line, err := requestGPIOLine(l.chip, l.offset, gpioLineOutput, 1)
+	if err != nil {
+		if l.fallback(err) {
+			return sysfsLine(l.sysfs).press(duration)
+		}
+		return &HardwareError{Kind: errIOFailure, Op: "write GPIO", Err: err}
+	}
+	defer line.Close()
+
+	if duration > 0 {
+		time.Sleep(duration)
+	}
+
+	if err := line.set(0); err != nil {
+		return &HardwareError{Kind: errIOFailure, Op: "write GPIO", Err: err}
+	}
+	return nil
+}
+
+// gpioReadMu serialises reads, since a character device line can only be
+// requested by one reader at a time.
+var gpioReadMu sync.Mutex
+
+func readGPIO(path string) (int, error) {
+	if path == "" {
+		return 0, &HardwareError{Kind: errNotSupported, Op: "read GPIO"}
+	}
+
+	gpioReadMu.Lock()
+	defer gpioReadMu.Unlock()
+	line, ok := watchedLines[path]
+	if !ok {
+		line, ok = heldLines[path]
+	}
+	if ok {
+		value, err := line.get()
+		if err != nil {
+			return 0, &HardwareError{Kind: errIOFailure, Op: "read GPIO", Err: err}
+		}
+		return value, nil
+	}
+	return resolveGPIO(path).read()
+}
+
+// gpioMu serialises button presses; a second press while one is held would
+// turn a short press into a long one.
+var gpioMu sync.Mutex
+
+func writeGPIO(path string, duration int) error {
+	if path == "" {
+		return &HardwareError{Kind: errNotSupported, Op: "write GPIO"}
+	}
+
+	if !gpioMu.TryLock() {
+		return &HardwareError{Kind: errBusy, Op: "write GPIO"}
+	}
+	defer gpioMu.Unlock()
+
+	return resolveGPIO(path).press(time.Duration(duration) * time.Millisecond)
+}
+
+// exportGPIOs exports the sysfs GPIOs of hw and the GPIOs cfg adds that
+// neither exist yet nor can be reached through a character device, as the
+// NanoKVM application does when it starts, so the service works on a
+// freshly booted device. The buttons and auxiliary outputs become outputs
+// driven low; the LEDs, auxiliary inputs and intrusion switch inputs.
+// Failures are logged; the GPIO then fails when it is used, as before.
+func exportGPIOs(hw *Hardware, cfg Config) {
+	type export struct {
+		name      string
+		direction string
+	}
+	gpios := []export{
+		{hw.GPIOReset, "low"},
+		{hw.GPIOPower, "low"},
+		{hw.GPIONMI, "low"},
+		{hw.GPIOPowerLED, "in"},
+		{hw.GPIOHDDLed, "in"},
+		{cfg.ChassisIntrusion.GPIO, "in"},
+	}
+	for _, s := range cfg.Systems {
+		gpios = append(gpios, export{s.GPIO.Reset, "low"}, export{s.GPIO.Power, "low"}, export{s.GPIO.NMI, "low"},
+			export{s.GPIO.PowerLED, "in"}, export{s.GPIO.HDDLED, "in"})
+	}
+	for _, g := range cfg.AuxGPIOs {
+		direction := "in"
+		if g.Direction == "output" {
+			direction = "low"
+		}
+		gpios = append(gpios, export{g.GPIO, direction})
+	}
+	for _, gpio := range gpios {
+		m := sysfsGPIOPattern.FindStringSubmatch(gpio.name)
+		if m == nil {
+			continue
+		}
+		if _, ok := resolveGPIO(gpio.name).(sysfsLine); !ok {
+			continue
+		}
+		dir := filepath.Join(gpioSysfsDir, "gpio"+m[1])
+		if _, err := os.Stat(filepath.Join(dir, "value")); err == nil {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(gpioSysfsDir, "export"), []byte(m[1]), 0o200); err != nil {
+			log.Printf("Failed to export GPIO %s: %v", m[1], err)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, "direction"), []byte(gpio.direction), 0o644); err != nil {
+			log.Printf("Failed to set direction of GPIO %s: %v", m[1], err)
+			continue
+		}
+		log.Printf("Exported GPIO %s as %s", m[1], gpio.direction)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestGPIOUAPISizes(t *testing.T) {
+	// The sizes are encoded in the ioctl numbers; see linux/gpio.h.
+	tests := []struct {
+		name   string
+		size   uintptr
+		expect uintptr
+	}{
+		{"gpiochip_info", unsafe.Sizeof(gpioChipInfoData{}), 68},
+		{"gpio_v2_line_config", unsafe.Sizeof(gpioV2LineConfig{}), 272},
+		{"gpio_v2_line_request", unsafe.Sizeof(gpioV2LineRequest{}), 592},
+		{"gpio_v2_line_values", unsafe.Sizeof(gpioV2LineValues{}), 16},
+		{"gpio_v2_line_event", unsafe.Sizeof(gpioV2LineEvent{}), 48},
+	}
+	for _, tt := range tests {
+		if tt.size != tt.expect {
+			t.Errorf("Expected %s to be %d bytes, got %d", tt.name, tt.expect, tt.size)
+		}
+	}
+}
+
+// setupGPIOChips creates stand-ins for GPIO character devices with the
+// given line counts and, if sysfsBases is set, their sysfs entries.
+func setupGPIOChips(t *testing.T, lines []int, sysfsBases []int) {
+	t.Helper()
+	devDir, sysfsDir := t.TempDir(), t.TempDir()
+	for i := range lines {
+		if err := os.WriteFile(filepath.Join(devDir, fmt.Sprintf("gpiochip%d", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, base := range sysfsBases {
+		entry := filepath.Join(sysfsDir, fmt.Sprintf("gpiochip%d", base))
+		os.Mkdir(entry, 0755)
+		os.WriteFile(filepath.Join(entry, "label"), []byte(fmt.Sprintf("bank%d\n", i)), 0644)
+		os.WriteFile(filepath.Join(entry, "base"), []byte(fmt.Sprintf("%d\n", base)), 0644)
+	}
+
+	oldDev, oldSysfs, oldInfo := gpioDevDir, gpioSysfsDir, gpioChipInfo
+	gpioDevDir, gpioSysfsDir = devDir, sysfsDir
+	gpioChipInfo = func(path string) (string, int, error) {
+		i := chipIndex(path)
+		return fmt.Sprintf("bank%d", i), lines[i], nil
+	}
+	t.Cleanup(func() { gpioDevDir, gpioSysfsDir, gpioChipInfo = oldDev, oldSysfs, oldInfo })
+}
+
+func TestResolveGPIO(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []int
+		sysfsBases []int
+		gpio       string
+		expect     gpioLine
+	}{
+		{
+			name:       "Bases from sysfs",
+			lines:      []int{32, 32},
+			sysfsBases: []int{448, 480},
+			gpio:       "/sys/class/gpio/gpio503/value",
+			expect:     cdevLine{chip: "gpiochip1", offset: 23, sysfs: "/sys/class/gpio/gpio503/value"},
+		},
+		{
+			name:   "Bases allocated downwards",
+			lines:  []int{32, 32},
+			gpio:   "/sys/class/gpio/gpio470/value",
+			expect: cdevLine{chip: "gpiochip1", offset: 22, sysfs: "/sys/class/gpio/gpio470/value"},
+		},
+		{
+			name:   "Number on no chip",
+			lines:  []int{32},
+			gpio:   "/sys/class/gpio/gpio12/value",
+			expect: sysfsLine("/sys/class/gpio/gpio12/value"),
+		},
+		{
+			name:   "No character devices",
+			gpio:   "/sys/class/gpio/gpio503/value",
+			expect: sysfsLine("/sys/class/gpio/gpio503/value"),
+		},
+		{
+			name:   "Chip and offset",
+			gpio:   "gpiochip2:7",
+			expect: cdevLine{chip: "gpiochip2", offset: 7},
+		},
+		{
+			name:   "Other file",
+			gpio:   "/tmp/gpio_power",
+			expect: sysfsLine("/tmp/gpio_power"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupGPIOChips(t, tt.lines, tt.sysfsBases)
+			if line, ok := tt.expect.(cdevLine); ok {
+				line.chip = filepath.Join(gpioDevDir, line.chip)
+				tt.expect = line
+			}
+			if got := resolveGPIO(tt.gpio); got != tt.expect {
+				t.Errorf("Expected %+v, got %+v", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestExportGPIOs(t *testing.T) {
+	setupGPIOChips(t, nil, nil)
+	for _, dir := range []string{"gpio503", "gpio504", "gpio507"} {
+		// The kernel creates these on export; gpio504 is exported already.
+		if err := os.Mkdir(filepath.Join(gpioSysfsDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(gpioSysfsDir, "gpio504", "value"), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gpioSysfsDir, "export"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hw := HWAlpha
+	hw.GPIOHDDLed = "/sys/class/gpio/gpio999/value"
+	exportGPIOs(&hw, Config{})
+
+	for _, tt := range []struct {
+		gpio      string
+		direction string
+	}{
+		{"gpio503", "low"},
+		{"gpio507", "low"},
+		{"gpio504", ""},
+	} {
+		content, _ := os.ReadFile(filepath.Join(gpioSysfsDir, tt.gpio, "direction"))
+		if string(content) != tt.direction {
+			t.Errorf("Expected %s direction %q, got %q", tt.gpio, tt.direction, content)
+		}
+	}
+	// gpio999 does not appear after export, so it was the last one tried.
+	if content, _ := os.ReadFile(filepath.Join(gpioSysfsDir, "export")); string(content) != "999" {
+		t.Errorf("Expected gpio999 exported last, got %q", content)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Structures and ioctls of the Linux GPIO character device, version 2 of
+// the uAPI (linux/gpio.h, kernel 5.10 and later).
+
+const (
+	gpioGetChipInfoIoctl      = 0x8044b401
+	gpioV2GetLineIoctl        = 0xc250b407
+	gpioV2LineGetValuesIoctl  = 0xc010b40e
+	gpioV2LineSetValuesIoctl  = 0xc010b40f
+	gpioV2LineFlagInput       = 1 << 2
+	gpioV2LineFlagOutput      = 1 << 3
+	gpioV2LineFlagEdgeRising  = 1 << 4
+	gpioV2LineFlagEdgeFalling = 1 << 5
+	gpioV2LineAttrOutputValue = 2
+)
+
+type gpioChipInfoData struct {
+	Name  [32]byte
+	Label [32]byte
+	Lines uint32
+}
+
+type gpioV2LineAttribute struct {
+	ID      uint32
+	Padding uint32
+	Value   uint64
+}
+
+type gpioV2LineConfigAttribute struct {
+	Attr gpioV2LineAttribute
+	Mask uint64
+}
+
+type gpioV2LineConfig struct {
+	Flags    uint64
+	NumAttrs uint32
+	Padding  [5]uint32
+	Attrs    [10]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	Offsets         [64]uint32
+	Consumer        [32]byte
+	Config          gpioV2LineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	Padding         [5]uint32
+	Fd              int32
+}
+
+type gpioV2LineValues struct {
+	Bits uint64
+	Mask uint64
+}
+
+type gpioV2LineEvent struct {
+	TimestampNs uint64
+	ID          uint32
+	Offset      uint32
+	Seqno       uint32
+	LineSeqno   uint32
+	Padding     [6]uint32
+}
+
+func gpioIoctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func readChipInfo(path string) (label string, lines int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	var info gpioChipInfoData
+	if err := gpioIoctl(f.Fd(), gpioGetChipInfoIoctl, unsafe.Pointer(&info)); err != nil {
+		return "", 0, err
+	}
+	return string(bytes.TrimRight(info.Label[:], "\x00")), int(info.Lines), nil
+}
+
+type gpioLineDirection int
+
+const (
+	gpioLineInput gpioLineDirection = iota
+	gpioLineOutput
+	// gpioLineEdges is an input that also queues an event on every edge;
+	// its handle is non-blocking, so a Read waiting for one returns when
+	// the handle is closed.
+	gpioLineEdges
+)
+
+// gpioLineHandle is a line requested from a chip; closing it releases the
+// line.
+type gpioLineHandle struct {
+	*os.File
+}
+
+// requestGPIOLine requests one line of chip, driving value on it if it is
+// an output.
+func requestGPIOLine(chip string, offset uint32, direction gpioLineDirection, value int) (*gpioLineHandle, error) {
+	f, err := os.OpenFile(chip, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	req := gpioV2LineRequest{NumLines: 1}
+	req.Offsets[0] = offset
+	copy(req.Consumer[:], "nanokvm-redfish")
+	req.Config.Flags = gpioV2LineFlagInput
+	if direction == gpioLineOutput {
+		req.Config.Flags = gpioV2LineFlagOutput
+		req.Config.NumAttrs = 1
+		req.Config.Attrs[0] = gpioV2LineConfigAttribute{
+			Attr: gpioV2LineAttribute{ID: gpioV2LineAttrOutputValue, Value: uint64(value & 1)},
+			Mask: 1,
+		}
+	}
+	if direction == gpioLineEdges {
+		req.Config.Flags = gpioV2LineFlagInput | gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling
+	}
+	if err := gpioIoctl(f.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	if direction == gpioLineEdges {
+		if err := syscall.SetNonblock(int(req.Fd), true); err != nil {
+			syscall.Close(int(req.Fd))
+			return nil, err
+		}
+	}
+	return &gpioLineHandle{os.NewFile(uintptr(req.Fd), chip)}, nil
+}
+
+// ioctl goes through SyscallConn because Fd would put an edge handle back
+// into blocking mode.
+func (h *gpioLineHandle) ioctl(request uintptr, arg unsafe.Pointer) error {
+	conn, err := h.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	if err := conn.Control(func(fd uintptr) { ioctlErr = gpioIoctl(fd, request, arg) }); err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func (h *gpioLineHandle) get() (int, error) {
+	values := gpioV2LineValues{Mask: 1}
+	if err := h.ioctl(gpioV2LineGetValuesIoctl, unsafe.Pointer(&values)); err != nil {
+		return 0, err
+	}
+	return int(values.Bits & 1), nil
+}
+
+func (h *gpioLineHandle) set(value int) error {
+	values := gpioV2LineValues{Bits: uint64(value & 1), Mask: 1}
+	return h.ioctl(gpioV2LineSetValuesIoctl, unsafe.Pointer(&values))
+}
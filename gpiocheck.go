@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gpioProblem is a GPIO that failed the startup check, with what to do
+// about it.
+type gpioProblem struct {
+	Name   string
+	Path   string
+	Reason string
+	// Critical is set for the GPIOs power actions cannot do without.
+	Critical bool
+}
+
+// gpioProblems is the result of checkGPIOs at startup, shown in the
+// manager's Status.
+var gpioProblems []gpioProblem
+
+// checkGPIOs checks that every GPIO of hw can be used, without pressing
+// anything: the buttons must be writable and the LEDs readable. Each
+// problem is logged.
+func checkGPIOs(hw *Hardware) []gpioProblem {
+	var problems []gpioProblem
+	for _, gpio := range []struct {
+		name     string
+		path     string
+		output   bool
+		critical bool
+	}{
+		{"reset", hw.GPIOReset, true, true},
+		{"power", hw.GPIOPower, true, true},
+		{"power_led", hw.GPIOPowerLED, false, true},
+		{"hdd_led", hw.GPIOHDDLed, false, false},
+		{"nmi", hw.GPIONMI, true, false},
+	} {
+		if gpio.path == "" {
+			continue
+		}
+		if reason := checkGPIO(gpio.path, gpio.output); reason != "" {
+			log.Printf("GPIO %s (%s) is not usable: %s", gpio.name, gpio.path, reason)
+			problems = append(problems, gpioProblem{gpio.name, gpio.path, reason, gpio.critical})
+		}
+	}
+	return problems
+}
+
+// checkGPIO returns why the GPIO cannot be used, or "" if it can.
+func checkGPIO(path string, output bool) string {
+	line, ok := resolveGPIO(path).(cdevLine)
+	if !ok {
+		return checkSysfsGPIO(path, output)
+	}
+
+	f, err := os.OpenFile(line.chip, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Sprintf("cannot open %s: %s", line.chip, describeFileError(err))
+	}
+	f.Close()
+	if _, lines, err := gpioChipInfo(line.chip); err == nil && int(line.offset) >= lines {
+		return fmt.Sprintf("%s has only %d lines; is this the right board revision?", line.chip, lines)
+	}
+	// An exported line is busy on the chip and used through sysfs.
+	if line.sysfs != "" {
+		if _, err := os.Stat(line.sysfs); err == nil {
+			return checkSysfsGPIO(line.sysfs, output)
+		}
+	}
+	return ""
+}
+
+func checkSysfsGPIO(path string, output bool) string {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		m := sysfsGPIOPattern.FindStringSubmatch(path)
+		switch {
+		case m == nil:
+			return fmt.Sprintf("%s does not exist", path)
+		case !dirExists(gpioSysfsDir):
+			return "this kernel has no sysfs GPIO; name the GPIO as gpiochipN:offset"
+		}
+		return fmt.Sprintf("GPIO %s is not exported; write %s to %s/export, or is this the right board revision?",
+			m[1], m[1], gpioSysfsDir)
+	}
+
+	flag := os.O_RDONLY
+	if output {
+		flag = os.O_WRONLY
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return fmt.Sprintf("cannot open %s: %s", path, describeFileError(err))
+	}
+	f.Close()
+
+	if output {
+		direction, err := os.ReadFile(filepath.Join(filepath.Dir(path), "direction"))
+		if err == nil && strings.TrimSpace(string(direction)) == "in" {
+			return fmt.Sprintf("GPIO is an input; write out to %s", filepath.Join(filepath.Dir(path), "direction"))
+		}
+	}
+	return ""
+}
+
+func describeFileError(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied; run the service as root or give it access"
+	case errors.Is(err, fs.ErrNotExist):
+		return "no such file"
+	}
+	return err.Error()
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// managerStatus is the manager's Status, with a Condition for each GPIO
+// that failed the startup check.
+func managerStatus() map[string]interface{} {
+	health := "OK"
+	var conditions []map[string]interface{}
+	for _, p := range gpioProblems {
+		severity := "Warning"
+		if p.Critical {
+			severity = "Critical"
+		}
+		if health != "Critical" {
+			health = severity
+		}
+		conditions = append(conditions, map[string]interface{}{
+			"MessageId":   resourceEventPrefix + "ResourceErrorsDetected",
+			"Message":     fmt.Sprintf("GPIO %s (%s) is not usable: %s", p.Name, p.Path, p.Reason),
+			"MessageArgs": []string{"GPIO/" + p.Name, p.Reason},
+			"Severity":    severity,
+		})
+	}
+	status := map[string]interface{}{"State": "Enabled", "Health": health}
+	if conditions != nil {
+		status["Conditions"] = conditions
+	}
+	return status
+}
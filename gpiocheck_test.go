@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckGPIOs(t *testing.T) {
+	setupGPIOChips(t, nil, nil)
+	dir := t.TempDir()
+	for name, direction := range map[string]string{"power": "out", "reset": "in", "led": "in"} {
+		os.Mkdir(filepath.Join(dir, name), 0755)
+		os.WriteFile(filepath.Join(dir, name, "value"), []byte("0\n"), 0644)
+		os.WriteFile(filepath.Join(dir, name, "direction"), []byte(direction+"\n"), 0644)
+	}
+
+	hw := &Hardware{
+		GPIOPower:    filepath.Join(dir, "power", "value"),
+		GPIOReset:    filepath.Join(dir, "reset", "value"),
+		GPIOPowerLED: filepath.Join(dir, "led", "value"),
+		// Not exported.
+		GPIOHDDLed: "/sys/class/gpio/gpio505/value",
+	}
+	problems := checkGPIOs(hw)
+
+	expect := map[string]string{
+		"reset":   "GPIO is an input",
+		"hdd_led": "GPIO 505 is not exported",
+	}
+	if len(problems) != len(expect) {
+		t.Fatalf("Expected problems with %v, got %+v", expect, problems)
+	}
+	for _, p := range problems {
+		if !strings.HasPrefix(p.Reason, expect[p.Name]) {
+			t.Errorf("Expected %s to fail with %q, got %q", p.Name, expect[p.Name], p.Reason)
+		}
+	}
+
+	old := gpioProblems
+	defer func() { gpioProblems = old }()
+	gpioProblems = problems
+	status := managerStatus()
+	if status["Health"] != "Critical" {
+		t.Errorf("Expected Critical with the reset GPIO unusable, got %v", status["Health"])
+	}
+	if conditions, _ := status["Conditions"].([]map[string]interface{}); len(conditions) != 2 {
+		t.Errorf("Expected a condition for each GPIO, got %v", status["Conditions"])
+	}
+	gpioProblems = nil
+	if status := managerStatus(); status["Health"] != "OK" || status["Conditions"] != nil {
+		t.Errorf("Expected OK without problems, got %v", status)
+	}
+}
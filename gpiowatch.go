@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// watchedLines holds the character device lines requested for edge events,
+// by Hardware GPIO name. The kernel gives a line to one requester only, so
+// readGPIO reads a watched line through its handle. Guarded by gpioReadMu.
+var watchedLines = map[string]*gpioLineHandle{}
+
+// watchGPIO signals on the returned channel soon after the GPIO changes,
+// until stop is closed. A signal only says the line may have changed; the
+// channel holds at most one, so a burst of edges coalesces into one.
+func watchGPIO(name string, stop <-chan struct{}) (<-chan struct{}, error) {
+	if name == "" {
+		return nil, &HardwareError{Kind: errNotSupported, Op: "watch GPIO"}
+	}
+	changed := make(chan struct{}, 1)
+	var err error
+	switch line := resolveGPIO(name).(type) {
+	case cdevLine:
+		err = line.watch(name, changed, stop)
+	case sysfsLine:
+		err = line.watch(changed, stop)
+	}
+	if err != nil {
+		return nil, &HardwareError{Kind: errIOFailure, Op: "watch GPIO", Err: err}
+	}
+	return changed, nil
+}
+
+func notifyChanged(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+func (l cdevLine) watch(name string, changed chan<- struct{}, stop <-chan struct{}) error {
+	line, err := requestGPIOLine(l.chip, l.offset, gpioLineEdges, 0)
+	if err != nil {
+		if l.fallback(err) {
+			return sysfsLine(l.sysfs).watch(changed, stop)
+		}
+		return err
+	}
+	gpioReadMu.Lock()
+	watchedLines[name] = line
+	gpioReadMu.Unlock()
+
+	go func() {
+		<-stop
+		gpioReadMu.Lock()
+		delete(watchedLines, name)
+		gpioReadMu.Unlock()
+		line.Close()
+	}()
+	go func() {
+		events := make([]byte, 16*unsafe.Sizeof(gpioV2LineEvent{}))
+		for {
+			// The events themselves do not matter, only that there were
+			// some; the value is read afresh.
+			if _, err := line.Read(events); err != nil {
+				return
+			}
+			notifyChanged(changed)
+		}
+	}()
+	return nil
+}
+
+// watch enables interrupts on a sysfs GPIO and waits for them with
+// select(2), where sysfs reports a changed value as an exceptional
+// condition.
+func (l sysfsLine) watch(changed chan<- struct{}, stop <-chan struct{}) error {
+	// Only GPIOs that can interrupt have an edge file; it is not created
+	// for a value file that is not a sysfs GPIO.
+	edge, err := os.OpenFile(filepath.Join(filepath.Dir(string(l)), "edge"), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = edge.Write([]byte("both"))
+	edge.Close()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(string(l))
+	if err != nil {
+		return err
+	}
+	fd := int(f.Fd())
+
+	go func() {
+		defer f.Close()
+		value := make([]byte, 8)
+		for {
+			// Reading the value from the start re-arms the notification.
+			if _, err := f.ReadAt(value, 0); err != nil {
+				log.Printf("Stopped watching %s: %v", l, err)
+				return
+			}
+			var except syscall.FdSet
+			bits := int(8 * unsafe.Sizeof(except.Bits[0]))
+			except.Bits[fd/bits] |= 1 << (fd % bits)
+			timeout := syscall.NsecToTimeval(int64(time.Second))
+			n, err := syscall.Select(fd+1, nil, nil, &except, &timeout)
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err != nil && err != syscall.EINTR {
+				log.Printf("Stopped watching %s: %v", l, err)
+				return
+			}
+			if n > 0 {
+				notifyChanged(changed)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import "time"
+
+// HardwareBackend reads and drives the host's front panel. Handlers reach
+// it through getPowerState and the button functions, so another way of
+// wiring up the host, such as a serial-controlled ATX board, only needs a
+// new implementation.
+type HardwareBackend interface {
+	// GetPowerState reports "On" or "Off".
+	GetPowerState() (string, error)
+	// PressPower and PressReset hold the button down for duration.
+	PressPower(duration time.Duration) error
+	PressReset(duration time.Duration) error
+}
+
+var hardwareBackend HardwareBackend = gpioBackend{}
+
+// nmiBackend is implemented by backends that can raise a non-maskable
+// interrupt on the host, for boards with an NMI header.
+type nmiBackend interface {
+	SupportsNMI() bool
+	PressNMI(duration time.Duration) error
+}
+
+// nmiPulse is how long the NMI line is held.
+const nmiPulse = 200 * time.Millisecond
+
+// panelCapabilities is implemented by backends whose board may lack some
+// of the front panel wiring, as some NanoKVM variants do: one without a
+// power LED cannot tell whether the host is on, one without the ATX
+// header cannot press its buttons at all.
+type panelCapabilities interface {
+	SupportsPowerState() bool
+	SupportsPowerButton() bool
+	SupportsReset() bool
+}
+
+// hddLEDReader is implemented by backends that can read the host's drive
+// activity LED.
+type hddLEDReader interface {
+	SupportsHDDLED() bool
+	ReadHDDLED() (bool, error)
+}
+
+// powerWatcher is implemented by backends that can tell when the power
+// state may have changed, so powerMonitor need not poll for it. The channel
+// is signalled after a change until stop is closed.
+type powerWatcher interface {
+	WatchPower(stop <-chan struct{}) (<-chan struct{}, error)
+}
+
+// gpioBackend drives the GPIOs of hw, or of currentHardware if hw is nil.
+type gpioBackend struct {
+	hw *Hardware
+}
+
+func (b gpioBackend) hardware() *Hardware {
+	if b.hw != nil {
+		return b.hw
+	}
+	return currentHardware
+}
+
+func (b gpioBackend) GetPowerState() (string, error) {
+	hw := b.hardware()
+	if hw.GPIOPowerLED == "" {
+		return "", &HardwareError{Kind: errNotSupported, Op: "read power state"}
+	}
+	powerLED, err := readGPIO(hw.GPIOPowerLED)
+	if err != nil {
+		return "", err
+	}
+
+	// GPIO value is inverted: 0 = power on, 1 = power off
+	if (powerLED == 0) != hw.PowerLEDActiveHigh {
+		return "On", nil
+	}
+	return "Off", nil
+}
+
+func (b gpioBackend) WatchPower(stop <-chan struct{}) (<-chan struct{}, error) {
+	return watchGPIO(b.hardware().GPIOPowerLED, stop)
+}
+
+func (b gpioBackend) SupportsPowerState() bool {
+	return b.hardware().GPIOPowerLED != ""
+}
+
+func (b gpioBackend) SupportsPowerButton() bool {
+	return b.hardware().GPIOPower != ""
+}
+
+func (b gpioBackend) SupportsReset() bool {
+	return b.hardware().GPIOReset != ""
+}
+
+func (b gpioBackend) SupportsNMI() bool {
+	return b.hardware().GPIONMI != ""
+}
+
+func (b gpioBackend) PressNMI(duration time.Duration) error {
+	return writeGPIO(b.hardware().GPIONMI, int(duration/time.Millisecond))
+}
+
+func (b gpioBackend) SupportsHDDLED() bool {
+	return b.hardware().GPIOHDDLed != ""
+}
+
+// ReadHDDLED assumes the HDD LED is wired like the power LED.
+func (b gpioBackend) ReadHDDLED() (bool, error) {
+	hw := b.hardware()
+	value, err := readGPIO(hw.GPIOHDDLed)
+	if err != nil {
+		return false, err
+	}
+	return (value == 0) != hw.PowerLEDActiveHigh, nil
+}
+
+func (b gpioBackend) PressPower(duration time.Duration) error {
+	if !b.SupportsPowerButton() {
+		return &HardwareError{Kind: errNotSupported, Op: "press power button"}
+	}
+	return writeGPIO(b.hardware().GPIOPower, int(duration/time.Millisecond))
+}
+
+func (b gpioBackend) PressReset(duration time.Duration) error {
+	if !b.SupportsReset() {
+		return &HardwareError{Kind: errNotSupported, Op: "press reset button"}
+	}
+	return writeGPIO(b.hardware().GPIOReset, int(duration/time.Millisecond))
+}
+
+// PressDurations overrides the board's button press lengths, in
+// milliseconds, for one action; zero keeps the board's.
+type PressDurations struct {
+	PowerMs     int `json:"PowerMs,omitempty"`
+	LongPressMs int `json:"LongPressMs,omitempty"`
+	ResetMs     int `json:"ResetMs,omitempty"`
+}
+
+// maxPressMs bounds an overridden press; the buttons cannot be pressed
+// for anything else in the meantime.
+const maxPressMs = 30000
+
+// validate returns the first out of range field and its value.
+func (p PressDurations) validate() (string, int, bool) {
+	for _, field := range []struct {
+		name  string
+		value int
+	}{{"PowerMs", p.PowerMs}, {"LongPressMs", p.LongPressMs}, {"ResetMs", p.ResetMs}} {
+		if field.value < 0 || field.value > maxPressMs {
+			return field.name, field.value, false
+		}
+	}
+	return "", 0, true
+}
+
+func (p PressDurations) apply(power, long, reset int) (int, int, int) {
+	if p.PowerMs > 0 {
+		power = p.PowerMs
+	}
+	if p.LongPressMs > 0 {
+		long = p.LongPressMs
+	}
+	if p.ResetMs > 0 {
+		reset = p.ResetMs
+	}
+	return power, long, reset
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// powerLossWindow is how long an unexpected power loss keeps the system's
+// Health at Warning.
+var powerLossWindow = time.Hour
+
+// powerActivity tells the power changes the service caused from the ones
+// it did not: a change within poweringOffWindow of a reset is its doing.
+var powerActivity struct {
+	sync.Mutex
+	running  int
+	ended    time.Time
+	lastLoss time.Time
+}
+
+func beginPowerAction() {
+	powerActivity.Lock()
+	defer powerActivity.Unlock()
+	powerActivity.running++
+}
+
+func endPowerAction() {
+	powerActivity.Lock()
+	defer powerActivity.Unlock()
+	powerActivity.running--
+	powerActivity.ended = time.Now()
+}
+
+// notePowerLoss is an onPowerStateChange listener recording the host going
+// off with no reset to explain it: a crash, a cut to its power supply or a
+// shutdown from its own OS, which cannot be told apart from here.
+func notePowerLoss(from, to string) {
+	if from != "On" || to != "Off" {
+		return
+	}
+	powerActivity.Lock()
+	defer powerActivity.Unlock()
+	if powerActivity.running > 0 || time.Since(powerActivity.ended) < poweringOffWindow {
+		return
+	}
+	log.Printf("Host went off without a power action")
+	powerActivity.lastLoss = time.Now()
+}
+
+// systemStatus derives the ComputerSystem's Status from what can be seen
+// of the host: its power state, recent power losses and, where the board
+// has one, the HDD LED (indicator, as from indicatorLED). Power losses are
+// only noticed on System.1, which the power monitor watches.
+func systemStatus(s *hostSystem, powerState, indicator string) map[string]string {
+	state := map[string]string{
+		"On":          "Enabled",
+		"PoweringOn":  "Starting",
+		"PoweringOff": "Enabled",
+		"Off":         "StandbyOffline",
+		// A board without a power LED cannot tell.
+		"": "Enabled",
+	}[powerState]
+	if state == "" {
+		state = "UnavailableOffline"
+	}
+
+	health := "OK"
+	powerActivity.Lock()
+	lastLoss := powerActivity.lastLoss
+	powerActivity.Unlock()
+	if s == primarySystem && !lastLoss.IsZero() && time.Since(lastLoss) < powerLossWindow {
+		health = "Warning"
+	}
+	// Disks busy on a host whose power LED says it is off means one of
+	// the LEDs is wrong.
+	if powerState == "Off" && (indicator == "Lit" || indicator == "Blinking") {
+		health = "Warning"
+	}
+	return map[string]string{"State": state, "Health": health, "HealthRollup": health}
+}
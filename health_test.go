@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// setupPowerActivity starts from a service that has never reset the host.
+func setupPowerActivity(t *testing.T) {
+	t.Helper()
+	powerActivity.Lock()
+	old := powerActivity.ended
+	powerActivity.ended, powerActivity.lastLoss = time.Time{}, time.Time{}
+	powerActivity.Unlock()
+	t.Cleanup(func() {
+		powerActivity.Lock()
+		powerActivity.ended, powerActivity.lastLoss = old, time.Time{}
+		powerActivity.Unlock()
+	})
+}
+
+func TestSystemStatus(t *testing.T) {
+	setupPowerActivity(t)
+
+	tests := []struct {
+		powerState   string
+		indicator    string
+		expectState  string
+		expectHealth string
+	}{
+		{"On", "", "Enabled", "OK"},
+		{"PoweringOn", "", "Starting", "OK"},
+		{"Off", "", "StandbyOffline", "OK"},
+		{"Off", "Off", "StandbyOffline", "OK"},
+		{"Off", "Blinking", "StandbyOffline", "Warning"},
+		{"On", "Lit", "Enabled", "OK"},
+	}
+	for _, tt := range tests {
+		status := systemStatus(primarySystem, tt.powerState, tt.indicator)
+		if status["State"] != tt.expectState || status["Health"] != tt.expectHealth {
+			t.Errorf("%s with HDD LED %q: expected %s/%s, got %s/%s", tt.powerState, tt.indicator,
+				tt.expectState, tt.expectHealth, status["State"], status["Health"])
+		}
+	}
+}
+
+func TestUnexpectedPowerLoss(t *testing.T) {
+	setupPowerActivity(t)
+
+	// A power loss the service caused is expected.
+	beginPowerAction()
+	notePowerLoss("On", "Off")
+	endPowerAction()
+	notePowerLoss("On", "Off")
+	if health := systemStatus(primarySystem, "Off", "")["Health"]; health != "OK" {
+		t.Errorf("Expected OK after a reset, got %s", health)
+	}
+
+	powerActivity.Lock()
+	powerActivity.ended = time.Now().Add(-2 * poweringOffWindow)
+	powerActivity.Unlock()
+	notePowerLoss("On", "Off")
+	if health := systemStatus(primarySystem, "Off", "")["Health"]; health != "Warning" {
+		t.Errorf("Expected Warning after an unexpected power loss, got %s", health)
+	}
+
+	old := powerLossWindow
+	powerLossWindow = 0
+	defer func() { powerLossWindow = old }()
+	if health := systemStatus(primarySystem, "Off", "")["Health"]; health != "OK" {
+		t.Errorf("Expected OK once the loss is no longer recent, got %s", health)
+	}
+}
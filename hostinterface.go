@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const hostInterfacesPath = "/redfish/v1/Managers/BMC/HostInterfaces"
+
+// hostInterfaceListener is the address the in-band listener is serving on,
+// or empty when the host interface is not active.
+var hostInterfaceListener string
+
+// SMBIOSType42 carries the fields a host agent needs to build an SMBIOS
+// Type 42 (Management Controller Host Interface) record for Redfish over
+// IP, as described in DSP0270.
+type SMBIOSType42 struct {
+	InterfaceType                 string `json:"InterfaceType"`
+	DeviceType                    string `json:"DeviceType"`
+	VendorID                      string `json:"VendorId,omitempty"`
+	ProductID                     string `json:"ProductId,omitempty"`
+	SerialNumber                  string `json:"SerialNumber,omitempty"`
+	ProtocolType                  string `json:"ProtocolType"`
+	ServiceUUID                   string `json:"ServiceUUID"`
+	HostIPAssignmentType          string `json:"HostIPAssignmentType"`
+	RedfishServiceIPDiscoveryType string `json:"RedfishServiceIPDiscoveryType"`
+	RedfishServiceIPAddressFormat string `json:"RedfishServiceIPAddressFormat"`
+	RedfishServiceIPAddress       string `json:"RedfishServiceIPAddress"`
+	RedfishServiceIPMask          string `json:"RedfishServiceIPMask"`
+	RedfishServiceIPPort          int    `json:"RedfishServiceIPPort"`
+	RedfishServiceHostname        string `json:"RedfishServiceHostname"`
+}
+
+// hostInterfaceAddress returns the first IPv4 address and mask assigned to
+// the gadget network interface.
+func hostInterfaceAddress(name string) (net.IP, net.IPMask, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4(), ipnet.Mask, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no IPv4 address on %s", name)
+}
+
+func readGadgetAttr(name string) string {
+	content, err := os.ReadFile(currentConfig.HostInterface.GadgetDir + "/" + name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func buildSMBIOSType42() SMBIOSType42 {
+	cfg := currentConfig.HostInterface
+	record := SMBIOSType42{
+		InterfaceType:                 "NetworkHostInterface",
+		DeviceType:                    "USBNetworkInterface",
+		VendorID:                      readGadgetAttr("idVendor"),
+		ProductID:                     readGadgetAttr("idProduct"),
+		SerialNumber:                  readGadgetAttr("strings/0x409/serialnumber"),
+		ProtocolType:                  "RedfishOverIP",
+		ServiceUUID:                   serviceUUID(),
+		HostIPAssignmentType:          "HostSelected",
+		RedfishServiceIPDiscoveryType: "Static",
+		RedfishServiceIPAddressFormat: "IPv4",
+		RedfishServiceIPPort:          cfg.Port,
+	}
+	record.RedfishServiceHostname, _ = os.Hostname()
+
+	if ip, mask, err := hostInterfaceAddress(cfg.Interface); err == nil {
+		record.RedfishServiceIPAddress = ip.String()
+		record.RedfishServiceIPMask = net.IP(mask).String()
+	}
+	return record
+}
+
+// withPrivilegeCap rejects requests needing a privilege that role lacks,
+// judging them by the cleaned path they are routed by. It also has withAuth
+// limit the principal to role, so the cap holds even for administrators.
+func withPrivilegeCap(role string, next http.Handler) http.Handler {
+	limit := &Principal{RoleID: role}
+	return withCanonicalPath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limit.HasPrivilege(requiredPrivilege(r)) {
+			writeInsufficientPrivilege(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), privilegeCapContextKey, role)))
+	}))
+}
+
+func newHostInterfaceHandler() http.Handler {
+	return withPrivilegeCap(currentConfig.HostInterface.Role, newHandler())
+}
+
+// startHostInterface serves the in-band endpoint on the gadget network
+// interface. A missing interface means the USB network gadget is off,
+// which is logged rather than treated as fatal.
+func startHostInterface() {
+	cfg := currentConfig.HostInterface
+	ip, _, err := hostInterfaceAddress(cfg.Interface)
+	if err != nil {
+		log.Printf("Host interface not started: %v", err)
+		return
+	}
+
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(cfg.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("Host interface not started: %v", err)
+		return
+	}
+	hostInterfaceListener = addr
+	log.Printf("Serving Redfish Host Interface on %s (role %s)", addr, cfg.Role)
+
+	go func() {
+		err := http.Serve(listener, newHostInterfaceHandler())
+		log.Printf("Host interface stopped: %v", err)
+	}()
+}
+
+func handleHostInterfaces(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, hostInterfacesPath), "/")
+
+	switch rest {
+	case "":
+		handleHostInterfaceCollection(w, r)
+	case "1":
+		handleHostInterface(w, r)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleHostInterfaceCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	if currentConfig.HostInterface.Enabled {
+		members = append(members, map[string]string{"@odata.id": hostInterfacesPath + "/1"})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#HostInterfaceCollection.HostInterfaceCollection",
+		ODataID:   hostInterfacesPath,
+		Name:      "Host Interface Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleHostInterface(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig.HostInterface
+	if !cfg.Enabled {
+		writeNotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	authModes := []string{"AuthNone"}
+	if currentConfig.RequireAuth {
+		authModes = []string{"BasicAuth", "RedfishSessionAuth"}
+	}
+	state := "Enabled"
+	if hostInterfaceListener == "" {
+		state = "StandbyOffline"
+	}
+
+	hostInterface := map[string]interface{}{
+		"@odata.type":          odataType("HostInterface"),
+		"@odata.id":            hostInterfacesPath + "/1",
+		"Id":                   "1",
+		"Name":                 "Redfish Host Interface",
+		"HostInterfaceType":    "NetworkHostInterface",
+		"InterfaceEnabled":     hostInterfaceListener != "",
+		"ExternallyAccessible": false,
+		"AuthenticationModes":  authModes,
+		"Status": map[string]string{
+			"State":  state,
+			"Health": "OK",
+		},
+		"Oem": map[string]interface{}{
+			"NanoKVM": map[string]interface{}{
+				"Interface":    cfg.Interface,
+				"Role":         cfg.Role,
+				"SMBIOSType42": buildSMBIOSType42(),
+			},
+		},
+	}
+
+	if isManagerInterface(cfg.Interface) {
+		hostInterface["ManagerEthernetInterface"] = map[string]string{
+			"@odata.id": ethernetInterfacesPath + "/" + cfg.Interface,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hostInterface)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrivilegeCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		method     string
+		path       string
+		expectCode int
+	}{
+		{"Read allowed", "ReadOnly", "GET", "/redfish/v1/Systems", http.StatusOK},
+		{"Reset refused", "ReadOnly", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", http.StatusForbidden},
+		{"Boot override refused", "ReadOnly", "PATCH", "/redfish/v1/Systems/System.1", http.StatusForbidden},
+		{"Reset through dot-dot refused", "ReadOnly", "POST",
+			"/redfish/v1/SessionService/../Systems/System.1/Actions/ComputerSystem.Reset", http.StatusForbidden},
+		{"Manager with trailing slash refused", "Operator", "PATCH", "/redfish/v1/Managers/BMC/", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			withPrivilegeCap(tt.role, newHandler()).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
+
+// TestPrivilegeCapAdministrator checks that an administrator's credentials
+// over a read-only host interface cannot do what the role forbids, including
+// in the checks the account handlers make themselves.
+func TestPrivilegeCapAdministrator(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("admin", "admin-password", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	defer func() { currentConfig = oldConfig }()
+
+	handler := withPrivilegeCap("ReadOnly", newHandler())
+	body := `{"UserName": "intruder", "Password": "Intruder-passw0rd", "RoleId": "Administrator"}`
+	req := httptest.NewRequest("POST", accountServicePath+"/Accounts", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("admin", "admin-password")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+	if _, ok := store.FindByUsername("intruder"); ok {
+		t.Error("Expected no account created")
+	}
+
+	// Reading still works with the same credentials.
+	req = httptest.NewRequest("GET", accountServicePath+"/Accounts", nil)
+	req.SetBasicAuth("admin", "admin-password")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestHostInterfaceResource(t *testing.T) {
+	tmpDir := t.TempDir()
+	gadgetDir := filepath.Join(tmpDir, "gadget")
+	if err := os.MkdirAll(gadgetDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gadgetDir, "idVendor"), []byte("0x1d6b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	machineID := filepath.Join(tmpDir, "machine-id")
+	if err := os.WriteFile(machineID, []byte("0123456789abcdef0123456789abcdef\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := currentConfig
+	oldMachineID := machineIDFile
+	currentConfig.HostInterface.Enabled = true
+	currentConfig.HostInterface.Interface = "lo"
+	currentConfig.HostInterface.GadgetDir = gadgetDir
+	machineIDFile = machineID
+	defer func() {
+		currentConfig = oldConfig
+		machineIDFile = oldMachineID
+	}()
+
+	req, err := http.NewRequest("GET", hostInterfacesPath+"/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newHandler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var got struct {
+		Oem struct {
+			NanoKVM struct {
+				SMBIOSType42 SMBIOSType42
+			}
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	record := got.Oem.NanoKVM.SMBIOSType42
+	if record.ServiceUUID != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Errorf("Unexpected ServiceUUID %s", record.ServiceUUID)
+	}
+	if record.VendorID != "0x1d6b" {
+		t.Errorf("Unexpected VendorId %s", record.VendorID)
+	}
+	if record.RedfishServiceIPAddress != "127.0.0.1" {
+		t.Errorf("Unexpected RedfishServiceIPAddress %s", record.RedfishServiceIPAddress)
+	}
+}
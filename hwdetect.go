@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	hwVersionFile            = "/etc/kvm/hw"
+	hwVersionEnv             = "NANOKVM_HW"
+	deviceTreeCompatibleFile = "/proc/device-tree/compatible"
+)
+
+// detectHardware works out the board revision. /etc/kvm/hw, written by the
+// NanoKVM image, decides; if it is missing, the NANOKVM_HW environment
+// variable, the device tree and the exported GPIOs are tried in turn. It
+// also returns which of them decided, for the log.
+func detectHardware() (*Hardware, string, error) {
+	hw, err := detectHardwareFromFile(hwVersionFile)
+	if err == nil {
+		return hw, hwVersionFile, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+
+	if version := os.Getenv(hwVersionEnv); version != "" {
+		hw, err := hardwareForVersion(version)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", hwVersionEnv, err)
+		}
+		return hw, hwVersionEnv, nil
+	}
+	if hw := detectHardwareFromDeviceTree(deviceTreeCompatibleFile); hw != nil {
+		return hw, deviceTreeCompatibleFile, nil
+	}
+	if hw := detectHardwareFromGPIOs(); hw != nil {
+		return hw, "exported GPIOs", nil
+	}
+	return nil, "", fmt.Errorf("%s is missing and no other source names the hardware version", hwVersionFile)
+}
+
+func detectHardwareFromFile(path string) (*Hardware, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hardware version: %w", err)
+	}
+	return hardwareForVersion(strings.TrimSpace(string(content)))
+}
+
+// hardwareProfiles are the boards by version: the built-in ones and any
+// loaded by loadHardwareProfiles.
+var hardwareProfiles = map[HWVersion]*Hardware{
+	HWVersionAlpha: &HWAlpha,
+	HWVersionBeta:  &HWBeta,
+	HWVersionPcie:  &HWPcie,
+}
+
+func hardwareForVersion(version string) (*Hardware, error) {
+	hw, ok := hardwareProfiles[HWVersion(version)]
+	if !ok {
+		return nil, fmt.Errorf("unknown hardware version: %s", version)
+	}
+	return hw, nil
+}
+
+// detectHardwareFromDeviceTree looks for a compatible string of the form
+// "sipeed,nanokvm-<version>". A plain "sipeed,nanokvm" does not say which
+// revision it is and is ignored.
+func detectHardwareFromDeviceTree(path string) *Hardware {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	for _, compatible := range bytes.Split(content, []byte{0}) {
+		version, ok := strings.CutPrefix(string(compatible), "sipeed,nanokvm-")
+		if !ok {
+			continue
+		}
+		if hw, err := hardwareForVersion(version); err == nil {
+			return hw
+		}
+	}
+	return nil
+}
+
+// detectHardwareFromGPIOs tells the revisions apart by their reset button:
+// GPIO 507 on alpha boards, 505 on the others. Beta and PCIe boards use
+// the same GPIOs, so either is taken as beta. This only works once the
+// NanoKVM application has exported them.
+func detectHardwareFromGPIOs() *Hardware {
+	exported := func(hw Hardware) bool {
+		m := sysfsGPIOPattern.FindStringSubmatch(hw.GPIOReset)
+		if m == nil {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(gpioSysfsDir, "gpio"+m[1], "value"))
+		return err == nil
+	}
+	switch {
+	case exported(HWAlpha):
+		return &HWAlpha
+	case exported(HWBeta):
+		return &HWBeta
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectHardwareFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		hwFile       string // "" leaves /etc/kvm/hw missing
+		env          string
+		compatible   string
+		exported     []string
+		expect       HWVersion
+		expectSource string
+		expectError  bool
+	}{
+		{name: "Version file", hwFile: "pcie", env: "alpha", expect: HWVersionPcie, expectSource: "hw"},
+		{name: "Unknown version file", hwFile: "gamma", env: "alpha", expectError: true},
+		{name: "Environment", env: "beta", compatible: "sipeed,nanokvm-pcie\x00", expect: HWVersionBeta, expectSource: "NANOKVM_HW"},
+		{name: "Unknown environment", env: "gamma", expectError: true},
+		{name: "Device tree", compatible: "sipeed,nanokvm-pcie\x00sophgo,sg2002\x00", expect: HWVersionPcie, expectSource: "compatible"},
+		{name: "Device tree without revision", compatible: "sipeed,nanokvm\x00", exported: []string{"gpio505"}, expect: HWVersionBeta, expectSource: "exported GPIOs"},
+		{name: "Alpha GPIOs", exported: []string{"gpio505", "gpio507"}, expect: HWVersionAlpha, expectSource: "exported GPIOs"},
+		{name: "Nothing", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldFile, oldDT, oldSysfs := hwVersionFile, deviceTreeCompatibleFile, gpioSysfsDir
+			t.Cleanup(func() { hwVersionFile, deviceTreeCompatibleFile, gpioSysfsDir = oldFile, oldDT, oldSysfs })
+			hwVersionFile = filepath.Join(dir, "hw")
+			deviceTreeCompatibleFile = filepath.Join(dir, "compatible")
+			gpioSysfsDir = filepath.Join(dir, "gpio")
+			t.Setenv(hwVersionEnv, tt.env)
+
+			if tt.hwFile != "" {
+				os.WriteFile(hwVersionFile, []byte(tt.hwFile+"\n"), 0644)
+			}
+			if tt.compatible != "" {
+				os.WriteFile(deviceTreeCompatibleFile, []byte(tt.compatible), 0644)
+			}
+			for _, gpio := range tt.exported {
+				os.MkdirAll(filepath.Join(gpioSysfsDir, gpio), 0755)
+				os.WriteFile(filepath.Join(gpioSysfsDir, gpio, "value"), []byte("0\n"), 0644)
+			}
+
+			hw, source, err := detectHardware()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %s from %s", hw.Version, source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if hw.Version != tt.expect || filepath.Base(source) != tt.expectSource {
+				t.Errorf("Expected %s from %s, got %s from %s", tt.expect, tt.expectSource, hw.Version, source)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Hardware error kinds. Errors from the GPIO layer wrap one of these so
+// handlers can tell clients whether retrying makes sense.
+var (
+	// errNotSupported means this board has no line for the operation.
+	errNotSupported = errors.New("not supported by this hardware")
+	// errBusy means another button press is still in progress.
+	errBusy = errors.New("hardware busy")
+	// errIOFailure means the GPIO could not be read or written.
+	errIOFailure = errors.New("hardware I/O failure")
+)
+
+// HardwareError describes a failed hardware operation.
+type HardwareError struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *HardwareError) Error() string {
+	if e.Err == nil {
+		return e.Op + ": " + e.Kind.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *HardwareError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HardwareError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// writeHardwareError maps a hardware error to a Redfish error response:
+// 501 for operations the board cannot do, 409 while the hardware is busy
+// and 500 for everything else.
+func writeHardwareError(w http.ResponseWriter, err error, action string) {
+	status, msg := hardwareErrorMessage(err, action)
+	if detail, ok := hardwareErrorDetail(err); ok {
+		writeRedfishError(w, status, msg, detail)
+		return
+	}
+	writeRedfishError(w, status, msg)
+}
+
+// hardwareErrorDetail is the NanoKVM registry message naming the hardware
+// operation behind err, which follows the Base message in the response.
+func hardwareErrorDetail(err error) (MessageInfo, bool) {
+	var hwErr *HardwareError
+	if !errors.As(err, &hwErr) {
+		return MessageInfo{}, false
+	}
+	switch hwErr.Kind {
+	case errNotSupported:
+		return newOemMessage("HardwareNotPresent", hwErr.Op), true
+	case errBusy:
+		return newOemMessage("HardwareBusy", hwErr.Op), true
+	}
+	cause := hwErr.Kind.Error()
+	if hwErr.Err != nil {
+		cause = hwErr.Err.Error()
+	}
+	return newOemMessage("HardwareOperationFailed", hwErr.Op, cause), true
+}
+
+// hardwareErrorMessage is writeHardwareError for callers that report the
+// failure somewhere other than the response, such as a task.
+func hardwareErrorMessage(err error, action string) (int, MessageInfo) {
+	log.Printf("%s failed: %v", action, err)
+
+	switch {
+	case errors.Is(err, errNotSupported):
+		return http.StatusNotImplemented, newMessage("ActionNotSupported", action)
+	case errors.Is(err, errBusy):
+		return http.StatusConflict, newMessage("ResourceInUse")
+	default:
+		return http.StatusInternalServerError, newMessage("InternalError")
+	}
+}
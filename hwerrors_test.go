@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHardwareErrorKinds(t *testing.T) {
+	tmpDir := t.TempDir()
+	garbage := filepath.Join(tmpDir, "garbage")
+	if err := os.WriteFile(garbage, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := readGPIO("")
+	if !errors.Is(err, errNotSupported) {
+		t.Errorf("Expected errNotSupported for empty path, got %v", err)
+	}
+	_, err = readGPIO(filepath.Join(tmpDir, "missing"))
+	if !errors.Is(err, errIOFailure) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected errIOFailure wrapping ErrNotExist, got %v", err)
+	}
+	_, err = readGPIO(garbage)
+	if !errors.Is(err, errIOFailure) {
+		t.Errorf("Expected errIOFailure for unparsable value, got %v", err)
+	}
+
+	gpioMu.Lock()
+	err = writeGPIO(garbage, 0)
+	gpioMu.Unlock()
+	if !errors.Is(err, errBusy) {
+		t.Errorf("Expected errBusy while another press is held, got %v", err)
+	}
+}
+
+func TestResetHardwareErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	gpioPowerLED := filepath.Join(tmpDir, "gpio_power_led")
+	if err := os.WriteFile(gpioPowerLED, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldHardware := currentHardware
+	defer func() { currentHardware = oldHardware }()
+
+	tests := []struct {
+		name       string
+		hardware   Hardware
+		busy       bool
+		expectCode int
+		expectID   string
+	}{
+		{
+			name:       "Press in progress",
+			hardware:   Hardware{GPIOPowerLED: gpioPowerLED, GPIOReset: filepath.Join(tmpDir, "gpio_reset")},
+			busy:       true,
+			expectCode: http.StatusConflict,
+			expectID:   "Base.1.8.ResourceInUse",
+		},
+		{
+			name:       "GPIO write fails",
+			hardware:   Hardware{GPIOPowerLED: gpioPowerLED, GPIOReset: filepath.Join(tmpDir, "missing", "gpio_reset")},
+			expectCode: http.StatusInternalServerError,
+			expectID:   "Base.1.8.InternalError",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hw := tt.hardware
+			currentHardware = &hw
+			if tt.busy {
+				gpioMu.Lock()
+				defer gpioMu.Unlock()
+			}
+
+			req, err := http.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+				bytes.NewBufferString(`{"ResetType": "ForceRestart"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(handleSystems).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+			var body map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["error"].Code != tt.expectID {
+				t.Errorf("Expected %s, got %s", tt.expectID, body["error"].Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadHardwareProfiles adds a board for every *.yaml file in dir, so a
+// board the built-in profiles do not cover can be supported by dropping a
+// file there. A profile is a flat YAML mapping:
+//
+//	version: lite              # matched against /etc/kvm/hw
+//	reset: /sys/class/gpio/gpio505/value
+//	power: gpiochip1:23
+//	power_led: gpiochip1:24
+//	hdd_led: ""
+//	hid_keyboard: /dev/hidg0
+//	power_press_ms: 500
+//	long_press_ms: 6000
+//	reset_press_ms: 500
+//	power_led_active_high: true
+//	fan_pwm: pwmchip0:1        # see Hardware.FanPWM
+//	fan_period_ns: 40000
+//	fan_min_duty: 30           # default 30
+//	fan_max_duty: 100          # default 100
+//	fan_tach: /sys/class/hwmon/hwmon0/fan1_input
+//	model: NanoKVM Lite        # shown on the manager
+//	part_number: SKU-1234
+//
+// A variant without some of the front panel wiring leaves its GPIOs out;
+// see resetTypes for what it can then do. A missing directory is not an
+// error.
+func loadHardwareProfiles(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		hw, err := parseHardwareProfile(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := hardwareProfiles[hw.Version]; ok {
+			return fmt.Errorf("%s: hardware version %q is already defined", path, hw.Version)
+		}
+		hardwareProfiles[hw.Version] = hw
+	}
+	return nil
+}
+
+func parseHardwareProfile(content []byte) (*Hardware, error) {
+	fields, err := parseFlatYAML(content)
+	if err != nil {
+		return nil, err
+	}
+
+	hw := &Hardware{HIDKeyboard: "/dev/hidg0"}
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "version":
+			hw.Version = HWVersion(value)
+		case "reset":
+			hw.GPIOReset = value
+		case "power":
+			hw.GPIOPower = value
+		case "power_led":
+			hw.GPIOPowerLED = value
+		case "hdd_led":
+			hw.GPIOHDDLed = value
+		case "nmi":
+			hw.GPIONMI = value
+		case "hid_keyboard":
+			hw.HIDKeyboard = value
+		case "power_press_ms":
+			hw.PowerPressMs, err = strconv.Atoi(value)
+		case "long_press_ms":
+			hw.LongPressMs, err = strconv.Atoi(value)
+		case "reset_press_ms":
+			hw.ResetPressMs, err = strconv.Atoi(value)
+		case "power_led_active_high":
+			hw.PowerLEDActiveHigh, err = strconv.ParseBool(value)
+		case "fan_pwm":
+			hw.FanPWM = value
+		case "fan_period_ns":
+			hw.FanPeriodNs, err = strconv.Atoi(value)
+		case "fan_min_duty":
+			hw.FanMinDuty, err = strconv.Atoi(value)
+		case "fan_max_duty":
+			hw.FanMaxDuty, err = strconv.Atoi(value)
+		case "fan_tach":
+			hw.FanTach = value
+		case "model":
+			hw.Model = value
+		case "part_number":
+			hw.PartNumber = value
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid value %q", key, value)
+		}
+	}
+
+	if hw.Version == "" {
+		return nil, fmt.Errorf("version must be set")
+	}
+	gpio := GPIOConfig{Reset: hw.GPIOReset, Power: hw.GPIOPower, PowerLED: hw.GPIOPowerLED, HDDLED: hw.GPIOHDDLed, NMI: hw.GPIONMI}
+	if err := gpio.validate(); err != nil {
+		return nil, err
+	}
+	if hw.PowerPressMs < 0 || hw.LongPressMs < 0 || hw.ResetPressMs < 0 {
+		return nil, fmt.Errorf("press lengths must not be negative")
+	}
+	if err := validateFan(hw, fields); err != nil {
+		return nil, err
+	}
+	return hw, nil
+}
+
+// validateFan checks the fan keys of a profile and fills in the default
+// duty cycle bounds for a fan whose profile leaves them out.
+func validateFan(hw *Hardware, fields map[string]string) error {
+	if hw.FanPWM == "" {
+		for _, key := range []string{"fan_period_ns", "fan_min_duty", "fan_max_duty", "fan_tach"} {
+			if _, ok := fields[key]; ok {
+				return fmt.Errorf("%s needs fan_pwm", key)
+			}
+		}
+		return nil
+	}
+	if _, ok := fields["fan_min_duty"]; !ok {
+		hw.FanMinDuty = 30
+	}
+	if _, ok := fields["fan_max_duty"]; !ok {
+		hw.FanMaxDuty = 100
+	}
+	switch {
+	case !validPWM(hw.FanPWM):
+		return fmt.Errorf("fan_pwm must be pwmchipN:channel or an absolute path, got %q", hw.FanPWM)
+	case hw.FanPeriodNs < 0:
+		return fmt.Errorf("fan_period_ns must not be negative")
+	case hw.FanMinDuty < 0 || hw.FanMaxDuty > 100 || hw.FanMinDuty > hw.FanMaxDuty:
+		return fmt.Errorf("fan duty cycle bounds must satisfy 0 <= fan_min_duty <= fan_max_duty <= 100")
+	case hw.FanTach != "" && !filepath.IsAbs(hw.FanTach):
+		return fmt.Errorf("fan_tach must be an absolute path, got %q", hw.FanTach)
+	}
+	return nil
+}
+
+// parseFlatYAML reads the subset of YAML profiles use: one "key: value"
+// per line, values optionally quoted, and # comments. Anything nested is
+// rejected rather than misread.
+func parseFlatYAML(content []byte) (map[string]string, error) {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if line != strings.TrimLeft(line, " \t") || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("line %d: only flat key: value mappings are supported", n)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, rest, err := cutQuoted(value, '"')
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if unquoted, err = strconv.Unquote(`"` + unquoted + `"`); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			value = unquoted
+			if !isComment(rest) {
+				return nil, fmt.Errorf("line %d: unexpected text after the value", n)
+			}
+		case strings.HasPrefix(value, "'"):
+			unquoted, rest, err := cutQuoted(value, '\'')
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			value = unquoted
+			if !isComment(rest) {
+				return nil, fmt.Errorf("line %d: unexpected text after the value", n)
+			}
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			if value == "" || strings.HasPrefix(value, "#") {
+				return nil, fmt.Errorf("line %d: %s has no value", n, key)
+			}
+		}
+		if _, ok := fields[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", n, key)
+		}
+		fields[key] = value
+	}
+	return fields, scanner.Err()
+}
+
+// cutQuoted splits a value starting with quote at its closing quote.
+func cutQuoted(value string, quote byte) (unquoted, rest string, err error) {
+	end := 1
+	for ; end < len(value); end++ {
+		if value[end] == '\\' && quote == '"' {
+			end++
+			continue
+		}
+		if value[end] == quote {
+			return value[1:end], value[end+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted value")
+}
+
+func isComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
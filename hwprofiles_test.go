@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadHardwareProfiles(t *testing.T) {
+	old := hardwareProfiles
+	hardwareProfiles = map[HWVersion]*Hardware{HWVersionBeta: &HWBeta}
+	defer func() { hardwareProfiles = old }()
+
+	dir := t.TempDir()
+	profile := `# Community board
+version: lite
+reset: /sys/class/gpio/gpio505/value   # front panel header
+power: "gpiochip1:23"
+power_led: 'gpiochip1:24'
+power_press_ms: 500
+long_press_ms: 6000
+power_led_active_high: true
+model: NanoKVM Lite
+part_number: "SKU-1234"
+`
+	if err := os.WriteFile(filepath.Join(dir, "lite.yaml"), []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a profile"), 0644)
+
+	if err := loadHardwareProfiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	hw, err := hardwareForVersion("lite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Hardware{
+		Version:            "lite",
+		GPIOReset:          "/sys/class/gpio/gpio505/value",
+		GPIOPower:          "gpiochip1:23",
+		GPIOPowerLED:       "gpiochip1:24",
+		HIDKeyboard:        "/dev/hidg0",
+		PowerPressMs:       500,
+		LongPressMs:        6000,
+		PowerLEDActiveHigh: true,
+		Model:              "NanoKVM Lite",
+		PartNumber:         "SKU-1234",
+	}
+	if !reflect.DeepEqual(*hw, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, *hw)
+	}
+
+	if err := loadHardwareProfiles(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("Expected a missing directory to be ignored, got %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "beta.yaml"), []byte(strings.Replace(profile, "lite", "beta", 1)), 0644)
+	delete(hardwareProfiles, "lite")
+	if err := loadHardwareProfiles(dir); err == nil {
+		t.Error("Expected an error redefining a built-in board")
+	}
+}
+
+func TestParseHardwareProfile(t *testing.T) {
+	const gpios = "reset: gpiochip0:1\npower: gpiochip0:2\npower_led: gpiochip0:3\n"
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"No version", gpios},
+		{"Unknown key", "version: x\n" + gpios + "fan: gpiochip0:4\n"},
+		{"Bad number", "version: x\n" + gpios + "power_press_ms: long\n"},
+		{"Negative press", "version: x\n" + gpios + "reset_press_ms: -1\n"},
+		{"Bad GPIO", "version: x\n" + gpios + "hdd_led: led0\n"},
+		{"Nested", "version: x\n" + gpios + "gpio:\n  power: gpiochip0:2\n"},
+		{"List", "version: x\n" + gpios + "- power\n"},
+		{"Unterminated quote", "version: \"x\n" + gpios},
+		{"Duplicate key", "version: x\nversion: y\n" + gpios},
+		{"Fan key without a fan", "version: x\n" + gpios + "fan_max_duty: 80\n"},
+		{"Bad fan PWM", "version: x\n" + gpios + "fan_pwm: pwm1\n"},
+		{"Fan bounds reversed", "version: x\n" + gpios + "fan_pwm: pwmchip0:1\nfan_min_duty: 80\nfan_max_duty: 50\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hw, err := parseHardwareProfile([]byte(tt.content)); err == nil {
+				t.Errorf("Expected an error, got %+v", hw)
+			}
+		})
+	}
+}
+
+func TestParseHardwareProfileFan(t *testing.T) {
+	hw, err := parseHardwareProfile([]byte("version: x\nreset: gpiochip0:1\npower: gpiochip0:2\npower_led: gpiochip0:3\n" +
+		"fan_pwm: pwmchip0:1\nfan_min_duty: 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hw.FanPWM != "pwmchip0:1" || hw.FanMinDuty != 0 || hw.FanMaxDuty != 100 {
+		t.Errorf("Expected a fan allowed to stop and run at full speed, got %+v", hw)
+	}
+}
+
+func TestHardwareProfileBehaviour(t *testing.T) {
+	dir := t.TempDir()
+	led := filepath.Join(dir, "led")
+	oldHardware := currentHardware
+	defer func() { currentHardware = oldHardware }()
+
+	currentHardware = &Hardware{GPIOPowerLED: led, GPIOReset: filepath.Join(dir, "reset"), PowerLEDActiveHigh: true, PowerPressMs: 300, ResetPressMs: 200}
+	os.WriteFile(led, []byte("1\n"), 0644)
+	if state, err := getPowerState(); err != nil || state != "On" {
+		t.Errorf("Expected an active-high LED reading 1 to mean On, got %s, %v", state, err)
+	}
+	if power, long, reset := primarySystem.pressDurations(); power != 300 || long != 1000 || reset != 200 {
+		t.Errorf("Expected presses of 300, 1000 and 200 ms, got %d, %d and %d", power, long, reset)
+	}
+	ops, _ := primarySystem.planReset("ForceRestart", PressDurations{})
+	if len(ops) != 1 || ops[0].Description != "Press reset button for 200 ms" {
+		t.Errorf("Expected the profile's reset press, got %+v", ops)
+	}
+}
+
+func TestVariantResetTypes(t *testing.T) {
+	dir := t.TempDir()
+	led, power, reset := filepath.Join(dir, "led"), filepath.Join(dir, "power"), filepath.Join(dir, "reset")
+	os.WriteFile(led, []byte("1\n"), 0644)
+	os.WriteFile(power, []byte("0\n"), 0644)
+	os.WriteFile(reset, []byte("0\n"), 0644)
+	oldHardware, oldBackend := currentHardware, hardwareBackend
+	defer func() { currentHardware, hardwareBackend = oldHardware, oldBackend }()
+	hardwareBackend = gpioBackend{}
+
+	// A variant without a power LED parses; it just cannot do as much.
+	if _, err := parseHardwareProfile([]byte("version: x\nreset: gpiochip0:1\npower: gpiochip0:2\n")); err != nil {
+		t.Errorf("Expected a profile without a power LED to parse, got %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		hardware    Hardware
+		expectTypes []string
+		expectPower bool
+	}{
+		{
+			name:        "Full front panel",
+			hardware:    Hardware{GPIOPowerLED: led, GPIOPower: power, GPIOReset: reset},
+			expectTypes: []string{"On", "ForceOn", "ForceOff", "GracefulShutdown", "GracefulRestart", "ForceRestart", "PushPowerButton", "PowerCycle"},
+			expectPower: true,
+		},
+		{
+			name:        "No power LED",
+			hardware:    Hardware{GPIOPower: power, GPIOReset: reset},
+			expectTypes: []string{"ForceRestart", "PushPowerButton"},
+		},
+		{
+			name:        "No reset button",
+			hardware:    Hardware{GPIOPowerLED: led, GPIOPower: power},
+			expectTypes: []string{"On", "ForceOn", "ForceOff", "GracefulShutdown", "GracefulRestart", "PushPowerButton", "PowerCycle"},
+			expectPower: true,
+		},
+		{
+			name:        "Power LED only",
+			hardware:    Hardware{GPIOPowerLED: led},
+			expectPower: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hw := tt.hardware
+			currentHardware = &hw
+
+			rr := httptest.NewRecorder()
+			handleSystems(rr, httptest.NewRequest("GET", "/redfish/v1/Systems/System.1", nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var system ComputerSystem
+			json.Unmarshal(rr.Body.Bytes(), &system)
+			if (system.PowerState != "") != tt.expectPower {
+				t.Errorf("Expected PowerState shown %v, got %q", tt.expectPower, system.PowerState)
+			}
+			action, ok := system.Actions["#ComputerSystem.Reset"].(map[string]interface{})
+			if ok != (len(tt.expectTypes) > 0) {
+				t.Fatalf("Expected the Reset action only with reset types, got %v", system.Actions)
+			}
+			var types []string
+			if ok {
+				for _, v := range action["ResetType@Redfish.AllowableValues"].([]interface{}) {
+					types = append(types, v.(string))
+				}
+			}
+			if !reflect.DeepEqual(types, tt.expectTypes) {
+				t.Errorf("Expected %v, got %v", tt.expectTypes, types)
+			}
+
+			rr = httptest.NewRecorder()
+			handleSystems(rr, httptest.NewRequest("GET", "/redfish/v1/Systems/System.1/ResetActionInfo", nil))
+			if !ok {
+				if rr.Code != http.StatusNotFound {
+					t.Errorf("Expected no ResetActionInfo without the action, got %d", rr.Code)
+				}
+			} else {
+				var info ActionInfo
+				json.Unmarshal(rr.Body.Bytes(), &info)
+				if action["@Redfish.ActionInfo"] != info.ODataID || len(info.Parameters) != 1 ||
+					!reflect.DeepEqual(info.Parameters[0].AllowableValues, tt.expectTypes) {
+					t.Errorf("Expected ResetActionInfo to list %v, got %d: %s", tt.expectTypes, rr.Code, rr.Body.String())
+				}
+			}
+
+			for _, resetType := range []string{"On", "ForceRestart", "PushPowerButton"} {
+				_, ok := primarySystem.planReset(resetType, PressDurations{})
+				if ok != containsString(tt.expectTypes, resetType) {
+					t.Errorf("Expected %s accepted %v, got %v", resetType, !ok, ok)
+				}
+			}
+		})
+	}
+}
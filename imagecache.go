@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Downloaded images are kept in ImageDir as a cache so that reinstalling
+// the same image does not fetch it again. Each image is stored as
+// <key>-<name>, where key is derived from the checksum the client gave or
+// else from the URL, next to a <file>.json holding what is needed to
+// revalidate or resume it. A download in progress is <file>.part.
+
+// cacheMeta is the sidecar metadata of a cached or partial image.
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+// cacheFileName names the cache entry for an image. Images with a
+// checksum are keyed by it, so the same image is found under any URL;
+// the rest by URL without credentials.
+func cacheFileName(u *url.URL, checksum *imageChecksum) string {
+	stripped := *u
+	stripped.User = nil
+	key := stripped.String()
+	if checksum != nil {
+		key = checksum.algorithm + ":" + hex.EncodeToString(checksum.sum)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8]) + "-" + imageFileName(u)
+}
+
+func loadCacheMeta(image string) cacheMeta {
+	var meta cacheMeta
+	if content, err := os.ReadFile(image + ".json"); err == nil {
+		json.Unmarshal(content, &meta)
+	}
+	return meta
+}
+
+func saveCacheMeta(image string, meta cacheMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(image+".json", content, 0o644)
+}
+
+// removeCacheEntry deletes an image together with its metadata and any
+// partial download.
+func removeCacheEntry(image string) {
+	for _, path := range []string{image, image + ".part", image + ".json"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove %s: %v", path, err)
+		}
+	}
+}
+
+// touchCacheEntry marks an image as just used for LRU eviction.
+func touchCacheEntry(image string) {
+	now := time.Now()
+	os.Chtimes(image, now, now)
+}
+
+// evictImages removes least recently used images from dir until need
+// more bytes fit both in the configured cache size and on the
+// filesystem. keep and the image currently inserted are never removed.
+func evictImages(dir string, need int64, keep string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type cached struct {
+		image string
+		size  int64
+		used  time.Time
+	}
+	var candidates []cached
+	var usage int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		usage += info.Size()
+		name := entry.Name()
+		if strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		image := filepath.Join(dir, strings.TrimSuffix(name, ".part"))
+		candidates = append(candidates, cached{image: image, size: info.Size(), used: info.ModTime()})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].used.Before(candidates[j].used) })
+
+	inserted := ""
+	if ins := currentInsertion(); ins != nil {
+		inserted = ins.Path
+	}
+	limit := int64(currentConfig.VirtualMedia.CacheSizeMB) << 20
+	for _, c := range candidates {
+		overLimit := limit > 0 && usage+need > limit
+		free, err := freeSpace(dir)
+		short := err == nil && uint64(need) > free
+		if !overLimit && !short {
+			return
+		}
+		if c.image == keep || c.image == inserted {
+			continue
+		}
+		log.Printf("Evicting %s from the image cache", filepath.Base(c.image))
+		removeCacheEntry(c.image)
+		usage -= c.size
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeImageServer serves images with ETags and range support. It can
+// break off the next full response part way to simulate a dropped
+// connection.
+type rangeImageServer struct {
+	mu       sync.Mutex
+	content  map[string][]byte
+	etag     string
+	cutAfter int
+	requests []string
+}
+
+func (s *rangeImageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, ok := s.content[r.URL.Path]
+	cut := 0
+	if r.Header.Get("Range") == "" && r.Header.Get("If-None-Match") == "" {
+		cut, s.cutAfter = s.cutAfter, 0
+	}
+	s.requests = append(s.requests, r.URL.Path+" range="+r.Header.Get("Range")+" if-none-match="+r.Header.Get("If-None-Match"))
+	etag := s.etag
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if cut > 0 {
+		w.Header().Set("Content-Length", "1048576")
+		w.Write(content[:cut])
+		return
+	}
+	http.ServeContent(w, r, "image.iso", time.Time{}, bytes.NewReader(content))
+}
+
+func (s *rangeImageServer) takeRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func testImage(size int, fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, size)
+}
+
+func TestImageCache(t *testing.T) {
+	setupLUN(t)
+	currentConfig.VirtualMedia.CacheSizeMB = 2048
+	dir := currentConfig.VirtualMedia.ImageDir
+	image := testImage(1<<20, 'a')
+	server := &rangeImageServer{content: map[string][]byte{"/installer.iso": image}, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/installer.iso")
+
+	path, err := downloadImage(u, "", "", dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.takeRequests()
+
+	again, err := downloadImage(u, "", "", dir, nil, nil)
+	if err != nil || again != path {
+		t.Fatalf("Expected the cached %s, got %s (%v)", path, again, err)
+	}
+	if requests := server.takeRequests(); len(requests) != 1 || requests[0] != `/installer.iso range= if-none-match="v1"` {
+		t.Errorf("Expected a single revalidation, got %v", requests)
+	}
+
+	// The image changed on the server.
+	server.mu.Lock()
+	server.content["/installer.iso"] = testImage(1<<20, 'b')
+	server.etag = `"v2"`
+	server.mu.Unlock()
+	if _, err := downloadImage(u, "", "", dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(path); content[0] != 'b' {
+		t.Error("Expected a changed image to be downloaded again")
+	}
+
+	// The server is gone, so the cached copy is used.
+	ts.Close()
+	if again, err := downloadImage(u, "", "", dir, nil, nil); err != nil || again != path {
+		t.Errorf("Expected the cached copy while the server is down, got %s (%v)", again, err)
+	}
+}
+
+func TestImageCacheByChecksum(t *testing.T) {
+	setupLUN(t)
+	currentConfig.VirtualMedia.CacheSizeMB = 2048
+	image := testImage(4096, 'a')
+	sum := sha256.Sum256(image)
+	checksum, err := newImageChecksum("SHA256", hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &rangeImageServer{content: map[string][]byte{"/a/installer.iso": image, "/b/installer.iso": image}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, path := range []string{"/a/installer.iso", "/b/installer.iso"} {
+		u, _ := url.Parse(ts.URL + path)
+		if _, err := downloadImage(u, "", "", currentConfig.VirtualMedia.ImageDir, checksum, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests := server.takeRequests(); len(requests) != 1 {
+		t.Errorf("Expected the same checksum to hit the cache from another URL, got %v", requests)
+	}
+}
+
+func TestImageDownloadResume(t *testing.T) {
+	image := append(testImage(1<<19, 'a'), testImage(1<<19, 'b')...)
+	sum := sha256.Sum256(image)
+	checksum, err := newImageChecksum("SHA256", hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		attempts int
+		checksum *imageChecksum
+	}{
+		{"Resume within a request", 3, nil},
+		{"Resume within a request with checksum", 3, checksum},
+		{"Resume on the next request", 1, nil},
+		{"Resume on the next request with checksum", 1, checksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLUN(t)
+			dir := currentConfig.VirtualMedia.ImageDir
+			oldAttempts := downloadAttempts
+			downloadAttempts = tt.attempts
+			defer func() { downloadAttempts = oldAttempts }()
+
+			server := &rangeImageServer{content: map[string][]byte{"/installer.iso": image}, etag: `"v1"`, cutAfter: 1 << 19}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+			u, _ := url.Parse(ts.URL + "/installer.iso")
+
+			var percents []int
+			progress := func(p int) { percents = append(percents, p) }
+			path, err := downloadImage(u, "", "", dir, tt.checksum, progress)
+			if tt.attempts == 1 {
+				if !errors.Is(err, errImageUnreachable) {
+					t.Fatalf("Expected the interrupted download to fail, got %v", err)
+				}
+				path, err = downloadImage(u, "", "", dir, tt.checksum, progress)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requests := server.takeRequests()
+			if len(requests) != 2 || requests[1] != "/installer.iso range=bytes=524288- if-none-match=" {
+				t.Errorf("Expected the second request to resume, got %v", requests)
+			}
+			if content, _ := os.ReadFile(path); !bytes.Equal(content, image) {
+				t.Error("Resumed image does not match")
+			}
+			if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+				t.Errorf("Expected the partial file to be gone, got %v", err)
+			}
+			if len(percents) == 0 || percents[len(percents)-1] != 100 {
+				t.Errorf("Expected progress to reach 100%%, got %v", percents)
+			}
+		})
+	}
+}
+
+func TestImageCacheEviction(t *testing.T) {
+	setupLUN(t)
+	currentConfig.VirtualMedia.CacheSizeMB = 1
+	dir := currentConfig.VirtualMedia.ImageDir
+	server := &rangeImageServer{content: map[string][]byte{
+		"/one.iso":   testImage(400<<10, '1'),
+		"/two.iso":   testImage(400<<10, '2'),
+		"/three.iso": testImage(400<<10, '3'),
+	}, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	download := func(name string) string {
+		t.Helper()
+		u, _ := url.Parse(ts.URL + "/" + name)
+		path, err := downloadImage(u, "", "", dir, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	one := download("one.iso")
+	setInsertion(&mediaInsertion{Slot: "CD1", Path: one, TransferMethod: "Upload"})
+	two := download("two.iso")
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(one, old, old)
+	three := download("three.iso")
+
+	for path, expectKept := range map[string]bool{one: true, two: false, three: true} {
+		if _, err := os.Stat(path); (err == nil) != expectKept {
+			t.Errorf("Expected %s kept %v, stat returned %v", filepath.Base(path), expectKept, err)
+		}
+	}
+	if _, err := os.Stat(two + ".json"); !os.IsNotExist(err) {
+		t.Error("Expected the evicted image's metadata to be removed")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Image download failures, mapped to Redfish messages by
+// writeImageError.
+var (
+	errImageUnreachable  = errors.New("image server unreachable")
+	errImageNotFound     = errors.New("image not found")
+	errImageUnauthorized = errors.New("image server refused access")
+	errNoSpace           = errors.New("not enough space for image")
+
+	// errImageInterrupted is a download that broke off part way and can
+	// be resumed.
+	errImageInterrupted = fmt.Errorf("%w: download interrupted", errImageUnreachable)
+)
+
+// imageHTTPClient has no overall timeout: an installer ISO over the
+// NanoKVM's network can take many minutes. Only connecting and waiting
+// for the response headers are bounded.
+var imageHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// imageFileName derives a safe local file name from the last element of
+// the image URL's path.
+func imageFileName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == ".." || name == "/" || name == "" {
+		name = "image.iso"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// freeSpace returns the bytes available to unprivileged users on the
+// filesystem holding dir.
+func freeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// progressWriter reports how much of a download of known size is done.
+type progressWriter struct {
+	total, done int64
+	report      func(percent int)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	p.report(int(p.done * 100 / p.total))
+	return len(b), nil
+}
+
+// downloadAttempts is how many times a download that breaks off part way
+// is tried in total, each retry resuming where the last one stopped.
+var downloadAttempts = 3
+
+// downloadImage fetches u into the image cache in dir and returns the
+// local path. A cached copy is used when it is still current. The image
+// is written to <file>.part first so a failed download never leaves a
+// truncated image behind under the final name; a later request for the
+// same image resumes the partial file with a range request. A checksum,
+// if given, is computed as the image arrives and checked before the
+// rename. progress, if not nil, is called with the percentage received
+// when the server sends a length.
+func downloadImage(u *url.URL, username, password, dir string, checksum *imageChecksum, progress func(percent int)) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	dest := filepath.Join(dir, cacheFileName(u, checksum))
+	if _, err := os.Stat(dest); err == nil {
+		fresh, err := cachedImageFresh(u, username, password, dest, checksum)
+		if err != nil {
+			return "", err
+		}
+		if fresh {
+			log.Printf("Using cached %s", filepath.Base(dest))
+			touchCacheEntry(dest)
+			return dest, nil
+		}
+		removeCacheEntry(dest)
+	}
+
+	var h hash.Hash
+	if checksum != nil {
+		h = checksum.newHash()
+		// Bytes already on disk from an earlier attempt count too.
+		if f, err := os.Open(dest + ".part"); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		received, err := fetchImagePart(u, username, password, dest, h, progress)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, errImageInterrupted) && received > 0 && attempt < downloadAttempts {
+			log.Printf("Download of %s interrupted, resuming: %v", u.Redacted(), err)
+			continue
+		}
+		return "", err
+	}
+
+	if checksum != nil {
+		if err := checksum.verify(h); err != nil {
+			removeCacheEntry(dest)
+			return "", err
+		}
+	}
+	if err := os.Rename(dest+".part", dest); err != nil {
+		return "", fmt.Errorf("failed to write image file: %w", err)
+	}
+	touchCacheEntry(dest)
+	evictImages(dir, 0, dest)
+	return dest, nil
+}
+
+// cachedImageFresh reports whether a cached image can be used as is. One
+// keyed by checksum was verified when stored. Otherwise the server is
+// asked whether the image changed; if it cannot be reached the cached
+// copy is used rather than failing.
+func cachedImageFresh(u *url.URL, username, password, image string, checksum *imageChecksum) (bool, error) {
+	if checksum != nil {
+		return true, nil
+	}
+	meta := loadCacheMeta(image)
+	if meta.ETag == "" && meta.LastModified == "" {
+		return false, nil
+	}
+
+	req, err := newImageRequest(u, username, password)
+	if err != nil {
+		return false, err
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		log.Printf("Cannot revalidate %s, using the cached copy: %v", u.Redacted(), err)
+		return true, nil
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return true, nil
+	}
+	if err := imageStatusError(resp); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func newImageRequest(u *url.URL, username, password string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errImageUnreachable, err)
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	return req, nil
+}
+
+func imageStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %s", errImageNotFound, resp.Status)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", errImageUnauthorized, resp.Status)
+	default:
+		return fmt.Errorf("%w: %s", errImageUnreachable, resp.Status)
+	}
+}
+
+// fetchImagePart makes one attempt at completing dest+".part", resuming
+// from its current size when the server supports ranges and the image has
+// not changed since the part was started. h, if not nil, has already seen
+// the bytes on disk and is reset if the download starts over. It returns
+// how many bytes this attempt received.
+func fetchImagePart(u *url.URL, username, password, dest string, h hash.Hash, progress func(percent int)) (int64, error) {
+	part := dest + ".part"
+	meta := loadCacheMeta(dest)
+
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := newImageRequest(u, username, password)
+	if err != nil {
+		return 0, err
+	}
+	validator := meta.ETag
+	if validator == "" {
+		validator = meta.LastModified
+	}
+	if offset > 0 && validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errImageUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if err := imageStatusError(resp); err != nil {
+		return 0, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if resp.StatusCode != http.StatusPartialContent {
+		// The server sent the whole image: it ignored the range, or the
+		// image changed since the part was written.
+		offset = 0
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if h != nil {
+			h.Reset()
+		}
+		meta = cacheMeta{
+			URL:          u.Redacted(),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         resp.ContentLength,
+		}
+		if err := saveCacheMeta(dest, meta); err != nil {
+			return 0, fmt.Errorf("failed to write image metadata: %w", err)
+		}
+	}
+
+	if resp.ContentLength > 0 {
+		dir := filepath.Dir(dest)
+		evictImages(dir, resp.ContentLength, dest)
+		if free, err := freeSpace(dir); err == nil && uint64(resp.ContentLength) > free {
+			return 0, fmt.Errorf("%w: need %d bytes, %d free", errNoSpace, resp.ContentLength, free)
+		}
+	}
+
+	f, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create image file: %w", err)
+	}
+
+	dst := []io.Writer{f}
+	if h != nil {
+		dst = append(dst, h)
+	}
+	if progress != nil && meta.Size > 0 {
+		dst = append(dst, &progressWriter{total: meta.Size, done: offset, report: progress})
+	}
+	n, err := io.Copy(io.MultiWriter(dst...), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && resp.ContentLength > 0 && n < resp.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			removeCacheEntry(dest)
+			return n, fmt.Errorf("%w: %v", errNoSpace, err)
+		}
+		return n, fmt.Errorf("%w: %v", errImageInterrupted, err)
+	}
+	return n, nil
+}
+
+// writeImageError reports a failed image fetch for the image at uri.
+func writeImageError(w http.ResponseWriter, err error, uri string) {
+	status, msg := imageErrorMessage(err, uri)
+	writeRedfishError(w, status, msg)
+}
+
+func imageErrorMessage(err error, uri string) (int, MessageInfo) {
+	log.Printf("Fetching image %s failed: %v", uri, err)
+
+	switch {
+	case errors.Is(err, errImageNotFound):
+		return http.StatusBadRequest, newMessage("ResourceMissingAtURI", uri)
+	case errors.Is(err, errImageUnauthorized):
+		return http.StatusBadRequest, newMessage("ResourceAtUriUnauthorized", uri, err.Error())
+	case errors.Is(err, errImageUnreachable):
+		return http.StatusBadRequest, newMessage("CouldNotEstablishConnection", uri)
+	case errors.Is(err, errNoSpace):
+		return http.StatusInsufficientStorage, newMessage("ResourceExhaustion", virtualMediaPath)
+	case errors.Is(err, errChecksumMismatch):
+		return http.StatusBadRequest, newMessage("InvalidObject", uri).withProperty("#/Oem/NanoKVM/Checksum")
+	default:
+		return http.StatusInternalServerError, newMessage("InternalError")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestImageFileName(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"http://images.example/installer.iso", "installer.iso"},
+		{"https://images.example/releases/24.04/ubuntu-24.04-live-server-amd64.iso", "ubuntu-24.04-live-server-amd64.iso"},
+		{"http://images.example/", "image.iso"},
+		{"http://images.example", "image.iso"},
+		{"http://images.example/my%20image$.iso", "my_image_.iso"},
+		{"http://images.example/..", "image.iso"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := imageFileName(u); got != tt.expected {
+			t.Errorf("imageFileName(%s) = %q, expected %q", tt.url, got, tt.expected)
+		}
+	}
+}
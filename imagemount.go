@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// runCommand runs an external program and returns its combined output.
+// Tests replace it to avoid needing root and a file server.
+var runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+// mountImage mounts the NFS or CIFS directory holding the image at u
+// read-only on mountPoint and returns the image's path under it. The
+// gadget then reads the image straight from the share, so nothing is
+// copied to the SD card.
+func mountImage(u *url.URL, protocol, username, password, mountPoint string) (string, error) {
+	dir, file := path.Split(u.Path)
+	if err := os.MkdirAll(mountPoint, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", mountPoint, err)
+	}
+
+	var args, env []string
+	switch protocol {
+	case "NFS":
+		args = []string{"-t", "nfs", "-o", "ro,nolock", u.Host + ":" + dir, mountPoint}
+	case "CIFS":
+		// mount.cifs reads the password from $PASSWD, which keeps it out
+		// of the process list.
+		opts := "ro,guest"
+		if username != "" {
+			opts = "ro,username=" + username
+			env = append(env, "PASSWD="+password)
+		}
+		args = []string{"-t", "cifs", "-o", opts, "//" + u.Host + strings.TrimSuffix(dir, "/"), mountPoint}
+	default:
+		return "", fmt.Errorf("cannot mount %s images", protocol)
+	}
+
+	if out, err := runCommand(env, "mount", args...); err != nil {
+		msg := strings.TrimSpace(string(out))
+		switch {
+		case strings.Contains(msg, "ermission denied"), strings.Contains(msg, "access denied"):
+			return "", fmt.Errorf("%w: %s", errImageUnauthorized, msg)
+		case strings.Contains(msg, "No such file or directory"):
+			return "", fmt.Errorf("%w: %s", errImageNotFound, msg)
+		default:
+			return "", fmt.Errorf("%w: %v: %s", errImageUnreachable, err, msg)
+		}
+	}
+
+	image := filepath.Join(mountPoint, file)
+	if _, err := os.Stat(image); err != nil {
+		unmountImage(mountPoint)
+		return "", fmt.Errorf("%w: %v", errImageNotFound, err)
+	}
+	return image, nil
+}
+
+// unmountImage releases a share mounted by mountImage. Failures are only
+// logged: the LUN has already let go of the image by then.
+func unmountImage(mountPoint string) {
+	if out, err := runCommand(nil, "umount", mountPoint); err != nil {
+		log.Printf("Failed to unmount %s: %v: %s", mountPoint, err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeMount replaces runCommand with one that "mounts" a share by
+// creating the files it holds in the mount point, or fails with output.
+type fakeMount struct {
+	files  []string
+	output string
+	calls  []string
+	env    []string
+}
+
+func (f *fakeMount) install(t *testing.T) {
+	old := runCommand
+	runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		f.calls = append(f.calls, name+" "+strings.Join(args, " "))
+		f.env = append(f.env, env...)
+		if name != "mount" {
+			return nil, nil
+		}
+		if f.output != "" {
+			return []byte(f.output), errors.New("exit status 32")
+		}
+		for _, file := range f.files {
+			if err := os.WriteFile(filepath.Join(args[len(args)-1], file), []byte("ISO image contents"), 0644); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { runCommand = old })
+}
+
+func TestMountImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		protocol    string
+		username    string
+		mount       fakeMount
+		expectMount string
+		expectEnv   string
+		expectErr   error
+	}{
+		{
+			name:        "NFS",
+			url:         "nfs://files.example/export/isos/installer.iso",
+			protocol:    "NFS",
+			mount:       fakeMount{files: []string{"installer.iso"}},
+			expectMount: "mount -t nfs -o ro,nolock files.example:/export/isos/ MNT",
+		},
+		{
+			name:        "CIFS guest",
+			url:         "smb://files.example/isos/installer.iso",
+			protocol:    "CIFS",
+			mount:       fakeMount{files: []string{"installer.iso"}},
+			expectMount: "mount -t cifs -o ro,guest //files.example/isos MNT",
+		},
+		{
+			name:        "CIFS with credentials",
+			url:         "smb://files.example/isos/linux/installer.iso",
+			protocol:    "CIFS",
+			username:    "deploy",
+			mount:       fakeMount{files: []string{"installer.iso"}},
+			expectMount: "mount -t cifs -o ro,username=deploy //files.example/isos/linux MNT",
+			expectEnv:   "PASSWD=secret",
+		},
+		{
+			name:      "Image missing from share",
+			url:       "nfs://files.example/export/isos/installer.iso",
+			protocol:  "NFS",
+			mount:     fakeMount{files: []string{"other.iso"}},
+			expectErr: errImageNotFound,
+		},
+		{
+			name:      "Access denied",
+			url:       "smb://files.example/isos/installer.iso",
+			protocol:  "CIFS",
+			mount:     fakeMount{output: "mount error(13): Permission denied"},
+			expectErr: errImageUnauthorized,
+		},
+		{
+			name:      "Server down",
+			url:       "nfs://files.example/export/isos/installer.iso",
+			protocol:  "NFS",
+			mount:     fakeMount{output: "mount.nfs: Connection timed out"},
+			expectErr: errImageUnreachable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mount.install(t)
+			mountPoint := filepath.Join(t.TempDir(), "CD1")
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			image, err := mountImage(u, tt.protocol, tt.username, "secret", mountPoint)
+			if tt.expectErr != nil {
+				if !errors.Is(err, tt.expectErr) {
+					t.Fatalf("Expected %v, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if image != filepath.Join(mountPoint, "installer.iso") {
+				t.Errorf("Unexpected image path %s", image)
+			}
+			if got := strings.ReplaceAll(tt.mount.calls[0], mountPoint, "MNT"); got != tt.expectMount {
+				t.Errorf("Expected %q, got %q", tt.expectMount, got)
+			}
+			if env := strings.Join(tt.mount.env, " "); env != tt.expectEnv {
+				t.Errorf("Expected environment %q, got %q", tt.expectEnv, env)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// The HDD LED flickers with disk activity, so it is read several times
+// over a short window to tell a steady LED from a blinking one.
+var (
+	hddLEDSamples  = 5
+	hddLEDInterval = 20 * time.Millisecond
+)
+
+// indicatorLED reports the ComputerSystem's IndicatorLED from the host's
+// HDD LED: "Lit", "Blinking", "Off", or "Unknown" if it cannot be read. It
+// returns false when the board has no HDD LED. The NanoKVM cannot drive
+// the LED, so it only shows whether the host's disks are busy.
+func indicatorLED() (string, bool) {
+	reader, ok := hardwareBackend.(hddLEDReader)
+	if !ok || !reader.SupportsHDDLED() {
+		return "", false
+	}
+
+	lit, unlit := 0, 0
+	for i := 0; i < hddLEDSamples; i++ {
+		if i > 0 {
+			time.Sleep(hddLEDInterval)
+		}
+		on, err := reader.ReadHDDLED()
+		if err != nil {
+			return "Unknown", true
+		}
+		if on {
+			lit++
+		} else {
+			unlit++
+		}
+	}
+	switch {
+	case unlit == 0:
+		return "Lit", true
+	case lit == 0:
+		return "Off", true
+	}
+	return "Blinking", true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// hddLEDBackend replays HDD LED readings, repeating the last one.
+type hddLEDBackend struct {
+	*MockBackend
+	readings []bool
+	err      error
+}
+
+func (b *hddLEDBackend) SupportsHDDLED() bool {
+	return true
+}
+
+func (b *hddLEDBackend) ReadHDDLED() (bool, error) {
+	if b.err != nil {
+		return false, b.err
+	}
+	on := b.readings[0]
+	if len(b.readings) > 1 {
+		b.readings = b.readings[1:]
+	}
+	return on, nil
+}
+
+func TestIndicatorLED(t *testing.T) {
+	old := hddLEDInterval
+	hddLEDInterval = 0
+	defer func() { hddLEDInterval = old }()
+
+	tests := []struct {
+		name     string
+		readings []bool
+		err      error
+		expect   string
+	}{
+		{"Steady", []bool{true}, nil, "Lit"},
+		{"Idle", []bool{false}, nil, "Off"},
+		{"Busy", []bool{false, true, false}, nil, "Blinking"},
+		{"Unreadable", nil, errors.New("gone"), "Unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupMockBackend(t, true)
+			hardwareBackend = &hddLEDBackend{mock, tt.readings, tt.err}
+			if indicator, ok := indicatorLED(); !ok || indicator != tt.expect {
+				t.Errorf("Expected %s, got %q (%v)", tt.expect, indicator, ok)
+			}
+		})
+	}
+}
+
+func TestSystemIndicatorLED(t *testing.T) {
+	host := startFakeHost(t, true)
+	if system := getSystem(t); system.IndicatorLED != "" || system.LocationIndicatorActive != nil {
+		t.Errorf("Expected no indicator without an HDD LED, got %q", system.IndicatorLED)
+	}
+
+	// Like the power LED, the HDD LED reads 0 when lit.
+	host.hw.GPIOHDDLed = filepath.Join(t.TempDir(), "gpio_hdd_led")
+	if err := os.WriteFile(host.hw.GPIOHDDLed, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	system := getSystem(t)
+	if system.IndicatorLED != "Lit" || system.LocationIndicatorActive == nil || !*system.LocationIndicatorActive {
+		t.Errorf("Expected a lit, active indicator, got %+v", system)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// intrusionSensor follows the chassis intrusion switch, sampling it in the
+// background like powerMonitor does the power LED.
+type intrusionSensor struct {
+	cfg IntrusionConfig
+
+	mu      sync.Mutex
+	sampled bool
+	open    bool
+	// tripped latches an intrusion until it is re-armed.
+	tripped bool
+	failing bool
+}
+
+// currentIntrusionSensor is nil when no intrusion switch is configured.
+var currentIntrusionSensor *intrusionSensor
+
+// intrusionPollInterval is how often the switch is sampled when it cannot
+// be watched.
+var intrusionPollInterval = time.Second
+
+// startIntrusionSensor samples the switch on each change, or every
+// intrusionPollInterval if it cannot be watched, until stop is closed.
+func startIntrusionSensor(cfg IntrusionConfig, stop <-chan struct{}) *intrusionSensor {
+	interval := intrusionPollInterval
+	changes, err := watchGPIO(cfg.GPIO, stop)
+	if err != nil {
+		log.Printf("Cannot watch the chassis intrusion switch, polling it every %v: %v", interval, err)
+	} else {
+		interval = powerWatchResync
+	}
+
+	s := &intrusionSensor{cfg: cfg}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.sample()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-changes:
+				time.Sleep(powerSettleTime)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *intrusionSensor) sample() {
+	value, err := readGPIO(s.cfg.GPIO)
+
+	s.mu.Lock()
+	if err != nil {
+		failing := s.failing
+		s.failing = true
+		s.mu.Unlock()
+		if !failing {
+			log.Printf("Cannot read the chassis intrusion switch: %v", err)
+		}
+		return
+	}
+	open := (value == 1) != s.cfg.ActiveLow
+	opened, closed := open && !s.open, !open && s.open && s.sampled
+	s.sampled, s.open, s.failing = true, open, false
+	if open {
+		s.tripped = true
+	}
+	s.mu.Unlock()
+
+	switch {
+	case opened:
+		log.Printf("Chassis intrusion detected")
+		emitEvent("Critical", "Chassis intrusion detected",
+			resourceEventPrefix+"ResourceErrorsDetected", "/redfish/v1/Chassis/System",
+			"PhysicalSecurity/IntrusionSensor", "HardwareIntrusion")
+	case closed:
+		log.Printf("Chassis closed")
+		emitEvent("OK", "Chassis closed", resourceEventPrefix+"ResourceChanged", "/redfish/v1/Chassis/System")
+	}
+}
+
+// state is the IntrusionSensor value, or "" before the switch has been
+// read.
+func (s *intrusionSensor) state() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intrusion := s.tripped
+	if s.cfg.ReArm == "Automatic" {
+		intrusion = s.open
+	}
+	switch {
+	case !s.sampled:
+		return ""
+	case intrusion:
+		return "HardwareIntrusion"
+	}
+	return "Normal"
+}
+
+// rearm clears a latched intrusion. While the chassis is still open the
+// sensor stays tripped.
+func (s *intrusionSensor) rearm() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tripped = s.open
+}
+
+// physicalSecurity is the chassis's PhysicalSecurity, or nil without an
+// intrusion switch.
+func physicalSecurity() map[string]interface{} {
+	s := currentIntrusionSensor
+	if s == nil {
+		return nil
+	}
+	var state interface{}
+	if st := s.state(); st != "" {
+		state = st
+	}
+	return map[string]interface{}{
+		"IntrusionSensor":       state,
+		"IntrusionSensorNumber": 1,
+		"IntrusionSensorReArm":  s.cfg.ReArm,
+	}
+}
+
+type ChassisPatchRequest struct {
+	PhysicalSecurity *struct {
+		IntrusionSensor *string `json:"IntrusionSensor"`
+	} `json:"PhysicalSecurity"`
+}
+
+// handlePatchChassis re-arms the intrusion sensor, the only writable
+// property of the chassis.
+func handlePatchChassis(w http.ResponseWriter, r *http.Request) {
+	s := currentIntrusionSensor
+	if s == nil {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	var req ChassisPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkPreconditions(w, r, resourceETag(chassisResource()), false) {
+		return
+	}
+	ignored, ok := checkPatchProperties(w, r, body, &req, handleChassisItem)
+	if !ok {
+		return
+	}
+	if req.PhysicalSecurity == nil || req.PhysicalSecurity.IntrusionSensor == nil {
+		writePatchResult(w, r, ignored, handleChassisItem)
+		return
+	}
+	if value := *req.PhysicalSecurity.IntrusionSensor; value != "Normal" {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueNotInList", value, "IntrusionSensor").
+				withProperty("#/PhysicalSecurity/IntrusionSensor"))
+		return
+	}
+
+	if s.state() == "HardwareIntrusion" {
+		s.rearm()
+		log.Printf("Chassis intrusion sensor re-armed")
+		emitEvent("OK", "Chassis intrusion sensor re-armed", resourceEventPrefix+"ResourceChanged", "/redfish/v1/Chassis/System")
+	}
+	writePatchResult(w, r, ignored, handleChassisItem)
+}
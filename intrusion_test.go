@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func getChassis(t *testing.T) map[string]interface{} {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleChassisItem(rr, httptest.NewRequest("GET", "/redfish/v1/Chassis/System", nil))
+	var chassis map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &chassis); err != nil {
+		t.Fatal(err)
+	}
+	return chassis
+}
+
+func TestIntrusionSensor(t *testing.T) {
+	setupGPIOChips(t, nil, nil)
+	gpio := filepath.Join(t.TempDir(), "value")
+	setSwitch := func(value string) {
+		if err := os.WriteFile(gpio, []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := currentIntrusionSensor
+	defer func() { currentIntrusionSensor = old }()
+
+	currentIntrusionSensor = nil
+	if chassis := getChassis(t); chassis["PhysicalSecurity"] != nil {
+		t.Errorf("Expected no PhysicalSecurity without a switch, got %v", chassis["PhysicalSecurity"])
+	}
+	rr := httptest.NewRecorder()
+	handleChassisItem(rr, httptest.NewRequest("PATCH", "/redfish/v1/Chassis/System",
+		bytes.NewBufferString(`{"PhysicalSecurity": {"IntrusionSensor": "Normal"}}`)))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 without a switch, got %d", rr.Code)
+	}
+
+	tests := []struct {
+		name  string
+		cfg   IntrusionConfig
+		steps []struct{ value, expect string }
+	}{
+		{
+			name: "Manual",
+			cfg:  IntrusionConfig{GPIO: gpio, ReArm: "Manual"},
+			steps: []struct{ value, expect string }{
+				{"0", "Normal"}, {"1", "HardwareIntrusion"}, {"0", "HardwareIntrusion"},
+			},
+		},
+		{
+			name: "Automatic and active low",
+			cfg:  IntrusionConfig{GPIO: gpio, ActiveLow: true, ReArm: "Automatic"},
+			steps: []struct{ value, expect string }{
+				{"1", "Normal"}, {"0", "HardwareIntrusion"}, {"1", "Normal"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventLog.Clear()
+			currentIntrusionSensor = &intrusionSensor{cfg: tt.cfg}
+			if chassis := getChassis(t); chassis["PhysicalSecurity"].(map[string]interface{})["IntrusionSensor"] != nil {
+				t.Errorf("Expected no reading before the first sample, got %v", chassis["PhysicalSecurity"])
+			}
+			for _, step := range tt.steps {
+				setSwitch(step.value)
+				currentIntrusionSensor.sample()
+				if got := currentIntrusionSensor.state(); got != step.expect {
+					t.Errorf("Expected %s with the switch at %s, got %s", step.expect, step.value, got)
+				}
+			}
+			entries := eventLog.Entries()
+			if len(entries) != 2 || entries[0].Severity != "Critical" {
+				t.Errorf("Expected a Critical event on opening and one on closing, got %+v", entries)
+			}
+		})
+	}
+
+	// The Manual sensor is left tripped with the chassis closed again.
+	currentIntrusionSensor = &intrusionSensor{cfg: IntrusionConfig{GPIO: gpio, ReArm: "Manual"}}
+	setSwitch("1")
+	currentIntrusionSensor.sample()
+	chassis := getChassis(t)
+	if chassis["Status"].(map[string]interface{})["Health"] != "Critical" {
+		t.Errorf("Expected Critical health after an intrusion, got %v", chassis["Status"])
+	}
+	setSwitch("0")
+	currentIntrusionSensor.sample()
+	for _, tt := range []struct {
+		body       string
+		expectCode int
+		expect     string
+	}{
+		{`{"PhysicalSecurity": {"IntrusionSensor": "TamperingDetected"}}`, http.StatusBadRequest, "HardwareIntrusion"},
+		{`{"PhysicalSecurity": {"IntrusionSensor": "Normal"}}`, http.StatusNoContent, "Normal"},
+	} {
+		rr := httptest.NewRecorder()
+		handleChassisItem(rr, httptest.NewRequest("PATCH", "/redfish/v1/Chassis/System", bytes.NewBufferString(tt.body)))
+		if rr.Code != tt.expectCode {
+			t.Errorf("Expected %d for %s, got %d: %s", tt.expectCode, tt.body, rr.Code, rr.Body.String())
+		}
+		if got := currentIntrusionSensor.state(); got != tt.expect {
+			t.Errorf("Expected %s after %s, got %s", tt.expect, tt.body, got)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ironicClient issues requests the way sushy does for Ironic: a session
+// token on every request after logging in.
+type ironicClient struct {
+	t     *testing.T
+	base  string
+	token string
+}
+
+func (c *ironicClient) call(method, path string, body interface{}, headers ...string) (*http.Response, []byte) {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("X-Auth-Token", c.token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp, content
+}
+
+// expect calls path and checks the status, decoding the body into out.
+func (c *ironicClient) expect(status int, method, path string, body, out interface{}, headers ...string) *http.Response {
+	c.t.Helper()
+	resp, content := c.call(method, path, body, headers...)
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, resp.StatusCode, content)
+	}
+	if out != nil {
+		if err := json.Unmarshal(content, out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// setupIronicService runs the full handler with session authentication, a
+// fake host that starts powered off and an image server, as a deploy
+// would see them.
+func setupIronicService(t *testing.T) (service, imageURL string) {
+	t.Helper()
+	if _, err := setupAccountStore(t).Create("ironic", "ironic-password", "Operator", true); err != nil {
+		t.Fatal(err)
+	}
+	setupSessionStore(t)
+	setupTaskStore(t)
+	setupLUN(t)
+	startFakeHost(t, false)
+
+	oldConfig, oldBoot := currentConfig, currentBootConfig
+	currentConfig.RequireAuth = true
+	currentConfig.AuthBackends = []string{"local"}
+	currentConfig.SchemaValidation = SchemaValidationStrict
+	t.Cleanup(func() { currentConfig, currentBootConfig = oldConfig, oldBoot })
+
+	server := httptest.NewServer(newHandler())
+	t.Cleanup(server.Close)
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "deploy.iso", time.Time{}, strings.NewReader("deploy ramdisk ISO"))
+	}))
+	t.Cleanup(images.Close)
+	return server.URL, images.URL + "/deploy.iso"
+}
+
+// TestIronicDeployCycle replays the requests Ironic's redfish hardware type
+// with the redfish-virtual-media boot interface makes to deploy a node:
+// discover the system and its virtual CD, insert the deploy image, boot
+// from it once, power off and clean up.
+func TestIronicDeployCycle(t *testing.T) {
+	base, imageURL := setupIronicService(t)
+	c := &ironicClient{t: t, base: base}
+
+	var root struct {
+		Systems odataLink `json:"Systems"`
+		Links   struct {
+			Sessions odataLink `json:"Sessions"`
+		} `json:"Links"`
+	}
+	c.expect(http.StatusOK, "GET", "/redfish/v1", nil, &root)
+
+	resp := c.expect(http.StatusCreated, "POST", root.Links.Sessions.ODataID,
+		map[string]string{"UserName": "ironic", "Password": "ironic-password"}, nil)
+	c.token = resp.Header.Get("X-Auth-Token")
+	session := resp.Header.Get("Location")
+
+	var systems collectionResponse
+	c.expect(http.StatusOK, "GET", root.Systems.ODataID, nil, &systems)
+	if len(systems.Members) != 1 {
+		t.Fatalf("Expected one system, got %v", systems.Members)
+	}
+	systemPath := systems.Members[0].ODataID
+
+	type system struct {
+		PowerState string `json:"PowerState"`
+		Boot       Boot   `json:"Boot"`
+		Links      struct {
+			ManagedBy []odataLink `json:"ManagedBy"`
+		} `json:"Links"`
+		Actions struct {
+			Reset struct {
+				Target       string   `json:"target"`
+				AllowedTypes []string `json:"ResetType@Redfish.AllowableValues"`
+			} `json:"#ComputerSystem.Reset"`
+		} `json:"Actions"`
+	}
+	var sys system
+	c.expect(http.StatusOK, "GET", systemPath, nil, &sys)
+	if sys.PowerState != "Off" || len(sys.Links.ManagedBy) == 0 {
+		t.Fatalf("Expected a powered off system with a manager, got %+v", sys)
+	}
+
+	// Find the virtual CD through the system's manager.
+	var manager managerResponse
+	c.expect(http.StatusOK, "GET", sys.Links.ManagedBy[0].ODataID, nil, &manager)
+	var media collectionResponse
+	c.expect(http.StatusOK, "GET", manager.VirtualMedia.ODataID, nil, &media)
+	var cd virtualMediaResponse
+	var cdPath string
+	for _, member := range media.Members {
+		var vm virtualMediaResponse
+		c.expect(http.StatusOK, "GET", member.ODataID, nil, &vm)
+		if containsString(vm.MediaTypes, "CD") || containsString(vm.MediaTypes, "DVD") {
+			cd, cdPath = vm, member.ODataID
+			break
+		}
+	}
+	if cd.Actions.InsertMedia == nil || cd.Actions.EjectMedia == nil {
+		t.Fatal("Expected a virtual CD with InsertMedia and EjectMedia")
+	}
+
+	// Ironic ejects whatever is left over before inserting.
+	c.expect(http.StatusNoContent, "POST", cd.Actions.EjectMedia.Target, map[string]string{}, nil)
+
+	// Insert as a task so the download does not hold the request.
+	resp = c.expect(http.StatusAccepted, "POST", cd.Actions.InsertMedia.Target,
+		map[string]interface{}{"Image": imageURL, "Inserted": true, "WriteProtected": true}, nil,
+		"Prefer", "respond-async")
+	monitor := resp.Header.Get("Location")
+	waitFor(t, "the insert task", func() bool {
+		resp, _ := c.call("GET", monitor, nil)
+		return resp.StatusCode == http.StatusNoContent
+	})
+
+	c.expect(http.StatusNoContent, "PATCH", systemPath, map[string]interface{}{
+		"Boot": map[string]string{
+			"BootSourceOverrideTarget":  "Cd",
+			"BootSourceOverrideEnabled": "Once",
+			"BootSourceOverrideMode":    "UEFI",
+		},
+	}, nil)
+
+	c.expect(http.StatusNoContent, "POST", sys.Actions.Reset.Target, map[string]string{"ResetType": "On"}, nil)
+	c.expect(http.StatusOK, "GET", systemPath, nil, &sys)
+	if sys.PowerState != "On" && sys.PowerState != "PoweringOn" {
+		t.Errorf("Expected the system to be starting after On, got %s", sys.PowerState)
+	}
+	waitFor(t, "power on", func() bool {
+		c.expect(http.StatusOK, "GET", systemPath, nil, &sys)
+		return sys.PowerState == "On"
+	})
+	if sys.Boot.BootSourceOverrideEnabled != "Disabled" || sys.Boot.BootSourceOverrideTarget != "None" {
+		t.Errorf("Expected the Once override to be used up, got %s/%s",
+			sys.Boot.BootSourceOverrideEnabled, sys.Boot.BootSourceOverrideTarget)
+	}
+
+	c.expect(http.StatusOK, "GET", cdPath, nil, &cd)
+	if !cd.Inserted || cd.Image != imageURL {
+		t.Errorf("Expected %s inserted, got %+v", imageURL, cd)
+	}
+
+	// Tear down: power off, eject and log out.
+	c.expect(http.StatusNoContent, "POST", sys.Actions.Reset.Target, map[string]string{"ResetType": "ForceOff"}, nil)
+	waitFor(t, "power off", func() bool {
+		c.expect(http.StatusOK, "GET", systemPath, nil, &sys)
+		return sys.PowerState == "Off"
+	})
+	c.expect(http.StatusNoContent, "POST", cd.Actions.EjectMedia.Target, map[string]string{}, nil)
+	c.expect(http.StatusNoContent, "DELETE", session, nil, nil)
+	c.expect(http.StatusUnauthorized, "GET", systemPath, nil, nil)
+}
+
+// TestSushyDeployCycle drives the same cycle with sushy itself when it is
+// installed (pip install sushy).
+func TestSushyDeployCycle(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import sushy").Run(); err != nil {
+		t.Skip("sushy is not installed")
+	}
+	base, imageURL := setupIronicService(t)
+
+	cmd := exec.Command("python3", "testdata/sushy_deploy_cycle.py", base, "ironic", "ironic-password", imageURL)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("sushy deploy cycle failed: %v", err)
+	}
+}
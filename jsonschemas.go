@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const jsonSchemasPath = "/redfish/v1/JsonSchemas"
+
+// embeddedSchemaIDs lists the embedded schema files by name without
+// .json, such as ComputerSystem.v1_20_0, which is also their JsonSchemaFile
+// Id.
+func embeddedSchemaIDs() []string {
+	files, err := schemaFS.ReadDir("schemas")
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, file := range files {
+		if id, ok := strings.CutSuffix(file.Name(), ".json"); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// handleJsonSchemas serves the JsonSchemas collection, a JsonSchemaFile
+// for each embedded schema, and the schema files themselves, so clients
+// without internet access can resolve the @odata.type of every resource.
+func handleJsonSchemas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, jsonSchemasPath), "/")
+	if rest == "" {
+		ids := embeddedSchemaIDs()
+		members := make([]map[string]string, len(ids))
+		for i, id := range ids {
+			members[i] = map[string]string{"@odata.id": jsonSchemasPath + "/" + id}
+		}
+		writeCollection(w, r, SystemCollection{
+			ODataType: "#JsonSchemaFileCollection.JsonSchemaFileCollection",
+			ODataID:   jsonSchemasPath,
+			Name:      "JSON Schema File Collection",
+			Members:   members,
+		})
+		return
+	}
+
+	id, file, _ := strings.Cut(rest, "/")
+	content, err := schemaFS.ReadFile("schemas/" + id + ".json")
+	if err != nil {
+		writeNotFound(w, r)
+		return
+	}
+	switch file {
+	case "":
+		handleJsonSchemaFile(w, id, content)
+	case id + ".json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleJsonSchemaFile(w http.ResponseWriter, id string, content []byte) {
+	var schema struct {
+		ID    string `json:"$id"`
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(content, &schema); err != nil {
+		writeInternalError(w, "parse schema "+id, err)
+		return
+	}
+
+	path := jsonSchemasPath + "/" + id
+	resource := map[string]interface{}{
+		"@odata.type": odataType("JsonSchemaFile"),
+		"@odata.id":   path,
+		"Id":          id,
+		"Name":        id + " Schema File",
+		"Description": "A copy of the DMTF schema, trimmed to the properties this service uses",
+		"Schema":      schema.Title,
+		"Languages":   []string{"en"},
+		"Location": []map[string]string{{
+			"Language":       "en",
+			"Uri":            path + "/" + id + ".json",
+			"PublicationUri": schema.ID,
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJsonSchemas(t *testing.T) {
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleJsonSchemas(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	var collection SystemCollection
+	if err := json.Unmarshal(get(jsonSchemasPath).Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Count != len(embeddedSchemaIDs()) || collection.Count == 0 {
+		t.Fatalf("Expected every embedded schema listed, got %d of %d", collection.Count, len(embeddedSchemaIDs()))
+	}
+
+	for _, member := range collection.Members {
+		var file struct {
+			Schema   string `json:"Schema"`
+			Location []struct {
+				URI            string `json:"Uri"`
+				PublicationURI string `json:"PublicationUri"`
+			} `json:"Location"`
+		}
+		rr := get(member["@odata.id"])
+		if err := json.Unmarshal(rr.Body.Bytes(), &file); err != nil || len(file.Location) != 1 {
+			t.Fatalf("Expected a JsonSchemaFile at %s, got %d: %s", member["@odata.id"], rr.Code, rr.Body.String())
+		}
+
+		var schema struct {
+			ID    string `json:"$id"`
+			Title string `json:"title"`
+		}
+		rr = get(file.Location[0].URI)
+		if err := json.Unmarshal(rr.Body.Bytes(), &schema); err != nil {
+			t.Fatalf("Expected the schema at %s, got %d", file.Location[0].URI, rr.Code)
+		}
+		if schema.ID != file.Location[0].PublicationURI || schema.Title != file.Schema {
+			t.Errorf("Expected %s to describe its schema, got %+v for %+v", member["@odata.id"], file, schema)
+		}
+	}
+
+	for _, path := range []string{
+		jsonSchemasPath + "/Bogus.v1_0_0",
+		jsonSchemasPath + "/ServiceRoot.v1_5_0/Other.json",
+	} {
+		if rr := get(path); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveLocalImage checks that p names a regular file inside one of the
+// configured local image directories and returns its real path. Symlinks
+// are resolved first so a link cannot expose a block device or a file
+// elsewhere on the card.
+func resolveLocalImage(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("%w: %s is not an absolute path", errImageNotFound, p)
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errImageNotFound, err)
+	}
+
+	allowed := false
+	for _, dir := range currentConfig.VirtualMedia.LocalImageDirs {
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(realDir, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("%w: %s is outside the local image directories", errImageUnauthorized, p)
+	}
+
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errImageNotFound, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%w: %s is not a regular file", errImageNotFound, p)
+	}
+	return real, nil
+}
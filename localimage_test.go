@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveLocalImage(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	for _, file := range []string{filepath.Join(dir, "installer.iso"), filepath.Join(outside, "secret.img")} {
+		if err := os.WriteFile(file, []byte("image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.img"), filepath.Join(dir, "escape.iso")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "isos"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := currentConfig.VirtualMedia.LocalImageDirs
+	currentConfig.VirtualMedia.LocalImageDirs = []string{dir}
+	defer func() { currentConfig.VirtualMedia.LocalImageDirs = old }()
+
+	tests := []struct {
+		name      string
+		path      string
+		expectErr error
+	}{
+		{"Image in directory", filepath.Join(dir, "installer.iso"), nil},
+		{"Path with dot dot", filepath.Join(dir, "isos", "..", "installer.iso"), nil},
+		{"Missing image", filepath.Join(dir, "missing.iso"), errImageNotFound},
+		{"Directory", filepath.Join(dir, "isos"), errImageNotFound},
+		{"Relative path", "installer.iso", errImageNotFound},
+		{"Outside directories", filepath.Join(outside, "secret.img"), errImageUnauthorized},
+		{"Symlink out of directory", filepath.Join(dir, "escape.iso"), errImageUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLocalImage(tt.path)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectErr, err)
+			}
+			if err == nil && filepath.Base(got) != "installer.iso" {
+				t.Errorf("Unexpected resolved path %s", got)
+			}
+		})
+	}
+}
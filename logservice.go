@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const logServicesPath = "/redfish/v1/Managers/BMC/LogServices"
+
+type LogEntry struct {
+	ODataType   string       `json:"@odata.type"`
+	ODataID     string       `json:"@odata.id"`
+	ID          string       `json:"Id"`
+	Name        string       `json:"Name"`
+	EntryType   string       `json:"EntryType"`
+	Severity    string       `json:"Severity"`
+	Message     string       `json:"Message"`
+	MessageID   string       `json:"MessageId,omitempty"`
+	MessageArgs []string     `json:"MessageArgs,omitempty"`
+	Created     string       `json:"Created"`
+	Oem         *LogEntryOem `json:"Oem,omitempty"`
+}
+
+type LogEntryOem struct {
+	NanoKVM LogEntryOemNanoKVM `json:"NanoKVM"`
+}
+
+type LogEntryOemNanoKVM struct {
+	Sequence uint64         `json:"Sequence"`
+	Audit    *LogEntryAudit `json:"Audit,omitempty"`
+}
+
+// LogEntryAudit details the request behind an audit log entry.
+type LogEntryAudit struct {
+	ClientAddress string `json:"ClientAddress"`
+	UserName      string `json:"UserName,omitempty"`
+	Method        string `json:"Method"`
+	Path          string `json:"Path"`
+	StatusCode    int    `json:"StatusCode"`
+}
+
+type logRecord struct {
+	id          int
+	created     Timestamp
+	severity    string
+	message     string
+	messageID   string
+	messageArgs []string
+	audit       *LogEntryAudit
+}
+
+// LogService keeps the most recent records in memory, discarding the oldest
+// once MaxEntries is reached.
+type LogService struct {
+	ID          string
+	Name        string
+	Description string
+	MaxEntries  int
+	// AppendOnly services cannot be cleared through the API.
+	AppendOnly bool
+
+	mu      sync.Mutex
+	records []logRecord
+	nextID  int
+}
+
+func newLogService(id, name, description string, maxEntries int) *LogService {
+	return &LogService{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		MaxEntries:  maxEntries,
+		nextID:      1,
+	}
+}
+
+var eventLog = newLogService("Log", "Event Log", "Power and boot events for the managed system", 500)
+
+var logServices = []*LogService{eventLog, auditLog}
+
+func (ls *LogService) odataID() string {
+	return logServicesPath + "/" + ls.ID
+}
+
+func (ls *LogService) Add(severity, message, messageID string, messageArgs ...string) {
+	ls.AddAt(newTimestamp(), severity, message, messageID, messageArgs...)
+}
+
+// AddAt records an entry with a timestamp taken by the caller, so that the
+// same occurrence carries the same sequence number in logs and events.
+func (ls *LogService) AddAt(ts Timestamp, severity, message, messageID string, messageArgs ...string) {
+	ls.addRecord(logRecord{
+		created:     ts,
+		severity:    severity,
+		message:     message,
+		messageID:   messageID,
+		messageArgs: messageArgs,
+	})
+}
+
+func (ls *LogService) addRecord(rec logRecord) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	rec.id = ls.nextID
+	ls.records = append(ls.records, rec)
+	ls.nextID++
+
+	if ls.MaxEntries > 0 && len(ls.records) > ls.MaxEntries {
+		ls.records = ls.records[len(ls.records)-ls.MaxEntries:]
+	}
+}
+
+func (ls *LogService) Clear() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.records = nil
+}
+
+func (ls *LogService) Entries() []LogEntry {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	entries := make([]LogEntry, 0, len(ls.records))
+	for _, rec := range ls.records {
+		entries = append(entries, ls.toEntry(rec))
+	}
+	return entries
+}
+
+func (ls *LogService) Entry(id string) (LogEntry, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for _, rec := range ls.records {
+		if strconv.Itoa(rec.id) == id {
+			return ls.toEntry(rec), true
+		}
+	}
+	return LogEntry{}, false
+}
+
+func (ls *LogService) toEntry(rec logRecord) LogEntry {
+	id := strconv.Itoa(rec.id)
+	return LogEntry{
+		ODataType:   odataType("LogEntry"),
+		ODataID:     ls.odataID() + "/Entries/" + id,
+		ID:          id,
+		Name:        "Log Entry " + id,
+		EntryType:   "Event",
+		Severity:    rec.severity,
+		Message:     rec.message,
+		MessageID:   rec.messageID,
+		MessageArgs: rec.messageArgs,
+		Created:     rec.created.String(),
+		Oem: &LogEntryOem{
+			NanoKVM: LogEntryOemNanoKVM{Sequence: rec.created.Sequence, Audit: rec.audit},
+		},
+	}
+}
+
+func findLogService(id string) *LogService {
+	for _, ls := range logServices {
+		if ls.ID == id {
+			return ls
+		}
+	}
+	return nil
+}
+
+func handleLogServices(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, logServicesPath), "/")
+	if rest == "" {
+		handleLogServiceCollection(w, r)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	ls := findLogService(parts[0])
+	if ls == nil {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		handleLogService(w, r, ls)
+	case len(parts) == 2 && parts[1] == "Entries":
+		handleLogEntries(w, r, ls)
+	case len(parts) == 3 && parts[1] == "Entries":
+		handleLogEntry(w, r, ls, parts[2])
+	case len(parts) == 3 && parts[1] == "Actions" && parts[2] == "LogService.ClearLog":
+		handleClearLog(w, r, ls)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleLogServiceCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	for _, ls := range logServices {
+		members = append(members, map[string]string{"@odata.id": ls.odataID()})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#LogServiceCollection.LogServiceCollection",
+		ODataID:   logServicesPath,
+		Name:      "Log Service Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleLogService(w http.ResponseWriter, r *http.Request, ls *LogService) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	actions := map[string]interface{}{}
+	if !ls.AppendOnly {
+		actions["#LogService.ClearLog"] = map[string]string{
+			"target": ls.odataID() + "/Actions/LogService.ClearLog",
+		}
+	}
+
+	now := newTimestamp()
+	service := map[string]interface{}{
+		"@odata.type":         odataType("LogService"),
+		"@odata.id":           ls.odataID(),
+		"Id":                  ls.ID,
+		"Name":                ls.Name,
+		"Description":         ls.Description,
+		"MaxNumberOfRecords":  ls.MaxEntries,
+		"OverWritePolicy":     "WrapsWhenFull",
+		"DateTime":            now.String(),
+		"DateTimeLocalOffset": now.Time.In(displayLocation).Format("-07:00"),
+		"ServiceEnabled":      true,
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+		"Entries": map[string]string{
+			"@odata.id": ls.odataID() + "/Entries",
+		},
+		"Actions": actions,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service)
+}
+
+func handleLogEntries(w http.ResponseWriter, r *http.Request, ls *LogService) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	entries := ls.Entries()
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ODataID
+	}
+	members, ok := filterMembers(w, r, ids, func(i int) interface{} { return entries[i] })
+	if !ok {
+		return
+	}
+
+	collection := SystemCollection{
+		ODataType: "#LogEntryCollection.LogEntryCollection",
+		ODataID:   ls.odataID() + "/Entries",
+		Name:      ls.Name + " Entries",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleLogEntry(w http.ResponseWriter, r *http.Request, ls *LogService, id string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	entry, ok := ls.Entry(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+func handleClearLog(w http.ResponseWriter, r *http.Request, ls *LogService) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+	if ls.AppendOnly {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("ActionNotSupported", "LogService.ClearLog"))
+		return
+	}
+
+	ls.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimestampString(t *testing.T) {
+	oldLocation := displayLocation
+	defer func() { displayLocation = oldLocation }()
+
+	ts := Timestamp{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	displayLocation = time.UTC
+	if got := ts.String(); got != "2024-01-02T03:04:05Z" {
+		t.Errorf("Expected UTC timestamp, got %s", got)
+	}
+
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	displayLocation = loc
+	if got := ts.String(); got != "2024-01-02T12:04:05+09:00" {
+		t.Errorf("Expected Tokyo timestamp, got %s", got)
+	}
+}
+
+func TestTimestampSequence(t *testing.T) {
+	clock := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	first := newTimestamp()
+	// The clock is stepped back, as NTP may do after boot.
+	clock = clock.Add(-time.Hour)
+	second := newTimestamp()
+	if second.Sequence <= first.Sequence {
+		t.Errorf("Expected increasing sequence, got %d then %d", first.Sequence, second.Sequence)
+	}
+	if !second.Time.Equal(clock) {
+		t.Errorf("Expected the time from the clock, got %s", second)
+	}
+}
+
+func TestLogServiceWraps(t *testing.T) {
+	ls := newLogService("Test", "Test Log", "", 3)
+	for i := 0; i < 5; i++ {
+		ls.Add("OK", "entry "+strconv.Itoa(i), "")
+	}
+
+	entries := ls.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].ID != "3" || entries[2].ID != "5" {
+		t.Errorf("Expected entries 3..5, got %s..%s", entries[0].ID, entries[2].ID)
+	}
+	if _, ok := ls.Entry("1"); ok {
+		t.Error("Expected entry 1 to have been discarded")
+	}
+	if entries[2].Oem.NanoKVM.Sequence <= entries[0].Oem.NanoKVM.Sequence {
+		t.Error("Expected sequence numbers to increase")
+	}
+}
+
+func TestHandleLogServices(t *testing.T) {
+	eventLog.Clear()
+	eventLog.Add("Warning", "test event", "")
+	entryID := eventLog.Entries()[0].ID
+
+	handler := newHandler()
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		expectCode int
+	}{
+		{"Collection", "GET", logServicesPath, http.StatusOK},
+		{"Service", "GET", logServicesPath + "/Log", http.StatusOK},
+		{"Entries", "GET", logServicesPath + "/Log/Entries", http.StatusOK},
+		{"Entry", "GET", logServicesPath + "/Log/Entries/" + entryID, http.StatusOK},
+		{"Missing entry", "GET", logServicesPath + "/Log/Entries/999999", http.StatusNotFound},
+		{"Missing service", "GET", logServicesPath + "/Nope", http.StatusNotFound},
+		{"Clear with GET", "GET", logServicesPath + "/Log/Actions/LogService.ClearLog", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+
+	req, err := http.NewRequest("GET", logServicesPath+"/Log/Entries/"+entryID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry LogEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339, entry.Created); err != nil {
+		t.Errorf("Created is not RFC3339: %v", err)
+	}
+	if entry.Severity != "Warning" {
+		t.Errorf("Expected Severity 'Warning', got '%s'", entry.Severity)
+	}
+
+	req, err = http.NewRequest("POST", logServicesPath+"/Log/Actions/LogService.ClearLog", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if len(eventLog.Entries()) != 0 {
+		t.Error("Expected log to be empty after ClearLog")
+	}
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -18,6 +20,11 @@ const (
 	HWVersionAlpha HWVersion = "alpha"
 	HWVersionBeta  HWVersion = "beta"
 	HWVersionPcie  HWVersion = "pcie"
+	// HWVersionCustom is an unrecognised board run from the configured
+	// GPIO map.
+	HWVersionCustom HWVersion = "custom"
+	// HWVersionSimulated is the -mock stand-in; see simulateDevice.
+	HWVersionSimulated HWVersion = "simulated"
 )
 
 type Hardware struct {
@@ -26,130 +33,90 @@ type Hardware struct {
 	GPIOPower    string
 	GPIOPowerLED string
 	GPIOHDDLed   string
+	// GPIONMI drives the motherboard's NMI header, if one is wired up.
+	GPIONMI      string
+	// HIDKeyboard is the USB gadget keyboard boot overrides are typed on.
+	HIDKeyboard  string
+	// Button press lengths in milliseconds; zero means 800 for a press,
+	// 1000 for a long press and 800 for reset.
+	PowerPressMs int
+	LongPressMs  int
+	ResetPressMs int
+	// PowerLEDActiveHigh is set for boards whose power LED GPIO reads 1
+	// while the host is on; the built-in boards read 0.
+	PowerLEDActiveHigh bool
+	// FanPWM is the PWM channel wired to a fan header, if any, as
+	// "pwmchipN:channel" or the channel's sysfs directory. FanPeriodNs
+	// sets its period, zero keeping the kernel's, and the duty cycle is
+	// kept between FanMinDuty and FanMaxDuty percent. FanTach is a hwmon
+	// fanN_input file giving the fan's speed, if its tachometer is wired.
+	FanPWM      string
+	FanPeriodNs int
+	FanMinDuty  int
+	FanMaxDuty  int
+	FanTach     string
+	// Model and PartNumber are reported on the manager.
+	Model      string
+	PartNumber string
 }
 
 var HWAlpha = Hardware{
 	Version:      HWVersionAlpha,
+	Model:        "NanoKVM",
 	GPIOReset:    "/sys/class/gpio/gpio507/value",
 	GPIOPower:    "/sys/class/gpio/gpio503/value",
 	GPIOPowerLED: "/sys/class/gpio/gpio504/value",
 	GPIOHDDLed:   "/sys/class/gpio/gpio505/value",
+	HIDKeyboard:  "/dev/hidg0",
 }
 
 var HWBeta = Hardware{
 	Version:      HWVersionBeta,
+	Model:        "NanoKVM",
 	GPIOReset:    "/sys/class/gpio/gpio505/value",
 	GPIOPower:    "/sys/class/gpio/gpio503/value",
 	GPIOPowerLED: "/sys/class/gpio/gpio504/value",
 	GPIOHDDLed:   "",
+	HIDKeyboard:  "/dev/hidg0",
 }
 
 var HWPcie = Hardware{
 	Version:      HWVersionPcie,
+	Model:        "NanoKVM-PCIe",
 	GPIOReset:    "/sys/class/gpio/gpio505/value",
 	GPIOPower:    "/sys/class/gpio/gpio503/value",
 	GPIOPowerLED: "/sys/class/gpio/gpio504/value",
 	GPIOHDDLed:   "",
+	HIDKeyboard:  "/dev/hidg0",
 }
 
 var currentHardware *Hardware
-var hwVersionFile = "/etc/kvm/hw"
 
-// Boot configuration (in-memory stub)
-var currentBootConfig = Boot{
-	BootSourceOverrideEnabled: "Disabled",
-	BootSourceOverrideMode:    "UEFI",
-	BootSourceOverrideTarget:  "None",
-	BootSourceOverrideTargetAllowableValues: []string{
-		"None", "Pxe", "Cd", "Usb", "Hdd", "BiosSetup",
-		"Utilities", "Diags", "UefiShell", "UefiTarget",
-		"SDCard", "UefiHttp", "RemoteDrive", "UefiBootNext",
-	},
-}
-
-func detectHardware() (*Hardware, error) {
-	return detectHardwareFromFile(hwVersionFile)
-}
-
-func detectHardwareFromFile(path string) (*Hardware, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read hardware version: %w", err)
-	}
-
-	version := strings.TrimSpace(string(content))
-	switch version {
-	case "alpha":
-		return &HWAlpha, nil
-	case "beta":
-		return &HWBeta, nil
-	case "pcie":
-		return &HWPcie, nil
-	default:
-		return nil, fmt.Errorf("unknown hardware version: %s", version)
-	}
-}
-
-func readGPIO(path string) (int, error) {
-	if path == "" {
-		return 0, fmt.Errorf("GPIO path not available for this hardware")
-	}
-
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read GPIO: %w", err)
-	}
-
-	value, err := strconv.Atoi(strings.TrimSpace(string(content)))
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse GPIO value: %w", err)
-	}
-
-	return value, nil
-}
-
-func writeGPIO(path string, duration int) error {
-	if path == "" {
-		return fmt.Errorf("GPIO path not available for this hardware")
-	}
-
-	if err := os.WriteFile(path, []byte("1"), 0o666); err != nil {
-		return fmt.Errorf("failed to write GPIO: %w", err)
-	}
-
-	if duration > 0 {
-		time.Sleep(time.Duration(duration) * time.Millisecond)
-	}
-
-	if err := os.WriteFile(path, []byte("0"), 0o666); err != nil {
-		return fmt.Errorf("failed to write GPIO: %w", err)
+var bootOverrideEnabledValues = []string{"Disabled", "Once", "Continuous"}
+var bootOverrideModeValues = []string{"Legacy", "UEFI"}
+
+// Boot configuration of System.1. An enabled override is applied by typing
+// the boot profile's keys on the HID keyboard after the next power-on.
+var currentBootConfig = newBootConfig()
+
+func newBootConfig() Boot {
+	return Boot{
+		BootSourceOverrideEnabled: "Disabled",
+		BootSourceOverrideMode:    "UEFI",
+		BootSourceOverrideTarget:  "None",
+		BootSourceOverrideEnabledAllowableValues: bootOverrideEnabledValues,
+		BootSourceOverrideModeAllowableValues:    bootOverrideModeValues,
+		BootSourceOverrideTargetAllowableValues: []string{
+			"None", "Pxe", "Cd", "Usb", "Hdd", "BiosSetup",
+			"Utilities", "Diags", "UefiShell", "UefiTarget",
+			"SDCard", "UefiHttp", "RemoteDrive", "UefiBootNext",
+		},
 	}
-	return nil
 }
 
+// getPowerState reads System.1's power LED.
 func getPowerState() (string, error) {
-	powerLED, err := readGPIO(currentHardware.GPIOPowerLED)
-	if err != nil {
-		return "", err
-	}
-
-	// GPIO value is inverted: 0 = power on, 1 = power off
-	if powerLED == 0 {
-		return "On", nil
-	}
-	return "Off", nil
-}
-
-func performReset() error {
-	return writeGPIO(currentHardware.GPIOReset, 800)
-}
-
-func pressPowerButton() error {
-	return writeGPIO(currentHardware.GPIOPower, 800)
-}
-
-func longPressPowerButton() error {
-	return writeGPIO(currentHardware.GPIOPower, 1000)
+	return hardwareBackend.GetPowerState()
 }
 
 type ServiceRoot struct {
@@ -158,9 +125,17 @@ type ServiceRoot struct {
 	ID           string                 `json:"Id"`
 	Name         string                 `json:"Name"`
 	RedfishVersion string              `json:"RedfishVersion"`
+	UUID         string                 `json:"UUID"`
 	Systems      map[string]string      `json:"Systems"`
 	Managers     map[string]string      `json:"Managers"`
 	Chassis      map[string]string      `json:"Chassis"`
+	AccountService map[string]string    `json:"AccountService"`
+	EventService map[string]string      `json:"EventService"`
+	SessionService map[string]string    `json:"SessionService"`
+	Tasks        map[string]string      `json:"Tasks"`
+	JsonSchemas  map[string]string      `json:"JsonSchemas"`
+	Registries   map[string]string      `json:"Registries"`
+	Links        map[string]Link        `json:"Links"`
 }
 
 type SystemCollection struct {
@@ -168,50 +143,91 @@ type SystemCollection struct {
 	ODataID   string                 `json:"@odata.id"`
 	Name      string                 `json:"Name"`
 	Members   []map[string]string    `json:"Members"`
+	Count     int                    `json:"Members@odata.count"`
+	NextLink  string                 `json:"Members@odata.nextLink,omitempty"`
+	OperationApplyTimeSupport *OperationApplyTimeSupport `json:"@Redfish.OperationApplyTimeSupport,omitempty"`
 }
 
 type Boot struct {
 	BootSourceOverrideEnabled            string   `json:"BootSourceOverrideEnabled"`
+	BootSourceOverrideEnabledAllowableValues []string `json:"BootSourceOverrideEnabled@Redfish.AllowableValues,omitempty"`
 	BootSourceOverrideMode               string   `json:"BootSourceOverrideMode,omitempty"`
+	BootSourceOverrideModeAllowableValues []string `json:"BootSourceOverrideMode@Redfish.AllowableValues,omitempty"`
 	BootSourceOverrideTarget             string   `json:"BootSourceOverrideTarget"`
 	BootSourceOverrideTargetAllowableValues []string `json:"BootSourceOverrideTarget@Redfish.AllowableValues"`
+	UefiTargetBootSourceOverride         string   `json:"UefiTargetBootSourceOverride,omitempty"`
+	// BootNext and BootOrder are kept for clients that send the whole
+	// Boot object; the firmware's own boot order is not changed.
+	BootNext  *string  `json:"BootNext,omitempty"`
+	BootOrder []string `json:"BootOrder,omitempty"`
 }
 
 type ComputerSystem struct {
 	ODataType    string                 `json:"@odata.type"`
 	ODataID      string                 `json:"@odata.id"`
+	ODataEtag    string                 `json:"@odata.etag,omitempty"`
 	ID           string                 `json:"Id"`
 	Name         string                 `json:"Name"`
-	PowerState   string                 `json:"PowerState"`
+	PowerState   string                 `json:"PowerState,omitempty"`
+	PowerRestorePolicy string           `json:"PowerRestorePolicy,omitempty"`
+	IndicatorLED string                 `json:"IndicatorLED,omitempty"`
+	LocationIndicatorActive *bool       `json:"LocationIndicatorActive,omitempty"`
+	Status       map[string]string      `json:"Status,omitempty"`
 	Boot         Boot                   `json:"Boot"`
 	Actions      map[string]interface{} `json:"Actions"`
+	Links        map[string][]Link      `json:"Links"`
+	Oem          *ComputerSystemOem     `json:"Oem,omitempty"`
+	OperationApplyTimeSupport *OperationApplyTimeSupport `json:"@Redfish.OperationApplyTimeSupport,omitempty"`
+	Settings                  *Settings                  `json:"@Redfish.Settings,omitempty"`
+}
+
+type ComputerSystemOem struct {
+	NanoKVM ComputerSystemOemNanoKVM `json:"NanoKVM"`
+}
+
+// ComputerSystemOemNanoKVM selects the keystroke profile used to steer the
+// host firmware for boot overrides.
+type ComputerSystemOemNanoKVM struct {
+	BootProfile                string   `json:"BootProfile,omitempty"`
+	BootProfileAllowableValues []string `json:"BootProfile@Redfish.AllowableValues,omitempty"`
 }
 
 type ResetAction struct {
 	Target               string   `json:"target"`
 	ResetTypeRedfishAllowableValues []string `json:"ResetType@Redfish.AllowableValues"`
+	ActionInfo           string   `json:"@Redfish.ActionInfo,omitempty"`
+	OperationApplyTimeSupport *OperationApplyTimeSupport `json:"@Redfish.OperationApplyTimeSupport,omitempty"`
 }
 
 type ResetRequest struct {
-	ResetType string `json:"ResetType"`
+	ResetType          string     `json:"ResetType"`
+	Oem                *ActionOem `json:"Oem,omitempty"`
+	OperationApplyTime *string    `json:"@Redfish.OperationApplyTime,omitempty"`
 }
 
 type SystemPatchRequest struct {
 	Boot *Boot `json:"Boot,omitempty"`
+	PowerRestorePolicy *string `json:"PowerRestorePolicy,omitempty"`
+	Oem  *ComputerSystemOem `json:"Oem,omitempty"`
+	OperationApplyTime *string `json:"@Redfish.OperationApplyTime,omitempty"`
 }
 
 func handleServiceRoot(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, "/redfish/v1") {
+		return
+	}
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, "GET")
 		return
 	}
 
 	root := ServiceRoot{
-		ODataType:      "#ServiceRoot.v1_5_0.ServiceRoot",
+		ODataType:      odataType("ServiceRoot"),
 		ODataID:        "/redfish/v1",
 		ID:             "RootService",
 		Name:           "NanoKVM Redfish Service",
 		RedfishVersion: "1.8.0",
+		UUID:           serviceUUID(),
 		Systems: map[string]string{
 			"@odata.id": "/redfish/v1/Systems",
 		},
@@ -221,169 +237,518 @@ func handleServiceRoot(w http.ResponseWriter, r *http.Request) {
 		Chassis: map[string]string{
 			"@odata.id": "/redfish/v1/Chassis",
 		},
+		AccountService: map[string]string{
+			"@odata.id": accountServicePath,
+		},
+		EventService: map[string]string{
+			"@odata.id": eventServicePath,
+		},
+		SessionService: map[string]string{
+			"@odata.id": sessionServicePath,
+		},
+		Tasks: map[string]string{
+			"@odata.id": taskServicePath,
+		},
+		JsonSchemas: map[string]string{
+			"@odata.id": jsonSchemasPath,
+		},
+		Registries: map[string]string{
+			"@odata.id": registriesPath,
+		},
+		Links: map[string]Link{
+			"Sessions": {ODataID: sessionServicePath + "/Sessions"},
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(root)
 }
 
+// handleRedfishVersions serves the protocol versions document at
+// /redfish, where some clients start discovery.
+func handleRedfishVersions(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, "/redfish") {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"v1": "/redfish/v1/"})
+}
+
+// handleSystems serves the Systems collection and routes the rest to the
+// system named by the path.
 func handleSystems(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/redfish/v1/Systems"), "/")
+	if rest == "" {
+		handleSystemCollection(w, r)
+		return
+	}
+	id, sub, _ := strings.Cut(rest, "/")
+	s := findSystem(id)
+	if s == nil {
+		writeNotFound(w, r)
+		return
+	}
+	switch sub {
+	case "":
+		handleSystem(w, r, s)
+	case "Actions/ComputerSystem.Reset":
+		handleReset(w, r, s)
+	case "Settings":
+		handleSystemSettings(w, r, s)
+	case "ResetActionInfo":
+		// A system with no reset action has nothing to describe.
+		if len(s.resetTypes()) == 0 {
+			writeNotFound(w, r)
+			return
+		}
+		handleActionInfo(w, r, s.resetActionInfo())
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleSystemCollection(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, "GET")
 		return
 	}
 
+	members := []map[string]string{}
+	for _, s := range allSystems() {
+		members = append(members, map[string]string{"@odata.id": s.path()})
+	}
+
 	collection := SystemCollection{
 		ODataType: "#ComputerSystemCollection.ComputerSystemCollection",
 		ODataID:   "/redfish/v1/Systems",
 		Name:      "Computer System Collection",
-		Members: []map[string]string{
-			{"@odata.id": "/redfish/v1/Systems/System.1"},
-		},
+		Members:   members,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(collection)
+	writeCollection(w, r, collection)
 }
 
-func handleSystem(w http.ResponseWriter, r *http.Request) {
+func handleSystem(w http.ResponseWriter, r *http.Request, s *hostSystem) {
 	switch r.Method {
 	case http.MethodGet:
-		handleSystemGet(w, r)
+		handleSystemGet(w, r, s)
 	case http.MethodPatch:
-		handleSystemPatch(w, r)
+		handleSystemPatch(w, r, s)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
 	}
 }
 
-func handleSystemGet(w http.ResponseWriter, r *http.Request) {
-	powerState, err := getPowerState()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get power state: %v", err), http.StatusInternalServerError)
-		return
+func handleSystemGet(w http.ResponseWriter, r *http.Request, s *hostSystem) {
+	// Without a power LED the PowerState is left out.
+	var powerState string
+	if powerLED, _, _ := s.capabilities(); powerLED {
+		var err error
+		if powerState, err = s.powerState(); err != nil {
+			writeHardwareError(w, err, "ComputerSystem.PowerState")
+			return
+		}
 	}
+	resetTypes := s.resetTypes()
 
 	system := ComputerSystem{
-		ODataType:  "#ComputerSystem.v1_13_0.ComputerSystem",
-		ODataID:    "/redfish/v1/Systems/System.1",
-		ID:         "System.1",
-		Name:       "NanoKVM System",
+		ODataType:  odataType("ComputerSystem"),
+		ODataID:    s.path(),
+		ODataEtag:  systemETag(s),
+		ID:         s.ID,
+		Name:       s.Name,
 		PowerState: powerState,
-		Boot:       currentBootConfig,
+		Boot:       *s.boot,
 		Actions: map[string]interface{}{
 			"#ComputerSystem.Reset": ResetAction{
-				Target: "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
-				ResetTypeRedfishAllowableValues: []string{"On", "ForceOff", "GracefulShutdown", "ForceRestart"},
+				Target: s.path() + "/Actions/ComputerSystem.Reset",
+				ResetTypeRedfishAllowableValues: resetTypes,
+				ActionInfo: s.resetActionInfoPath(),
+				OperationApplyTimeSupport: immediateApplyTime(),
 			},
 		},
+		// Clients such as sushy find the VirtualMedia through the
+		// managers listed here.
+		Links: map[string][]Link{
+			"ManagedBy": {{ODataID: "/redfish/v1/Managers/BMC"}},
+		},
+		OperationApplyTimeSupport: immediateApplyTime(),
+		Settings:                  s.settingsAnnotation(),
+	}
+	if len(resetTypes) == 0 {
+		delete(system.Actions, "#ComputerSystem.Reset")
+	}
+	// The power restore policy, the keyboard and the chassis's LEDs
+	// belong to the host the NanoKVM is plugged into.
+	var indicator string
+	if s == primarySystem {
+		system.PowerRestorePolicy = getPowerRestorePolicy()
+		system.Links["Chassis"] = []Link{{ODataID: "/redfish/v1/Chassis/System"}}
+		system.Oem = &ComputerSystemOem{
+			NanoKVM: ComputerSystemOemNanoKVM{
+				BootProfile:                getBootProfile(),
+				BootProfileAllowableValues: bootProfileNames(),
+			},
+		}
+		var ok bool
+		if indicator, ok = indicatorLED(); ok {
+			active := indicator == "Lit" || indicator == "Blinking"
+			system.IndicatorLED, system.LocationIndicatorActive = indicator, &active
+		}
 	}
+	system.Status = systemStatus(s, powerState, indicator)
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", system.ODataEtag)
 	json.NewEncoder(w).Encode(system)
 }
 
-func handleSystemPatch(w http.ResponseWriter, r *http.Request) {
+func handleSystemPatch(w http.ResponseWriter, r *http.Request, s *hostSystem) {
 	var req SystemPatchRequest
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
 		return
 	}
 
 	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkOperationApplyTime(w, req.OperationApplyTime) {
+		return
+	}
+	// metal3 reuses the etag from before its previous Boot PATCH.
+	if !checkPreconditions(w, r, systemETag(s), metal3Compatible() && req.Oem == nil) {
+		return
+	}
+	get := func(w http.ResponseWriter, r *http.Request) { handleSystemGet(w, r, s) }
+	ignored, ok := checkPatchProperties(w, r, body, &req, get)
+	if !ok {
+		return
+	}
+	// Only System.1 has a power restore policy and a boot profile.
+	if s != primarySystem && req.PowerRestorePolicy != nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyNotWritable", "PowerRestorePolicy").withProperty("#/PowerRestorePolicy"))
+		return
+	}
+	if s != primarySystem && req.Oem != nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyNotWritable", "BootProfile").withProperty("#/Oem/NanoKVM/BootProfile"))
 		return
 	}
 
-	// Update boot configuration if provided
-	if req.Boot != nil {
-		if req.Boot.BootSourceOverrideEnabled != "" {
-			currentBootConfig.BootSourceOverrideEnabled = req.Boot.BootSourceOverrideEnabled
+	if req.PowerRestorePolicy != nil && !containsString(powerRestorePolicyValues, *req.PowerRestorePolicy) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueNotInList", *req.PowerRestorePolicy, "PowerRestorePolicy").
+				withProperty("#/PowerRestorePolicy"))
+		return
+	}
+
+	if req.Oem != nil && req.Oem.NanoKVM.BootProfile != "" {
+		if err := setBootProfile(req.Oem.NanoKVM.BootProfile); err != nil {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueNotInList", req.Oem.NanoKVM.BootProfile, "BootProfile").
+					withProperty("#/Oem/NanoKVM/BootProfile"))
+			return
 		}
-		if req.Boot.BootSourceOverrideTarget != "" {
-			// Validate target is in allowed values
-			validTarget := false
-			for _, allowed := range currentBootConfig.BootSourceOverrideTargetAllowableValues {
-				if req.Boot.BootSourceOverrideTarget == allowed {
-					validTarget = true
-					break
-				}
-			}
-			if !validTarget {
-				http.Error(w, "Invalid BootSourceOverrideTarget", http.StatusBadRequest)
-				return
-			}
-			currentBootConfig.BootSourceOverrideTarget = req.Boot.BootSourceOverrideTarget
+	}
+
+	if req.Boot != nil && !s.applyBootPatch(w, req.Boot) {
+		return
+	}
+
+	if req.PowerRestorePolicy != nil {
+		if err := setPowerRestorePolicy(*req.PowerRestorePolicy); err != nil {
+			writeInternalError(w, "save power settings", err)
+			return
+		}
+	}
+
+	writePatchResult(w, r, ignored, get)
+}
+
+// powerOperation is one hardware step of a power action.
+type powerOperation struct {
+	Description string
+	Do          func() error
+	// Transition is the PowerState reported from the start of Do until
+	// the power LED confirms it, if any.
+	Transition string
+}
+
+// resetTypes lists the ResetType values the system accepts. Those that
+// act on the power state need the power LED to read it, and a board
+// without a power or reset button loses the types that press it.
+func (s *hostSystem) resetTypes() []string {
+	powerLED, powerButton, resetButton := s.capabilities()
+	var types []string
+	if powerLED && powerButton {
+		types = append(types, "On", "ForceOn", "ForceOff", "GracefulShutdown", "GracefulRestart")
+	}
+	if resetButton {
+		types = append(types, "ForceRestart")
+	}
+	if powerButton {
+		types = append(types, "PushPowerButton")
+	}
+	if powerLED && powerButton {
+		types = append(types, "PowerCycle")
+	}
+	if s.nmiSupported() {
+		types = append(types, "Nmi")
+	}
+	return types
+}
+
+// planReset works out the button presses for resetType given the current
+// power state, with the board's press lengths unless presses overrides
+// them. It returns false for a reset type the system does not accept.
+func (s *hostSystem) planReset(resetType string, presses PressDurations) ([]powerOperation, bool) {
+	powerMs, longMs, resetMs := presses.apply(s.pressDurations())
+	pressPower := func() error { return s.pressPowerButton(powerMs) }
+	press := powerOperation{fmt.Sprintf("Press power button for %d ms", powerMs), pressPower, "PoweringOn"}
+	shutdown := powerOperation{fmt.Sprintf("Press power button for %d ms", powerMs), pressPower, "PoweringOff"}
+	longPress := powerOperation{fmt.Sprintf("Hold power button for %d ms", longMs), func() error { return s.pressPowerButton(longMs) }, "PoweringOff"}
+	reset := powerOperation{fmt.Sprintf("Press reset button for %d ms", resetMs), func() error { return s.performReset(resetMs) }, "PoweringOn"}
+	waitOff := powerOperation{"Wait for the power LED to go off", func() error { return s.waitForPowerOff(powerOffWait) }, ""}
+	waitShutdown := powerOperation{"Wait for the host to shut down", func() error { return s.waitForPowerOff(shutdownWait) }, ""}
+	nmi := powerOperation{fmt.Sprintf("Pulse the NMI line for %d ms", nmiPulse/time.Millisecond), s.sendNMI, ""}
+
+	switch resetType {
+	case "On", "ForceOn", "ForceOff", "GracefulShutdown", "GracefulRestart", "ForceRestart", "PushPowerButton", "PowerCycle", "Nmi":
+	default:
+		return nil, false
+	}
+	if !containsString(s.resetTypes(), resetType) {
+		// The board is not wired for it.
+		return nil, false
+	}
+	switch resetType {
+	case "ForceRestart":
+		return []powerOperation{reset}, true
+	case "Nmi":
+		// The host keeps running; the interrupt only triggers a crash
+		// dump if its OS is set up for one.
+		return []powerOperation{nmi}, true
+	}
+
+	// A reset acts on what the LED shows now, not on the last sample.
+	powerState, err := s.getPowerState()
+	if err == nil {
+		powerState = s.withPowerTransition(powerState)
+	}
+	switch resetType {
+	case "On", "ForceOn":
+		if powerState == "Off" {
+			return []powerOperation{press}, true
+		}
+	case "ForceOff":
+		// Forcing the host off also cuts a graceful shutdown short.
+		if powerState == "On" || powerState == "PoweringOn" || powerState == "PoweringOff" {
+			return []powerOperation{longPress}, true
+		}
+	case "GracefulShutdown":
+		if powerState == "On" && currentConfig.GracefulShutdownTimeout > 0 {
+			return []powerOperation{shutdown, s.escalateShutdown(currentConfig.GracefulShutdownTimeout, longMs)}, true
+		}
+		if powerState == "On" {
+			return []powerOperation{shutdown, waitShutdown}, true
+		}
+	case "PushPowerButton":
+		// The press happens whatever the state; the state only says
+		// which way the host is expected to go.
+		switch powerState {
+		case "Off":
+			return []powerOperation{press}, true
+		case "On":
+			return []powerOperation{shutdown}, true
 		}
-		if req.Boot.BootSourceOverrideMode != "" {
-			currentBootConfig.BootSourceOverrideMode = req.Boot.BootSourceOverrideMode
+		return []powerOperation{{press.Description, pressPower, ""}}, true
+	case "GracefulRestart":
+		switch powerState {
+		case "On":
+			return []powerOperation{shutdown, waitShutdown, press}, true
+		case "PoweringOff":
+			return []powerOperation{waitShutdown, press}, true
+		case "Off":
+			return []powerOperation{press}, true
+		}
+	case "PowerCycle":
+		if powerState == "On" || powerState == "PoweringOff" {
+			return []powerOperation{longPress, waitOff, press}, true
+		}
+		if powerState == "Off" {
+			return []powerOperation{press}, true
 		}
 	}
+	return nil, true
+}
 
-	// Return success with no content
-	w.WriteHeader(http.StatusNoContent)
+// overrideTarget returns the boot override target if one is enabled.
+func (b *Boot) overrideTarget() (string, bool) {
+	target := b.BootSourceOverrideTarget
+	if b.BootSourceOverrideEnabled == "Disabled" || target == "None" || target == "" {
+		return "", false
+	}
+	return target, true
+}
+
+// powersOn reports whether the planned operations start the host booting,
+// which is when a boot override has to be typed.
+func powersOn(resetType string, ops []powerOperation) bool {
+	switch resetType {
+	case "On", "ForceOn", "GracefulRestart", "PowerCycle":
+		return len(ops) > 0
+	case "PushPowerButton":
+		return len(ops) > 0 && ops[0].Transition == "PoweringOn"
+	case "ForceRestart":
+		return true
+	}
+	return false
 }
 
-func handleReset(w http.ResponseWriter, r *http.Request) {
+func handleReset(w http.ResponseWriter, r *http.Request, s *hostSystem) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, "POST")
 		return
 	}
 
 	var req ResetRequest
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
 		return
 	}
 
 	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkActionParameters(w, body, "ComputerSystem.Reset", &req) {
+		return
+	}
+	if req.ResetType == "" {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterMissing", "ComputerSystem.Reset", "ResetType").withProperty("#/ResetType"))
+		return
+	}
+	if !checkOperationApplyTime(w, req.OperationApplyTime) {
 		return
 	}
 
-	switch req.ResetType {
-	case "On":
-		powerState, _ := getPowerState()
-		if powerState == "Off" {
-			if err := pressPowerButton(); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to power on: %v", err), http.StatusInternalServerError)
-				return
-			}
+	var presses PressDurations
+	if req.Oem != nil && req.Oem.NanoKVM.PressDurations != nil {
+		presses = *req.Oem.NanoKVM.PressDurations
+		if name, value, ok := presses.validate(); !ok {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("ActionParameterValueFormatError", fmt.Sprint(value), name, "ComputerSystem.Reset").
+					withProperty("#/Oem/NanoKVM/PressDurations/"+name))
+			return
 		}
-	case "ForceOff":
-		powerState, _ := getPowerState()
-		if powerState == "On" {
-			if err := longPressPowerButton(); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to power off: %v", err), http.StatusInternalServerError)
-				return
-			}
+	}
+
+	// The plan depends on the power state, so it is made under the same
+	// lock as the presses.
+	dryRun := dryRunRequested(r, req.Oem)
+	locked := false
+	if !dryRun {
+		if !s.actionMu.TryLock() {
+			writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+			return
 		}
-	case "GracefulShutdown":
-		powerState, _ := getPowerState()
-		if powerState == "On" {
-			if err := pressPowerButton(); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to shutdown: %v", err), http.StatusInternalServerError)
-				return
+		locked = true
+		defer func() {
+			if locked {
+				s.actionMu.Unlock()
 			}
+		}()
+	}
+
+	ops, ok := s.planReset(req.ResetType, presses)
+	if !ok {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", req.ResetType, "ResetType", "ComputerSystem.Reset").
+				withProperty("#/ResetType"))
+		return
+	}
+	if req.ResetType == "ForceOn" && len(ops) == 0 {
+		// On leaves a running host alone; ForceOn is refused, so a client
+		// that forces power on learns it did not boot the host.
+		writeRedfishError(w, http.StatusConflict, newMessage("PropertyValueConflict", "ResetType", "PowerState"))
+		return
+	}
+
+	if dryRun {
+		powerState, err := s.powerState()
+		if err != nil {
+			powerState = "Unknown"
 		}
-	case "ForceRestart":
-		if err := performReset(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to reset: %v", err), http.StatusInternalServerError)
-			return
+		report := DryRunReport{
+			Action:       "ComputerSystem.Reset",
+			Parameters:   map[string]string{"ResetType": req.ResetType},
+			CurrentState: map[string]string{"PowerState": powerState},
 		}
-	default:
-		http.Error(w, fmt.Sprintf("Invalid ResetType: %s", req.ResetType), http.StatusBadRequest)
+		for _, op := range ops {
+			report.WouldPerform = append(report.WouldPerform, op.Description)
+		}
+		boot := s.boot
+		if s.settings.pending != nil && powersOn(req.ResetType, ops) {
+			boot = s.settings.pending
+			report.WouldPerform = append(report.WouldPerform, "Apply the pending settings")
+		}
+		if target, ok := boot.overrideTarget(); ok && powersOn(req.ResetType, ops) {
+			// Only System.1 is on the keyboard.
+			profile := bootKeyProfiles[getBootProfile()]
+			if key, steps, err := profile.KeySequence(target); err == nil && s == primarySystem {
+				report.WouldPerform = append(report.WouldPerform, describeKeySequence(profile, key, steps))
+			}
+			if boot.BootSourceOverrideEnabled == "Once" {
+				report.WouldPerform = append(report.WouldPerform, "Clear the one-time boot override")
+			}
+		}
+		writeDryRunReport(w, report)
 		return
 	}
 
+	// A press takes the best part of a second, which would tie up the
+	// request, so it runs as a task unless synchronous_reset asks for the
+	// old behaviour. A plan of more than one step waits for the host
+	// between them, up to the shutdown timeout, and whether a
+	// GracefulShutdown, GracefulRestart or PowerCycle worked is only known
+	// at the end, so it always gets one.
+	if len(ops) > 0 && (!currentConfig.SynchronousReset || respondAsync(r) || len(ops) > 1) {
+		locked = false
+		t := taskStore.Start(fmt.Sprintf("Reset %s (%s)", s.ID, req.ResetType), func(t *task) {
+			status, msg := s.runReset(req.ResetType, ops, t.SetPercent)
+			// Free the system first, so a client that sees the task end
+			// can reset it again straight away.
+			s.actionMu.Unlock()
+			t.Finish(status, msg)
+		})
+		writeTaskAccepted(w, t)
+		return
+	}
+
+	if status, msg := s.runReset(req.ResetType, ops, nil); msg != nil {
+		writeRedfishError(w, status, *msg)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func handleManagers(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, "/redfish/v1/Managers") {
+		return
+	}
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, "GET")
 		return
 	}
 
@@ -396,35 +761,94 @@ func handleManagers(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(collection)
+	writeCollection(w, r, collection)
 }
 
 func handleManager(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !checkResourcePath(w, r, "/redfish/v1/Managers/BMC") {
 		return
 	}
+	switch r.Method {
+	case http.MethodGet:
+		handleManagerGet(w, r)
+	case http.MethodPatch:
+		handleManagerPatch(w, r)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
+	}
+}
 
+// managerResource returns the Manager without its clock, which changes
+// every second and so is left out of its etag.
+func managerResource() map[string]interface{} {
 	manager := map[string]interface{}{
-		"@odata.type": "#Manager.v1_5_0.Manager",
+		"@odata.type": odataType("Manager"),
 		"@odata.id":   "/redfish/v1/Managers/BMC",
 		"Id":          "BMC",
 		"Name":        "NanoKVM Manager",
 		"ManagerType": "BMC",
-		"Status": map[string]string{
-			"State":  "Enabled",
-			"Health": "OK",
+		"Status":      managerStatus(),
+		"LogServices": map[string]string{
+			"@odata.id": logServicesPath,
+		},
+		"HostInterfaces": map[string]string{
+			"@odata.id": hostInterfacesPath,
+		},
+		"VirtualMedia": map[string]string{
+			"@odata.id": virtualMediaPath,
+		},
+		"NetworkProtocol": map[string]string{
+			"@odata.id": networkProtocolPath,
+		},
+		"EthernetInterfaces": map[string]string{
+			"@odata.id": ethernetInterfacesPath,
+		},
+		"UUID":                  serviceUUID(),
+		"ServiceEntryPointUUID": serviceUUID(),
+		"Links": map[string]interface{}{
+			"ManagerForServers": managedSystemLinks(),
+			"ManagerForChassis": []Link{{ODataID: "/redfish/v1/Chassis/System"}},
+		},
+		"Actions": map[string]interface{}{
+			"#Manager.Reset": managerResetAction(),
+			"Oem": map[string]interface{}{
+				"#NanoKVM.SetMaintenanceMode": map[string]string{
+					"target": maintenanceActionPath,
+				},
+			},
+		},
+		"Oem": map[string]interface{}{
+			"NanoKVM": map[string]interface{}{
+				"MaintenanceMode": inMaintenanceMode(),
+				"GPIOs": map[string]string{
+					"@odata.id": auxGPIOsPath,
+				},
+			},
 		},
 	}
 
+	addManagerInventory(manager)
+	return manager
+}
+
+// handleManagerGet serves the Manager. A matching If-None-Match still gets
+// the full body, since the clock in it has moved on.
+func handleManagerGet(w http.ResponseWriter, r *http.Request) {
+	manager := managerResource()
+	etag := resourceETag(manager)
+	addManagerDateTime(manager)
+	manager["@odata.etag"] = etag
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
 	json.NewEncoder(w).Encode(manager)
 }
 
 func handleChassis(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, "/redfish/v1/Chassis") {
+		return
+	}
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, "GET")
 		return
 	}
 
@@ -437,18 +861,41 @@ func handleChassis(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(collection)
+	writeCollection(w, r, collection)
 }
 
 func handleChassisItem(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, "/redfish/v1/Chassis/System") {
+		return
+	}
+	if r.Method == http.MethodPatch {
+		handlePatchChassis(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		// Only the intrusion sensor makes the chassis writable.
+		if currentIntrusionSensor == nil {
+			writeMethodNotAllowed(w, r, "GET")
+		} else {
+			writeMethodNotAllowed(w, r, "GET", "PATCH")
+		}
 		return
 	}
 
+	chassis := chassisResource()
+	etag := resourceETag(chassis)
+	if notModified(w, r, etag) {
+		return
+	}
+	chassis["@odata.etag"] = etag
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(chassis)
+}
+
+func chassisResource() map[string]interface{} {
 	chassis := map[string]interface{}{
-		"@odata.type": "#Chassis.v1_10_0.Chassis",
+		"@odata.type": odataType("Chassis"),
 		"@odata.id":   "/redfish/v1/Chassis/System",
 		"Id":          "System",
 		"Name":        "NanoKVM System Chassis",
@@ -457,39 +904,284 @@ func handleChassisItem(w http.ResponseWriter, r *http.Request) {
 			"State":  "Enabled",
 			"Health": "OK",
 		},
+		"Links": map[string]interface{}{
+			"ComputerSystems": []Link{{ODataID: primarySystem.path()}},
+			"ManagedBy":       []Link{{ODataID: "/redfish/v1/Managers/BMC"}},
+		},
+	}
+	chassis["Sensors"] = map[string]string{"@odata.id": sensorsPath}
+	if powerMeterPresent() {
+		chassis["PowerSubsystem"] = map[string]string{"@odata.id": powerSubsystemPath}
+	}
+	if fanConfigured() {
+		chassis["ThermalSubsystem"] = map[string]string{"@odata.id": thermalSubsystemPath}
+	}
+	if security := physicalSecurity(); security != nil {
+		chassis["PhysicalSecurity"] = security
+		if security["IntrusionSensor"] == "HardwareIntrusion" {
+			chassis["Status"] = map[string]string{"State": "Enabled", "Health": "Critical"}
+		}
+	}
+	return chassis
+}
+
+func newRouter() router {
+	return router{
+		"/redfish":                                handleRedfishVersions,
+		"/redfish/v1":                             handleServiceRoot,
+		metadataPath:                              handleMetadata,
+		odataServicePath:                          handleODataService,
+		oemSchemaPath:                             handleOemSchema,
+		jsonSchemasPath:                           handleJsonSchemas,
+		registriesPath:                            handleRegistries,
+		"/redfish/v1/Systems":                     handleSystems,
+		"/redfish/v1/Managers":                    handleManagers,
+		"/redfish/v1/Managers/BMC":                handleManager,
+		networkProtocolPath:                       handleNetworkProtocol,
+		ethernetInterfacesPath:                    handleEthernetInterfaces,
+		maintenanceActionPath:                     handleSetMaintenanceMode,
+		managerResetPath:                          handleManagerReset,
+		managerResetActionInfoPath:                handleManagerResetActionInfo,
+		auxGPIOsPath:                              handleAuxGPIOs,
+		"/redfish/v1/Managers/BMC/LogServices":    handleLogServices,
+		"/redfish/v1/Managers/BMC/HostInterfaces": handleHostInterfaces,
+		virtualMediaPath:                          handleVirtualMedia,
+		"/redfish/v1/AccountService":              handleAccountService,
+		"/redfish/v1/EventService":                handleEventService,
+		"/redfish/v1/SessionService":              handleSessionService,
+		taskServicePath:                           handleTaskService,
+		"/redfish/v1/Chassis":                     handleChassis,
+		"/redfish/v1/Chassis/System":              handleChassisItem,
+		sensorsPath:                               handleSensors,
+		powerSubsystemPath:                        handlePowerSubsystem,
+		thermalSubsystemPath:                      handleThermalSubsystem,
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(chassis)
+func newHandler() http.Handler {
+	return withCanonicalPath(withODataVersion(withAudit(withWriteAllowlist(withActionRateLimit(withAuth(withContentType(withMaintenanceMode(withSchemaValidation(withODataAnnotations(withOptions(newRouter())))))))))))
 }
 
 func main() {
-	hw, err := detectHardware()
+	if len(os.Args) > 1 && os.Args[1] == "provision-test" {
+		os.Exit(provisionTestMain(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	mock := flag.Bool("mock", false, "simulate the NanoKVM and its host instead of using the hardware")
+	flag.StringVar(&configFile, "config", configFile, "path to the JSON config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *mock {
+		dir, err := os.MkdirTemp("", "nanokvm-redfish-mock-")
+		if err != nil {
+			log.Fatalf("Failed to create simulated device: %v", err)
+		}
+		if err := simulateDevice(&cfg, dir); err != nil {
+			log.Fatalf("Failed to create simulated device: %v", err)
+		}
+		log.Printf("Simulating the NanoKVM; state is kept in %s", dir)
+		rebootDevice = func() error {
+			log.Printf("Not rebooting: the NanoKVM is simulated")
+			return nil
+		}
+		setSystemClock = func(t time.Time) error {
+			log.Printf("Not setting the clock to %s: the NanoKVM is simulated", t.Format(time.RFC3339))
+			return nil
+		}
+	}
+	currentConfig = cfg
+	displayLocation = cfg.location()
+
+	// Deferred first so that a GracefulRestart reboots only once
+	// everything deferred below has saved its state.
+	rebootOnExit := false
+	defer func() {
+		if rebootOnExit {
+			if err := rebootDevice(); err != nil {
+				log.Fatalf("Failed to reboot: %v", err)
+			}
+		}
+	}()
+	registerBootProfiles(cfg.BootProfiles)
+	setBootProfile(cfg.BootProfile)
+	setMaintenanceMode(cfg.MaintenanceMode)
+
+	store, err := openAccountStore(cfg.AccountsFile)
+	if err != nil {
+		log.Fatalf("Failed to open account store: %v", err)
+	}
+	accountStore = store
+
+	if err := primarySystem.loadBootState(cfg.BootStateFile); err != nil {
+		log.Fatalf("Failed to load boot settings: %v", err)
+	}
+	for _, sc := range cfg.Systems {
+		s := newHostSystem(sc)
+		if *mock {
+			s.backend = newMockBackend(false)
+		}
+		if err := s.loadBootState(sc.BootStateFile); err != nil {
+			log.Fatalf("Failed to load boot settings of %s: %v", s.ID, err)
+		}
+		extraSystems = append(extraSystems, s)
+	}
+	if err := loadPowerState(cfg.PowerStateFile); err != nil {
+		log.Fatalf("Failed to load power settings: %v", err)
+	}
+	if err := loadNTPState(cfg.NTP); err != nil {
+		log.Fatalf("Failed to load NTP settings: %v", err)
+	}
+	if err := loadVLANs(cfg.Network); err != nil {
+		log.Fatalf("Failed to load VLANs: %v", err)
+	}
+	if err := loadNetworkState(cfg.Network); err != nil {
+		log.Fatalf("Failed to load network settings: %v", err)
+	}
+	if err := loadDNS(cfg.Network); err != nil {
+		log.Fatalf("Failed to load DNS settings: %v", err)
+	}
+	if err := loadServiceUUID(cfg.ServiceUUIDFile); err != nil {
+		log.Fatalf("Failed to load service UUID: %v", err)
+	}
+	if cfg.RequireAuth && containsString(cfg.AuthBackends, "local") && len(store.List()) == 0 {
+		password, err := generatePassword()
+		if err != nil {
+			log.Fatalf("Failed to generate initial password: %v", err)
+		}
+		if _, err := store.Create("admin", password, "Administrator", true); err != nil {
+			log.Fatalf("Failed to create initial account: %v", err)
+		}
+		path, err := writeInitialPassword(cfg.AccountsFile, password)
+		if err != nil {
+			log.Fatalf("Failed to save initial password: %v", err)
+		}
+		log.Printf("Created initial account admin with the password in %s; change it via the AccountService and delete the file", path)
+	}
+
+	trail, err := openAuditTrail(cfg.AuditLogFile)
 	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	auditTrail = trail
+	defer trail.Close()
+
+	events, err := openEventService(cfg.Events.SubscriptionsFile)
+	if err != nil {
+		log.Fatalf("Failed to open event service: %v", err)
+	}
+	eventService = events
+	defer events.Close()
+
+	stopReaper := make(chan struct{})
+	defer close(stopReaper)
+	go sessionStore.reapLoop(time.Minute, stopReaper)
+
+	if err := loadHardwareProfiles(cfg.HardwareProfilesDir); err != nil {
+		log.Fatalf("Failed to load hardware profiles: %v", err)
+	}
+	hw, detectedBy, err := detectHardware()
+	switch {
+	case *mock:
+		hw, hardwareBackend = &simulatedHardware, newMockBackend(false)
+	case err == nil:
+		log.Printf("Detected hardware version: %s (from %s)", hw.Version, detectedBy)
+	case cfg.GPIO.complete():
+		log.Printf("Failed to detect hardware: %v; using the GPIOs from the config", err)
+		hw = &Hardware{Version: HWVersionCustom, HIDKeyboard: "/dev/hidg0"}
+	default:
 		log.Fatalf("Failed to detect hardware: %v", err)
 	}
-	currentHardware = hw
-	log.Printf("Detected hardware version: %s", hw.Version)
-
-	http.HandleFunc("/redfish/v1", handleServiceRoot)
-	http.HandleFunc("/redfish/v1/", handleServiceRoot)
-	http.HandleFunc("/redfish/v1/Systems", handleSystems)
-	http.HandleFunc("/redfish/v1/Systems/", handleSystems)
-	http.HandleFunc("/redfish/v1/Systems/System.1", handleSystem)
-	http.HandleFunc("/redfish/v1/Systems/System.1/", handleSystem)
-	http.HandleFunc("/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", handleReset)
-	http.HandleFunc("/redfish/v1/Managers", handleManagers)
-	http.HandleFunc("/redfish/v1/Managers/", handleManagers)
-	http.HandleFunc("/redfish/v1/Managers/BMC", handleManager)
-	http.HandleFunc("/redfish/v1/Managers/BMC/", handleManager)
-	http.HandleFunc("/redfish/v1/Chassis", handleChassis)
-	http.HandleFunc("/redfish/v1/Chassis/", handleChassis)
-	http.HandleFunc("/redfish/v1/Chassis/System", handleChassisItem)
-	http.HandleFunc("/redfish/v1/Chassis/System/", handleChassisItem)
-
-	port := ":8080"
-	log.Printf("Starting Redfish API server on %s", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
+	configured := cfg.GPIO.apply(*hw)
+	currentHardware = &configured
+	if !*mock {
+		stopDisabledNTP(cfg.NTP)
+		restoreVLANs()
+		applyDNS()
+		exportGPIOs(currentHardware, cfg)
+		gpioProblems = checkGPIOs(currentHardware)
+		for _, s := range extraSystems {
+			// Problems with another host's GPIOs are only logged; they
+			// do not make the manager itself unhealthy.
+			checkGPIOs(s.hardware)
+		}
+		if fanConfigured() {
+			setupFan()
+		}
+	}
+	if powerLED, _, _ := primarySystem.capabilities(); cfg.PowerPollInterval > 0 && powerLED {
+		stopMonitor := make(chan struct{})
+		defer close(stopMonitor)
+		currentPowerMonitor = startPowerMonitor(time.Duration(cfg.PowerPollInterval)*time.Millisecond, stopMonitor)
+		currentPowerMonitor.onPowerStateChange(logPowerStateChange)
+		currentPowerMonitor.onPowerStateChange(recordPowerStateChange)
+		currentPowerMonitor.onPowerStateChange(notePowerLoss)
+	}
+	go applyPowerRestorePolicy()
+	if cfg.ChassisIntrusion.GPIO != "" {
+		stopIntrusion := make(chan struct{})
+		defer close(stopIntrusion)
+		currentIntrusionSensor = startIntrusionSensor(cfg.ChassisIntrusion, stopIntrusion)
+	}
+
+	if cfg.HostInterface.Enabled {
+		startHostInterface()
+	}
+
+	server := &http.Server{
+		Addr:    cfg.ListenAddress,
+		Handler: newHandler(),
+	}
+
+	restart, stopped := make(chan string, 1), make(chan string)
+	restartManager = func(resetType string) { restart <- resetType }
+	go func() {
+		resetType := <-restart
+		timeout := managerShutdownTimeout
+		if resetType == "ForceRestart" {
+			// Only long enough for the action's response to go out.
+			timeout = time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		server.Shutdown(ctx)
+		stopped <- resetType
+	}()
+
+	if cfg.TLS.CertFile != "" {
+		tlsConfig, err := buildTLSConfig(cfg.TLS)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+		if cfg.TLS.RequireClientCert {
+			log.Printf("Client certificate authentication enabled")
+		}
+		log.Printf("Starting Redfish API server on %s (HTTPS)", cfg.ListenAddress)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Starting Redfish API server on %s", cfg.ListenAddress)
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed: %v", err)
 	}
+
+	// The server only closes for a Manager.Reset. A GracefulRestart lets
+	// host actions running in the background finish, so no button is
+	// left held, and reboots once the deferred cleanup has run.
+	if <-stopped == "GracefulRestart" {
+		for _, s := range allSystems() {
+			s.actionMu.Lock()
+		}
+		log.Printf("Service stopped; rebooting the NanoKVM")
+		rebootOnExit = true
+		return
+	}
+	if err := rebootDevice(); err != nil {
+		log.Fatalf("Failed to reboot: %v", err)
+	}
 }
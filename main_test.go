@@ -10,6 +10,14 @@ import (
 	"testing"
 )
 
+// TestMain has resets answer once the buttons are pressed, so the tests can
+// check what a press did straight after it; TestResetRunsAsTask covers the
+// default.
+func TestMain(m *testing.M) {
+	currentConfig.SynchronousReset = true
+	os.Exit(m.Run())
+}
+
 func TestDetectHardware(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -46,12 +54,12 @@ func TestDetectHardware(t *testing.T) {
 				t.Fatal(err)
 			}
 			defer os.Remove(tmpFile.Name())
-			
+
 			if _, err := tmpFile.Write([]byte(tt.hwContent)); err != nil {
 				t.Fatal(err)
 			}
 			tmpFile.Close()
-			
+
 			result, err := detectHardwareFromFile(tmpFile.Name())
 			if tt.expectError {
 				if err == nil {
@@ -216,6 +224,26 @@ func TestHandleServiceRoot(t *testing.T) {
 	if root.RedfishVersion != "1.8.0" {
 		t.Errorf("Expected version '1.8.0', got '%s'", root.RedfishVersion)
 	}
+	// Client libraries find where to log in through these two.
+	if root.SessionService["@odata.id"] != sessionServicePath {
+		t.Errorf("Expected SessionService at %s, got %v", sessionServicePath, root.SessionService)
+	}
+	if root.Links["Sessions"].ODataID != sessionServicePath+"/Sessions" {
+		t.Errorf("Expected Links.Sessions at %s/Sessions, got %v", sessionServicePath, root.Links)
+	}
+}
+
+func TestHandleRedfishVersions(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleRedfishVersions(rr, httptest.NewRequest("GET", "/redfish", nil))
+
+	var versions map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions["v1"] != "/redfish/v1/" {
+		t.Errorf("Expected only v1 at /redfish/v1/, got %v", versions)
+	}
 }
 
 func TestHandleSystems(t *testing.T) {
@@ -250,7 +278,7 @@ func TestHandleSystem(t *testing.T) {
 	if err := os.WriteFile(gpioFile, []byte("0"), 0644); err != nil {
 		t.Fatal(err)
 	}
-	
+
 	oldPath := currentHardware.GPIOPowerLED
 	currentHardware.GPIOPowerLED = gpioFile
 	defer func() {
@@ -263,7 +291,7 @@ func TestHandleSystem(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleSystem)
+	handler := http.HandlerFunc(handleSystems)
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
@@ -295,7 +323,7 @@ func TestHandleReset(t *testing.T) {
 	gpioPower := filepath.Join(tmpDir, "gpio_power")
 	gpioReset := filepath.Join(tmpDir, "gpio_reset")
 	gpioPowerLED := filepath.Join(tmpDir, "gpio_power_led")
-	
+
 	if err := os.WriteFile(gpioPower, []byte("1"), 0644); err != nil {
 		t.Fatal(err)
 	}
@@ -309,11 +337,11 @@ func TestHandleReset(t *testing.T) {
 	oldPower := currentHardware.GPIOPower
 	oldReset := currentHardware.GPIOReset
 	oldPowerLED := currentHardware.GPIOPowerLED
-	
+
 	currentHardware.GPIOPower = gpioPower
 	currentHardware.GPIOReset = gpioReset
 	currentHardware.GPIOPowerLED = gpioPowerLED
-	
+
 	defer func() {
 		currentHardware.GPIOPower = oldPower
 		currentHardware.GPIOReset = oldReset
@@ -341,14 +369,14 @@ func TestHandleReset(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			body := ResetRequest{ResetType: tt.resetType}
 			jsonBody, _ := json.Marshal(body)
-			
+
 			req, err := http.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", bytes.NewBuffer(jsonBody))
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(handleReset)
+			handler := http.HandlerFunc(handleSystems)
 			handler.ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.expectCode {
@@ -381,7 +409,7 @@ func TestMethodNotAllowed(t *testing.T) {
 			name:    "GET to reset action",
 			method:  "GET",
 			path:    "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
-			handler: handleReset,
+			handler: handleSystems,
 		},
 	}
 
@@ -403,14 +431,14 @@ func TestMethodNotAllowed(t *testing.T) {
 }
 
 func TestInvalidJSON(t *testing.T) {
-	req, err := http.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", 
+	req, err := http.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
 		bytes.NewBufferString("invalid json"))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleReset)
+	handler := http.HandlerFunc(handleSystems)
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusBadRequest {
@@ -464,14 +492,14 @@ func TestHandleSystemPatch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req, err := http.NewRequest("PATCH", "/redfish/v1/Systems/System.1", 
+			req, err := http.NewRequest("PATCH", "/redfish/v1/Systems/System.1",
 				bytes.NewBufferString(tt.body))
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(handleSystem)
+			handler := http.HandlerFunc(handleSystems)
 			handler.ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.expectCode {
@@ -481,11 +509,11 @@ func TestHandleSystemPatch(t *testing.T) {
 			// Verify boot config was updated for valid request
 			if tt.name == "Valid boot config update" && tt.expectCode == http.StatusNoContent {
 				if currentBootConfig.BootSourceOverrideEnabled != "Once" {
-					t.Errorf("Expected BootSourceOverrideEnabled 'Once', got '%s'", 
+					t.Errorf("Expected BootSourceOverrideEnabled 'Once', got '%s'",
 						currentBootConfig.BootSourceOverrideEnabled)
 				}
 				if currentBootConfig.BootSourceOverrideTarget != "Pxe" {
-					t.Errorf("Expected BootSourceOverrideTarget 'Pxe', got '%s'", 
+					t.Errorf("Expected BootSourceOverrideTarget 'Pxe', got '%s'",
 						currentBootConfig.BootSourceOverrideTarget)
 				}
 			}
@@ -539,4 +567,38 @@ func TestHandleChassis(t *testing.T) {
 	if result["@odata.type"] != "#ChassisCollection.ChassisCollection" {
 		t.Errorf("Expected ChassisCollection type, got %v", result["@odata.type"])
 	}
-}
\ No newline at end of file
+}
+
+func TestTopologyLinks(t *testing.T) {
+	startFakeHost(t, false)
+	handler := newHandler()
+	links := func(path string) map[string][]Link {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		var resource struct {
+			Links map[string][]Link `json:"Links"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resource); err != nil {
+			t.Fatalf("Expected %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		return resource.Links
+	}
+	linksTo := func(from, name, to string) {
+		t.Helper()
+		for _, link := range links(from)[name] {
+			if link.ODataID == to {
+				return
+			}
+		}
+		t.Errorf("Expected %s Links.%s to reach %s", from, name, to)
+	}
+
+	system, manager, chassis := "/redfish/v1/Systems/System.1", "/redfish/v1/Managers/BMC", "/redfish/v1/Chassis/System"
+	linksTo(system, "ManagedBy", manager)
+	linksTo(system, "Chassis", chassis)
+	linksTo(manager, "ManagerForServers", system)
+	linksTo(manager, "ManagerForChassis", chassis)
+	linksTo(chassis, "ComputerSystems", system)
+	linksTo(chassis, "ManagedBy", manager)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+const maintenanceActionPath = "/redfish/v1/Managers/BMC/Actions/Oem/NanoKVM.SetMaintenanceMode"
+
+var (
+	maintenanceMu   sync.Mutex
+	maintenanceMode bool
+)
+
+func inMaintenanceMode() bool {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	return maintenanceMode
+}
+
+// setMaintenanceMode switches the mode and reports whether it changed.
+func setMaintenanceMode(enabled bool) bool {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	changed := maintenanceMode != enabled
+	maintenanceMode = enabled
+	return changed
+}
+
+type MaintenanceModeRequest struct {
+	Enabled *bool `json:"Enabled"`
+}
+
+func handleSetMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, maintenanceActionPath) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var req MaintenanceModeRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkActionParameters(w, body, "NanoKVM.SetMaintenanceMode", &req) {
+		return
+	}
+	if req.Enabled == nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyMissing", "Enabled").withProperty("#/Enabled"))
+		return
+	}
+
+	if setMaintenanceMode(*req.Enabled) {
+		message, severity := "Maintenance mode disabled", "OK"
+		if *req.Enabled {
+			message, severity = "Maintenance mode enabled", "Warning"
+		}
+		log.Print(message)
+		emitEvent(severity, message, resourceEventPrefix+"ResourceChanged", "/redfish/v1/Managers/BMC")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withMaintenanceMode refuses state-changing requests while the host is
+// under maintenance. GETs, logging in and out, and the action that leaves
+// maintenance mode still work.
+func withMaintenanceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inMaintenanceMode() && isStateChanging(r) && r.URL.Path != maintenanceActionPath {
+			writeRedfishError(w, http.StatusServiceUnavailable,
+				newMessage("ResourceInStandby"), newOemMessage("MaintenanceModeActive"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
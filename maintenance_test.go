@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("admin", "Passw0rd!", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("operator", "Passw0rd!", "Operator", true); err != nil {
+		t.Fatal(err)
+	}
+	setupSessionStore(t)
+	oldConfig := currentConfig
+	oldBoot := currentBootConfig
+	currentConfig.RequireAuth = true
+	defer func() {
+		currentConfig = oldConfig
+		currentBootConfig = oldBoot
+		setMaintenanceMode(false)
+	}()
+
+	handler := newHandler()
+	tests := []struct {
+		name       string
+		username   string
+		method     string
+		path       string
+		body       string
+		expectCode int
+	}{
+		{"Operator cannot enable", "operator", "POST", maintenanceActionPath, `{"Enabled": true}`, http.StatusForbidden},
+		{"Missing Enabled", "admin", "POST", maintenanceActionPath, `{}`, http.StatusBadRequest},
+		{"Enable", "admin", "POST", maintenanceActionPath, `{"Enabled": true}`, http.StatusNoContent},
+		{"Boot override refused", "operator", "PATCH", "/redfish/v1/Systems/System.1", `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`, http.StatusServiceUnavailable},
+		{"Reset refused", "admin", "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", `{"ResetType": "ForceRestart"}`, http.StatusServiceUnavailable},
+		{"Account change refused", "admin", "POST", accountServicePath + "/Accounts", `{"UserName": "new", "Password": "Passw0rd!", "RoleId": "ReadOnly"}`, http.StatusServiceUnavailable},
+		{"Reads still served", "operator", "GET", "/redfish/v1/Systems", "", http.StatusOK},
+		{"Login still allowed", "", "POST", sessionServicePath + "/Sessions", `{"UserName": "admin", "Password": "Passw0rd!"}`, http.StatusCreated},
+		{"Disable", "admin", "POST", maintenanceActionPath, `{"Enabled": false}`, http.StatusNoContent},
+		{"Boot override accepted", "operator", "PATCH", "/redfish/v1/Systems/System.1", `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, "Passw0rd!")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestManagerReportsMaintenanceMode(t *testing.T) {
+	setMaintenanceMode(true)
+	defer setMaintenanceMode(false)
+
+	req := httptest.NewRequest("GET", "/redfish/v1/Managers/BMC", nil)
+	rr := httptest.NewRecorder()
+	handleManager(rr, req)
+
+	var manager struct {
+		Oem struct {
+			NanoKVM struct {
+				MaintenanceMode bool
+			}
+		}
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&manager); err != nil {
+		t.Fatal(err)
+	}
+	if !manager.Oem.NanoKVM.MaintenanceMode {
+		t.Error("Expected Oem.NanoKVM.MaintenanceMode to be true")
+	}
+}
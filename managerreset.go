@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	managerResetPath           = "/redfish/v1/Managers/BMC/Actions/Manager.Reset"
+	managerResetActionInfoPath = "/redfish/v1/Managers/BMC/ResetActionInfo"
+)
+
+// managerResetTypes are the Manager.Reset types the NanoKVM supports. A
+// GracefulRestart stops the service cleanly, letting host actions in
+// progress finish and saving its state, before rebooting; a ForceRestart
+// only lets the response go out first.
+var managerResetTypes = []string{"GracefulRestart", "ForceRestart"}
+
+// managerShutdownTimeout bounds how long a GracefulRestart waits for
+// requests in progress before rebooting regardless.
+const managerShutdownTimeout = 30 * time.Second
+
+// restartManager carries out a Manager.Reset once its response has been
+// written. main sets it to stop the server and reboot the device; until
+// then it does nothing.
+var restartManager = func(resetType string) {}
+
+// rebootDevice reboots the NanoKVM, flushing the filesystems first.
+var rebootDevice = func() error {
+	syscall.Sync()
+	return syscall.Reboot(syscall.LINUX_REBOOT_CMD_RESTART)
+}
+
+// managerResetting is set by the first Manager.Reset, so that a second one
+// sent before the server stops is refused rather than queued.
+var managerResetting atomic.Bool
+
+func managerResetAction() ResetAction {
+	return ResetAction{
+		Target:                          managerResetPath,
+		ResetTypeRedfishAllowableValues: managerResetTypes,
+		ActionInfo:                      managerResetActionInfoPath,
+		OperationApplyTimeSupport:       immediateApplyTime(),
+	}
+}
+
+func handleManagerResetActionInfo(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, managerResetActionInfoPath) {
+		return
+	}
+	handleActionInfo(w, r, newActionInfo(managerResetActionInfoPath, "ResetActionInfo", "Reset Action Info",
+		ActionInfoParameter{
+			Name:            "ResetType",
+			Required:        true,
+			DataType:        "String",
+			AllowableValues: managerResetTypes,
+		}))
+}
+
+// handleManagerReset reboots the NanoKVM itself, so a wedged device can be
+// recovered without SSH. The host is not touched.
+func handleManagerReset(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, managerResetPath) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var req ResetRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkActionParameters(w, body, "Manager.Reset", &req) {
+		return
+	}
+	if req.ResetType == "" {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterMissing", "Manager.Reset", "ResetType").withProperty("#/ResetType"))
+		return
+	}
+	if !containsString(managerResetTypes, req.ResetType) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", req.ResetType, "ResetType", "Manager.Reset").
+				withProperty("#/ResetType"))
+		return
+	}
+	if !checkOperationApplyTime(w, req.OperationApplyTime) {
+		return
+	}
+
+	if dryRunRequested(r, req.Oem) {
+		report := DryRunReport{
+			Action:       "Manager.Reset",
+			Parameters:   map[string]string{"ResetType": req.ResetType},
+			CurrentState: map[string]string{},
+		}
+		if req.ResetType == "GracefulRestart" {
+			report.WouldPerform = append(report.WouldPerform,
+				"Stop accepting requests",
+				"Wait for host actions in progress",
+				"Save state and stop the service")
+		}
+		report.WouldPerform = append(report.WouldPerform, "Reboot the NanoKVM")
+		writeDryRunReport(w, report)
+		return
+	}
+
+	if !managerResetting.CompareAndSwap(false, true) {
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return
+	}
+	log.Printf("Manager.Reset %s requested; rebooting the NanoKVM", req.ResetType)
+	emitEvent("Warning", fmt.Sprintf("NanoKVM rebooting (%s)", req.ResetType),
+		resourceEventPrefix+"ResourceChanged", "/redfish/v1/Managers/BMC")
+	w.WriteHeader(http.StatusNoContent)
+	restartManager(req.ResetType)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagerReset(t *testing.T) {
+	oldRestart := restartManager
+	defer func() {
+		restartManager = oldRestart
+		managerResetting.Store(false)
+	}()
+	var restarts []string
+	restartManager = func(resetType string) { restarts = append(restarts, resetType) }
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", managerResetPath, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handleManagerReset(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		expectCode int
+	}{
+		{"Missing ResetType", `{}`, http.StatusBadRequest},
+		{"Host reset type", `{"ResetType": "On"}`, http.StatusBadRequest},
+		{"Dry run", `{"ResetType": "GracefulRestart", "Oem": {"NanoKVM": {"DryRun": true}}}`, http.StatusOK},
+		{"GracefulRestart", `{"ResetType": "GracefulRestart"}`, http.StatusNoContent},
+		{"Already restarting", `{"ResetType": "ForceRestart"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rr := post(tt.body); rr.Code != tt.expectCode {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.expectCode, rr.Code, rr.Body.String())
+		}
+	}
+	if len(restarts) != 1 || restarts[0] != "GracefulRestart" {
+		t.Errorf("Expected one GracefulRestart, got %v", restarts)
+	}
+
+	rr := httptest.NewRecorder()
+	handleManager(rr, httptest.NewRequest("GET", "/redfish/v1/Managers/BMC", nil))
+	var manager struct {
+		Actions map[string]ResetAction
+	}
+	json.Unmarshal(rr.Body.Bytes(), &manager)
+	if action := manager.Actions["#Manager.Reset"]; action.Target != managerResetPath || action.ActionInfo != managerResetActionInfoPath {
+		t.Errorf("Expected the Manager.Reset action advertised, got %+v", action)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// massStorageLUN drives one LUN of the USB gadget's mass_storage function
+// through configfs. The NanoKVM composite gadget exports a single LUN, so
+// only one image can be presented to the host at a time.
+type massStorageLUN struct {
+	dir string
+}
+
+// lunState is what the host currently sees on the LUN. An empty File
+// means no medium.
+type lunState struct {
+	File     string
+	CDROM    bool
+	ReadOnly bool
+}
+
+func currentLUN() massStorageLUN {
+	return massStorageLUN{dir: currentConfig.VirtualMedia.LUNDir}
+}
+
+func (l massStorageLUN) lunError(op string, err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return &HardwareError{Kind: errNotSupported, Op: op, Err: err}
+	case errors.Is(err, syscall.EBUSY):
+		// The kernel refuses to change a medium the host has locked.
+		return &HardwareError{Kind: errBusy, Op: op, Err: err}
+	default:
+		return &HardwareError{Kind: errIOFailure, Op: op, Err: err}
+	}
+}
+
+func (l massStorageLUN) read(name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(l.dir, name))
+	if err != nil {
+		return "", l.lunError("read mass storage "+name, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (l massStorageLUN) write(name, value string) error {
+	if err := os.WriteFile(filepath.Join(l.dir, name), []byte(value+"\n"), 0o644); err != nil {
+		return l.lunError("write mass storage "+name, err)
+	}
+	return nil
+}
+
+func (l massStorageLUN) State() (lunState, error) {
+	var state lunState
+	var err error
+	if state.File, err = l.read("file"); err != nil {
+		return state, err
+	}
+	cdrom, err := l.read("cdrom")
+	if err != nil {
+		return state, err
+	}
+	ro, err := l.read("ro")
+	if err != nil {
+		return state, err
+	}
+	state.CDROM = cdrom == "1"
+	state.ReadOnly = ro == "1"
+	return state, nil
+}
+
+// Attach presents file to the host. The kernel only lets cdrom and ro
+// change while the LUN is empty, so they are written before the file.
+func (l massStorageLUN) Attach(file string, cdrom, readOnly bool) error {
+	unlock, err := lockGadget()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := l.State()
+	if err != nil {
+		return err
+	}
+	if state.File != "" {
+		return &HardwareError{Kind: errBusy, Op: "attach " + file}
+	}
+
+	if err := l.write("cdrom", boolFlag(cdrom)); err != nil {
+		return err
+	}
+	if err := l.write("ro", boolFlag(readOnly || cdrom)); err != nil {
+		return err
+	}
+	return l.write("file", file)
+}
+
+// Detach removes the medium. forced_eject ignores the host's prevent
+// removal lock; older kernels without it fall back to clearing file.
+func (l massStorageLUN) Detach() error {
+	unlock, err := lockGadget()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(filepath.Join(l.dir, "forced_eject")); err == nil {
+		return l.write("forced_eject", "1")
+	}
+	return l.write("file", "")
+}
+
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
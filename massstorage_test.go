@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupLUN points the VirtualMedia config at a fake configfs LUN directory
+// with no medium inserted, and at empty image and mount directories.
+func setupLUN(t *testing.T) massStorageLUN {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, value := range map[string]string{"file": "\n", "cdrom": "0\n", "ro": "0\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := currentConfig.VirtualMedia
+	currentConfig.VirtualMedia.LUNDir = dir
+	currentConfig.VirtualMedia.ImageDir = filepath.Join(t.TempDir(), "images")
+	currentConfig.VirtualMedia.MountDir = filepath.Join(t.TempDir(), "mnt")
+	currentConfig.VirtualMedia.GadgetLockFile = filepath.Join(t.TempDir(), "gadget.lock")
+	t.Cleanup(func() {
+		currentConfig.VirtualMedia = old
+		setInsertion(nil)
+	})
+	return massStorageLUN{dir: dir}
+}
+
+func TestMassStorageLUN(t *testing.T) {
+	lun := setupLUN(t)
+
+	if err := lun.Attach("/data/installer.iso", true, false); err != nil {
+		t.Fatal(err)
+	}
+	state, err := lun.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := lunState{File: "/data/installer.iso", CDROM: true, ReadOnly: true}
+	if state != expected {
+		t.Errorf("Expected %+v after attach, got %+v", expected, state)
+	}
+
+	if err := lun.Attach("/data/other.img", false, false); !errors.Is(err, errBusy) {
+		t.Errorf("Expected errBusy attaching over an inserted medium, got %v", err)
+	}
+
+	if err := lun.Detach(); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := lun.State(); state.File != "" {
+		t.Errorf("Expected no medium after detach, got %q", state.File)
+	}
+
+	if err := lun.Attach("/data/scratch.img", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := lun.State(); state.CDROM || state.ReadOnly {
+		t.Errorf("Expected a writable disk, got %+v", state)
+	}
+
+	missing := massStorageLUN{dir: filepath.Join(t.TempDir(), "missing")}
+	if _, err := missing.State(); !errors.Is(err, errNotSupported) {
+		t.Errorf("Expected errNotSupported without a LUN, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	metadataPath     = "/redfish/v1/$metadata"
+	odataServicePath = "/redfish/v1/odata"
+)
+
+// odataVersion is the OData protocol version of every response.
+const odataVersion = "4.0"
+
+type schemaNamespace struct {
+	Namespace string
+	// Version is empty for collections and unversioned namespaces.
+	Version string
+}
+
+// redfishSchemas lists the DMTF schema namespaces behind the @odata.type
+// of every resource, action and payload the service emits, with the
+// version in use, and the RedfishExtensions and Resource namespaces they
+// build on. It is the one place a version is set: odataType builds every
+// versioned @odata.type from it, and a version with an embedded schema
+// needs the file under schemas/ renamed to match. The OEM types are in
+// oemSchemaDocument.
+var redfishSchemas = []schemaNamespace{
+	{"AccountService", "v1_5_0"},
+	{"ActionInfo", "v1_1_2"},
+	{"Chassis", "v1_10_0"},
+	{"ChassisCollection", ""},
+	{"ComputerSystem", "v1_20_0"},
+	{"ComputerSystemCollection", ""},
+	{"EthernetInterface", "v1_12_0"},
+	{"EthernetInterfaceCollection", ""},
+	{"Event", "v1_7_0"},
+	{"EventDestination", "v1_8_0"},
+	{"EventDestinationCollection", ""},
+	{"EventService", "v1_5_0"},
+	{"Fan", "v1_0_0"},
+	{"FanCollection", ""},
+	{"HostInterface", "v1_3_0"},
+	{"HostInterfaceCollection", ""},
+	{"JsonSchemaFile", "v1_1_4"},
+	{"JsonSchemaFileCollection", ""},
+	{"LogEntry", "v1_11_0"},
+	{"LogEntryCollection", ""},
+	{"LogService", "v1_1_0"},
+	{"LogServiceCollection", ""},
+	{"Manager", "v1_15_0"},
+	{"ManagerAccount", "v1_7_0"},
+	{"ManagerAccountCollection", ""},
+	{"ManagerCollection", ""},
+	{"ManagerNetworkProtocol", "v1_9_0"},
+	{"Message", "v1_1_1"},
+	{"MessageRegistry", "v1_4_1"},
+	{"MessageRegistryFile", "v1_1_3"},
+	{"MessageRegistryFileCollection", ""},
+	{"PowerSubsystem", "v1_1_0"},
+	{"RedfishExtensions", "v1_0_0"},
+	{"Resource", ""},
+	{"Role", "v1_2_0"},
+	{"RoleCollection", ""},
+	{"Sensor", "v1_2_0"},
+	{"SensorCollection", ""},
+	{"ServiceRoot", "v1_5_0"},
+	{"Session", "v1_3_0"},
+	{"SessionCollection", ""},
+	{"SessionService", "v1_1_8"},
+	{"Settings", "v1_3_5"},
+	{"Task", "v1_4_3"},
+	{"TaskCollection", ""},
+	{"TaskService", "v1_1_4"},
+	{"ThermalSubsystem", "v1_0_0"},
+	{"VirtualMedia", "v1_3_0"},
+	{"VirtualMediaCollection", ""},
+	{"VLanNetworkInterface", "v1_3_0"},
+	{"VLanNetworkInterfaceCollection", ""},
+}
+
+// odataType returns the @odata.type of the type named after namespace at
+// the version redfishSchemas lists, such as "#Manager.v1_15_0.Manager".
+func odataType(namespace string) string {
+	return odataTypeOf(namespace, namespace)
+}
+
+// odataTypeOf returns the @odata.type of the type called name in
+// namespace, for the few types not named after their namespace.
+func odataTypeOf(namespace, name string) string {
+	for _, s := range redfishSchemas {
+		if s.Namespace == namespace {
+			if s.Version == "" {
+				return "#" + namespace + "." + name
+			}
+			return "#" + namespace + "." + s.Version + "." + name
+		}
+	}
+	panic("no schema version for " + namespace)
+}
+
+// odataContext returns the @odata.context of a resource with the given
+// @odata.type: $metadata with the type's unversioned name as the fragment,
+// such as "/redfish/v1/$metadata#Manager.Manager".
+func odataContext(odataType string) string {
+	parts := strings.Split(strings.TrimPrefix(odataType, "#"), ".")
+	if len(parts) < 2 {
+		return ""
+	}
+	return metadataPath + "#" + parts[0] + "." + parts[len(parts)-1]
+}
+
+// metadataDocument builds the OData CSDL $metadata document: a reference
+// to the DMTF CSDL file of each namespace in redfishSchemas and to the
+// service's own for the OEM namespaces, and the Service entity container
+// that the service root instantiates.
+func metadataDocument() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<edmx:Edmx xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx" Version="4.0">` + "\n")
+	for _, s := range redfishSchemas {
+		fmt.Fprintf(&b, "  <edmx:Reference Uri=\"http://redfish.dmtf.org/schemas/v1/%s_v1.xml\">\n", s.Namespace)
+		fmt.Fprintf(&b, "    <edmx:Include Namespace=\"%s\"/>\n", s.Namespace)
+		if s.Version != "" {
+			fmt.Fprintf(&b, "    <edmx:Include Namespace=\"%s.%s\"/>\n", s.Namespace, s.Version)
+		}
+		b.WriteString("  </edmx:Reference>\n")
+	}
+	fmt.Fprintf(&b, "  <edmx:Reference Uri=\"%s\">\n", oemSchemaPath)
+	for _, namespace := range oemSchemaNamespaces {
+		fmt.Fprintf(&b, "    <edmx:Include Namespace=\"%s\"/>\n", namespace)
+	}
+	b.WriteString("  </edmx:Reference>\n")
+	b.WriteString("  <edmx:DataServices>\n")
+	b.WriteString("    <Schema xmlns=\"http://docs.oasis-open.org/odata/ns/edm\" Namespace=\"Service\">\n")
+	fmt.Fprintf(&b, "      <EntityContainer Name=\"Service\" Extends=\"%s\"/>\n", strings.TrimPrefix(odataType("ServiceRoot"), "#"))
+	b.WriteString("    </Schema>\n")
+	b.WriteString("  </edmx:DataServices>\n")
+	b.WriteString("</edmx:Edmx>\n")
+	return b.String()
+}
+
+func handleMetadata(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, metadataPath) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(metadataDocument()))
+}
+
+// handleODataService serves the OData service document, which lists the
+// service root and the resources it links directly.
+func handleODataService(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, odataServicePath) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	value := []map[string]string{
+		{"name": "Service", "kind": "Singleton", "url": "/redfish/v1/"},
+	}
+	for _, top := range []struct{ name, url string }{
+		{"Systems", "/redfish/v1/Systems"},
+		{"Chassis", "/redfish/v1/Chassis"},
+		{"Managers", "/redfish/v1/Managers"},
+		{"AccountService", accountServicePath},
+		{"EventService", eventServicePath},
+		{"SessionService", sessionServicePath},
+		{"Sessions", sessionServicePath + "/Sessions"},
+		{"Tasks", taskServicePath},
+		{"JsonSchemas", jsonSchemasPath},
+		{"Registries", registriesPath},
+	} {
+		value = append(value, map[string]string{"name": top.name, "kind": "Singleton", "url": top.url})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"@odata.context": metadataPath,
+		"value":          value,
+	})
+}
+
+// withODataVersion sets OData-Version on every response and refuses a
+// request that asks for another version of the protocol, so a client
+// never reads a payload it cannot interpret.
+func withODataVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("OData-Version", odataVersion)
+		if version := strings.TrimSpace(r.Header.Get("OData-Version")); version != "" && version != odataVersion {
+			writeRedfishError(w, http.StatusPreconditionFailed,
+				newMessage("PreconditionFailed"),
+				newOemMessage("ODataVersionNotSupported", version, odataVersion))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetadataDocument(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleMetadata(rr, httptest.NewRequest("GET", metadataPath, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("Expected 200 with XML, got %d with %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var doc struct {
+		References []struct {
+			URI      string `xml:"Uri,attr"`
+			Includes []struct {
+				Namespace string `xml:"Namespace,attr"`
+			} `xml:"Include"`
+		} `xml:"Reference"`
+		Container struct {
+			Name    string `xml:"Name,attr"`
+			Extends string `xml:"Extends,attr"`
+		} `xml:"DataServices>Schema>EntityContainer"`
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Container.Name != "Service" || doc.Container.Extends != "ServiceRoot.v1_5_0.ServiceRoot" {
+		t.Errorf("Expected the Service container to extend ServiceRoot, got %+v", doc.Container)
+	}
+
+	included := map[string]bool{}
+	for _, ref := range doc.References {
+		if !strings.HasPrefix(ref.URI, "http://redfish.dmtf.org/schemas/v1/") && ref.URI != oemSchemaPath {
+			t.Errorf("Unexpected reference %s", ref.URI)
+		}
+		for _, include := range ref.Includes {
+			included[include.Namespace] = true
+		}
+	}
+	// Every resource version with an embedded schema is one the service
+	// emits, so $metadata must reference it.
+	files, err := schemaFS.ReadDir("schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if namespace := strings.TrimSuffix(file.Name(), ".json"); !included[namespace] {
+			t.Errorf("Expected $metadata to include %s", namespace)
+		}
+	}
+}
+
+func TestODataType(t *testing.T) {
+	for _, tt := range []struct {
+		got, expect string
+	}{
+		{odataType("ComputerSystem"), "#ComputerSystem.v1_20_0.ComputerSystem"},
+		{odataType("Manager"), "#Manager.v1_15_0.Manager"},
+		{odataType("ManagerCollection"), "#ManagerCollection.ManagerCollection"},
+		{odataTypeOf("Settings", "OperationApplyTimeSupport"), "#Settings.v1_3_5.OperationApplyTimeSupport"},
+	} {
+		if tt.got != tt.expect {
+			t.Errorf("Expected %s, got %s", tt.expect, tt.got)
+		}
+	}
+}
+
+func TestOemSchemaDocument(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleOemSchema(rr, httptest.NewRequest("GET", oemSchemaPath, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("Expected 200 with XML, got %d with %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var doc struct {
+		Schemas []struct {
+			Namespace   string `xml:"Namespace,attr"`
+			EntityTypes []struct {
+				Name string `xml:"Name,attr"`
+			} `xml:"EntityType"`
+			Actions []struct {
+				Name string `xml:"Name,attr"`
+			} `xml:"Action"`
+		} `xml:"DataServices>Schema"`
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	declared := map[string]bool{}
+	var namespaces []string
+	for _, schema := range doc.Schemas {
+		namespaces = append(namespaces, schema.Namespace)
+		for _, entity := range schema.EntityTypes {
+			declared[schema.Namespace+"."+entity.Name] = true
+		}
+		for _, action := range schema.Actions {
+			declared[schema.Namespace+"."+action.Name] = true
+		}
+	}
+	if strings.Join(namespaces, " ") != strings.Join(oemSchemaNamespaces, " ") {
+		t.Errorf("Expected namespaces %v, got %v", oemSchemaNamespaces, namespaces)
+	}
+	// Every OEM type and action the service emits is declared.
+	for _, name := range []string{
+		"NanoKVMGPIO.v1_0_0.NanoKVMGPIO", "NanoKVMGPIOCollection.NanoKVMGPIOCollection",
+		"NanoKVM.SetMaintenanceMode", "NanoKVM.SetValue", "NanoKVM.Pulse",
+	} {
+		if !declared[name] {
+			t.Errorf("Expected %s declared", name)
+		}
+	}
+}
+
+func TestODataServiceDocument(t *testing.T) {
+	setupAccountStore(t)
+	setupEventService(t)
+	setupSessionStore(t)
+	setupTaskStore(t)
+	handler := newHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", odataServicePath, nil))
+	var doc struct {
+		Context string `json:"@odata.context"`
+		Value   []struct {
+			Name string `json:"name"`
+			Kind string `json:"kind"`
+			URL  string `json:"url"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Context != metadataPath || len(doc.Value) == 0 || doc.Value[0].Name != "Service" {
+		t.Fatalf("Expected the service document to start with the service root, got %+v", doc)
+	}
+	for _, entry := range doc.Value {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", entry.URL, nil))
+		if rr.Code != http.StatusOK || entry.Kind != "Singleton" {
+			t.Errorf("Expected %s to be a servable singleton, got %d for %s", entry.Name, rr.Code, entry.URL)
+		}
+	}
+}
+
+func TestODataDocumentsArePublic(t *testing.T) {
+	oldConfig := currentConfig
+	defer func() { currentConfig = oldConfig }()
+	setupAccountStore(t)
+	currentConfig.RequireAuth = true
+
+	handler := newHandler()
+	for _, path := range []string{"/redfish", metadataPath, odataServicePath, oemSchemaPath} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected %s without credentials, got %d", path, rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/redfish/v1/Systems", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the systems to still need credentials, got %d", rr.Code)
+	}
+}
+
+func TestODataVersion(t *testing.T) {
+	handler := newHandler()
+
+	for _, tt := range []struct {
+		version    string
+		expectCode int
+	}{
+		{"", http.StatusOK},
+		{"4.0", http.StatusOK},
+		{"5.0", http.StatusPreconditionFailed},
+	} {
+		req := httptest.NewRequest("GET", "/redfish/v1/", nil)
+		if tt.version != "" {
+			req.Header.Set("OData-Version", tt.version)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.expectCode {
+			t.Errorf("OData-Version %q: expected %d, got %d", tt.version, tt.expectCode, rr.Code)
+		}
+		if v := rr.Header().Get("OData-Version"); v != odataVersion {
+			t.Errorf("OData-Version %q: expected response OData-Version %s, got %q", tt.version, odataVersion, v)
+		}
+	}
+}
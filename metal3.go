@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// metal3Compatible reports whether the "metal3" compatibility profile is
+// configured. Bare Metal Operator drives Ironic, whose redfish-virtual-media
+// driver
+//   - PATCHes Boot with the If-Match it read before its previous PATCH,
+//   - inserts virtual media without Prefer: respond-async, and gives up on
+//     a request held open past its read timeout,
+//   - powers the host on as soon as InsertMedia has returned.
+//
+// The profile accepts the stale etag on Boot, runs Upload inserts as tasks
+// regardless, and holds a power-on reset until the insert has finished.
+func metal3Compatible() bool {
+	return currentConfig.Compatibility == "metal3"
+}
+
+// mediaInsertWait bounds how long a power-on reset waits for an
+// asynchronous InsertMedia in the metal3 profile.
+var mediaInsertWait = 60 * time.Second
+
+var (
+	pendingInsertMu sync.Mutex
+	pendingInsert   chan struct{}
+)
+
+// startPendingInsert records an InsertMedia running in the background. The
+// returned function marks it finished.
+func startPendingInsert() func() {
+	done := make(chan struct{})
+	pendingInsertMu.Lock()
+	pendingInsert = done
+	pendingInsertMu.Unlock()
+	return func() {
+		pendingInsertMu.Lock()
+		defer pendingInsertMu.Unlock()
+		close(done)
+		if pendingInsert == done {
+			pendingInsert = nil
+		}
+	}
+}
+
+// waitForPendingInsert blocks until any background InsertMedia finishes,
+// reporting false if it is still running after mediaInsertWait.
+func waitForPendingInsert() bool {
+	pendingInsertMu.Lock()
+	done := pendingInsert
+	pendingInsertMu.Unlock()
+	if done == nil {
+		return true
+	}
+	timer := time.NewTimer(mediaInsertWait)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetal3InsertMediaThenReset(t *testing.T) {
+	lun := setupLUN(t)
+	setupTaskStore(t)
+	host := startFakeHost(t, false)
+	oldConfig, oldWait := currentConfig, mediaInsertWait
+	defer func() { currentConfig, mediaInsertWait = oldConfig, oldWait }()
+	currentConfig.Compatibility = "metal3"
+
+	release, stuck := make(chan struct{}), make(chan struct{})
+	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stuck.iso" {
+			<-stuck
+		}
+		<-release
+		w.Write([]byte("ISO image contents"))
+	}))
+	defer imageServer.Close()
+
+	insert := func(t *testing.T, name string) {
+		t.Helper()
+		// No Prefer header: Ironic does not send one.
+		body := `{"Image": "` + imageServer.URL + `/` + name + `"}`
+		req := httptest.NewRequest("POST", virtualMediaPath+"/CD1/Actions/VirtualMedia.InsertMedia", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleVirtualMedia(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+		}
+	}
+
+	t.Run("Reset waits for the insert", func(t *testing.T) {
+		insert(t, "installer.iso")
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+		if rr := postReset(t, "On"); rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		if state, _ := lun.State(); !strings.HasSuffix(state.File, "-installer.iso") {
+			t.Errorf("Expected the image attached before the power-on, got %q", state.File)
+		}
+		waitFor(t, "power on", func() bool { return host.pressCount() == 1 })
+	})
+
+	t.Run("Insert still running", func(t *testing.T) {
+		if rr := postReset(t, "ForceOff"); rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		waitFor(t, "power off", func() bool { return host.pressCount() == 2 })
+
+		req := httptest.NewRequest("POST", virtualMediaPath+"/CD1/Actions/VirtualMedia.EjectMedia", strings.NewReader("{}"))
+		rr := httptest.NewRecorder()
+		handleVirtualMedia(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected eject status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		mediaInsertWait = 50 * time.Millisecond
+		insert(t, "stuck.iso")
+		if rr := postReset(t, "On"); rr.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+		}
+		if host.pressCount() != 2 {
+			t.Errorf("Expected no power-on while the insert runs, got %d presses", host.pressCount())
+		}
+
+		close(stuck)
+		mediaInsertWait = oldWait
+		if !waitForPendingInsert() {
+			t.Error("Expected the insert to finish")
+		}
+	})
+}
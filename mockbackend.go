@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// MockBackend is an in-memory host for tests and development without a
+// NanoKVM: releasing the power button switches it on or off, and the
+// reset button leaves it as it is.
+type MockBackend struct {
+	mu           sync.Mutex
+	on           bool
+	powerPresses int
+	resetPresses int
+	nmis         int
+	err          error
+}
+
+func newMockBackend(on bool) *MockBackend {
+	return &MockBackend{on: on}
+}
+
+// SetPowered switches the host on or off as if from its own power switch.
+func (m *MockBackend) SetPowered(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.on = on
+}
+
+// Fail makes every call return err, or succeed again if err is nil.
+func (m *MockBackend) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Presses reports how often each button has been pressed.
+func (m *MockBackend) Presses() (power, reset int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.powerPresses, m.resetPresses
+}
+
+// NMIs reports how many NMIs have been sent.
+func (m *MockBackend) NMIs() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.nmis
+}
+
+func (m *MockBackend) GetPowerState() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return "", m.err
+	}
+	if m.on {
+		return "On", nil
+	}
+	return "Off", nil
+}
+
+func (m *MockBackend) PressPower(duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.powerPresses++
+	m.on = !m.on
+	return nil
+}
+
+func (m *MockBackend) PressReset(duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.resetPresses++
+	return nil
+}
+
+func (m *MockBackend) SupportsNMI() bool {
+	return true
+}
+
+func (m *MockBackend) PressNMI(duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.nmis++
+	return nil
+}
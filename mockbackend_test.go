@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupMockBackend replaces the GPIOs with an in-memory host.
+func setupMockBackend(t *testing.T, on bool) *MockBackend {
+	t.Helper()
+	mock := newMockBackend(on)
+	oldBackend, oldBoot := hardwareBackend, currentBootConfig
+	hardwareBackend = mock
+	primarySystem.setPowerTransition("")
+	t.Cleanup(func() {
+		hardwareBackend, currentBootConfig = oldBackend, oldBoot
+		primarySystem.setPowerTransition("")
+	})
+	currentBootConfig.BootSourceOverrideEnabled = "Disabled"
+	return mock
+}
+
+func TestResetWithMockBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		on          bool
+		resetType   string
+		fail        error
+		expectCode  int
+		expectState string
+		expectPower int
+		expectReset int
+	}{
+		{"On", false, "On", nil, http.StatusNoContent, "On", 1, 0},
+		{"On when on", true, "On", nil, http.StatusNoContent, "On", 0, 0},
+		{"ForceOn", false, "ForceOn", nil, http.StatusNoContent, "On", 1, 0},
+		{"ForceOn when on", true, "ForceOn", nil, http.StatusConflict, "On", 0, 0},
+		{"PushPowerButton when off", false, "PushPowerButton", nil, http.StatusNoContent, "On", 1, 0},
+		{"PushPowerButton when on", true, "PushPowerButton", nil, http.StatusNoContent, "Off", 1, 0},
+		{"ForceOff", true, "ForceOff", nil, http.StatusNoContent, "Off", 1, 0},
+		{"ForceRestart", true, "ForceRestart", nil, http.StatusNoContent, "On", 0, 1},
+		{"Nmi", true, "Nmi", nil, http.StatusNoContent, "On", 0, 0},
+		{"Busy", true, "ForceRestart", &HardwareError{Kind: errBusy, Op: "test"}, http.StatusConflict, "", 0, 0},
+		{"Broken", true, "ForceRestart", &HardwareError{Kind: errIOFailure, Op: "test"}, http.StatusInternalServerError, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupMockBackend(t, tt.on)
+			mock.Fail(tt.fail)
+
+			rr := postReset(t, tt.resetType)
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			if power, reset := mock.Presses(); power != tt.expectPower || reset != tt.expectReset {
+				t.Errorf("Expected %d power and %d reset presses, got %d and %d",
+					tt.expectPower, tt.expectReset, power, reset)
+			}
+			if tt.fail != nil {
+				return
+			}
+			if state, _ := getPowerState(); state != tt.expectState {
+				t.Errorf("Expected %s, got %s", tt.expectState, state)
+			}
+		})
+	}
+}
+
+// hungOSBackend is a host whose OS ignores a short press of the power
+// button; only holding it switches the host off.
+type hungOSBackend struct {
+	*MockBackend
+}
+
+func (b hungOSBackend) PressPower(duration time.Duration) error {
+	if duration < time.Second {
+		return nil
+	}
+	return b.MockBackend.PressPower(duration)
+}
+
+func TestGracefulShutdownEscalation(t *testing.T) {
+	mock := setupMockBackend(t, true)
+	hardwareBackend = hungOSBackend{mock}
+	setupTaskStore(t)
+	oldConfig := currentConfig
+	currentConfig.GracefulShutdownTimeout = 1
+	defer func() { currentConfig = oldConfig }()
+
+	rr := postReset(t, "GracefulShutdown")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var res TaskResource
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	task, _ := taskStore.Get(res.ID)
+	waitFor(t, "shutdown task", func() bool { return task.resource().TaskState == "Completed" })
+
+	if state, _ := getPowerState(); state != "Off" {
+		t.Errorf("Expected the host forced Off, got %s", state)
+	}
+	escalated := false
+	for _, entry := range eventLog.Entries() {
+		if strings.Contains(entry.Message, "host forced off") {
+			escalated = true
+		}
+	}
+	if !escalated {
+		t.Error("Expected the escalation in the event log")
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipv4Settings is how an interface gets its IPv4 addresses: from DHCP, or
+// the static addresses listed.
+type ipv4Settings struct {
+	DHCPEnabled     bool          `json:"DHCPEnabled"`
+	StaticAddresses []IPv4Address `json:"StaticAddresses"`
+}
+
+// IPv4Address is an entry of IPv4StaticAddresses.
+type IPv4Address struct {
+	Address    string `json:"Address"`
+	SubnetMask string `json:"SubnetMask"`
+	Gateway    string `json:"Gateway,omitempty"`
+}
+
+// pendingNetworkChange is a change to an interface's addressing that is
+// undone at Deadline unless it is confirmed first. It is saved to
+// NetworkConfig.StateFile until then, so that a restart in between undoes
+// it too.
+type pendingNetworkChange struct {
+	Interface string       `json:"Interface"`
+	Previous  ipv4Settings `json:"Previous"`
+	Deadline  time.Time    `json:"Deadline"`
+
+	// applied is set once networking has been restarted with the change;
+	// only a request that arrives after that can confirm it.
+	applied bool
+	timer   *time.Timer
+}
+
+var (
+	networkMu      sync.Mutex
+	networkPending *pendingNetworkChange
+)
+
+// networkApplyDelay lets the response to a PATCH go out before networking
+// is restarted under it.
+const networkApplyDelay = time.Second
+
+// scheduleNetworkApply runs apply once the PATCH has been answered.
+var scheduleNetworkApply = func(apply func()) {
+	time.AfterFunc(networkApplyDelay, apply)
+}
+
+// isConfigurableInterface reports whether the addressing of an interface
+// can be changed, which needs a file for its static addresses or a VLAN
+// the service set up.
+func isConfigurableInterface(name string) bool {
+	_, ok := currentConfig.Network.StaticFiles[name]
+	if !ok {
+		_, ok = lookupVLAN(name)
+	}
+	return ok
+}
+
+// ipv4CIDR writes a static address in address/prefix form.
+func ipv4CIDR(address IPv4Address) string {
+	ones, _ := net.IPMask(net.ParseIP(address.SubnetMask).To4()).Size()
+	return fmt.Sprintf("%s/%d", address.Address, ones)
+}
+
+// readIPv4Settings reads an interface's addressing from its static file,
+// one "address/prefix [gateway]" per line. Without the file the interface
+// uses DHCP.
+func readIPv4Settings(name string) (ipv4Settings, error) {
+	if v, ok := lookupVLAN(name); ok {
+		return v.IPv4, nil
+	}
+	path := currentConfig.Network.StaticFiles[name]
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ipv4Settings{DHCPEnabled: true, StaticAddresses: []IPv4Address{}}, nil
+	}
+	if err != nil {
+		return ipv4Settings{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	settings := ipv4Settings{StaticAddresses: []IPv4Address{}}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		ip, network, err := net.ParseCIDR(fields[0])
+		if err != nil || ip.To4() == nil {
+			return ipv4Settings{}, fmt.Errorf("%s: %q is not an IPv4 address/prefix", path, fields[0])
+		}
+		address := IPv4Address{Address: ip.String(), SubnetMask: net.IP(network.Mask).String()}
+		if len(fields) > 1 {
+			address.Gateway = fields[1]
+		}
+		settings.StaticAddresses = append(settings.StaticAddresses, address)
+	}
+	return settings, scanner.Err()
+}
+
+// writeIPv4Settings writes an interface's addressing to its static file,
+// removing the file to use DHCP.
+func writeIPv4Settings(name string, settings ipv4Settings) error {
+	if _, ok := lookupVLAN(name); ok {
+		return setVLANAddresses(name, settings)
+	}
+	path := currentConfig.Network.StaticFiles[name]
+	if settings.DHCPEnabled {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	var b bytes.Buffer
+	for _, address := range settings.StaticAddresses {
+		line := ipv4CIDR(address)
+		if address.Gateway != "" {
+			line += " " + address.Gateway
+		}
+		b.WriteString(line + "\n")
+	}
+	return writeFileAtomic(path, b.Bytes(), 0o644)
+}
+
+// applyIPv4Settings puts the addressing saved for an interface into
+// effect.
+func applyIPv4Settings(name string) error {
+	if v, ok := lookupVLAN(name); ok {
+		return configureVLAN(v)
+	}
+	return restartNetworking()
+}
+
+// restartNetworking applies the static files by restarting the device's
+// networking. Without an init script there is nothing to run.
+func restartNetworking() error {
+	script := currentConfig.Network.InitScript
+	if script == "" {
+		return nil
+	}
+	if output, err := runCommand(nil, script, "restart"); err != nil {
+		return fmt.Errorf("%s restart failed: %w: %s", script, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func saveNetworkState() error {
+	path := currentConfig.Network.StateFile
+	if path == "" {
+		return nil
+	}
+	if networkPending == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	content, err := json.MarshalIndent(networkPending, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content, 0o600)
+}
+
+// loadNetworkState undoes a network change the service stopped before
+// confirming, since whoever made it may have lost access to the device.
+func loadNetworkState(cfg NetworkConfig) error {
+	if cfg.StateFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", cfg.StateFile, err)
+	}
+	var pending pendingNetworkChange
+	if err := json.Unmarshal(content, &pending); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", cfg.StateFile, err)
+	}
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	networkPending = &pending
+	revertNetworkChange("the service restarted before it was confirmed")
+	return nil
+}
+
+// revertNetworkChange puts back the addressing a pending change replaced.
+// If that cannot be written, the change is given up on all the same, so
+// that the interface can be changed again, but the saved state is left for
+// the next start to try again. It is called with networkMu held.
+func revertNetworkChange(reason string) {
+	pending := networkPending
+	log.Printf("Reverting the network change to %s: %s", pending.Interface, reason)
+	if err := writeIPv4Settings(pending.Interface, pending.Previous); err != nil {
+		log.Printf("Failed to revert the network change to %s: %v", pending.Interface, err)
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+		networkPending = nil
+		emitEvent("Critical", fmt.Sprintf("Network change to %s could not be reverted: %v", pending.Interface, err),
+			resourceEventPrefix+"ResourceChanged", ethernetInterfacesPath+"/"+pending.Interface)
+		return
+	}
+	if err := applyIPv4Settings(pending.Interface); err != nil {
+		log.Printf("Failed to revert the network change to %s: %v", pending.Interface, err)
+	}
+	networkPending = nil
+	if err := saveNetworkState(); err != nil {
+		log.Printf("Failed to save network settings: %v", err)
+	}
+	emitEvent("Warning", fmt.Sprintf("Network change to %s reverted: %s", pending.Interface, reason),
+		resourceEventPrefix+"ResourceChanged", ethernetInterfacesPath+"/"+pending.Interface)
+}
+
+// changeIPv4Settings applies next to an interface, keeping what it had to
+// go back to unless the change is confirmed within the confirm timeout.
+// It is called with networkMu held.
+func changeIPv4Settings(name string, previous, next ipv4Settings) error {
+	timeout := time.Duration(currentConfig.Network.ConfirmTimeout) * time.Second
+	pending := &pendingNetworkChange{Interface: name, Previous: previous, Deadline: time.Now().Add(timeout)}
+	networkPending = pending
+	if err := saveNetworkState(); err != nil {
+		networkPending = nil
+		return err
+	}
+	if err := writeIPv4Settings(name, next); err != nil {
+		networkPending = nil
+		saveNetworkState()
+		return err
+	}
+
+	scheduleNetworkApply(func() {
+		networkMu.Lock()
+		defer networkMu.Unlock()
+		if networkPending != pending {
+			return
+		}
+		if err := applyIPv4Settings(name); err != nil {
+			revertNetworkChange(err.Error())
+			return
+		}
+		pending.applied = true
+		pending.timer = time.AfterFunc(time.Until(pending.Deadline), func() {
+			networkMu.Lock()
+			defer networkMu.Unlock()
+			if networkPending == pending {
+				revertNetworkChange(fmt.Sprintf("not confirmed within %d s", currentConfig.Network.ConfirmTimeout))
+			}
+		})
+	})
+	return nil
+}
+
+// confirmNetworkChange keeps a pending change to an interface once r has
+// reached the service at one of the addresses the interface has since the
+// change, which shows the new addressing works.
+func confirmNetworkChange(r *http.Request, name string) {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	pending := networkPending
+	if pending == nil || pending.Interface != name || !pending.applied {
+		return
+	}
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	addresses, err := readInterfaceAddresses()
+	if err != nil {
+		return
+	}
+	index, _ := strconv.Atoi(readNetAttr(name, "ifindex"))
+	for _, addr := range addresses[index] {
+		if addr.IP.Equal(local.IP) {
+			pending.timer.Stop()
+			networkPending = nil
+			if err := saveNetworkState(); err != nil {
+				log.Printf("Failed to save network settings: %v", err)
+			}
+			log.Printf("Network change to %s confirmed through %s", name, local.IP)
+			emitEvent("OK", fmt.Sprintf("Network change to %s confirmed", name),
+				resourceEventPrefix+"ResourceChanged", ethernetInterfacesPath+"/"+name)
+			return
+		}
+	}
+}
+
+// addIPv4Settings adds the writable addressing of a configurable interface
+// to its resource, and when a change to it will be undone.
+func addIPv4Settings(resource map[string]interface{}, name string, settings ipv4Settings) {
+	resource["DHCPv4"] = map[string]interface{}{"DHCPEnabled": settings.DHCPEnabled}
+	resource["IPv4StaticAddresses"] = settings.StaticAddresses
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	if networkPending != nil && networkPending.Interface == name {
+		nanoKVMOem(resource)["RevertTime"] = networkPending.Deadline.In(displayLocation).Format(time.RFC3339)
+	}
+}
+
+type EthernetInterfacePatchRequest struct {
+	DHCPv4 *struct {
+		DHCPEnabled *bool `json:"DHCPEnabled,omitempty"`
+	} `json:"DHCPv4,omitempty"`
+	IPv4StaticAddresses []IPv4Address `json:"IPv4StaticAddresses,omitempty"`
+	StaticNameServers   []string      `json:"StaticNameServers,omitempty"`
+	Oem                 *struct {
+		NanoKVM *struct {
+			SearchDomains []string `json:"SearchDomains,omitempty"`
+		} `json:"NanoKVM,omitempty"`
+	} `json:"Oem,omitempty"`
+}
+
+// checkIPv4Address writes an error and returns false if the i-th static
+// address is not a usable IPv4 address, mask and gateway.
+func checkIPv4Address(w http.ResponseWriter, i int, address IPv4Address) bool {
+	pointer := fmt.Sprintf("#/IPv4StaticAddresses/%d/", i)
+	ip := net.ParseIP(address.Address).To4()
+	if ip == nil || ip.IsUnspecified() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueFormatError", address.Address, "Address").withProperty(pointer+"Address"))
+		return false
+	}
+	mask := net.ParseIP(address.SubnetMask).To4()
+	if ones, bits := net.IPMask(mask).Size(); mask == nil || bits == 0 || ones == 0 {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueFormatError", address.SubnetMask, "SubnetMask").withProperty(pointer+"SubnetMask"))
+		return false
+	}
+	if address.Gateway == "" {
+		return true
+	}
+	gateway := net.ParseIP(address.Gateway).To4()
+	if gateway == nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueFormatError", address.Gateway, "Gateway").withProperty(pointer+"Gateway"))
+		return false
+	}
+	if !ip.Mask(net.IPMask(mask)).Equal(gateway.Mask(net.IPMask(mask))) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueConflict", "Gateway", "SubnetMask").withProperty(pointer+"Gateway"))
+		return false
+	}
+	return true
+}
+
+// handleEthernetInterfacePatch switches an interface between DHCP and
+// static addresses. The change is applied just after the response goes
+// out, and undone after the confirm timeout unless a GET of the interface
+// reaches the service through its new addressing first, so a mistake
+// cannot lock everyone out of the device. Name servers and search domains
+// take effect at once.
+func handleEthernetInterfacePatch(w http.ResponseWriter, r *http.Request, name string) {
+	var req EthernetInterfacePatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	get := func(w http.ResponseWriter, r *http.Request) { handleEthernetInterfaceGet(w, r, name) }
+	if !checkPreconditions(w, r, contentETag(fetchResource(r, get).body.Bytes()), false) {
+		return
+	}
+	ignored, ok := checkPatchProperties(w, r, body, &req, get)
+	if !ok {
+		return
+	}
+	// The name servers are checked first and changed last, so that a
+	// PATCH refused for its addressing changes nothing.
+	dns, ok := checkDNSPatch(w, req)
+	if !ok {
+		return
+	}
+	if (req.DHCPv4 != nil || req.IPv4StaticAddresses != nil) && !patchIPv4Settings(w, name, req) {
+		return
+	}
+	if dns != nil && !changeDNS(w, name, *dns) {
+		return
+	}
+
+	writePatchResult(w, r, ignored, get)
+}
+
+// patchIPv4Settings makes the change req asks of an interface's
+// addressing, if any. It writes an error and returns false if it cannot.
+func patchIPv4Settings(w http.ResponseWriter, name string, req EthernetInterfacePatchRequest) bool {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	if networkPending != nil {
+		// Whatever is pending has to be confirmed or undone first, or
+		// undoing it would lose this change.
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return false
+	}
+	current, err := readIPv4Settings(name)
+	if err != nil {
+		writeInternalError(w, "read network settings", err)
+		return false
+	}
+	next := current
+	if req.DHCPv4 != nil && req.DHCPv4.DHCPEnabled != nil {
+		next.DHCPEnabled = *req.DHCPv4.DHCPEnabled
+	}
+	if _, ok := lookupVLAN(name); ok && next.DHCPEnabled {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueIncorrect", "DHCPEnabled", "true").withProperty("#/DHCPv4/DHCPEnabled"))
+		return false
+	}
+	if req.IPv4StaticAddresses != nil {
+		if next.DHCPEnabled {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("PropertyValueConflict", "IPv4StaticAddresses", "DHCPv4/DHCPEnabled").
+					withProperty("#/IPv4StaticAddresses"))
+			return false
+		}
+		for i, address := range req.IPv4StaticAddresses {
+			if !checkIPv4Address(w, i, address) {
+				return false
+			}
+		}
+		next.StaticAddresses = req.IPv4StaticAddresses
+	}
+	if next.DHCPEnabled {
+		next.StaticAddresses = []IPv4Address{}
+	} else if len(next.StaticAddresses) == 0 {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyMissing", "IPv4StaticAddresses").withProperty("#/IPv4StaticAddresses"))
+		return false
+	}
+
+	if !ipv4SettingsEqual(current, next) {
+		if err := changeIPv4Settings(name, current, next); err != nil {
+			writeInternalError(w, "change network settings", err)
+			return false
+		}
+		mode := "DHCP"
+		if !next.DHCPEnabled {
+			var addresses []string
+			for _, address := range next.StaticAddresses {
+				addresses = append(addresses, address.Address)
+			}
+			mode = "static " + strings.Join(addresses, ", ")
+		}
+		log.Printf("Changing %s to %s; reverting in %d s unless confirmed", name, mode, currentConfig.Network.ConfirmTimeout)
+		emitEvent("Warning", fmt.Sprintf("%s changed to %s; reverting in %d s unless confirmed",
+			name, mode, currentConfig.Network.ConfirmTimeout),
+			resourceEventPrefix+"ResourceChanged", ethernetInterfacesPath+"/"+name)
+	}
+	return true
+}
+
+func ipv4SettingsEqual(a, b ipv4Settings) bool {
+	if a.DHCPEnabled != b.DHCPEnabled || len(a.StaticAddresses) != len(b.StaticAddresses) {
+		return false
+	}
+	for i := range a.StaticAddresses {
+		if a.StaticAddresses[i] != b.StaticAddresses[i] {
+			return false
+		}
+	}
+	return true
+}
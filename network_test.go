@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEthernetInterfaceStaticAddresses(t *testing.T) {
+	fakeNetSysfs(t, map[string]map[string]string{
+		"eth0": {"type": "1", "ifindex": "2", "flags": "0x1003", "carrier": "1"},
+		"usb0": {"type": "1", "ifindex": "3", "flags": "0x1003"},
+	})
+	dir := t.TempDir()
+	staticFile := filepath.Join(dir, "eth.nodhcp")
+	currentConfig.Network = NetworkConfig{
+		StaticFiles:    map[string]string{"eth0": staticFile},
+		InitScript:     "/etc/init.d/S30eth",
+		StateFile:      filepath.Join(dir, "network.json"),
+		ConfirmTimeout: 60,
+	}
+
+	oldAddresses, oldRun, oldSchedule := readInterfaceAddresses, runCommand, scheduleNetworkApply
+	defer func() {
+		readInterfaceAddresses, runCommand, scheduleNetworkApply = oldAddresses, oldRun, oldSchedule
+		networkPending = nil
+	}()
+	leased := map[int][]interfaceAddress{2: {{IP: net.ParseIP("192.168.1.50"), PrefixLength: 24}}}
+	readInterfaceAddresses = func() (map[int][]interfaceAddress, error) { return leased, nil }
+	var calls []string
+	runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		return nil, nil
+	}
+	var apply func()
+	scheduleNetworkApply = func(f func()) { apply = f }
+
+	do := func(method, path, body string, local net.IP) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if local != nil {
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: local, Port: 8080}))
+		}
+		rr := httptest.NewRecorder()
+		handleEthernetInterfaces(rr, req)
+		return rr
+	}
+	eth0 := ethernetInterfacesPath + "/eth0"
+	static := `{"DHCPv4": {"DHCPEnabled": false}, "IPv4StaticAddresses": [
+		{"Address": "192.168.1.60", "SubnetMask": "255.255.255.0", "Gateway": "192.168.1.1"}]}`
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Static addresses with DHCP on", `{"IPv4StaticAddresses": [{"Address": "192.168.1.60", "SubnetMask": "255.255.255.0"}]}`},
+		{"No static addresses", `{"DHCPv4": {"DHCPEnabled": false}}`},
+		{"Bad mask", `{"DHCPv4": {"DHCPEnabled": false}, "IPv4StaticAddresses": [{"Address": "192.168.1.60", "SubnetMask": "255.0.255.0"}]}`},
+		{"Gateway off the subnet", `{"DHCPv4": {"DHCPEnabled": false}, "IPv4StaticAddresses": [
+			{"Address": "192.168.1.60", "SubnetMask": "255.255.255.0", "Gateway": "10.0.0.1"}]}`},
+	}
+	for _, tt := range tests {
+		if rr := do("PATCH", eth0, tt.body, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := do("PATCH", ethernetInterfacesPath+"/usb0", `{"DHCPv4": {"DHCPEnabled": false}}`, nil); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for an interface without a static file, got %d", rr.Code)
+	}
+
+	if rr := do("PATCH", eth0, static, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if content, _ := os.ReadFile(staticFile); string(content) != "192.168.1.60/24 192.168.1.1\n" {
+		t.Errorf("Expected the static address written, got %q", content)
+	}
+	if rr := do("PATCH", eth0, `{"DHCPv4": {"DHCPEnabled": true}}`, nil); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while a change is pending, got %d", rr.Code)
+	}
+	if len(calls) != 0 || apply == nil {
+		t.Fatalf("Expected networking restarted only after the response, got %v", calls)
+	}
+	apply()
+	if len(calls) != 1 || calls[0] != "/etc/init.d/S30eth restart" {
+		t.Errorf("Expected networking restarted, got %v", calls)
+	}
+
+	// A request still on a connection to the old address, or to another
+	// interface, does not confirm the change.
+	leased = map[int][]interfaceAddress{
+		2: {{IP: net.ParseIP("192.168.1.60"), PrefixLength: 24, Permanent: true}},
+		3: {{IP: net.ParseIP("169.254.1.1"), PrefixLength: 16, Permanent: true}},
+	}
+	do("GET", eth0, "", net.ParseIP("192.168.1.50"))
+	do("GET", eth0, "", net.ParseIP("169.254.1.1"))
+	if networkPending == nil {
+		t.Fatal("Expected the change still pending")
+	}
+	rr := do("GET", eth0, "", net.ParseIP("192.168.1.60"))
+	var resource struct {
+		DHCPv4              struct{ DHCPEnabled bool }
+		IPv4StaticAddresses []IPv4Address
+		IPv4Addresses       []struct{ AddressOrigin string }
+		Oem                 struct{ NanoKVM map[string]interface{} }
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resource)
+	if networkPending != nil {
+		t.Fatal("Expected the change confirmed through the new address")
+	}
+	if _, err := os.Stat(currentConfig.Network.StateFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the saved rollback removed, got %v", err)
+	}
+	if resource.DHCPv4.DHCPEnabled || len(resource.IPv4StaticAddresses) != 1 ||
+		resource.IPv4Addresses[0].AddressOrigin != "Static" || resource.Oem.NanoKVM["RevertTime"] != nil {
+		t.Errorf("Expected the static address served, got %s", rr.Body.String())
+	}
+
+	// A change the service restarts before confirming is undone.
+	if rr := do("PATCH", eth0, `{"DHCPv4": {"DHCPEnabled": true}}`, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(staticFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the static file removed for DHCP, got %v", err)
+	}
+	networkPending = nil
+	if err := loadNetworkState(currentConfig.Network); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(staticFile); string(content) != "192.168.1.60/24 192.168.1.1\n" {
+		t.Errorf("Expected the static address put back, got %q", content)
+	}
+	if len(calls) != 2 || networkPending != nil {
+		t.Errorf("Expected networking restarted with the old settings, got %v", calls)
+	}
+}
+
+func TestEthernetInterfaceRevertFailure(t *testing.T) {
+	fakeNetSysfs(t, map[string]map[string]string{
+		"eth0": {"type": "1", "ifindex": "2", "flags": "0x1003", "carrier": "1"},
+	})
+	dir := t.TempDir()
+	staticFile := filepath.Join(dir, "eth.nodhcp")
+	currentConfig.Network = NetworkConfig{
+		StaticFiles:    map[string]string{"eth0": staticFile},
+		InitScript:     "/etc/init.d/S30eth",
+		StateFile:      filepath.Join(dir, "network.json"),
+		ConfirmTimeout: 60,
+	}
+
+	oldRun, oldSchedule := runCommand, scheduleNetworkApply
+	defer func() {
+		runCommand, scheduleNetworkApply = oldRun, oldSchedule
+		networkPending = nil
+	}()
+	runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		return []byte("eth0: link failure"), errors.New("exit status 1")
+	}
+	var apply func()
+	scheduleNetworkApply = func(f func()) { apply = f }
+
+	patch := func(body string) int {
+		rr := httptest.NewRecorder()
+		handleEthernetInterfaces(rr, httptest.NewRequest("PATCH", ethernetInterfacesPath+"/eth0", bytes.NewBufferString(body)))
+		return rr.Code
+	}
+	static := `{"DHCPv4": {"DHCPEnabled": false}, "IPv4StaticAddresses": [
+		{"Address": "192.168.1.60", "SubnetMask": "255.255.255.0"}]}`
+	if code := patch(static); code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", code)
+	}
+
+	// Going back to DHCP removes the static file, which a directory in
+	// its place stops.
+	if err := os.Remove(staticFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(staticFile, "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	apply()
+	if networkPending != nil {
+		t.Fatal("Expected the change given up on when it cannot be reverted")
+	}
+	if _, err := os.Stat(currentConfig.Network.StateFile); err != nil {
+		t.Errorf("Expected the saved rollback kept for the next start, got %v", err)
+	}
+	if err := os.RemoveAll(staticFile); err != nil {
+		t.Fatal(err)
+	}
+	if code := patch(static); code != http.StatusNoContent {
+		t.Errorf("Expected the interface changeable again, got %d", code)
+	}
+}
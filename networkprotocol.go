@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const networkProtocolPath = "/redfish/v1/Managers/BMC/NetworkProtocol"
+
+// savedNTP is what NTPConfig.StateFile holds, and the NTP settings
+// ManagerNetworkProtocol reports.
+type savedNTP struct {
+	ProtocolEnabled bool     `json:"ProtocolEnabled"`
+	NTPServers      []string `json:"NTPServers"`
+}
+
+var (
+	ntpMu       sync.Mutex
+	ntpSettings savedNTP
+)
+
+// loadNTPState restores the NTP settings saved in cfg.StateFile. Before
+// any are saved they are read off the client's config file, with the
+// client counted as on if it has servers.
+func loadNTPState(cfg NTPConfig) error {
+	ntpMu.Lock()
+	defer ntpMu.Unlock()
+
+	if cfg.StateFile != "" {
+		content, err := os.ReadFile(cfg.StateFile)
+		if err == nil {
+			var saved savedNTP
+			if err := json.Unmarshal(content, &saved); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", cfg.StateFile, err)
+			}
+			ntpSettings = saved
+			return nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read %s: %w", cfg.StateFile, err)
+		}
+	}
+	servers, err := readNTPServers(cfg.ConfigFile)
+	if err != nil {
+		return err
+	}
+	ntpSettings = savedNTP{ProtocolEnabled: len(servers) > 0, NTPServers: servers}
+	return nil
+}
+
+func ntpEnabled() bool {
+	ntpMu.Lock()
+	defer ntpMu.Unlock()
+	return ntpSettings.ProtocolEnabled
+}
+
+// readNTPServers returns the servers and pools in an ntp.conf. A missing
+// file has none.
+func readNTPServers(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	servers := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && (fields[0] == "server" || fields[0] == "pool") {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
+
+// writeNTPServers replaces the server and pool lines of an ntp.conf with
+// servers, keeping everything else in it.
+func writeNTPServers(path string, servers []string) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 1 && (fields[0] == "server" || fields[0] == "pool") {
+			continue
+		}
+		b.WriteString(scanner.Text() + "\n")
+	}
+	for _, server := range servers {
+		fmt.Fprintf(&b, "server %s iburst\n", server)
+	}
+	return writeFileAtomic(path, b.Bytes(), 0o644)
+}
+
+// applyNTP makes settings the NTP client's: it rewrites the servers in
+// its config, restarts it if it is on and stops it if not, and saves the
+// settings. It is called with ntpMu held.
+func applyNTP(cfg NTPConfig, settings savedNTP) error {
+	if cfg.ConfigFile != "" {
+		if err := writeNTPServers(cfg.ConfigFile, settings.NTPServers); err != nil {
+			return fmt.Errorf("failed to write %s: %w", cfg.ConfigFile, err)
+		}
+	}
+	if err := runNTPInitScript(cfg, settings.ProtocolEnabled); err != nil {
+		return err
+	}
+	if cfg.StateFile != "" {
+		content, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(cfg.StateFile, content, 0o600); err != nil {
+			return err
+		}
+	}
+	ntpSettings = settings
+	return nil
+}
+
+// runNTPInitScript restarts the NTP client, or stops it if enabled is
+// false. Without an init script there is nothing to run.
+func runNTPInitScript(cfg NTPConfig, enabled bool) error {
+	if cfg.InitScript == "" {
+		return nil
+	}
+	action := "restart"
+	if !enabled {
+		action = "stop"
+	}
+	if output, err := runCommand(nil, cfg.InitScript, action); err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", cfg.InitScript, action, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// stopDisabledNTP stops the NTP client at startup if it was turned off,
+// since the device's init scripts start it on every boot.
+func stopDisabledNTP(cfg NTPConfig) {
+	if ntpEnabled() {
+		return
+	}
+	if err := runNTPInitScript(cfg, false); err != nil {
+		log.Printf("Failed to stop the NTP client: %v", err)
+	}
+}
+
+// listenPort returns the port the service listens on.
+func listenPort() int {
+	_, port, err := net.SplitHostPort(currentConfig.ListenAddress)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func networkProtocolResource() map[string]interface{} {
+	ntpMu.Lock()
+	ntp := ntpSettings
+	ntpMu.Unlock()
+	if ntp.NTPServers == nil {
+		ntp.NTPServers = []string{}
+	}
+
+	https := currentConfig.TLS.CertFile != ""
+	resource := map[string]interface{}{
+		"@odata.type": odataType("ManagerNetworkProtocol"),
+		"@odata.id":   networkProtocolPath,
+		"Id":          "NetworkProtocol",
+		"Name":        "Manager Network Protocol",
+		"Status":      map[string]string{"State": "Enabled", "Health": "OK"},
+		"HTTP":        map[string]interface{}{"ProtocolEnabled": !https, "Port": listenPort()},
+		"HTTPS":       map[string]interface{}{"ProtocolEnabled": https, "Port": listenPort()},
+		"NTP":         ntp,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		resource["HostName"] = hostname
+	}
+	return resource
+}
+
+type NetworkProtocolPatchRequest struct {
+	NTP *struct {
+		ProtocolEnabled *bool    `json:"ProtocolEnabled,omitempty"`
+		NTPServers      []string `json:"NTPServers,omitempty"`
+	} `json:"NTP,omitempty"`
+}
+
+func handleNetworkProtocol(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, networkProtocolPath) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		handleNetworkProtocolGet(w, r)
+	case http.MethodPatch:
+		handleNetworkProtocolPatch(w, r)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
+	}
+}
+
+func handleNetworkProtocolGet(w http.ResponseWriter, r *http.Request) {
+	resource := networkProtocolResource()
+	etag := resourceETag(resource)
+	if notModified(w, r, etag) {
+		return
+	}
+	resource["@odata.etag"] = etag
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// handleNetworkProtocolPatch configures the device's NTP client. Only the
+// NTP settings are writable; the service's own protocols are set in its
+// config file.
+func handleNetworkProtocolPatch(w http.ResponseWriter, r *http.Request) {
+	var req NetworkProtocolPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if !checkPreconditions(w, r, resourceETag(networkProtocolResource()), false) {
+		return
+	}
+	ignored, ok := checkPatchProperties(w, r, body, &req, handleNetworkProtocolGet)
+	if !ok {
+		return
+	}
+
+	if req.NTP != nil {
+		ntpMu.Lock()
+		next := ntpSettings
+		if req.NTP.ProtocolEnabled != nil {
+			next.ProtocolEnabled = *req.NTP.ProtocolEnabled
+		}
+		if req.NTP.NTPServers != nil {
+			// Empty and null entries clear a slot.
+			next.NTPServers = []string{}
+			for i, server := range req.NTP.NTPServers {
+				if server == "" {
+					continue
+				}
+				if strings.ContainsAny(server, " \t\n#") {
+					ntpMu.Unlock()
+					writeRedfishError(w, http.StatusBadRequest,
+						newMessage("PropertyValueFormatError", server, "NTPServers").
+							withProperty(fmt.Sprintf("#/NTP/NTPServers/%d", i)))
+					return
+				}
+				next.NTPServers = append(next.NTPServers, server)
+			}
+		}
+		err := applyNTP(currentConfig.NTP, next)
+		ntpMu.Unlock()
+		if err != nil {
+			writeInternalError(w, "configure NTP", err)
+			return
+		}
+		state := "disabled"
+		if next.ProtocolEnabled {
+			state = "enabled"
+		}
+		emitEvent("OK", fmt.Sprintf("NTP %s, servers: %s", state, strings.Join(next.NTPServers, ", ")),
+			resourceEventPrefix+"ResourceChanged", networkProtocolPath)
+	}
+
+	writePatchResult(w, r, ignored, handleNetworkProtocolGet)
+}
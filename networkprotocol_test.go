@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNetworkProtocolNTP(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NTPConfig{
+		ConfigFile: filepath.Join(dir, "ntp.conf"),
+		InitScript: "/etc/init.d/S49ntp",
+		StateFile:  filepath.Join(dir, "ntp.json"),
+	}
+	os.WriteFile(cfg.ConfigFile, []byte("driftfile /var/lib/ntp/ntp.drift\nserver 0.pool.ntp.org iburst\n"), 0644)
+
+	oldConfig, oldSettings, oldRun := currentConfig, ntpSettings, runCommand
+	defer func() { currentConfig, ntpSettings, runCommand = oldConfig, oldSettings, oldRun }()
+	currentConfig.NTP = cfg
+	var calls []string
+	runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		return nil, nil
+	}
+
+	if err := loadNTPState(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !ntpEnabled() || len(ntpSettings.NTPServers) != 1 || ntpSettings.NTPServers[0] != "0.pool.ntp.org" {
+		t.Fatalf("Expected the servers in ntp.conf with NTP on, got %+v", ntpSettings)
+	}
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleNetworkProtocol(rr, httptest.NewRequest("PATCH", networkProtocolPath, bytes.NewBufferString(body)))
+		return rr
+	}
+	if rr := patch(`{"NTP": {"NTPServers": ["time.example.com", "bad server"]}}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a server with a space, got %d", rr.Code)
+	}
+	if rr := patch(`{"NTP": {"NTPServers": ["time.example.com", "", "10.0.0.1"]}}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	content, _ := os.ReadFile(cfg.ConfigFile)
+	expected := "driftfile /var/lib/ntp/ntp.drift\nserver time.example.com iburst\nserver 10.0.0.1 iburst\n"
+	if string(content) != expected {
+		t.Errorf("Expected ntp.conf\n%s\ngot\n%s", expected, content)
+	}
+
+	if rr := patch(`{"NTP": {"ProtocolEnabled": false}}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(calls) != 2 || calls[0] != cfg.InitScript+" restart" || calls[1] != cfg.InitScript+" stop" {
+		t.Errorf("Expected the client restarted then stopped, got %v", calls)
+	}
+
+	// The saved settings win over ntp.conf after a restart.
+	if err := loadNTPState(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if ntpEnabled() || len(ntpSettings.NTPServers) != 2 {
+		t.Errorf("Expected NTP off with two servers, got %+v", ntpSettings)
+	}
+
+	rr := httptest.NewRecorder()
+	handleNetworkProtocol(rr, httptest.NewRequest("GET", networkProtocolPath, nil))
+	var resource struct {
+		NTP savedNTP
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resource)
+	if resource.NTP.ProtocolEnabled || len(resource.NTP.NTPServers) != 2 {
+		t.Errorf("Expected the NTP settings served, got %s", rr.Body.String())
+	}
+}
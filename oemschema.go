@@ -0,0 +1,91 @@
+package main
+
+import "net/http"
+
+// oemSchemaPath serves the CSDL for the OEM types and actions, which
+// $metadata references so that clients and the Redfish Service Validator
+// can resolve them like the DMTF ones.
+const oemSchemaPath = "/redfish/v1/Schemas/NanoKVM_v1.xml"
+
+// oemSchemaNamespaces are the namespaces oemSchemaDocument declares.
+var oemSchemaNamespaces = []string{"NanoKVM", "NanoKVMGPIO", "NanoKVMGPIO.v1_0_0", "NanoKVMGPIOCollection"}
+
+const oemSchemaDocument = `<?xml version="1.0" encoding="UTF-8"?>
+<edmx:Edmx xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx" Version="4.0">
+  <edmx:Reference Uri="http://docs.oasis-open.org/odata/odata/v4.0/errata03/csd01/complete/vocabularies/Org.OData.Core.V1.xml">
+    <edmx:Include Namespace="Org.OData.Core.V1" Alias="OData"/>
+  </edmx:Reference>
+  <edmx:Reference Uri="http://redfish.dmtf.org/schemas/v1/RedfishExtensions_v1.xml">
+    <edmx:Include Namespace="RedfishExtensions.v1_0_0" Alias="Redfish"/>
+  </edmx:Reference>
+  <edmx:Reference Uri="http://redfish.dmtf.org/schemas/v1/Resource_v1.xml">
+    <edmx:Include Namespace="Resource"/>
+    <edmx:Include Namespace="Resource.v1_0_0"/>
+  </edmx:Reference>
+  <edmx:Reference Uri="http://redfish.dmtf.org/schemas/v1/Manager_v1.xml">
+    <edmx:Include Namespace="Manager.v1_0_0"/>
+  </edmx:Reference>
+  <edmx:DataServices>
+    <Schema xmlns="http://docs.oasis-open.org/odata/ns/edm" Namespace="NanoKVM">
+      <Action Name="SetMaintenanceMode" IsBound="true">
+        <Parameter Name="Manager" Type="Manager.v1_0_0.OemActions"/>
+        <Parameter Name="Enabled" Type="Edm.Boolean" Nullable="false"/>
+      </Action>
+      <Action Name="SetValue" IsBound="true">
+        <Parameter Name="NanoKVMGPIO" Type="NanoKVMGPIO.v1_0_0.Actions"/>
+        <Parameter Name="Value" Type="Edm.Int64" Nullable="false"/>
+      </Action>
+      <Action Name="Pulse" IsBound="true">
+        <Parameter Name="NanoKVMGPIO" Type="NanoKVMGPIO.v1_0_0.Actions"/>
+        <Parameter Name="DurationMs" Type="Edm.Int64"/>
+      </Action>
+    </Schema>
+    <Schema xmlns="http://docs.oasis-open.org/odata/ns/edm" Namespace="NanoKVMGPIO">
+      <EntityType Name="NanoKVMGPIO" BaseType="Resource.v1_0_0.Resource" Abstract="true">
+        <Annotation Term="OData.Description" String="An auxiliary GPIO of the NanoKVM."/>
+      </EntityType>
+    </Schema>
+    <Schema xmlns="http://docs.oasis-open.org/odata/ns/edm" Namespace="NanoKVMGPIO.v1_0_0">
+      <EntityType Name="NanoKVMGPIO" BaseType="NanoKVMGPIO.NanoKVMGPIO">
+        <Property Name="Direction" Type="NanoKVMGPIO.v1_0_0.Direction" Nullable="false">
+          <Annotation Term="OData.Permissions" EnumMember="OData.Permission/Read"/>
+        </Property>
+        <Property Name="Value" Type="Edm.Int64">
+          <Annotation Term="OData.Permissions" EnumMember="OData.Permission/Read"/>
+          <Annotation Term="OData.Description" String="The level of the GPIO, or null if reading it would disturb an output."/>
+        </Property>
+        <Property Name="Status" Type="Resource.Status" Nullable="false"/>
+        <Property Name="Actions" Type="NanoKVMGPIO.v1_0_0.Actions" Nullable="false"/>
+      </EntityType>
+      <EnumType Name="Direction">
+        <Member Name="Input"/>
+        <Member Name="Output"/>
+      </EnumType>
+      <ComplexType Name="Actions">
+        <Annotation Term="OData.AdditionalProperties" Bool="false"/>
+      </ComplexType>
+    </Schema>
+    <Schema xmlns="http://docs.oasis-open.org/odata/ns/edm" Namespace="NanoKVMGPIOCollection">
+      <EntityType Name="NanoKVMGPIOCollection" BaseType="Resource.v1_0_0.ResourceCollection">
+        <NavigationProperty Name="Members" Type="Collection(NanoKVMGPIO.NanoKVMGPIO)" Nullable="false">
+          <Annotation Term="OData.Permissions" EnumMember="OData.Permission/Read"/>
+          <Annotation Term="OData.AutoExpandReferences"/>
+        </NavigationProperty>
+      </EntityType>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>
+`
+
+func handleOemSchema(w http.ResponseWriter, r *http.Request) {
+	if !checkResourcePath(w, r, oemSchemaPath) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(oemSchemaDocument))
+}
@@ -0,0 +1,31 @@
+package main
+
+import "net/http"
+
+// withOptions answers OPTIONS on every resource with the methods it
+// supports. Each handler already lists those in the Allow header when it
+// rejects a method, so the request is passed through and the handler's
+// 405 turned into the answer; a 404 for a resource that does not exist is
+// passed on as it is.
+func withOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+		if allow := buf.header.Get("Allow"); buf.status == http.StatusMethodNotAllowed && allow != "" {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		for name, values := range buf.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	startFakeHost(t, false)
+	oldConfig, oldAccounts := currentConfig, accountStore
+	defer func() { currentConfig, accountStore = oldConfig, oldAccounts }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	accountStore = nil
+	handler := newHandler()
+
+	tests := []struct {
+		method      string
+		path        string
+		expectCode  int
+		expectAllow string
+	}{
+		{"OPTIONS", "/redfish/v1/Systems/System.1", http.StatusOK, "GET, PATCH, OPTIONS"},
+		{"OPTIONS", "/redfish/v1/Systems", http.StatusOK, "GET, OPTIONS"},
+		{"OPTIONS", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", http.StatusOK, "POST, OPTIONS"},
+		{"DELETE", "/redfish/v1/Managers/BMC", http.StatusMethodNotAllowed, "GET, PATCH, OPTIONS"},
+		{"OPTIONS", "/redfish/v1/Systems/DoesNotExist", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.expectCode {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.expectCode, rr.Code, rr.Body.String())
+		}
+		if allow := rr.Header().Get("Allow"); allow != tt.expectAllow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.expectAllow, allow)
+		}
+	}
+}
+
+func TestMethodsNotAllowed(t *testing.T) {
+	startFakeHost(t, false)
+	oldConfig, oldAccounts, oldEvents := currentConfig, accountStore, eventService
+	defer func() { currentConfig, accountStore, eventService = oldConfig, oldAccounts, oldEvents }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	accountStore, eventService = nil, nil
+	handler := newHandler()
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	// Every resource reachable from the service root refuses PUT with the
+	// same Allow list OPTIONS returns, and collections refuse PATCH.
+	crawlResources(handler, func(path string, get *httptest.ResponseRecorder) {
+		allow := serve("OPTIONS", path).Header().Get("Allow")
+		if !strings.HasSuffix(allow, "OPTIONS") {
+			t.Errorf("OPTIONS %s: expected an Allow list, got %q", path, allow)
+		}
+		rr := serve("PUT", path)
+		if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != allow {
+			t.Errorf("PUT %s: expected 405 with Allow %q, got %d with %q", path, allow, rr.Code, rr.Header().Get("Allow"))
+		}
+		var resource map[string]interface{}
+		json.Unmarshal(get.Body.Bytes(), &resource)
+		if _, collection := resource["Members"]; collection {
+			if rr := serve("PATCH", path); rr.Code != http.StatusMethodNotAllowed {
+				t.Errorf("PATCH %s: expected 405, got %d", path, rr.Code)
+			}
+		}
+	})
+
+	tests := []struct {
+		method      string
+		path        string
+		expectAllow string
+	}{
+		{"GET", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset", "POST, OPTIONS"},
+		{"POST", "/redfish/v1/Managers/BMC", "GET, PATCH, OPTIONS"},
+		{"PATCH", "/redfish/v1/AccountService/Accounts", "GET, POST, OPTIONS"},
+		{"POST", "/redfish/v1/AccountService/Accounts/1", "GET, PATCH, DELETE, OPTIONS"},
+		{"PATCH", "/redfish/v1/EventService/Subscriptions", "GET, POST, OPTIONS"},
+	}
+	for _, tt := range tests {
+		rr := serve(tt.method, tt.path)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected 405, got %d: %s", tt.method, tt.path, rr.Code, rr.Body.String())
+		}
+		if allow := rr.Header().Get("Allow"); allow != tt.expectAllow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.expectAllow, allow)
+		}
+	}
+}
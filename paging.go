@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// maxCollectionPage caps the members listed in one response, so that a
+// full event log is not built into a single body on the SoC. Clients
+// follow Members@odata.nextLink for the rest.
+const maxCollectionPage = 100
+
+// writeCollection writes a collection, listing the page of its Members
+// chosen by the request's $skip and $top. Members@odata.count is always
+// the full count, and Members@odata.nextLink is set while members remain.
+func writeCollection(w http.ResponseWriter, r *http.Request, collection SystemCollection) {
+	query := r.URL.Query()
+	skip, ok := pagingParameter(w, query, "$skip")
+	if !ok {
+		return
+	}
+	top, ok := pagingParameter(w, query, "$top")
+	if !ok {
+		return
+	}
+
+	total := len(collection.Members)
+	start := 0
+	if skip > 0 {
+		start = skip
+	}
+	if start > total {
+		start = total
+	}
+	end := total
+	if top >= 0 && start+top < end {
+		end = start + top
+	}
+	if end-start > maxCollectionPage {
+		end = start + maxCollectionPage
+	}
+
+	if end < total && (top < 0 || end-start < top) {
+		query.Set("$skip", strconv.Itoa(end))
+		if top >= 0 {
+			query.Set("$top", strconv.Itoa(top-(end-start)))
+		}
+		collection.NextLink = collection.ODataID + "?" + query.Encode()
+	}
+	collection.Members = collection.Members[start:end]
+	collection.Count = total
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// pagingParameter reads $skip or $top as a non-negative integer, returning
+// -1 when it is absent. It writes the error and returns false when the
+// value is not one.
+func pagingParameter(w http.ResponseWriter, query map[string][]string, name string) (int, bool) {
+	values, ok := query[name]
+	if !ok {
+		return -1, true
+	}
+	n, err := strconv.Atoi(values[0])
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("QueryParameterValueTypeError", values[0], name))
+		return 0, false
+	}
+	if n < 0 {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("QueryParameterOutOfRange", values[0], name, "0 or more"))
+		return 0, false
+	}
+	return n, true
+}
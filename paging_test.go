@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestCollectionPaging(t *testing.T) {
+	eventLog.Clear()
+	defer eventLog.Clear()
+	for i := 0; i < 250; i++ {
+		severity := "OK"
+		if i%2 == 1 {
+			severity = "Warning"
+		}
+		eventLog.Add(severity, "entry "+strconv.Itoa(i), "")
+	}
+	entriesPath := eventLog.odataID() + "/Entries"
+
+	get := func(path string) (int, SystemCollection) {
+		rr := httptest.NewRecorder()
+		handleLogServices(rr, httptest.NewRequest("GET", path, nil))
+		var collection SystemCollection
+		json.Unmarshal(rr.Body.Bytes(), &collection)
+		return rr.Code, collection
+	}
+	first := func(collection SystemCollection) string {
+		if len(collection.Members) == 0 {
+			return ""
+		}
+		return collection.Members[0]["@odata.id"]
+	}
+	entryPath := func(i int) string {
+		return eventLog.Entries()[i].ODataID
+	}
+
+	tests := []struct {
+		name         string
+		query        string
+		expectCount  int
+		expectFirst  string
+		expectLength int
+		expectNext   url.Values
+	}{
+		{"Default page", "", 250, entryPath(0), 100, url.Values{"$skip": {"100"}}},
+		{"Last page", "?$skip=200", 250, entryPath(200), 50, nil},
+		{"Top", "?$top=10&$skip=5", 250, entryPath(5), 10, nil},
+		{"Top past the page size", "?$top=150", 250, entryPath(0), 100, url.Values{"$skip": {"100"}, "$top": {"50"}}},
+		{"Skip past the end", "?$skip=300", 250, "", 0, nil},
+		{"Filtered", "?$filter=" + url.QueryEscape("Severity eq 'Warning'") + "&$top=110", 125, entryPath(1), 100,
+			url.Values{"$skip": {"100"}, "$top": {"10"}, "$filter": {"Severity eq 'Warning'"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, collection := get(entriesPath + tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+			}
+			if collection.Count != tt.expectCount || len(collection.Members) != tt.expectLength || first(collection) != tt.expectFirst {
+				t.Errorf("Expected %d of %d members from %q, got %d of %d from %q",
+					tt.expectLength, tt.expectCount, tt.expectFirst, len(collection.Members), collection.Count, first(collection))
+			}
+			if tt.expectNext == nil {
+				if collection.NextLink != "" {
+					t.Errorf("Expected no nextLink, got %s", collection.NextLink)
+				}
+				return
+			}
+			if want := entriesPath + "?" + tt.expectNext.Encode(); collection.NextLink != want {
+				t.Errorf("Expected nextLink %s, got %s", want, collection.NextLink)
+			}
+		})
+	}
+
+	// Following nextLink lists every entry exactly once.
+	seen := 0
+	for path := entriesPath; path != ""; {
+		_, collection := get(path)
+		seen += len(collection.Members)
+		path = collection.NextLink
+	}
+	if seen != 250 {
+		t.Errorf("Expected 250 entries across the pages, got %d", seen)
+	}
+
+	for _, query := range []string{"?$top=ten", "?$skip=-1"} {
+		if code, _ := get(entriesPath + query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
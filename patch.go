@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// checkPatchProperties finds the properties of a PATCH body that the
+// request struct req has no field for, looking inside nested objects, and
+// returns a message for each: PropertyNotWritable if the resource as get
+// serves it has the property, PropertyUnknown if not. The PATCH goes ahead
+// with the rest; if nothing in the body can be written it is refused with
+// the messages instead. Annotations such as @Redfish.OperationApplyTime
+// are left to the handler.
+func checkPatchProperties(w http.ResponseWriter, r *http.Request, body []byte, req interface{}, get http.HandlerFunc) ([]MessageInfo, bool) {
+	var props map[string]interface{}
+	if len(body) == 0 || json.Unmarshal(body, &props) != nil {
+		return nil, true
+	}
+
+	// The resource is only fetched to tell read-only properties from
+	// unknown ones, which a well-formed PATCH does not need.
+	var resource map[string]interface{}
+	fetched := false
+	lookup := func(path []string) bool {
+		if !fetched {
+			json.Unmarshal(fetchResource(r, get).body.Bytes(), &resource)
+			fetched = true
+		}
+		current := resource
+		for _, name := range path[:len(path)-1] {
+			current, _ = current[name].(map[string]interface{})
+		}
+		_, ok := current[path[len(path)-1]]
+		return ok
+	}
+
+	var msgs []MessageInfo
+	accepted := 0
+	var walk func(props map[string]interface{}, t reflect.Type, path []string)
+	walk = func(props map[string]interface{}, t reflect.Type, path []string) {
+		fields := jsonFields(t)
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if strings.Contains(name, "@") {
+				continue
+			}
+			property := append(path[:len(path):len(path)], name)
+			pointer := "#/" + strings.Join(property, "/")
+			field, known := fields[name]
+			nested, isObject := props[name].(map[string]interface{})
+			switch {
+			case known && field.Kind() == reflect.Struct && isObject:
+				walk(nested, field, property)
+			case known:
+				accepted++
+			case lookup(property):
+				msgs = append(msgs, newMessage("PropertyNotWritable", name).withProperty(pointer))
+			default:
+				msgs = append(msgs, newMessage("PropertyUnknown", name).withProperty(pointer))
+			}
+		}
+	}
+	walk(props, reflect.TypeOf(req), nil)
+
+	if len(msgs) > 0 && accepted == 0 {
+		writeRedfishError(w, http.StatusBadRequest, msgs...)
+		return nil, false
+	}
+	return msgs, true
+}
+
+// writePatchResult answers a PATCH that was applied: 204 if every
+// property was written, otherwise the resource as it is now with a message
+// for each property that was not.
+func writePatchResult(w http.ResponseWriter, r *http.Request, msgs []MessageInfo, get http.HandlerFunc) {
+	if len(msgs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writePatchedResource(w, r, msgs, get)
+}
+
+// writePatchedResource answers a PATCH with the resource as it is now,
+// annotated with msgs if there are any.
+func writePatchedResource(w http.ResponseWriter, r *http.Request, msgs []MessageInfo, get http.HandlerFunc) {
+	buf := fetchResource(r, get)
+	var resource map[string]interface{}
+	if buf.status != http.StatusOK || json.Unmarshal(buf.body.Bytes(), &resource) != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if len(msgs) > 0 {
+		resource["@Message.ExtendedInfo"] = msgs
+	}
+
+	if etag := buf.header.Get("ETag"); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
+
+// fetchResource runs get for the resource r is patching, without the
+// PATCH's conditions or query.
+func fetchResource(r *http.Request, get http.HandlerFunc) *bufferedResponseWriter {
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.Body = http.NoBody
+	req.URL.RawQuery = ""
+	req.Header.Del("If-Match")
+	req.Header.Del("If-None-Match")
+
+	buf := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+	get(buf, req)
+	return buf
+}
+
+// jsonFields maps the JSON names of the fields of struct type t, or of the
+// struct t points to, to their types with pointers removed.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields := map[string]reflect.Type{}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		ft := t.Field(i).Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		fields[name] = ft
+	}
+	return fields
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPatchReadOnlyProperties(t *testing.T) {
+	startFakeHost(t, false)
+	oldBoot := currentBootConfig
+	defer func() { currentBootConfig = oldBoot }()
+
+	tests := []struct {
+		name         string
+		body         string
+		expectCode   int
+		expectIDs    []string
+		expectTarget string
+	}{
+		{"Writable only", `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`, http.StatusNoContent, nil, "Pxe"},
+		{"Read-only alongside writable", `{"PowerState": "On", "Boot": {"BootSourceOverrideTarget": "Cd"}}`,
+			http.StatusOK, []string{"Base.1.8.PropertyNotWritable"}, "Cd"},
+		{"Read-only only", `{"Id": "System.2", "PowerState": "On"}`,
+			http.StatusBadRequest, []string{"Base.1.8.PropertyNotWritable", "Base.1.8.PropertyNotWritable"}, "Cd"},
+		{"Unknown property", `{"Bogus": 1, "Boot": {"BootSourceOverrideTarget": "Hdd"}}`,
+			http.StatusOK, []string{"Base.1.8.PropertyUnknown"}, "Hdd"},
+		{"Unknown nested property", `{"Boot": {"BootSourceOverrideTarget": "Usb", "Bogus": 1}}`,
+			http.StatusOK, []string{"Base.1.8.PropertyUnknown"}, "Usb"},
+		{"Annotations ignored", `{"@odata.type": "#ComputerSystem.v1_20_0.ComputerSystem", "Boot": {"BootSourceOverrideTarget": "Pxe"}}`,
+			http.StatusNoContent, nil, "Pxe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handleSystems(rr, httptest.NewRequest("PATCH", "/redfish/v1/Systems/System.1", bytes.NewBufferString(tt.body)))
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+
+			var body struct {
+				ID    string           `json:"Id"`
+				Info  []MessageInfo    `json:"@Message.ExtendedInfo"`
+				Error redfishErrorBody `json:"error"`
+			}
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			info := body.Info
+			if rr.Code == http.StatusBadRequest {
+				info = body.Error.ExtendedInfo
+			} else if rr.Code == http.StatusOK && body.ID != "System.1" {
+				t.Errorf("Expected the system in the response, got %s", rr.Body.String())
+			}
+			if len(info) != len(tt.expectIDs) {
+				t.Fatalf("Expected %v, got %+v", tt.expectIDs, info)
+			}
+			for i, id := range tt.expectIDs {
+				if info[i].MessageID != id {
+					t.Errorf("Expected %s, got %s", id, info[i].MessageID)
+				}
+				if tt.name == "Unknown nested property" && info[i].RelatedProperties[0] != "#/Boot/Bogus" {
+					t.Errorf("Expected the nested property pointed to, got %v", info[i].RelatedProperties)
+				}
+			}
+			if target := primarySystem.boot.BootSourceOverrideTarget; target != tt.expectTarget {
+				t.Errorf("Expected BootSourceOverrideTarget %s, got %s", tt.expectTarget, target)
+			}
+		})
+	}
+}
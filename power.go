@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// poweringOnWindow and poweringOffWindow bound how long the system reads
+// PoweringOn or PoweringOff after a reset started the transition: until
+// the power LED confirms it, or this long if it never does. A graceful
+// shutdown is up to the host's OS, so it gets longer.
+var (
+	poweringOnWindow  = 30 * time.Second
+	poweringOffWindow = 60 * time.Second
+)
+
+// powerOffWait bounds how long PowerCycle waits for the host to go off
+// before pressing the power button again, and shutdownWait how long
+// GracefulRestart waits for the OS to shut it down.
+var (
+	powerOffWait = 10 * time.Second
+	shutdownWait = 60 * time.Second
+)
+
+// powerActionMu is held for the whole of a reset of System.1, from reading
+// the power state to the last press, so a second reset cannot interleave
+// its presses with the first one's; it is refused instead.
+var powerActionMu sync.Mutex
+
+// powerTransition is the state a reset is taking a system to.
+type powerTransition struct {
+	mu    sync.Mutex
+	state string
+	until time.Time
+}
+
+var primaryTransition powerTransition
+
+// setPowerTransition records that a reset is taking the host to
+// "PoweringOn" or "PoweringOff"; "" clears it.
+func (s *hostSystem) setPowerTransition(state string) {
+	t := s.transition
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = state
+	switch state {
+	case "PoweringOn":
+		t.until = time.Now().Add(poweringOnWindow)
+	case "PoweringOff":
+		t.until = time.Now().Add(poweringOffWindow)
+	default:
+		t.until = time.Time{}
+	}
+}
+
+func (s *hostSystem) powerTransition() string {
+	t := s.transition
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Now().After(t.until) {
+		return ""
+	}
+	return t.state
+}
+
+// powerState is the PowerState the ComputerSystem reports. From the first
+// press of a reset until the power LED shows the new state, the host reads
+// PoweringOn or PoweringOff, so a client polling after On never sees it
+// fall back to Off, and pressing the button again in that window would not
+// undo the reset. Only System.1 has a power monitor to read from.
+func (s *hostSystem) powerState() (string, error) {
+	var state string
+	var err error
+	if s == primarySystem {
+		state, err = sampledPowerState()
+	} else {
+		state, err = s.getPowerState()
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.withPowerTransition(state), nil
+}
+
+// withPowerTransition is the PowerState to report while the LED reads
+// state.
+func (s *hostSystem) withPowerTransition(state string) string {
+	switch transition := s.powerTransition(); {
+	case transition == "PoweringOn" && state == "On",
+		transition == "PoweringOff" && state == "Off":
+		s.setPowerTransition("")
+	case transition != "":
+		return transition
+	}
+	return state
+}
+
+// waitForPowerOff polls the power LED until the host is off.
+func (s *hostSystem) waitForPowerOff(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := s.getPowerState()
+		if err != nil {
+			return err
+		}
+		if state == "Off" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &HardwareError{Kind: errIOFailure, Op: "wait for power off",
+				Err: fmt.Errorf("host still on after %v", timeout)}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// escalateShutdown waits timeout seconds for the OS to shut the host down,
+// then forces it off with a longMs hold of the power button, as a BMC
+// does for a host that ignores the shutdown request.
+func (s *hostSystem) escalateShutdown(timeout, longMs int) powerOperation {
+	return powerOperation{
+		Description: fmt.Sprintf("Wait %d s for the host to shut down, then hold power button for %d ms", timeout, longMs),
+		Do: func() error {
+			if s.waitForPowerOff(time.Duration(timeout)*time.Second) == nil {
+				return nil
+			}
+			log.Printf("GracefulShutdown not completed after %d s, forcing the host off", timeout)
+			emitEvent("Warning", fmt.Sprintf("GracefulShutdown not completed after %d s; host forced off", timeout),
+				resourceEventPrefix+"ResourceErrorsDetected", s.path(),
+				"PowerState", "GracefulShutdownTimeout")
+			if err := s.pressPowerButton(longMs); err != nil {
+				return err
+			}
+			return s.waitForPowerOff(powerOffWait)
+		},
+	}
+}
+
+// runReset performs a planned reset and what follows from it: the boot
+// override keystrokes and clearing a one-time override. It is called with
+// s.actionMu held and returns the action's status and, on failure, the
+// message to report. progress, if set, is told the percentage done after
+// each operation.
+func (s *hostSystem) runReset(resetType string, ops []powerOperation, progress func(percent int)) (int, *MessageInfo) {
+	// Only System.1 has a power monitor to tell its resets from a loss.
+	if s == primarySystem {
+		beginPowerAction()
+		defer endPowerAction()
+	}
+
+	// The host must not reach its boot menu before the image is attached.
+	if s == primarySystem && metal3Compatible() && powersOn(resetType, ops) && !waitForPendingInsert() {
+		msg := newMessage("ResourceInUse")
+		return http.StatusConflict, &msg
+	}
+
+	for i, op := range ops {
+		if op.Transition != "" {
+			s.setPowerTransition(op.Transition)
+		}
+		if err := op.Do(); err != nil {
+			s.setPowerTransition("")
+			status, msg := hardwareErrorMessage(err, "ComputerSystem.Reset")
+			return status, &msg
+		}
+		if progress != nil {
+			progress((i + 1) * 100 / (len(ops) + 1))
+		}
+	}
+
+	// Settings staged for the next reset take effect on the boot this
+	// reset starts, before its override is typed.
+	if s.settings.pending != nil && powersOn(resetType, ops) {
+		if err := s.applySettings(*s.settings.pending); err != nil {
+			log.Printf("Failed to apply pending settings: %v", err)
+		}
+	}
+	if target, ok := s.boot.overrideTarget(); ok && powersOn(resetType, ops) {
+		if err := s.startBootKeys(bootKeyProfiles[getBootProfile()], target); err != nil {
+			log.Printf("Cannot apply boot override %s: %v", target, err)
+			emitEvent("Warning", fmt.Sprintf("Boot override to %s not applied: %v", target, err),
+				resourceEventPrefix+"ResourceErrorsDetected", s.path(),
+				"Boot/BootSourceOverrideTarget", err.Error())
+		}
+		// A one-time override is used up by this boot, whether or not the
+		// profile could reach the target.
+		if s.boot.BootSourceOverrideEnabled == "Once" {
+			s.boot.BootSourceOverrideEnabled = "Disabled"
+			s.boot.BootSourceOverrideTarget = "None"
+			s.boot.UefiTargetBootSourceOverride = ""
+			if err := s.saveBootState(); err != nil {
+				log.Printf("Failed to save boot settings: %v", err)
+			}
+			emitEvent("OK", fmt.Sprintf("One-time boot override to %s cleared", target),
+				resourceEventPrefix+"ResourceChanged", s.path())
+		}
+	}
+
+	emitEvent("OK", fmt.Sprintf("Reset action %s performed", resetType),
+		resourceEventPrefix+"ResourcePowerStateChanged", s.path(),
+		s.path(), resetType)
+	return http.StatusNoContent, nil
+}
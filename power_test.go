@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHost stands in for the host behind the GPIO files: releasing the
+// power button switches it on or off, and the power LED follows.
+type fakeHost struct {
+	hw Hardware
+
+	mu      sync.Mutex
+	presses int
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startFakeHost points currentHardware at the fake host's GPIO files.
+func startFakeHost(t *testing.T, on bool) *fakeHost {
+	t.Helper()
+	dir := t.TempDir()
+	h := &fakeHost{
+		hw: Hardware{
+			GPIOPower:    filepath.Join(dir, "gpio_power"),
+			GPIOReset:    filepath.Join(dir, "gpio_reset"),
+			GPIOPowerLED: filepath.Join(dir, "gpio_power_led"),
+			HIDKeyboard:  filepath.Join(dir, "hidg0"),
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for _, path := range []string{h.hw.GPIOPower, h.hw.GPIOReset, h.hw.HIDKeyboard} {
+		if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.setLED(on)
+
+	oldHardware := currentHardware
+	currentHardware = &h.hw
+	// An earlier reset's PoweringOn window belongs to another host.
+	primarySystem.setPowerTransition("")
+	go h.run()
+	t.Cleanup(func() {
+		h.freeze()
+		stopBootKeys()
+		primarySystem.setPowerTransition("")
+		currentHardware = oldHardware
+	})
+	return h
+}
+
+// freeze stops the host reacting to the buttons, as a hung or slow host
+// would; the LED keeps its state.
+func (h *fakeHost) freeze() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.done
+}
+
+func (h *fakeHost) setLED(on bool) {
+	// The power LED is inverted: 0 means the host is on.
+	value := "1"
+	if on {
+		value = "0"
+	}
+	os.WriteFile(h.hw.GPIOPowerLED, []byte(value), 0644)
+}
+
+func (h *fakeHost) run() {
+	defer close(h.done)
+	pressed := false
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(5 * time.Millisecond):
+		}
+		value, _ := os.ReadFile(h.hw.GPIOPower)
+		down := string(value) == "1"
+		if pressed && !down {
+			led, _ := os.ReadFile(h.hw.GPIOPowerLED)
+			h.setLED(string(led) == "1")
+			h.mu.Lock()
+			h.presses++
+			h.mu.Unlock()
+		}
+		pressed = down
+	}
+}
+
+func (h *fakeHost) pressCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.presses
+}
+
+func postReset(t *testing.T, resetType string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+		bytes.NewBufferString(`{"ResetType": "`+resetType+`"}`))
+	rr := httptest.NewRecorder()
+	handleReset(rr, req, primarySystem)
+	return rr
+}
+
+// postResetTask posts a reset that runs as a task and waits for the task
+// to end.
+func postResetTask(t *testing.T, resetType string) TaskResource {
+	t.Helper()
+	setupTaskStore(t)
+	rr := postReset(t, resetType)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var res TaskResource
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	task, _ := taskStore.Get(res.ID)
+	waitFor(t, resetType+" task", func() bool {
+		res = task.resource()
+		return res.EndTime != ""
+	})
+	return res
+}
+
+func getSystem(t *testing.T) ComputerSystem {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleSystemGet(rr, httptest.NewRequest("GET", "/redfish/v1/Systems/System.1", nil), primarySystem)
+	var system ComputerSystem
+	if err := json.Unmarshal(rr.Body.Bytes(), &system); err != nil {
+		t.Fatal(err)
+	}
+	return system
+}
+
+func systemPowerStateOf(t *testing.T) string {
+	t.Helper()
+	return getSystem(t).PowerState
+}
+
+func TestPlanReset(t *testing.T) {
+	tests := []struct {
+		resetType  string
+		state      string
+		transition string
+		expect     []string
+	}{
+		{"On", "Off", "", []string{"Press power button for 800 ms"}},
+		{"On", "Off", "PoweringOn", nil},
+		{"ForceOn", "Off", "", []string{"Press power button for 800 ms"}},
+		{"ForceOn", "On", "", nil},
+		{"ForceOff", "Off", "PoweringOn", []string{"Hold power button for 1000 ms"}},
+		{"ForceOff", "On", "PoweringOff", []string{"Hold power button for 1000 ms"}},
+		{"GracefulShutdown", "Off", "PoweringOn", nil},
+		{"GracefulShutdown", "On", "PoweringOff", nil},
+		{"GracefulShutdown", "On", "", []string{"Press power button for 800 ms", "Wait for the host to shut down"}},
+		{"PushPowerButton", "On", "", []string{"Press power button for 800 ms"}},
+		{"PushPowerButton", "Off", "PoweringOn", []string{"Press power button for 800 ms"}},
+		{"GracefulRestart", "On", "", []string{"Press power button for 800 ms", "Wait for the host to shut down", "Press power button for 800 ms"}},
+		{"GracefulRestart", "On", "PoweringOff", []string{"Wait for the host to shut down", "Press power button for 800 ms"}},
+		{"GracefulRestart", "Off", "", []string{"Press power button for 800 ms"}},
+		{"GracefulRestart", "Off", "PoweringOn", nil},
+		{"PowerCycle", "On", "", []string{"Hold power button for 1000 ms", "Wait for the power LED to go off", "Press power button for 800 ms"}},
+		{"PowerCycle", "On", "PoweringOff", []string{"Hold power button for 1000 ms", "Wait for the power LED to go off", "Press power button for 800 ms"}},
+		{"PowerCycle", "Off", "", []string{"Press power button for 800 ms"}},
+		{"PowerCycle", "Off", "PoweringOn", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resetType+" "+tt.state+" "+tt.transition, func(t *testing.T) {
+			startFakeHost(t, tt.state == "On")
+			primarySystem.setPowerTransition(tt.transition)
+
+			ops, ok := primarySystem.planReset(tt.resetType, PressDurations{})
+			if !ok {
+				t.Fatal("Expected a known reset type")
+			}
+			var got []string
+			for _, op := range ops {
+				got = append(got, op.Description)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestPoweringOn(t *testing.T) {
+	host := startFakeHost(t, false)
+	// The LED stays off for a while as the host starts.
+	host.freeze()
+
+	if rr := postReset(t, "On"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if state := systemPowerStateOf(t); state != "PoweringOn" {
+		t.Errorf("Expected PoweringOn, got %s", state)
+	}
+	if ops, _ := primarySystem.planReset("On", PressDurations{}); len(ops) != 0 {
+		t.Errorf("Expected On while powering on to do nothing, got %v", ops)
+	}
+
+	host.setLED(true)
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected On once the LED is on, got %s", state)
+	}
+	host.setLED(false)
+	if state := systemPowerStateOf(t); state != "Off" {
+		t.Errorf("Expected Off after the host shut down, got %s", state)
+	}
+}
+
+func TestPoweringOff(t *testing.T) {
+	host := startFakeHost(t, true)
+	// The host takes its time to shut down.
+	host.freeze()
+
+	if rr := postReset(t, "ForceOff"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if state := systemPowerStateOf(t); state != "PoweringOff" {
+		t.Errorf("Expected PoweringOff, got %s", state)
+	}
+	host.setLED(false)
+	if state := systemPowerStateOf(t); state != "Off" {
+		t.Errorf("Expected Off once the LED is off, got %s", state)
+	}
+	host.setLED(true)
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected On after the host was switched on, got %s", state)
+	}
+}
+
+func TestGracefulShutdownTask(t *testing.T) {
+	old := shutdownWait
+	shutdownWait = 500 * time.Millisecond
+	defer func() { shutdownWait = old }()
+
+	tests := []struct {
+		name        string
+		shutsDown   bool
+		expectState string
+		expectTask  string
+	}{
+		{"Host shuts down", true, "Off", "Completed"},
+		{"Host ignores it", false, "On", "Exception"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := startFakeHost(t, true)
+			// The host takes its time to shut down.
+			host.freeze()
+			setupTaskStore(t)
+
+			rr := postReset(t, "GracefulShutdown")
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+			}
+			var res TaskResource
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			task, _ := taskStore.Get(res.ID)
+
+			waitFor(t, "shutdown press", func() bool { return task.resource().PercentComplete > 0 })
+			if state := systemPowerStateOf(t); state != "PoweringOff" {
+				t.Errorf("Expected PoweringOff while waiting, got %s", state)
+			}
+			if tt.shutsDown {
+				host.setLED(false)
+			}
+			waitFor(t, "shutdown task", func() bool { return task.resource().TaskState == tt.expectTask })
+			if state := systemPowerStateOf(t); state != tt.expectState {
+				t.Errorf("Expected %s after the task, got %s", tt.expectState, state)
+			}
+		})
+	}
+}
+
+func TestPowerStateDuringPress(t *testing.T) {
+	host := startFakeHost(t, false)
+	setupTaskStore(t)
+
+	req := httptest.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+		bytes.NewBufferString(`{"ResetType": "On"}`))
+	req.Header.Set("Prefer", "respond-async")
+	handleReset(httptest.NewRecorder(), req, primarySystem)
+
+	waitFor(t, "power press", func() bool {
+		value, _ := os.ReadFile(host.hw.GPIOPower)
+		return string(value) == "1"
+	})
+	if state := systemPowerStateOf(t); state != "PoweringOn" {
+		t.Errorf("Expected PoweringOn while the button is held, got %s", state)
+	}
+	waitFor(t, "power on", func() bool { return systemPowerStateOf(t) == "On" })
+}
+
+func TestResetRunsAsTask(t *testing.T) {
+	startFakeHost(t, false)
+	old := currentConfig.SynchronousReset
+	currentConfig.SynchronousReset = false
+	defer func() { currentConfig.SynchronousReset = old }()
+
+	if res := postResetTask(t, "On"); res.TaskState != "Completed" {
+		t.Fatalf("Expected the task to complete, got %+v", res)
+	}
+	waitFor(t, "power on", func() bool { return systemPowerStateOf(t) == "On" })
+	// Nothing to press needs no task.
+	if rr := postReset(t, "On"); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d with the host on, got %d", http.StatusNoContent, rr.Code)
+	}
+}
+
+func TestPowerCycle(t *testing.T) {
+	host := startFakeHost(t, true)
+
+	if res := postResetTask(t, "PowerCycle"); res.TaskState != "Completed" {
+		t.Fatalf("Expected the task to complete, got %+v", res)
+	}
+	waitFor(t, "the second press", func() bool { return host.pressCount() == 2 })
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected On after the cycle, got %s", state)
+	}
+}
+
+func TestGracefulRestart(t *testing.T) {
+	host := startFakeHost(t, true)
+
+	if res := postResetTask(t, "GracefulRestart"); res.TaskState != "Completed" {
+		t.Fatalf("Expected the task to complete, got %+v", res)
+	}
+	waitFor(t, "the second press", func() bool { return host.pressCount() == 2 })
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected On after the restart, got %s", state)
+	}
+}
+
+func TestGracefulRestartTimeout(t *testing.T) {
+	// The OS ignores the shutdown request.
+	startFakeHost(t, true).freeze()
+	old := shutdownWait
+	shutdownWait = 50 * time.Millisecond
+	defer func() { shutdownWait = old }()
+
+	if res := postResetTask(t, "GracefulRestart"); res.TaskState != "Exception" {
+		t.Errorf("Expected the task to fail, got %+v", res)
+	}
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected the host to be left On, got %s", state)
+	}
+}
+
+func TestResetNmi(t *testing.T) {
+	host := startFakeHost(t, true)
+	if rr := postReset(t, "Nmi"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without an NMI GPIO, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if containsString(primarySystem.resetTypes(), "Nmi") {
+		t.Error("Expected Nmi not to be offered without an NMI GPIO")
+	}
+
+	host.hw.GPIONMI = filepath.Join(t.TempDir(), "gpio_nmi")
+	if err := os.WriteFile(host.hw.GPIONMI, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(primarySystem.resetTypes(), "Nmi") {
+		t.Error("Expected Nmi to be offered with an NMI GPIO")
+	}
+	if rr := postReset(t, "Nmi"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	if value, _ := os.ReadFile(host.hw.GPIONMI); string(value) != "0" {
+		t.Errorf("Expected the NMI line released, got %q", value)
+	}
+	if host.pressCount() != 0 {
+		t.Errorf("Expected no power presses, got %d", host.pressCount())
+	}
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected the host to stay On, got %s", state)
+	}
+}
+
+func TestPowerCycleTimeout(t *testing.T) {
+	startFakeHost(t, true).freeze()
+	old := powerOffWait
+	powerOffWait = 50 * time.Millisecond
+	defer func() { powerOffWait = old }()
+
+	if res := postResetTask(t, "PowerCycle"); res.TaskState != "Exception" {
+		t.Errorf("Expected the task to fail, got %+v", res)
+	}
+}
+
+func TestConcurrentResets(t *testing.T) {
+	host := startFakeHost(t, true)
+
+	first := make(chan int)
+	go func() {
+		first <- postReset(t, "ForceRestart").Code
+	}()
+	waitFor(t, "reset press", func() bool {
+		value, _ := os.ReadFile(host.hw.GPIOReset)
+		return string(value) == "1"
+	})
+
+	for _, resetType := range []string{"ForceOff", "ForceRestart"} {
+		rr := postReset(t, resetType)
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d for %s during a reset, got %d", http.StatusConflict, resetType, rr.Code)
+		}
+		var body map[string]redfishErrorBody
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["error"].Code != "Base.1.8.ResourceInUse" {
+			t.Errorf("Expected ResourceInUse, got %s", body["error"].Code)
+		}
+	}
+
+	if code := <-first; code != http.StatusNoContent {
+		t.Errorf("Expected status %d for the first reset, got %d", http.StatusNoContent, code)
+	}
+	if host.pressCount() != 0 {
+		t.Errorf("Expected no power button presses, got %d", host.pressCount())
+	}
+	if rr := postReset(t, "ForceOff"); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d after the reset, got %d", http.StatusNoContent, rr.Code)
+	}
+}
+
+func TestResetAsync(t *testing.T) {
+	host := startFakeHost(t, false)
+	setupTaskStore(t)
+
+	req := httptest.NewRequest("POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+		bytes.NewBufferString(`{"ResetType": "On"}`))
+	req.Header.Set("Prefer", "respond-async")
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	handleReset(rr, req, primarySystem)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the response before the press ended, took %v", elapsed)
+	}
+	var res TaskResource
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	task, ok := taskStore.Get(res.ID)
+	if !ok {
+		t.Fatalf("Expected task %s", res.ID)
+	}
+
+	if rr := postReset(t, "ForceOff"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d while the task presses, got %d", http.StatusConflict, rr.Code)
+	}
+	waitFor(t, "reset task", func() bool { return task.resource().TaskState == "Completed" })
+	waitFor(t, "power on", func() bool { return host.pressCount() == 1 })
+	if state := systemPowerStateOf(t); state != "On" {
+		t.Errorf("Expected On after the task, got %s", state)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const powerSubsystemPath = "/redfish/v1/Chassis/System/PowerSubsystem"
+
+// i2cSlaveIoctl is I2C_SLAVE from linux/i2c-dev.h, which sets the address
+// later reads and writes on the device go to.
+const i2cSlaveIoctl = 0x0703
+
+// The INA219 and INA226 keep the shunt voltage in register 1 and the bus
+// voltage in register 2, both big-endian. The current is worked out from
+// the shunt voltage here, so the chips' calibration registers are left
+// alone.
+const (
+	inaShuntVoltageRegister = 0x01
+	inaBusVoltageRegister   = 0x02
+)
+
+// powerMeterMu serialises reads, since each one selects a register before
+// reading it.
+var powerMeterMu sync.Mutex
+
+// readI2CRegister reads a 16-bit register of the chip at addr on bus;
+// tests replace it.
+var readI2CRegister = i2cReadRegister
+
+func i2cReadRegister(bus string, addr int, register byte) (uint16, error) {
+	f, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlaveIoctl, uintptr(addr)); errno != 0 {
+		return 0, errno
+	}
+	if _, err := f.Write([]byte{register}); err != nil {
+		return 0, err
+	}
+	value := make([]byte, 2)
+	if _, err := f.Read(value); err != nil {
+		return 0, err
+	}
+	return uint16(value[0])<<8 | uint16(value[1]), nil
+}
+
+// powerMeasurement is one reading of the power meter.
+type powerMeasurement struct {
+	Volts, Amps, Watts float64
+}
+
+func powerMeterPresent() bool {
+	return currentConfig.PowerMeter.Chip != ""
+}
+
+func readPowerMeter() (powerMeasurement, error) {
+	cfg := currentConfig.PowerMeter
+
+	powerMeterMu.Lock()
+	shunt, err := readI2CRegister(cfg.Bus, cfg.Address, inaShuntVoltageRegister)
+	var bus uint16
+	if err == nil {
+		bus, err = readI2CRegister(cfg.Bus, cfg.Address, inaBusVoltageRegister)
+	}
+	powerMeterMu.Unlock()
+	if err != nil {
+		return powerMeasurement{}, &HardwareError{Kind: errIOFailure, Op: "read power meter", Err: err}
+	}
+
+	var shuntVolts, busVolts float64
+	switch cfg.Chip {
+	case "ina219":
+		// 10 µV per bit; the bus voltage is in the upper 13 bits at 4 mV.
+		shuntVolts = float64(int16(shunt)) * 10e-6
+		busVolts = float64(bus>>3) * 4e-3
+	case "ina226":
+		shuntVolts = float64(int16(shunt)) * 2.5e-6
+		busVolts = float64(bus) * 1.25e-3
+	}
+	amps := shuntVolts / (cfg.ShuntMilliohms / 1000)
+	return powerMeasurement{
+		Volts: roundMilli(busVolts),
+		Amps:  roundMilli(amps),
+		Watts: roundMilli(busVolts * amps),
+	}, nil
+}
+
+func roundMilli(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// powerMeterSensor returns read for chassisSensors, picking one value out
+// of a measurement.
+func powerMeterSensor(value func(powerMeasurement) float64) func() (sensorReading, error) {
+	return func() (sensorReading, error) {
+		m, err := readPowerMeter()
+		if err != nil {
+			return sensorReading{}, err
+		}
+		return sensorReading{Reading: value(m)}, nil
+	}
+}
+
+func handlePowerSubsystem(w http.ResponseWriter, r *http.Request) {
+	if !powerMeterPresent() || r.URL.Path != powerSubsystemPath {
+		writeNotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	status := map[string]string{"State": "Enabled", "Health": "OK"}
+	readings := map[string]interface{}{}
+	m, err := readPowerMeter()
+	if err != nil {
+		log.Printf("Failed to read the power meter: %v", err)
+		status["Health"] = "Warning"
+	}
+	for _, excerpt := range []struct {
+		name   string
+		sensor string
+		value  float64
+	}{
+		{"Voltage", "HostVoltage", m.Volts},
+		{"Current", "HostCurrent", m.Amps},
+		{"PowerConsumedWatts", "HostPower", m.Watts},
+	} {
+		reading := map[string]interface{}{"DataSourceUri": sensorsPath + "/" + excerpt.sensor, "Reading": nil}
+		if err == nil {
+			reading["Reading"] = excerpt.value
+		}
+		readings[excerpt.name] = reading
+	}
+
+	subsystem := map[string]interface{}{
+		"@odata.type": odataType("PowerSubsystem"),
+		"@odata.id":   powerSubsystemPath,
+		"Id":          "PowerSubsystem",
+		"Name":        "Power Subsystem",
+		"Status":      status,
+		"Oem": map[string]interface{}{
+			"NanoKVM": readings,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subsystem)
+}
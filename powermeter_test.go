@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPowerMeter(t *testing.T) {
+	oldConfig, oldRead := currentConfig, readI2CRegister
+	defer func() { currentConfig, readI2CRegister = oldConfig, oldRead }()
+	currentConfig.SoCThermalZone = ""
+
+	var registers map[byte]uint16
+	readI2CRegister = func(bus string, addr int, register byte) (uint16, error) {
+		if bus != "/dev/i2c-1" || addr != 0x40 {
+			t.Errorf("Expected the chip at 0x40 on /dev/i2c-1, got %#x on %s", addr, bus)
+		}
+		if registers == nil {
+			return 0, errors.New("no ACK")
+		}
+		return registers[register], nil
+	}
+
+	for _, tt := range []struct {
+		chip      string
+		shunt     float64
+		registers map[byte]uint16
+		expect    powerMeasurement
+	}{
+		// 5 mV across 100 mΩ at 12 V.
+		{"ina219", 100, map[byte]uint16{1: 500, 2: 3000 << 3}, powerMeasurement{12, 0.05, 0.6}},
+		// 5 mV across 10 mΩ at 12 V.
+		{"ina226", 10, map[byte]uint16{1: 2000, 2: 9600}, powerMeasurement{12, 0.5, 6}},
+		// Current flowing back into the supply.
+		{"ina226", 10, map[byte]uint16{1: 0xfc18, 2: 9600}, powerMeasurement{12, -0.25, -3}},
+	} {
+		currentConfig.PowerMeter = PowerMeterConfig{Chip: tt.chip, Bus: "/dev/i2c-1", Address: 0x40, ShuntMilliohms: tt.shunt}
+		registers = tt.registers
+		if m, err := readPowerMeter(); err != nil || m != tt.expect {
+			t.Errorf("Expected %+v from the %s, got %+v, %v", tt.expect, tt.chip, m, err)
+		}
+	}
+
+	var collection SystemCollection
+	rr := httptest.NewRecorder()
+	handleSensors(rr, httptest.NewRequest("GET", sensorsPath, nil))
+	json.Unmarshal(rr.Body.Bytes(), &collection)
+	if len(collection.Members) != 3 {
+		t.Errorf("Expected the voltage, current and power sensors, got %v", collection.Members)
+	}
+
+	var subsystem struct {
+		Status map[string]string
+		Oem    struct {
+			NanoKVM map[string]struct {
+				DataSourceUri string
+				Reading       *float64
+			}
+		}
+	}
+	rr = httptest.NewRecorder()
+	handlePowerSubsystem(rr, httptest.NewRequest("GET", powerSubsystemPath, nil))
+	json.Unmarshal(rr.Body.Bytes(), &subsystem)
+	if power := subsystem.Oem.NanoKVM["PowerConsumedWatts"]; power.Reading == nil || *power.Reading != -3 || power.DataSourceUri != sensorsPath+"/HostPower" {
+		t.Errorf("Expected the power with its sensor, got %+v", subsystem.Oem.NanoKVM)
+	}
+
+	registers = nil
+	rr = httptest.NewRecorder()
+	handlePowerSubsystem(rr, httptest.NewRequest("GET", powerSubsystemPath, nil))
+	subsystem.Oem.NanoKVM = nil
+	json.Unmarshal(rr.Body.Bytes(), &subsystem)
+	if subsystem.Status["Health"] != "Warning" || subsystem.Oem.NanoKVM["Voltage"].Reading != nil {
+		t.Errorf("Expected Warning and no readings when the chip does not answer, got %+v", subsystem)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// powerMonitor samples the power LED in the background, or watches it where
+// the backend can, so GET requests read a cached state, and tells the
+// subsystems registered with onPowerStateChange when it changes, however it
+// was changed: by a reset, the front panel button or the host's own OS.
+type powerMonitor struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	state   string
+	sampled time.Time
+
+	listenersMu sync.Mutex
+	listeners   []func(from, to string)
+}
+
+// currentPowerMonitor is nil when polling is disabled.
+var currentPowerMonitor *powerMonitor
+
+// powerWatchResync is how often the power state is still sampled when the
+// backend reports changes itself, in case it misses one. powerSettleTime
+// lets the LED settle after an edge before it is read.
+var (
+	powerWatchResync = 30 * time.Second
+	powerSettleTime  = 20 * time.Millisecond
+)
+
+// startPowerMonitor samples every interval until stop is closed. If the
+// backend can watch the power LED, it samples on each change instead, and
+// only every powerWatchResync besides.
+func startPowerMonitor(interval time.Duration, stop <-chan struct{}) *powerMonitor {
+	var changes <-chan struct{}
+	if w, ok := hardwareBackend.(powerWatcher); ok {
+		var err error
+		if changes, err = w.WatchPower(stop); err != nil {
+			log.Printf("Cannot watch the power LED, polling it every %v: %v", interval, err)
+		} else if interval < powerWatchResync {
+			interval = powerWatchResync
+		}
+	}
+
+	m := &powerMonitor{interval: interval}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.sample()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-changes:
+				time.Sleep(powerSettleTime)
+			}
+		}
+	}()
+	return m
+}
+
+func (m *powerMonitor) sample() {
+	state, err := getPowerState()
+	if err != nil {
+		// Requests fall back to reading the LED themselves and report
+		// the error.
+		return
+	}
+
+	m.mu.Lock()
+	from := m.state
+	m.state, m.sampled = state, time.Now()
+	m.mu.Unlock()
+
+	if from != "" && from != state {
+		m.listenersMu.Lock()
+		listeners := append([]func(from, to string){}, m.listeners...)
+		m.listenersMu.Unlock()
+		for _, fn := range listeners {
+			fn(from, state)
+		}
+	}
+}
+
+// cached returns the last sample if it is recent enough to trust.
+func (m *powerMonitor) cached() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == "" || time.Since(m.sampled) > 2*m.interval {
+		return "", false
+	}
+	return m.state, true
+}
+
+// onPowerStateChange registers fn to be called from the monitor's
+// goroutine with the old and new state whenever the power LED changes.
+func (m *powerMonitor) onPowerStateChange(fn func(from, to string)) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// sampledPowerState is getPowerState from the monitor's cache when it has
+// a recent sample.
+func sampledPowerState() (string, error) {
+	if m := currentPowerMonitor; m != nil {
+		if state, ok := m.cached(); ok {
+			return state, nil
+		}
+	}
+	return getPowerState()
+}
+
+// logPowerStateChange records a change of the host's power in the event
+// log, whatever caused it.
+func logPowerStateChange(from, to string) {
+	log.Printf("Host power changed from %s to %s", from, to)
+	emitEvent("OK", fmt.Sprintf("Host power changed from %s to %s", from, to),
+		resourceEventPrefix+"ResourcePowerStateChanged", primarySystem.path(),
+		primarySystem.path(), to)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPowerMonitor(t *testing.T) {
+	mock := setupMockBackend(t, false)
+	stop := make(chan struct{})
+	m := startPowerMonitor(50*time.Millisecond, stop)
+	oldMonitor := currentPowerMonitor
+	currentPowerMonitor = m
+	t.Cleanup(func() { currentPowerMonitor = oldMonitor })
+
+	var mu sync.Mutex
+	var changes []string
+	m.onPowerStateChange(func(from, to string) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, from+"->"+to)
+	})
+
+	waitFor(t, "first sample", func() bool { _, ok := m.cached(); return ok })
+	mock.SetPowered(true)
+	waitFor(t, "power change", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changes) == 1
+	})
+	if changes[0] != "Off->On" {
+		t.Errorf("Change = %q, want Off->On", changes[0])
+	}
+
+	// A failing read keeps serving the last sample while it is recent.
+	mock.Fail(&HardwareError{Kind: errIOFailure, Op: "test"})
+	if state, err := sampledPowerState(); err != nil || state != "On" {
+		t.Errorf("sampledPowerState() = %q, %v; want cached On", state, err)
+	}
+
+	close(stop)
+	time.Sleep(150 * time.Millisecond)
+	if _, err := sampledPowerState(); err == nil {
+		t.Error("sampledPowerState() used a stale sample")
+	}
+}
+
+// watchingBackend reports its power changes the way gpioBackend does on a
+// kernel with GPIO edge events.
+type watchingBackend struct {
+	*MockBackend
+	changes chan struct{}
+}
+
+func (b watchingBackend) WatchPower(stop <-chan struct{}) (<-chan struct{}, error) {
+	return b.changes, nil
+}
+
+func TestPowerMonitorWatch(t *testing.T) {
+	mock := setupMockBackend(t, false)
+	backend := watchingBackend{mock, make(chan struct{}, 1)}
+	hardwareBackend = backend
+
+	stop := make(chan struct{})
+	defer close(stop)
+	m := startPowerMonitor(10*time.Millisecond, stop)
+	if m.interval != powerWatchResync {
+		t.Errorf("Sampling every %v while watching, want %v", m.interval, powerWatchResync)
+	}
+
+	changed := make(chan string, 1)
+	m.onPowerStateChange(func(from, to string) { changed <- from + "->" + to })
+	waitFor(t, "first sample", func() bool { _, ok := m.cached(); return ok })
+
+	mock.SetPowered(true)
+	backend.changes <- struct{}{}
+	select {
+	case change := <-changed:
+		if change != "Off->On" {
+			t.Errorf("Change = %q, want Off->On", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No change reported after an edge")
+	}
+}
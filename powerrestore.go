@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var powerRestorePolicyValues = []string{"AlwaysOn", "AlwaysOff", "LastState"}
+
+// bootIDFile changes on every boot of the NanoKVM, which is how a reboot
+// is told apart from a restart of the service.
+var bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// lastStateSettle is how long a new power state has to hold before it is
+// recorded as the LastState. A power cut that takes the NanoKVM down with
+// the host must not leave Off recorded.
+var lastStateSettle = 10 * time.Second
+
+// savedPower is what powerStateFile holds. PowerRestorePolicy is empty
+// until a client sets one, and nothing is done at boot until then.
+type savedPower struct {
+	PowerRestorePolicy string `json:"PowerRestorePolicy,omitempty"`
+	LastState          string `json:"LastState,omitempty"`
+	BootID             string `json:"BootID,omitempty"`
+}
+
+var (
+	powerStateMu   sync.Mutex
+	powerStateFile string
+	powerState     savedPower
+)
+
+// loadPowerState restores the settings saved in path, if any, and makes
+// later changes save there.
+func loadPowerState(path string) error {
+	powerStateMu.Lock()
+	defer powerStateMu.Unlock()
+	powerStateFile, powerState = path, savedPower{}
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var saved savedPower
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if saved.PowerRestorePolicy != "" && !containsString(powerRestorePolicyValues, saved.PowerRestorePolicy) {
+		return fmt.Errorf("%s: invalid PowerRestorePolicy %q", path, saved.PowerRestorePolicy)
+	}
+	powerState = saved
+	return nil
+}
+
+// savePowerState writes powerState to powerStateFile. It is called with
+// powerStateMu held.
+func savePowerState() error {
+	if powerStateFile == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(powerState, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(powerStateFile, content, 0o600)
+}
+
+func getPowerRestorePolicy() string {
+	powerStateMu.Lock()
+	defer powerStateMu.Unlock()
+	return powerState.PowerRestorePolicy
+}
+
+func setPowerRestorePolicy(policy string) error {
+	if !containsString(powerRestorePolicyValues, policy) {
+		return fmt.Errorf("unknown PowerRestorePolicy %q", policy)
+	}
+	powerStateMu.Lock()
+	defer powerStateMu.Unlock()
+	previous := powerState.PowerRestorePolicy
+	powerState.PowerRestorePolicy = policy
+	if err := savePowerState(); err != nil {
+		powerState.PowerRestorePolicy = previous
+		return err
+	}
+	return nil
+}
+
+// recordPowerStateChange is an onPowerStateChange listener keeping the
+// LastState up to date once the new state has settled.
+func recordPowerStateChange(from, to string) {
+	time.AfterFunc(lastStateSettle, func() {
+		state, err := getPowerState()
+		if err != nil || state != to {
+			return
+		}
+		recordLastState(state)
+	})
+}
+
+func recordLastState(state string) {
+	powerStateMu.Lock()
+	defer powerStateMu.Unlock()
+	if powerState.LastState == state {
+		return
+	}
+	powerState.LastState = state
+	if err := savePowerState(); err != nil {
+		log.Printf("Failed to save power state: %v", err)
+	}
+}
+
+// applyPowerRestorePolicy runs once at startup. If the NanoKVM has booted
+// since the service last ran, it powers the host on or shuts it down as
+// the PowerRestorePolicy says; otherwise it records the host's state.
+func applyPowerRestorePolicy() {
+	content, err := os.ReadFile(bootIDFile)
+	if err != nil {
+		log.Printf("Cannot read the boot ID, not applying PowerRestorePolicy: %v", err)
+		return
+	}
+	bootID := strings.TrimSpace(string(content))
+
+	powerStateMu.Lock()
+	saved := powerState
+	powerState.BootID = bootID
+	if err := savePowerState(); err != nil {
+		log.Printf("Failed to save power state: %v", err)
+	}
+	powerStateMu.Unlock()
+
+	state, err := getPowerState()
+	if err != nil {
+		log.Printf("Cannot read the power state, not applying PowerRestorePolicy: %v", err)
+		return
+	}
+	want := map[string]string{"AlwaysOn": "On", "AlwaysOff": "Off", "LastState": saved.LastState}[saved.PowerRestorePolicy]
+	if saved.BootID == bootID || want == "" || want == state {
+		recordLastState(state)
+		return
+	}
+
+	// The new state is recorded by the power monitor once it settles.
+	resetType := map[string]string{"On": "On", "Off": "GracefulShutdown"}[want]
+	log.Printf("Host is %s after the NanoKVM booted; PowerRestorePolicy %s wants it %s",
+		state, saved.PowerRestorePolicy, want)
+	powerActionMu.Lock()
+	defer powerActionMu.Unlock()
+	ops, _ := primarySystem.planReset(resetType, PressDurations{})
+	if _, msg := primarySystem.runReset(resetType, ops, nil); msg != nil {
+		log.Printf("Failed to apply PowerRestorePolicy %s: %s", saved.PowerRestorePolicy, msg.Message)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupPowerState points the power settings and boot ID at temporary
+// files, starting from saved.
+func setupPowerState(t *testing.T, saved savedPower, bootID string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "power.json")
+	content, _ := json.Marshal(saved)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldBootIDFile := bootIDFile
+	bootIDFile = filepath.Join(dir, "boot_id")
+	if err := os.WriteFile(bootIDFile, []byte(bootID+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadPowerState(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		bootIDFile = oldBootIDFile
+		loadPowerState("")
+	})
+	return path
+}
+
+func TestPowerRestorePolicyPatch(t *testing.T) {
+	path := setupPowerState(t, savedPower{}, "boot-1")
+
+	if rr := patchSystem(t, `{"PowerRestorePolicy": "Sometimes"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := patchSystem(t, `{"PowerRestorePolicy": "AlwaysOn"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	if err := loadPowerState(path); err != nil {
+		t.Fatal(err)
+	}
+	if policy := getPowerRestorePolicy(); policy != "AlwaysOn" {
+		t.Errorf("Expected AlwaysOn after reload, got %q", policy)
+	}
+}
+
+func TestApplyPowerRestorePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		lastState   string
+		savedBootID string
+		on          bool
+		expectState string
+	}{
+		{"No policy", "", "On", "boot-1", false, "Off"},
+		{"AlwaysOn", "AlwaysOn", "", "boot-1", false, "On"},
+		{"AlwaysOn when on", "AlwaysOn", "", "boot-1", true, "On"},
+		{"AlwaysOff", "AlwaysOff", "", "boot-1", true, "Off"},
+		{"LastState on", "LastState", "On", "boot-1", false, "On"},
+		{"LastState off", "LastState", "Off", "boot-1", true, "Off"},
+		{"LastState unknown", "LastState", "", "boot-1", false, "Off"},
+		{"Service restart", "AlwaysOn", "", "boot-2", false, "Off"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMockBackend(t, tt.on)
+			setupPowerState(t, savedPower{PowerRestorePolicy: tt.policy, LastState: tt.lastState, BootID: tt.savedBootID}, "boot-2")
+
+			applyPowerRestorePolicy()
+			if state, _ := getPowerState(); state != tt.expectState {
+				t.Errorf("Expected %s, got %s", tt.expectState, state)
+			}
+			powerStateMu.Lock()
+			defer powerStateMu.Unlock()
+			if powerState.BootID != "boot-2" {
+				t.Errorf("Expected the boot ID to be recorded, got %q", powerState.BootID)
+			}
+		})
+	}
+}
+
+func TestRecordPowerStateChange(t *testing.T) {
+	mock := setupMockBackend(t, false)
+	setupPowerState(t, savedPower{}, "boot-1")
+	old := lastStateSettle
+	lastStateSettle = 10 * time.Millisecond
+	defer func() { lastStateSettle = old }()
+
+	// A change that does not hold is not recorded.
+	recordPowerStateChange("Off", "On")
+	time.Sleep(50 * time.Millisecond)
+	powerStateMu.Lock()
+	if powerState.LastState != "" {
+		t.Errorf("Expected a change back to Off not to be recorded, got %q", powerState.LastState)
+	}
+	powerStateMu.Unlock()
+
+	mock.SetPowered(true)
+	recordPowerStateChange("Off", "On")
+	waitFor(t, "LastState On", func() bool {
+		powerStateMu.Lock()
+		defer powerStateMu.Unlock()
+		return powerState.LastState == "On"
+	})
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// provisionPollInterval is how often provision-test re-reads the system
+// while waiting for a power or boot state.
+var provisionPollInterval = 2 * time.Second
+
+// redfishClient is a minimal Redfish client used by provision-test.
+type redfishClient struct {
+	base     string
+	username string
+	password string
+	http     *http.Client
+}
+
+type odataLink struct {
+	ODataID string `json:"@odata.id"`
+}
+
+type collectionResponse struct {
+	Members []odataLink `json:"Members"`
+}
+
+type actionTarget struct {
+	Target string `json:"target"`
+}
+
+type systemResponse struct {
+	PowerState   string `json:"PowerState"`
+	BootProgress *struct {
+		LastState string `json:"LastState"`
+	} `json:"BootProgress"`
+	Actions struct {
+		Reset *actionTarget `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+type managerResponse struct {
+	VirtualMedia *odataLink `json:"VirtualMedia"`
+}
+
+type virtualMediaResponse struct {
+	MediaTypes []string `json:"MediaTypes"`
+	Inserted   bool     `json:"Inserted"`
+	Image      string   `json:"Image"`
+	Actions    struct {
+		InsertMedia *actionTarget `json:"#VirtualMedia.InsertMedia"`
+		EjectMedia  *actionTarget `json:"#VirtualMedia.EjectMedia"`
+	} `json:"Actions"`
+}
+
+// do sends body as JSON and decodes the response into out when given.
+// Non-2xx responses become errors carrying the Redfish error message.
+func (c *redfishClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var redfishErr struct {
+			Error redfishErrorBody `json:"error"`
+		}
+		if json.Unmarshal(content, &redfishErr) == nil && redfishErr.Error.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, redfishErr.Error.Message)
+		}
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(content)))
+	}
+	if out != nil && len(content) > 0 {
+		if err := json.Unmarshal(content, out); err != nil {
+			return fmt.Errorf("%s %s: %w", method, path, err)
+		}
+	}
+	return nil
+}
+
+func (c *redfishClient) firstMember(path string) (string, error) {
+	var collection collectionResponse
+	if err := c.do(http.MethodGet, path, nil, &collection); err != nil {
+		return "", err
+	}
+	if len(collection.Members) == 0 {
+		return "", fmt.Errorf("%s has no members", path)
+	}
+	return collection.Members[0].ODataID, nil
+}
+
+// ProvisionTestOptions configures one provision-test run.
+type ProvisionTestOptions struct {
+	Target      string
+	Username    string
+	Password    string
+	Image       string
+	BootTarget  string
+	ExpectState string
+	Insecure    bool
+	Timeout     time.Duration
+}
+
+// ProvisionStepResult is one line of the provision-test report. Skipped
+// steps do not fail the run.
+type ProvisionStepResult struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+type ProvisionReport struct {
+	Target string                `json:"target"`
+	Passed bool                  `json:"passed"`
+	Steps  []ProvisionStepResult `json:"steps"`
+}
+
+// provisionRun walks a target through power off, media insert, boot
+// override, power on, boot and eject.
+type provisionRun struct {
+	opts   ProvisionTestOptions
+	client *redfishClient
+	report ProvisionReport
+
+	systemPath string
+	resetPath  string
+	mediaPath  string
+	media      virtualMediaResponse
+}
+
+var errStepSkipped = errors.New("skipped")
+
+func (p *provisionRun) step(name string, fn func() (string, error)) bool {
+	start := time.Now()
+	detail, err := fn()
+	result := ProvisionStepResult{Name: name, Status: "PASS", Detail: detail, Duration: time.Since(start).Round(time.Millisecond)}
+	switch {
+	case errors.Is(err, errStepSkipped):
+		result.Status = "SKIP"
+	case err != nil:
+		result.Status = "FAIL"
+		result.Detail = err.Error()
+	}
+	p.report.Steps = append(p.report.Steps, result)
+	return err == nil || errors.Is(err, errStepSkipped)
+}
+
+func (p *provisionRun) system() (systemResponse, error) {
+	var system systemResponse
+	err := p.client.do(http.MethodGet, p.systemPath, nil, &system)
+	return system, err
+}
+
+// waitFor polls the system until done reports true or the timeout passes.
+func (p *provisionRun) waitFor(what string, done func(systemResponse) bool) error {
+	deadline := time.Now().Add(p.opts.Timeout)
+	for {
+		system, err := p.system()
+		if err != nil {
+			return err
+		}
+		if done(system) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s", p.opts.Timeout, what)
+		}
+		time.Sleep(provisionPollInterval)
+	}
+}
+
+func (p *provisionRun) reset(resetType, wantState string) (string, error) {
+	if err := p.client.do(http.MethodPost, p.resetPath, map[string]string{"ResetType": resetType}, nil); err != nil {
+		return "", err
+	}
+	err := p.waitFor("PowerState "+wantState, func(s systemResponse) bool { return s.PowerState == wantState })
+	return "PowerState " + wantState, err
+}
+
+func (p *provisionRun) discover() (string, error) {
+	var err error
+	if p.systemPath, err = p.client.firstMember("/redfish/v1/Systems"); err != nil {
+		return "", err
+	}
+	system, err := p.system()
+	if err != nil {
+		return "", err
+	}
+	if system.Actions.Reset == nil {
+		return "", fmt.Errorf("%s has no ComputerSystem.Reset action", p.systemPath)
+	}
+	p.resetPath = system.Actions.Reset.Target
+
+	managerPath, err := p.client.firstMember("/redfish/v1/Managers")
+	if err != nil {
+		return "", err
+	}
+	var manager managerResponse
+	if err := p.client.do(http.MethodGet, managerPath, nil, &manager); err != nil {
+		return "", err
+	}
+	if manager.VirtualMedia == nil {
+		return "", fmt.Errorf("%s has no VirtualMedia", managerPath)
+	}
+
+	var collection collectionResponse
+	if err := p.client.do(http.MethodGet, manager.VirtualMedia.ODataID, nil, &collection); err != nil {
+		return "", err
+	}
+	for _, member := range collection.Members {
+		var media virtualMediaResponse
+		if err := p.client.do(http.MethodGet, member.ODataID, nil, &media); err != nil {
+			return "", err
+		}
+		if containsString(media.MediaTypes, "CD") || containsString(media.MediaTypes, "DVD") {
+			p.mediaPath, p.media = member.ODataID, media
+			break
+		}
+	}
+	if p.mediaPath == "" {
+		return "", fmt.Errorf("no CD/DVD virtual media under %s", manager.VirtualMedia.ODataID)
+	}
+	if p.media.Actions.InsertMedia == nil || p.media.Actions.EjectMedia == nil {
+		return "", fmt.Errorf("%s lacks InsertMedia or EjectMedia", p.mediaPath)
+	}
+	return fmt.Sprintf("system %s, media %s", p.systemPath, p.mediaPath), nil
+}
+
+func (p *provisionRun) insertMedia() (string, error) {
+	body := map[string]interface{}{
+		"Image":          p.opts.Image,
+		"Inserted":       true,
+		"WriteProtected": true,
+	}
+	if err := p.client.do(http.MethodPost, p.media.Actions.InsertMedia.Target, body, nil); err != nil {
+		return "", err
+	}
+	var media virtualMediaResponse
+	if err := p.client.do(http.MethodGet, p.mediaPath, nil, &media); err != nil {
+		return "", err
+	}
+	if !media.Inserted {
+		return "", fmt.Errorf("%s reports Inserted false after InsertMedia", p.mediaPath)
+	}
+	return media.Image, nil
+}
+
+func (p *provisionRun) setBootOverride() (string, error) {
+	body := map[string]interface{}{
+		"Boot": map[string]string{
+			"BootSourceOverrideTarget":  p.opts.BootTarget,
+			"BootSourceOverrideEnabled": "Once",
+		},
+	}
+	return p.opts.BootTarget + " once", p.client.do(http.MethodPatch, p.systemPath, body, nil)
+}
+
+func (p *provisionRun) watchBootProgress() (string, error) {
+	system, err := p.system()
+	if err != nil {
+		return "", err
+	}
+	if system.BootProgress == nil {
+		return "target does not report BootProgress", errStepSkipped
+	}
+
+	var last string
+	err = p.waitFor("BootProgress "+p.opts.ExpectState, func(s systemResponse) bool {
+		if s.BootProgress != nil {
+			last = s.BootProgress.LastState
+		}
+		return last == p.opts.ExpectState
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w (last state %q)", err, last)
+	}
+	return "LastState " + last, nil
+}
+
+func (p *provisionRun) ejectMedia() (string, error) {
+	if err := p.client.do(http.MethodPost, p.media.Actions.EjectMedia.Target, map[string]string{}, nil); err != nil {
+		return "", err
+	}
+	var media virtualMediaResponse
+	if err := p.client.do(http.MethodGet, p.mediaPath, nil, &media); err != nil {
+		return "", err
+	}
+	if media.Inserted {
+		return "", fmt.Errorf("%s still reports Inserted after EjectMedia", p.mediaPath)
+	}
+	return "", nil
+}
+
+// runProvisionTest runs the whole loop against opts.Target. Once media is
+// inserted it is always ejected again, even if a later step fails, so a
+// failed run does not leave the host booting the test image.
+func runProvisionTest(opts ProvisionTestOptions) ProvisionReport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+	p := &provisionRun{
+		opts: opts,
+		client: &redfishClient{
+			base:     strings.TrimSuffix(opts.Target, "/"),
+			username: opts.Username,
+			password: opts.Password,
+			http:     &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		},
+		report: ProvisionReport{Target: opts.Target},
+	}
+
+	ok := p.step("Discover resources", p.discover) &&
+		p.step("Power off", func() (string, error) { return p.reset("ForceOff", "Off") })
+	if ok && p.step("Insert media", p.insertMedia) {
+		ok = p.step("Set boot override", p.setBootOverride) &&
+			p.step("Power on", func() (string, error) { return p.reset("On", "On") }) &&
+			p.step("Watch boot progress", p.watchBootProgress)
+		ok = p.step("Eject media", p.ejectMedia) && ok
+	} else {
+		ok = false
+	}
+
+	p.report.Passed = ok
+	return p.report
+}
+
+func (r ProvisionReport) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Provisioning test against %s\n", r.Target)
+	for _, s := range r.Steps {
+		line := fmt.Sprintf("  %-4s  %-20s %8s", s.Status, s.Name, s.Duration)
+		if s.Detail != "" {
+			line += "  " + s.Detail
+		}
+		fmt.Fprintln(w, line)
+	}
+	if r.Passed {
+		fmt.Fprintln(w, "Result: PASS")
+	} else {
+		fmt.Fprintln(w, "Result: FAIL")
+	}
+}
+
+// provisionTestMain implements the provision-test subcommand and returns
+// the process exit status.
+func provisionTestMain(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("provision-test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var opts ProvisionTestOptions
+	var jsonOutput bool
+	fs.StringVar(&opts.Target, "target", "", "base URL of the Redfish service, e.g. https://nanokvm.example")
+	fs.StringVar(&opts.Username, "username", "", "Redfish user name")
+	fs.StringVar(&opts.Password, "password", os.Getenv("REDFISH_PASSWORD"), "Redfish password (default $REDFISH_PASSWORD)")
+	fs.StringVar(&opts.Image, "image", "", "URL of the ISO image to boot")
+	fs.StringVar(&opts.BootTarget, "boot-target", "Cd", "BootSourceOverrideTarget to boot the image from")
+	fs.StringVar(&opts.ExpectState, "expect-state", "OSRunning", "BootProgress LastState that counts as a successful boot")
+	fs.BoolVar(&opts.Insecure, "insecure", false, "skip TLS certificate verification")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Minute, "how long to wait for each power or boot state")
+	fs.BoolVar(&jsonOutput, "json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.Target == "" || opts.Image == "" {
+		fmt.Fprintln(stderr, "provision-test: -target and -image are required")
+		fs.Usage()
+		return 2
+	}
+
+	report := runProvisionTest(opts)
+	if jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		report.writeText(stdout)
+	}
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedfishTarget serves just enough of a BMC for provision-test.
+type fakeRedfishTarget struct {
+	mu           sync.Mutex
+	powerState   string
+	bootProgress string
+	bootTarget   string
+	inserted     bool
+	image        string
+	insertStatus int
+	// bootsTo is the LastState the host reaches after power on.
+	bootsTo string
+	calls   []string
+}
+
+func (f *fakeRedfishTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	write := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	const media = "/redfish/v1/Managers/BMC/VirtualMedia/CD1"
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /redfish/v1/Systems":
+		write(map[string]interface{}{"Members": []map[string]string{{"@odata.id": "/redfish/v1/Systems/1"}}})
+	case "GET /redfish/v1/Systems/1":
+		write(map[string]interface{}{
+			"PowerState":   f.powerState,
+			"BootProgress": map[string]string{"LastState": f.bootProgress},
+			"Actions": map[string]interface{}{
+				"#ComputerSystem.Reset": map[string]string{"target": "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset"},
+			},
+		})
+	case "PATCH /redfish/v1/Systems/1":
+		boot, _ := body["Boot"].(map[string]interface{})
+		f.bootTarget, _ = boot["BootSourceOverrideTarget"].(string)
+		w.WriteHeader(http.StatusNoContent)
+	case "POST /redfish/v1/Systems/1/Actions/ComputerSystem.Reset":
+		switch body["ResetType"] {
+		case "ForceOff":
+			f.powerState, f.bootProgress = "Off", "None"
+		case "On":
+			f.powerState, f.bootProgress = "On", f.bootsTo
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /redfish/v1/Managers":
+		write(map[string]interface{}{"Members": []map[string]string{{"@odata.id": "/redfish/v1/Managers/BMC"}}})
+	case "GET /redfish/v1/Managers/BMC":
+		write(map[string]interface{}{"VirtualMedia": map[string]string{"@odata.id": "/redfish/v1/Managers/BMC/VirtualMedia"}})
+	case "GET /redfish/v1/Managers/BMC/VirtualMedia":
+		write(map[string]interface{}{"Members": []map[string]string{{"@odata.id": media}}})
+	case "GET " + media:
+		write(map[string]interface{}{
+			"MediaTypes": []string{"CD", "DVD"},
+			"Inserted":   f.inserted,
+			"Image":      f.image,
+			"Actions": map[string]interface{}{
+				"#VirtualMedia.InsertMedia": map[string]string{"target": media + "/Actions/VirtualMedia.InsertMedia"},
+				"#VirtualMedia.EjectMedia":  map[string]string{"target": media + "/Actions/VirtualMedia.EjectMedia"},
+			},
+		})
+	case "POST " + media + "/Actions/VirtualMedia.InsertMedia":
+		if f.insertStatus != 0 {
+			writeRedfishError(w, f.insertStatus, newMessage("InternalError"))
+			return
+		}
+		f.inserted, f.image = true, body["Image"].(string)
+		w.WriteHeader(http.StatusNoContent)
+	case "POST " + media + "/Actions/VirtualMedia.EjectMedia":
+		f.inserted, f.image = false, ""
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func TestProvisionTest(t *testing.T) {
+	oldInterval := provisionPollInterval
+	provisionPollInterval = time.Millisecond
+	defer func() { provisionPollInterval = oldInterval }()
+
+	tests := []struct {
+		name         string
+		target       *fakeRedfishTarget
+		expectPassed bool
+		expectStatus []string
+	}{
+		{
+			name:         "Full loop",
+			target:       &fakeRedfishTarget{powerState: "On", bootsTo: "OSRunning"},
+			expectPassed: true,
+			expectStatus: []string{"PASS", "PASS", "PASS", "PASS", "PASS", "PASS", "PASS"},
+		},
+		{
+			name:         "Host never boots",
+			target:       &fakeRedfishTarget{powerState: "On", bootsTo: "SystemHardwareInitializationComplete"},
+			expectStatus: []string{"PASS", "PASS", "PASS", "PASS", "PASS", "FAIL", "PASS"},
+		},
+		{
+			name:         "Insert fails",
+			target:       &fakeRedfishTarget{powerState: "On", insertStatus: http.StatusInternalServerError},
+			expectStatus: []string{"PASS", "PASS", "FAIL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.target)
+			defer server.Close()
+
+			report := runProvisionTest(ProvisionTestOptions{
+				Target:      server.URL,
+				Image:       "http://images.example/boot.iso",
+				BootTarget:  "Cd",
+				ExpectState: "OSRunning",
+				Timeout:     20 * time.Millisecond,
+			})
+
+			if report.Passed != tt.expectPassed {
+				t.Errorf("Expected Passed %v, got %v", tt.expectPassed, report.Passed)
+			}
+			var statuses []string
+			for _, step := range report.Steps {
+				statuses = append(statuses, step.Status)
+			}
+			if strings.Join(statuses, " ") != strings.Join(tt.expectStatus, " ") {
+				t.Errorf("Expected steps %v, got %+v", tt.expectStatus, report.Steps)
+			}
+			if tt.target.inserted {
+				t.Error("Media left inserted after the run")
+			}
+		})
+	}
+}
+
+func TestProvisionTestMain(t *testing.T) {
+	oldInterval := provisionPollInterval
+	provisionPollInterval = time.Millisecond
+	defer func() { provisionPollInterval = oldInterval }()
+
+	target := &fakeRedfishTarget{powerState: "Off", bootsTo: "OSRunning"}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := provisionTestMain([]string{"-target", server.URL}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit status 2 without -image, got %d", code)
+	}
+
+	stdout.Reset()
+	code := provisionTestMain([]string{"-target", server.URL, "-image", "http://images.example/boot.iso", "-json"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit status 0, got %d: %s", code, stdout.String())
+	}
+	var report ProvisionReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed || target.bootTarget != "Cd" {
+		t.Errorf("Unexpected result: %+v, boot target %q", report, target.bootTarget)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds one client's remaining allowance as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per client address.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+var actionLimiter = newRateLimiter()
+
+func newRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: map[string]*tokenBucket{}}
+}
+
+// Allow takes a token from client's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *RateLimiter) Allow(client string, cfg RateLimitConfig) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := timeNow()
+	burst := float64(cfg.Burst)
+
+	// Buckets that have refilled completely carry no state worth keeping.
+	for key, b := range l.buckets {
+		if key != client && b.tokens+now.Sub(b.last).Seconds()*cfg.Rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*cfg.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / cfg.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+func isActionRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/Actions/")
+}
+
+// withActionRateLimit stops a misbehaving client from pressing buttons
+// faster than the hardware, or the host, can sensibly take. Only actions
+// are limited; reads and configuration changes pass straight through.
+func withActionRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := currentConfig.RateLimit
+		if cfg.Burst > 0 && isActionRequest(r) {
+			if ok, wait := actionLimiter.Allow(clientHost(r), cfg); !ok {
+				retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+				w.Header().Set("Retry-After", retryAfter)
+				writeRedfishError(w, http.StatusTooManyRequests,
+					newMessage("ServiceTemporarilyUnavailable", retryAfter))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestActionRateLimit(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+	oldConfig := currentConfig
+	oldLimiter := actionLimiter
+	currentConfig.RateLimit = RateLimitConfig{Burst: 3, Rate: 0.5}
+	actionLimiter = newRateLimiter()
+	defer func() {
+		timeNow = time.Now
+		currentConfig = oldConfig
+		actionLimiter = oldLimiter
+	}()
+
+	handler := withActionRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	resetPath := "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset"
+
+	tests := []struct {
+		name        string
+		advance     time.Duration
+		remoteAddr  string
+		method      string
+		path        string
+		expectCode  int
+		expectRetry string
+	}{
+		{"First of burst", 0, "10.0.0.1:5000", "POST", resetPath, http.StatusNoContent, ""},
+		{"Second of burst", 0, "10.0.0.1:5001", "POST", resetPath, http.StatusNoContent, ""},
+		{"Third of burst", 0, "10.0.0.1:5002", "POST", resetPath, http.StatusNoContent, ""},
+		{"Burst exhausted", 0, "10.0.0.1:5003", "POST", resetPath, http.StatusTooManyRequests, "2"},
+		{"Other client", 0, "10.0.0.2:5000", "POST", resetPath, http.StatusNoContent, ""},
+		{"Reads are not limited", 0, "10.0.0.1:5004", "GET", "/redfish/v1/Systems/System.1", http.StatusNoContent, ""},
+		{"Patches are not limited", 0, "10.0.0.1:5005", "PATCH", "/redfish/v1/Systems/System.1", http.StatusNoContent, ""},
+		{"Partly refilled", time.Second, "10.0.0.1:5006", "POST", resetPath, http.StatusTooManyRequests, "1"},
+		{"One token refilled", time.Second, "10.0.0.1:5007", "POST", resetPath, http.StatusNoContent, ""},
+		{"Empty again", 0, "10.0.0.1:5008", "POST", resetPath, http.StatusTooManyRequests, "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock = clock.Add(tt.advance)
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.expectRetry {
+				t.Errorf("Expected Retry-After %q, got %q", tt.expectRetry, got)
+			}
+		})
+	}
+}
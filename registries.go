@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const registriesPath = "/redfish/v1/Registries"
+
+// oemRegistryPrefix is the NanoKVM registry, whose messages add detail
+// specific to this service after the Base message of an error.
+const oemRegistryPrefix = "NanoKVM.1.3."
+
+var oemMessages = map[string]messageDefinition{
+	"HardwareBusy": {
+		Message:    "The hardware operation %1 could not start because the hardware is busy.",
+		Severity:   "Warning",
+		Resolution: "Wait for the operation in progress to finish and resubmit the request.",
+	},
+	"HardwareNotPresent": {
+		Message:    "The hardware operation %1 is not available on this board.",
+		Severity:   "Warning",
+		Resolution: "Configure the hardware for the board, or do not request the operation.",
+	},
+	"HardwareOperationFailed": {
+		Message:    "The hardware operation %1 failed: %2.",
+		Severity:   "Critical",
+		Resolution: "Check that the device exists and is accessible to the service, then resubmit the request.",
+	},
+	"MethodNotAllowed": {
+		Message:    "The HTTP method %1 is not allowed on the resource at %2.",
+		Severity:   "Critical",
+		Resolution: "Use one of the methods listed in the Allow header of the response.",
+	},
+	"ServiceNotEnabled": {
+		Message:    "The %1 is not enabled in the configuration of this service.",
+		Severity:   "Critical",
+		Resolution: "Enable the service in the configuration file and restart the service.",
+	},
+	"ODataVersionNotSupported": {
+		Message:    "The OData-Version %1 requested is not supported; the service implements OData %2.",
+		Severity:   "Critical",
+		Resolution: "Resubmit the request with the supported OData-Version, or without the header.",
+	},
+	"UnsupportedMediaType": {
+		Message:    "The request body's media type %1 is not supported; the service accepts %2.",
+		Severity:   "Critical",
+		Resolution: "Resubmit the request with a Content-Type of application/json.",
+	},
+	"MaintenanceModeActive": {
+		Message:    "The manager is in maintenance mode and refuses changes to the managed system.",
+		Severity:   "Warning",
+		Resolution: "Leave maintenance mode with the NanoKVM.SetMaintenanceMode action and resubmit the request.",
+	},
+}
+
+// resourceEventMessages is the subset of the DMTF ResourceEvent registry
+// used by emitEvent.
+var resourceEventMessages = map[string]messageDefinition{
+	"ResourceChanged": {
+		Message:    "One or more resource properties have changed.",
+		Severity:   "OK",
+		Resolution: "None.",
+	},
+	"ResourceCreated": {
+		Message:    "The resource has been created successfully.",
+		Severity:   "OK",
+		Resolution: "None.",
+	},
+	"ResourceErrorsDetected": {
+		Message:    "The resource property %1 has detected errors of type %2.",
+		Severity:   "Warning",
+		Resolution: "Resolution dependent upon error type.",
+	},
+	"ResourcePowerStateChanged": {
+		Message:    "The power state of resource %1 has changed to type %2.",
+		Severity:   "OK",
+		Resolution: "None.",
+	},
+	"ResourceRemoved": {
+		Message:    "The resource has been removed successfully.",
+		Severity:   "OK",
+		Resolution: "None.",
+	},
+}
+
+// messageRegistry is a registry the service uses MessageIds from. Only
+// the messages the service sends are listed, so a standard registry is a
+// subset of the published one.
+type messageRegistry struct {
+	Prefix       string
+	Version      string
+	Name         string
+	OwningEntity string
+	// PublicationURI is where the full registry is published; empty for
+	// the OEM registry.
+	PublicationURI string
+	Messages       map[string]messageDefinition
+}
+
+var messageRegistries = []messageRegistry{
+	{
+		Prefix:         "Base",
+		Version:        "1.8.0",
+		Name:           "Base Message Registry",
+		OwningEntity:   "DMTF",
+		PublicationURI: "http://redfish.dmtf.org/registries/Base.1.8.0.json",
+		Messages:       baseMessages,
+	},
+	{
+		Prefix:         "ResourceEvent",
+		Version:        "1.3.0",
+		Name:           "Resource Event Message Registry",
+		OwningEntity:   "DMTF",
+		PublicationURI: "http://redfish.dmtf.org/registries/ResourceEvent.1.3.0.json",
+		Messages:       resourceEventMessages,
+	},
+	{
+		Prefix:       "NanoKVM",
+		Version:      "1.3.0",
+		Name:         "NanoKVM Message Registry",
+		OwningEntity: "NanoKVM",
+		Messages:     oemMessages,
+	},
+}
+
+func (reg messageRegistry) id() string {
+	return reg.Prefix + "." + reg.Version
+}
+
+func (reg messageRegistry) fileURI() string {
+	return registriesPath + "/" + reg.Prefix + "/" + reg.id() + ".json"
+}
+
+// handleRegistries serves the Registries collection, a MessageRegistryFile
+// per registry and the registries themselves, so clients can look up the
+// MessageIds in errors and events without internet access.
+func handleRegistries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, registriesPath), "/")
+	if rest == "" {
+		members := []map[string]string{}
+		for _, reg := range messageRegistries {
+			members = append(members, map[string]string{"@odata.id": registriesPath + "/" + reg.Prefix})
+		}
+		writeCollection(w, r, SystemCollection{
+			ODataType: "#MessageRegistryFileCollection.MessageRegistryFileCollection",
+			ODataID:   registriesPath,
+			Name:      "Registry File Collection",
+			Members:   members,
+		})
+		return
+	}
+
+	prefix, file, _ := strings.Cut(rest, "/")
+	for _, reg := range messageRegistries {
+		if reg.Prefix != prefix {
+			continue
+		}
+		switch file {
+		case "":
+			handleRegistryFile(w, reg)
+			return
+		case reg.id() + ".json":
+			handleRegistry(w, reg)
+			return
+		}
+	}
+	writeNotFound(w, r)
+}
+
+func handleRegistryFile(w http.ResponseWriter, reg messageRegistry) {
+	location := map[string]string{
+		"Language": "en",
+		"Uri":      reg.fileURI(),
+	}
+	if reg.PublicationURI != "" {
+		location["PublicationUri"] = reg.PublicationURI
+	}
+
+	file := map[string]interface{}{
+		"@odata.type": odataType("MessageRegistryFile"),
+		"@odata.id":   registriesPath + "/" + reg.Prefix,
+		"Id":          reg.Prefix,
+		"Name":        reg.Name + " File",
+		"Registry":    reg.id(),
+		"Languages":   []string{"en"},
+		"Location":    []map[string]string{location},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(file)
+}
+
+func handleRegistry(w http.ResponseWriter, reg messageRegistry) {
+	messages := map[string]interface{}{}
+	for id, def := range reg.Messages {
+		n := 0
+		for strings.Contains(def.Message, "%"+string(rune('1'+n))) {
+			n++
+		}
+		paramTypes := make([]string, n)
+		for i := range paramTypes {
+			paramTypes[i] = "string"
+		}
+		messages[id] = map[string]interface{}{
+			"Description":  def.Message,
+			"Message":      def.Message,
+			"Severity":     def.Severity,
+			"NumberOfArgs": n,
+			"ParamTypes":   paramTypes,
+			"Resolution":   def.Resolution,
+		}
+	}
+
+	registry := map[string]interface{}{
+		"@odata.type":     odataType("MessageRegistry"),
+		"Id":              reg.id(),
+		"Name":            reg.Name,
+		"Language":        "en",
+		"Description":     "The messages of the " + reg.Name + " that this service sends.",
+		"RegistryPrefix":  reg.Prefix,
+		"RegistryVersion": reg.Version,
+		"OwningEntity":    reg.OwningEntity,
+		"Messages":        messages,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registry)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistries(t *testing.T) {
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleRegistries(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	var collection SystemCollection
+	if err := json.Unmarshal(get(registriesPath).Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Count != len(messageRegistries) {
+		t.Fatalf("Expected %d registries, got %d", len(messageRegistries), collection.Count)
+	}
+
+	served := map[string]map[string]json.RawMessage{}
+	for _, member := range collection.Members {
+		var file struct {
+			Registry string `json:"Registry"`
+			Location []struct {
+				URI string `json:"Uri"`
+			} `json:"Location"`
+		}
+		rr := get(member["@odata.id"])
+		if err := json.Unmarshal(rr.Body.Bytes(), &file); err != nil || len(file.Location) != 1 {
+			t.Fatalf("Expected a MessageRegistryFile at %s, got %d: %s", member["@odata.id"], rr.Code, rr.Body.String())
+		}
+
+		var registry struct {
+			ID             string                     `json:"Id"`
+			RegistryPrefix string                     `json:"RegistryPrefix"`
+			Messages       map[string]json.RawMessage `json:"Messages"`
+		}
+		rr = get(file.Location[0].URI)
+		if err := json.Unmarshal(rr.Body.Bytes(), &registry); err != nil || registry.ID != file.Registry {
+			t.Fatalf("Expected registry %s at %s, got %d: %s", file.Registry, file.Location[0].URI, rr.Code, rr.Body.String())
+		}
+		major, minor, _ := strings.Cut(strings.TrimPrefix(registry.ID, registry.RegistryPrefix+"."), ".")
+		minor, _, _ = strings.Cut(minor, ".")
+		served[registry.RegistryPrefix+"."+major+"."+minor+"."] = registry.Messages
+	}
+
+	// Every MessageId the service sends resolves in a served registry.
+	var args struct {
+		NumberOfArgs int `json:"NumberOfArgs"`
+	}
+	for _, msg := range []MessageInfo{
+		newMessage("ResourceMissingAtURI", "/redfish/v1/Bogus"),
+		newOemMessage("HardwareOperationFailed", "write GPIO", "no such file"),
+		{MessageID: resourceEventPrefix + "ResourcePowerStateChanged", MessageArgs: []string{"System.1", "On"}},
+	} {
+		prefix := msg.MessageID[:strings.LastIndex(msg.MessageID, ".")+1]
+		def, ok := served[prefix][strings.TrimPrefix(msg.MessageID, prefix)]
+		if !ok {
+			t.Errorf("Expected %s in a served registry", msg.MessageID)
+			continue
+		}
+		if json.Unmarshal(def, &args); args.NumberOfArgs != len(msg.MessageArgs) {
+			t.Errorf("Expected %s to take %d args, registry says %d", msg.MessageID, len(msg.MessageArgs), args.NumberOfArgs)
+		}
+	}
+
+	if rr := get(registriesPath + "/Base/Base.1.0.0.json"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another registry version, got %d", rr.Code)
+	}
+}
+
+func TestHardwareErrorDetail(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeHardwareError(rr, &HardwareError{Kind: errIOFailure, Op: "write GPIO", Err: errors.New("no such file")}, "ComputerSystem.Reset")
+
+	var body map[string]redfishErrorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	info := body["error"].ExtendedInfo
+	if body["error"].Code != "Base.1.8.InternalError" || len(info) != 2 {
+		t.Fatalf("Expected InternalError with a NanoKVM detail, got %+v", body["error"])
+	}
+	if info[1].MessageID != oemRegistryPrefix+"HardwareOperationFailed" || info[1].Message != "The hardware operation write GPIO failed: no such file." {
+		t.Errorf("Unexpected detail %+v", info[1])
+	}
+}
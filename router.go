@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// router serves each request with the handler registered for the longest
+// prefix of its path, matched a whole segment at a time, so a single entry
+// serves a resource and everything below it. Handlers check the rest of the
+// path themselves and answer 404 for anything they do not implement.
+type router map[string]http.HandlerFunc
+
+func (rt router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for p := r.URL.Path; ; p = path.Dir(p) {
+		if h, ok := rt[p]; ok {
+			h(w, r)
+			return
+		}
+		if p == "/" {
+			break
+		}
+	}
+	writeNotFound(w, r)
+}
+
+// withCanonicalPath cleans the request path before anything else looks at
+// it, so /redfish/v1/Systems/ and /redfish/v1//Systems are served as
+// /redfish/v1/Systems rather than redirected.
+func withCanonicalPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		canonical := path.Clean("/" + r.URL.Path)
+		if canonical == r.URL.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = canonical
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
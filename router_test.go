@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanonicalPaths(t *testing.T) {
+	startFakeHost(t, false)
+	oldConfig, oldAccounts := currentConfig, accountStore
+	defer func() { currentConfig, accountStore = oldConfig, oldAccounts }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	accountStore = nil
+	handler := newHandler()
+
+	tests := []struct {
+		path       string
+		expectCode int
+		expectID   string
+	}{
+		{"/redfish/v1/Systems", http.StatusOK, "/redfish/v1/Systems"},
+		{"/redfish/v1/Systems/", http.StatusOK, "/redfish/v1/Systems"},
+		{"/redfish/v1//Systems", http.StatusOK, "/redfish/v1/Systems"},
+		{"/redfish/v1/Systems/System.1/", http.StatusOK, "/redfish/v1/Systems/System.1"},
+		{"/redfish/v1/Managers/BMC/../../Chassis", http.StatusOK, "/redfish/v1/Chassis"},
+		{"/redfish/v1/", http.StatusOK, "/redfish/v1"},
+		{"/redfish/v1/Bogus", http.StatusNotFound, ""},
+		{"/redfish/v1/$metadata/Bogus", http.StatusNotFound, ""},
+		{"/redfish/v1/Managers/BMC/Actions/Oem/NanoKVM.SetMaintenanceMode/Bogus", http.StatusNotFound, ""},
+		{"/bogus", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.expectCode {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.expectCode, rr.Code)
+			continue
+		}
+		if tt.expectID == "" {
+			continue
+		}
+		var resource map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resource); err != nil {
+			t.Fatal(err)
+		}
+		if resource["@odata.id"] != tt.expectID {
+			t.Errorf("GET %s: expected %s, got %v", tt.path, tt.expectID, resource["@odata.id"])
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The schemas directory holds trimmed copies of the DMTF published JSON
+// schemas for the resource versions this service emits. They keep the
+// DMTF layout ($ref into definitions, annotation patternProperties) so the
+// files can be swapped for the upstream ones without code changes.
+//
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+type SchemaValidationMode string
+
+const (
+	SchemaValidationOff    SchemaValidationMode = "off"
+	SchemaValidationLog    SchemaValidationMode = "log"
+	SchemaValidationStrict SchemaValidationMode = "strict"
+)
+
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 interface{}            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Pattern              string                 `json:"pattern"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	PatternProperties    map[string]*jsonSchema `json:"patternProperties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+}
+
+var (
+	schemaCache   = map[string]*jsonSchema{}
+	schemaCacheMu sync.Mutex
+)
+
+// schemaFileForType maps an @odata.type such as
+// "#ComputerSystem.v1_20_0.ComputerSystem" to its schema file name.
+func schemaFileForType(odataType string) string {
+	odataType = strings.TrimPrefix(odataType, "#")
+	idx := strings.LastIndex(odataType, ".")
+	if idx < 0 {
+		return ""
+	}
+	return odataType[:idx] + ".json"
+}
+
+func loadSchema(name string) (*jsonSchema, error) {
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+
+	if schema, ok := schemaCache[name]; ok {
+		return schema, nil
+	}
+
+	content, err := schemaFS.ReadFile("schemas/" + name)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema jsonSchema
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", name, err)
+	}
+	schemaCache[name] = &schema
+	return &schema, nil
+}
+
+// validatePayload checks a JSON resource against the embedded schema for its
+// @odata.type. Payloads without a type or without a matching schema are not
+// checked.
+func validatePayload(body []byte) ([]string, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("response is not a JSON object: %w", err)
+	}
+
+	odataType, _ := payload["@odata.type"].(string)
+	if odataType == "" {
+		return nil, nil
+	}
+
+	schema, err := loadSchema(schemaFileForType(odataType))
+	if err != nil {
+		return nil, nil
+	}
+
+	v := &schemaValidator{root: schema}
+	v.validate(payload, schema, "")
+	return v.errors, nil
+}
+
+type schemaValidator struct {
+	root   *jsonSchema
+	errors []string
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "/"
+	}
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) resolve(schema *jsonSchema) *jsonSchema {
+	for schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/definitions/")
+		def, ok := v.root.Definitions[name]
+		if !ok {
+			return schema
+		}
+		schema = def
+	}
+	return schema
+}
+
+func (v *schemaValidator) validate(value interface{}, schema *jsonSchema, path string) {
+	schema = v.resolve(schema)
+
+	if len(schema.AnyOf) > 0 {
+		for _, option := range schema.AnyOf {
+			sub := &schemaValidator{root: v.root}
+			sub.validate(value, option, path)
+			if len(sub.errors) == 0 {
+				return
+			}
+		}
+		v.fail(path, "does not match any allowed schema")
+		return
+	}
+
+	if schema.Type != nil && !matchesType(value, schema.Type) {
+		v.fail(path, "expected type %v, got %s", schema.Type, jsonTypeOf(value))
+		return
+	}
+
+	if len(schema.Enum) > 0 && value != nil {
+		found := false
+		for _, allowed := range schema.Enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "value %v is not one of the allowed values", value)
+		}
+	}
+
+	if s, ok := value.(string); ok && schema.Pattern != "" {
+		if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(s) {
+			v.fail(path, "value %q does not match pattern %s", s, schema.Pattern)
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(typed, schema, path)
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range typed {
+				v.validate(item, schema.Items, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(obj map[string]interface{}, schema *jsonSchema, path string) {
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path, "missing required property %s", name)
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := obj[name]
+		propPath := path + "/" + name
+		matched := false
+
+		if prop, ok := schema.Properties[name]; ok {
+			matched = true
+			v.validate(value, prop, propPath)
+		}
+		for pattern, prop := range schema.PatternProperties {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(name) {
+				if !matched {
+					v.validate(value, prop, propPath)
+				}
+				matched = true
+			}
+		}
+
+		if !matched && schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+			v.fail(propPath, "property is not defined in the schema")
+		}
+	}
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if typed == float64(int64(typed)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+func matchesType(value interface{}, schemaType interface{}) bool {
+	actual := jsonTypeOf(value)
+	check := func(t string) bool {
+		return t == actual || (t == "number" && actual == "integer")
+	}
+
+	switch typed := schemaType.(type) {
+	case string:
+		return check(typed)
+	case []interface{}:
+		for _, t := range typed {
+			if s, ok := t.(string); ok && check(s) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponseWriter) WriteHeader(status int) {
+	b.status = status
+}
+
+// withSchemaValidation checks successful JSON responses against the
+// embedded schemas. In log mode mismatches are only logged; in strict mode
+// the response is replaced with a 500 so schema drift is caught in testing.
+func withSchemaValidation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := currentConfig.SchemaValidation
+		if mode != SchemaValidationLog && mode != SchemaValidationStrict {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		if buf.status == http.StatusOK && strings.HasPrefix(buf.header.Get("Content-Type"), "application/json") {
+			problems, err := validatePayload(buf.body.Bytes())
+			if err != nil {
+				problems = []string{err.Error()}
+			}
+			for _, problem := range problems {
+				log.Printf("Schema validation failed for %s %s: %s", r.Method, r.URL.Path, problem)
+			}
+			if len(problems) > 0 && mode == SchemaValidationStrict {
+				writeRedfishError(w, http.StatusInternalServerError, newMessage("InternalError"))
+				return
+			}
+		}
+
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
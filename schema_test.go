@@ -0,0 +1,228 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaFileForType(t *testing.T) {
+	tests := []struct {
+		odataType string
+		expected  string
+	}{
+		{"#ComputerSystem.v1_20_0.ComputerSystem", "ComputerSystem.v1_20_0.json"},
+		{"#ChassisCollection.ChassisCollection", "ChassisCollection.json"},
+		{"NoNamespace", ""},
+	}
+
+	for _, tt := range tests {
+		if got := schemaFileForType(tt.odataType); got != tt.expected {
+			t.Errorf("schemaFileForType(%q) = %q, expected %q", tt.odataType, got, tt.expected)
+		}
+	}
+}
+
+func TestValidatePayload(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectErrors bool
+	}{
+		{
+			name:         "Valid manager",
+			body:         `{"@odata.type": "#Manager.v1_15_0.Manager", "@odata.id": "/redfish/v1/Managers/BMC", "Id": "BMC", "Name": "BMC", "ManagerType": "BMC"}`,
+			expectErrors: false,
+		},
+		{
+			name:         "Missing required property",
+			body:         `{"@odata.type": "#Manager.v1_15_0.Manager", "@odata.id": "/redfish/v1/Managers/BMC", "Name": "BMC"}`,
+			expectErrors: true,
+		},
+		{
+			name:         "Unknown property",
+			body:         `{"@odata.type": "#Manager.v1_15_0.Manager", "@odata.id": "/redfish/v1/Managers/BMC", "Id": "BMC", "Name": "BMC", "Bogus": 1}`,
+			expectErrors: true,
+		},
+		{
+			name:         "Value not in enum",
+			body:         `{"@odata.type": "#Manager.v1_15_0.Manager", "@odata.id": "/redfish/v1/Managers/BMC", "Id": "BMC", "Name": "BMC", "ManagerType": "Toaster"}`,
+			expectErrors: true,
+		},
+		{
+			name:         "Wrong type in nested object",
+			body:         `{"@odata.type": "#Manager.v1_15_0.Manager", "@odata.id": "/redfish/v1/Managers/BMC", "Id": "BMC", "Name": "BMC", "Status": {"Health": 1}}`,
+			expectErrors: true,
+		},
+		{
+			name:         "Annotations are allowed",
+			body:         `{"@odata.type": "#ChassisCollection.ChassisCollection", "@odata.id": "/redfish/v1/Chassis", "Name": "Chassis", "Members": [], "Members@odata.count": 0}`,
+			expectErrors: false,
+		},
+		{
+			name:         "Unknown type is not checked",
+			body:         `{"@odata.type": "#Unknown.v1_0_0.Unknown", "Bogus": 1}`,
+			expectErrors: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := validatePayload([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.expectErrors && len(problems) == 0 {
+				t.Error("Expected validation errors but got none")
+			}
+			if !tt.expectErrors && len(problems) > 0 {
+				t.Errorf("Unexpected validation errors: %v", problems)
+			}
+		})
+	}
+}
+
+// TestResourcesMatchSchemas runs every resource through strict validation so
+// that a field added without a schema update fails here rather than in a
+// client.
+func TestResourcesMatchSchemas(t *testing.T) {
+	currentHardware = &HWAlpha
+
+	tmpDir := t.TempDir()
+	gpioFile := filepath.Join(tmpDir, "gpio_power_led")
+	if err := os.WriteFile(gpioFile, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPath := currentHardware.GPIOPowerLED
+	currentHardware.GPIOPowerLED = gpioFile
+	oldConfig := currentConfig
+	currentConfig.SchemaValidation = SchemaValidationStrict
+	currentConfig.HostInterface.Enabled = true
+	defer func() {
+		currentHardware.GPIOPowerLED = oldPath
+		currentConfig = oldConfig
+	}()
+
+	eventLog.Clear()
+	eventLog.Add("OK", "schema test", "")
+	entryPath := eventLog.Entries()[0].ODataID
+
+	account, err := setupAccountStore(t).Create("admin", "password", "Administrator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := setupEventService(t).Create(EventSubscription{
+		Destination: "http://127.0.0.1:9/events",
+		Protocol:    "Redfish",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := setupSessionStore(t).Create(&Principal{Username: "admin", RoleID: "Administrator", Backend: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setupLUN(t)
+	setupAuditTrail(t)
+	auditTrail.Record(AuditRecord{Client: "10.0.0.7", Method: "PATCH", Path: "/redfish/v1/Systems/System.1", StatusCode: http.StatusNoContent})
+	auditEntryPath := auditLog.Entries()[0].ODataID
+
+	task := setupTaskStore(t).Start("Schema test", func(task *task) {
+		task.Finish(http.StatusNoContent, nil)
+	})
+	waitFor(t, "task", func() bool { return task.resource().TaskState == "Completed" })
+
+	handler := newHandler()
+	paths := []string{
+		"/redfish/v1",
+		"/redfish/v1/Systems",
+		"/redfish/v1/Systems/System.1",
+		"/redfish/v1/Managers",
+		"/redfish/v1/Managers/BMC",
+		"/redfish/v1/Chassis",
+		"/redfish/v1/Chassis/System",
+		logServicesPath,
+		logServicesPath + "/Log",
+		logServicesPath + "/Log/Entries",
+		entryPath,
+		logServicesPath + "/Audit",
+		logServicesPath + "/Audit/Entries",
+		auditEntryPath,
+		accountServicePath,
+		accountServicePath + "/Accounts",
+		accountPath(account.ID),
+		accountServicePath + "/Roles",
+		accountServicePath + "/Roles/Operator",
+		eventServicePath,
+		eventServicePath + "/Subscriptions",
+		subscriptionPath(sub.ID),
+		sessionServicePath,
+		sessionServicePath + "/Sessions",
+		sessionPath(session.ID),
+		hostInterfacesPath,
+		hostInterfacesPath + "/1",
+		virtualMediaPath,
+		virtualMediaPath + "/CD1",
+		taskServicePath,
+		taskServicePath + "/Tasks",
+		taskPath(task.id),
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			problems, err := validatePayload(rr.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) > 0 {
+				t.Errorf("Schema validation failed: %v", problems)
+			}
+		})
+	}
+}
+
+func TestSchemaValidationStrictMode(t *testing.T) {
+	oldConfig := currentConfig
+	currentConfig.SchemaValidation = SchemaValidationStrict
+	defer func() { currentConfig = oldConfig }()
+
+	drifted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"@odata.type": "#Manager.v1_15_0.Manager", "@odata.id": "/redfish/v1/Managers/BMC", "Id": "BMC", "Name": "BMC", "NewField": true}`))
+	})
+
+	req, err := http.NewRequest("GET", "/redfish/v1/Managers/BMC", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	withSchemaValidation(drifted).ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d in strict mode, got %d", http.StatusInternalServerError, rr.Code)
+	}
+
+	currentConfig.SchemaValidation = SchemaValidationLog
+	rr = httptest.NewRecorder()
+	withSchemaValidation(drifted).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d in log mode, got %d", http.StatusOK, rr.Code)
+	}
+}
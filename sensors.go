@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const sensorsPath = "/redfish/v1/Chassis/System/Sensors"
+
+// sensorReading is one reading of a chassis sensor. Thresholds holds the
+// Redfish Thresholds by name, e.g. "UpperCritical", as plain readings.
+type sensorReading struct {
+	Reading    float64
+	Thresholds map[string]float64
+}
+
+// chassisSensor describes a sensor listed under the chassis. present
+// reports whether this device has it at all; read takes a reading.
+type chassisSensor struct {
+	ID              string
+	Name            string
+	ReadingType     string
+	ReadingUnits    string
+	PhysicalContext string
+	present         func() bool
+	read            func() (sensorReading, error)
+}
+
+var chassisSensors = []chassisSensor{
+	{
+		ID:              "SoCTemp",
+		Name:            "NanoKVM SoC Temperature",
+		ReadingType:     "Temperature",
+		ReadingUnits:    "Cel",
+		PhysicalContext: "ManagementSubsystem",
+		present:         socThermalZonePresent,
+		read:            readSoCTemperature,
+	},
+	{
+		ID:              "HostVoltage",
+		Name:            "Host Supply Voltage",
+		ReadingType:     "Voltage",
+		ReadingUnits:    "V",
+		PhysicalContext: "PowerSupply",
+		present:         powerMeterPresent,
+		read:            powerMeterSensor(func(m powerMeasurement) float64 { return m.Volts }),
+	},
+	{
+		ID:              "HostCurrent",
+		Name:            "Host Supply Current",
+		ReadingType:     "Current",
+		ReadingUnits:    "A",
+		PhysicalContext: "PowerSupply",
+		present:         powerMeterPresent,
+		read:            powerMeterSensor(func(m powerMeasurement) float64 { return m.Amps }),
+	},
+	{
+		ID:              "HostPower",
+		Name:            "Host Power Consumption",
+		ReadingType:     "Power",
+		ReadingUnits:    "W",
+		PhysicalContext: "PowerSupply",
+		present:         powerMeterPresent,
+		read:            powerMeterSensor(func(m powerMeasurement) float64 { return m.Watts }),
+	},
+}
+
+// presentSensors returns the sensors this device has.
+func presentSensors() []chassisSensor {
+	var sensors []chassisSensor
+	for _, s := range chassisSensors {
+		if s.present() {
+			sensors = append(sensors, s)
+		}
+	}
+	return sensors
+}
+
+// sensorHealth rates a reading against its upper thresholds.
+func sensorHealth(r sensorReading) string {
+	if limit, ok := r.Thresholds["UpperCritical"]; ok && r.Reading >= limit {
+		return "Critical"
+	}
+	if limit, ok := r.Thresholds["UpperCaution"]; ok && r.Reading >= limit {
+		return "Warning"
+	}
+	return "OK"
+}
+
+func handleSensors(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, sensorsPath), "/")
+	if id == "" {
+		handleSensorCollection(w, r)
+		return
+	}
+	for _, s := range presentSensors() {
+		if s.ID == id {
+			handleSensor(w, r, s)
+			return
+		}
+	}
+	writeNotFound(w, r)
+}
+
+func handleSensorCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	for _, s := range presentSensors() {
+		members = append(members, map[string]string{"@odata.id": sensorsPath + "/" + s.ID})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#SensorCollection.SensorCollection",
+		ODataID:   sensorsPath,
+		Name:      "Sensor Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleSensor(w http.ResponseWriter, r *http.Request, s chassisSensor) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	sensor := map[string]interface{}{
+		"@odata.type":     odataType("Sensor"),
+		"@odata.id":       sensorsPath + "/" + s.ID,
+		"Id":              s.ID,
+		"Name":            s.Name,
+		"ReadingType":     s.ReadingType,
+		"ReadingUnits":    s.ReadingUnits,
+		"PhysicalContext": s.PhysicalContext,
+		"Reading":         nil,
+	}
+	reading, err := s.read()
+	if err != nil {
+		log.Printf("Failed to read sensor %s: %v", s.ID, err)
+		sensor["Status"] = map[string]string{"State": "Enabled", "Health": "Warning"}
+	} else {
+		sensor["Reading"] = reading.Reading
+		sensor["Status"] = map[string]string{"State": "Enabled", "Health": sensorHealth(reading)}
+		if len(reading.Thresholds) > 0 {
+			thresholds := map[string]interface{}{}
+			for name, value := range reading.Thresholds {
+				thresholds[name] = map[string]float64{"Reading": value}
+			}
+			sensor["Thresholds"] = thresholds
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sensor)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSoCTemperatureSensor(t *testing.T) {
+	zone := t.TempDir()
+	for name, value := range map[string]string{
+		"temp":              "52345",
+		"trip_point_0_type": "active",
+		"trip_point_0_temp": "60000",
+		"trip_point_1_type": "passive",
+		"trip_point_1_temp": "85000",
+		"trip_point_2_type": "critical",
+		"trip_point_2_temp": "100000",
+	} {
+		os.WriteFile(filepath.Join(zone, name), []byte(value+"\n"), 0644)
+	}
+	oldConfig := currentConfig
+	defer func() { currentConfig = oldConfig }()
+
+	get := func(path string, into interface{}) int {
+		rr := httptest.NewRecorder()
+		handleSensors(rr, httptest.NewRequest("GET", path, nil))
+		if into != nil {
+			json.Unmarshal(rr.Body.Bytes(), into)
+		}
+		return rr.Code
+	}
+
+	currentConfig.SoCThermalZone = filepath.Join(zone, "missing")
+	var collection SystemCollection
+	get(sensorsPath, &collection)
+	if len(collection.Members) != 0 {
+		t.Errorf("Expected no sensors without a thermal zone, got %v", collection.Members)
+	}
+	if code := get(sensorsPath+"/SoCTemp", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a thermal zone, got %d", code)
+	}
+
+	currentConfig.SoCThermalZone = zone
+	get(sensorsPath, &collection)
+	if len(collection.Members) != 1 || collection.Members[0]["@odata.id"] != sensorsPath+"/SoCTemp" {
+		t.Errorf("Expected the SoC temperature listed, got %v", collection.Members)
+	}
+
+	var sensor struct {
+		Reading      float64
+		ReadingUnits string
+		Thresholds   map[string]struct{ Reading float64 }
+		Status       map[string]string
+	}
+	get(sensorsPath+"/SoCTemp", &sensor)
+	if sensor.Reading != 52.345 || sensor.ReadingUnits != "Cel" || sensor.Status["Health"] != "OK" {
+		t.Errorf("Expected 52.345 Cel and OK, got %+v", sensor)
+	}
+	if len(sensor.Thresholds) != 2 || sensor.Thresholds["UpperCaution"].Reading != 85 || sensor.Thresholds["UpperCritical"].Reading != 100 {
+		t.Errorf("Expected the passive and critical trip points as thresholds, got %v", sensor.Thresholds)
+	}
+
+	os.WriteFile(filepath.Join(zone, "temp"), []byte("91000\n"), 0644)
+	get(sensorsPath+"/SoCTemp", &sensor)
+	if sensor.Status["Health"] != "Warning" {
+		t.Errorf("Expected Warning past the passive trip point, got %v", sensor.Status)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var machineIDFile = "/etc/machine-id"
+
+// currentServiceUUID identifies this service in the service root, the
+// manager and the SMBIOS Type 42 record. loadServiceUUID sets it.
+var currentServiceUUID string
+
+// loadServiceUUID reads the service UUID from path, creating it on first
+// boot so aggregators see the same UUID across restarts. A new UUID is
+// derived from the machine ID, which keeps the ServiceUUID earlier
+// releases put in the SMBIOS record, or is random when there is none.
+// An empty path keeps the UUID in memory only.
+func loadServiceUUID(path string) error {
+	content, err := os.ReadFile(path)
+	if path != "" && err == nil {
+		id := strings.TrimSpace(string(content))
+		if !isUUID(id) {
+			return fmt.Errorf("%s: invalid UUID %q", path, id)
+		}
+		currentServiceUUID = id
+		return nil
+	}
+	if path != "" && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	id, ok := machineUUID()
+	if !ok {
+		if id, err = randomUUID(); err != nil {
+			return err
+		}
+	}
+	if path != "" {
+		if err := writeFileAtomic(path, []byte(id+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	currentServiceUUID = id
+	return nil
+}
+
+// serviceUUID returns the UUID loaded at startup, falling back to the
+// machine ID before it is loaded.
+func serviceUUID() string {
+	if currentServiceUUID != "" {
+		return currentServiceUUID
+	}
+	if id, ok := machineUUID(); ok {
+		return id
+	}
+	return "00000000-0000-0000-0000-000000000000"
+}
+
+// machineUUID formats the machine ID as a UUID.
+func machineUUID() (string, bool) {
+	content, err := os.ReadFile(machineIDFile)
+	id := strings.TrimSpace(string(content))
+	if err != nil || len(id) != 32 {
+		return "", false
+	}
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:32], true
+}
+
+// randomUUID returns a version 4 UUID.
+func randomUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func isUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, c := range id {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case !strings.ContainsRune("0123456789abcdefABCDEF", c):
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupServiceUUID(t *testing.T, machineID string) string {
+	dir := t.TempDir()
+	oldMachineID, oldUUID := machineIDFile, currentServiceUUID
+	t.Cleanup(func() { machineIDFile, currentServiceUUID = oldMachineID, oldUUID })
+	machineIDFile = filepath.Join(dir, "machine-id")
+	if machineID != "" {
+		if err := os.WriteFile(machineIDFile, []byte(machineID+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "state", "uuid")
+}
+
+func TestLoadServiceUUID(t *testing.T) {
+	path := setupServiceUUID(t, "0123456789abcdef0123456789abcdef")
+	if err := loadServiceUUID(path); err != nil {
+		t.Fatal(err)
+	}
+	if serviceUUID() != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Errorf("Expected the first UUID from the machine ID, got %s", serviceUUID())
+	}
+
+	// A new machine ID, as after reflashing, does not change a saved UUID.
+	os.WriteFile(machineIDFile, []byte("fedcba9876543210fedcba9876543210\n"), 0644)
+	if err := loadServiceUUID(path); err != nil {
+		t.Fatal(err)
+	}
+	if serviceUUID() != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Errorf("Expected the saved UUID, got %s", serviceUUID())
+	}
+
+	os.WriteFile(path, []byte("not-a-uuid\n"), 0644)
+	if err := loadServiceUUID(path); err == nil {
+		t.Error("Expected an invalid UUID file to fail")
+	}
+}
+
+func TestLoadServiceUUIDWithoutMachineID(t *testing.T) {
+	path := setupServiceUUID(t, "")
+	if err := loadServiceUUID(path); err != nil {
+		t.Fatal(err)
+	}
+	id := serviceUUID()
+	if !isUUID(id) || id[14] != '4' {
+		t.Fatalf("Expected a random version 4 UUID, got %s", id)
+	}
+
+	currentServiceUUID = ""
+	if err := loadServiceUUID(path); err != nil {
+		t.Fatal(err)
+	}
+	if serviceUUID() != id {
+		t.Errorf("Expected %s again after a restart, got %s", id, serviceUUID())
+	}
+}
+
+func TestServiceUUIDResources(t *testing.T) {
+	setupServiceUUID(t, "")
+	if err := loadServiceUUID(""); err != nil {
+		t.Fatal(err)
+	}
+
+	var root, manager map[string]interface{}
+	rr := httptest.NewRecorder()
+	handleServiceRoot(rr, httptest.NewRequest("GET", "/redfish/v1", nil))
+	json.Unmarshal(rr.Body.Bytes(), &root)
+	rr = httptest.NewRecorder()
+	handleManager(rr, httptest.NewRequest("GET", "/redfish/v1/Managers/BMC", nil))
+	json.Unmarshal(rr.Body.Bytes(), &manager)
+
+	id := serviceUUID()
+	if root["UUID"] != id || manager["UUID"] != id || manager["ServiceEntryPointUUID"] != id {
+		t.Errorf("Expected %s throughout, got root %v, manager %v and entry point %v", id, root["UUID"], manager["UUID"], manager["ServiceEntryPointUUID"])
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Session is a login created through the SessionService. Clients present
+// Token in the X-Auth-Token header instead of sending credentials on every
+// request.
+type Session struct {
+	ID       string
+	Token    string
+	Username string
+	RoleID   string
+	Backend  string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+// SessionStore keeps sessions in memory; a daemon restart logs everyone out.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	nextID   int
+}
+
+var sessionStore = newSessionStore()
+
+func newSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions: map[string]*Session{},
+		nextID:   1,
+	}
+}
+
+// expired reports whether the session has been idle too long or has
+// outlived its absolute lifetime. A zero MaxLifetime means no limit.
+func (s *Session) expired(now time.Time) bool {
+	cfg := currentConfig.Sessions
+	if now.Sub(s.LastUsed) >= time.Duration(cfg.IdleTimeout)*time.Second {
+		return true
+	}
+	return cfg.MaxLifetime > 0 && now.Sub(s.Created) >= time.Duration(cfg.MaxLifetime)*time.Second
+}
+
+func (ss *SessionStore) Create(p *Principal) (Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return Session{}, err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := timeNow()
+	session := &Session{
+		ID:       strconv.Itoa(ss.nextID),
+		Token:    hex.EncodeToString(buf),
+		Username: p.Username,
+		RoleID:   p.RoleID,
+		Backend:  p.Backend,
+		Created:  now,
+		LastUsed: now,
+	}
+	ss.nextID++
+	ss.sessions[session.ID] = session
+	return *session, nil
+}
+
+// Lookup finds the live session for token and marks it as used. Expired
+// sessions are removed on the spot rather than waiting for the reaper.
+func (ss *SessionStore) Lookup(token string) (Session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := timeNow()
+	for id, session := range ss.sessions {
+		if session.Token != token {
+			continue
+		}
+		if session.expired(now) {
+			delete(ss.sessions, id)
+			log.Printf("Session %s for %s expired", id, session.Username)
+			return Session{}, false
+		}
+		session.LastUsed = now
+		return *session, true
+	}
+	return Session{}, false
+}
+
+func (ss *SessionStore) Get(id string) (Session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	session, ok := ss.sessions[id]
+	if !ok || session.expired(timeNow()) {
+		return Session{}, false
+	}
+	return *session, true
+}
+
+func (ss *SessionStore) List() []Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := timeNow()
+	var result []Session
+	for _, session := range ss.sessions {
+		if !session.expired(now) {
+			result = append(result, *session)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, _ := strconv.Atoi(result[i].ID)
+		b, _ := strconv.Atoi(result[j].ID)
+		return a < b
+	})
+	return result
+}
+
+func (ss *SessionStore) Delete(id string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.sessions[id]; !ok {
+		return false
+	}
+	delete(ss.sessions, id)
+	return true
+}
+
+// Reap removes every expired session and returns how many were removed.
+func (ss *SessionStore) Reap() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := timeNow()
+	removed := 0
+	for id, session := range ss.sessions {
+		if session.expired(now) {
+			delete(ss.sessions, id)
+			log.Printf("Session %s for %s expired", id, session.Username)
+			removed++
+		}
+	}
+	return removed
+}
+
+// reapLoop calls Reap every interval until stop is closed.
+func (ss *SessionStore) reapLoop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ss.Reap()
+		case <-stop:
+			return
+		}
+	}
+}
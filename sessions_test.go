@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func setupSessionStore(t *testing.T) *SessionStore {
+	t.Helper()
+
+	old := sessionStore
+	sessionStore = newSessionStore()
+	t.Cleanup(func() { sessionStore = old })
+	return sessionStore
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store := setupSessionStore(t)
+
+	oldConfig := currentConfig
+	currentConfig.Sessions.IdleTimeout = 60
+	currentConfig.Sessions.MaxLifetime = 300
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+	defer func() {
+		currentConfig = oldConfig
+		timeNow = time.Now
+	}()
+
+	session, err := store.Create(&Principal{Username: "admin", RoleID: "Administrator", Backend: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Regular use keeps the session alive past the idle timeout...
+	for i := 0; i < 4; i++ {
+		clock = clock.Add(50 * time.Second)
+		if _, ok := store.Lookup(session.Token); !ok {
+			t.Fatalf("Session expired after %d active intervals", i+1)
+		}
+	}
+
+	// ...but not past its absolute lifetime.
+	clock = clock.Add(50 * time.Second)
+	if _, ok := store.Lookup(session.Token); !ok {
+		t.Fatal("Session expired before its lifetime")
+	}
+	clock = clock.Add(50 * time.Second)
+	if _, ok := store.Lookup(session.Token); ok {
+		t.Error("Expected session to expire after its lifetime")
+	}
+
+	idle, err := store.Create(&Principal{Username: "viewer", RoleID: "ReadOnly", Backend: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(59 * time.Second)
+	if removed := store.Reap(); removed != 0 {
+		t.Errorf("Expected no sessions reaped, got %d", removed)
+	}
+	clock = clock.Add(time.Second)
+	if removed := store.Reap(); removed != 1 {
+		t.Errorf("Expected idle session to be reaped, got %d", removed)
+	}
+	if _, ok := store.Get(idle.ID); ok {
+		t.Error("Expected reaped session to be gone")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const sessionServicePath = "/redfish/v1/SessionService"
+
+type SessionResource struct {
+	ODataType   string  `json:"@odata.type"`
+	ODataID     string  `json:"@odata.id"`
+	ID          string  `json:"Id"`
+	Name        string  `json:"Name"`
+	UserName    string  `json:"UserName"`
+	Password    *string `json:"Password"`
+	SessionType string  `json:"SessionType"`
+}
+
+type SessionRequest struct {
+	UserName *string `json:"UserName"`
+	Password *string `json:"Password"`
+}
+
+func sessionPath(id string) string {
+	return sessionServicePath + "/Sessions/" + id
+}
+
+func toSessionResource(session Session) SessionResource {
+	return SessionResource{
+		ODataType:   odataType("Session"),
+		ODataID:     sessionPath(session.ID),
+		ID:          session.ID,
+		Name:        "User Session",
+		UserName:    session.Username,
+		SessionType: "Redfish",
+	}
+}
+
+// isSessionLogin reports whether r is a login request, which has to be
+// reachable before the client holds any credentials the service accepts.
+func isSessionLogin(r *http.Request) bool {
+	return r.Method == http.MethodPost && r.URL.Path == sessionServicePath+"/Sessions"
+}
+
+func handleSessionService(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, sessionServicePath), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "":
+		handleSessionServiceRoot(w, r)
+	case len(parts) == 1 && parts[0] == "Sessions":
+		handleSessions(w, r)
+	case len(parts) == 2 && parts[0] == "Sessions":
+		handleSession(w, r, parts[1])
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleSessionServiceRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	service := map[string]interface{}{
+		"@odata.type":    odataType("SessionService"),
+		"@odata.id":      sessionServicePath,
+		"Id":             "SessionService",
+		"Name":           "Session Service",
+		"ServiceEnabled": len(authBackends()) > 0,
+		"SessionTimeout": currentConfig.Sessions.IdleTimeout,
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+		"Sessions": map[string]string{
+			"@odata.id": sessionServicePath + "/Sessions",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service)
+}
+
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sessions := sessionStore.List()
+		ids := make([]string, len(sessions))
+		for i, session := range sessions {
+			ids[i] = sessionPath(session.ID)
+		}
+		members, ok := filterMembers(w, r, ids, func(i int) interface{} { return toSessionResource(sessions[i]) })
+		if !ok {
+			return
+		}
+
+		collection := SystemCollection{
+			ODataType:                 "#SessionCollection.SessionCollection",
+			ODataID:                   sessionServicePath + "/Sessions",
+			Name:                      "Session Collection",
+			Members:                   members,
+			OperationApplyTimeSupport: immediateApplyTime(),
+		}
+
+		writeCollection(w, r, collection)
+	case http.MethodPost:
+		handleSessionsPost(w, r)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "POST")
+	}
+}
+
+func handleSessionsPost(w http.ResponseWriter, r *http.Request) {
+	if len(authBackends()) == 0 {
+		writeServiceNotEnabled(w, "SessionService")
+		return
+	}
+
+	var req SessionRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if req.UserName == nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyMissing", "UserName").withProperty("#/UserName"))
+		return
+	}
+	if req.Password == nil {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyMissing", "Password").withProperty("#/Password"))
+		return
+	}
+
+	principal, ok := authenticatePassword(*req.UserName, *req.Password)
+	if !ok {
+		writeUnauthorized(w)
+		return
+	}
+
+	session, err := sessionStore.Create(principal)
+	if err != nil {
+		writeInternalError(w, "create session", err)
+		return
+	}
+	log.Printf("Created session %s for %s", session.ID, session.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", sessionPath(session.ID))
+	w.Header().Set("X-Auth-Token", session.Token)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toSessionResource(session))
+}
+
+func handleSession(w http.ResponseWriter, r *http.Request, id string) {
+	session, ok := sessionStore.Get(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toSessionResource(session))
+	case http.MethodDelete:
+		// Anyone may log themselves out; ending someone else's session
+		// is a manager configuration change.
+		if p := principalFromRequest(r); p != nil && p.Username != session.Username &&
+			!p.HasPrivilege(PrivilegeConfigureManager) {
+			writeInsufficientPrivilege(w)
+			return
+		}
+		sessionStore.Delete(session.ID)
+		log.Printf("Deleted session %s for %s", session.ID, session.Username)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "DELETE")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionLogin(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("admin", "admin-password", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("viewer", "viewer-password", "ReadOnly", true); err != nil {
+		t.Fatal(err)
+	}
+	setupSessionStore(t)
+
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	defer func() { currentConfig = oldConfig }()
+
+	handler := newHandler()
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body := `{"UserName": "` + username + `", "Password": "` + password + `"}`
+		req, err := http.NewRequest("POST", sessionServicePath+"/Sessions", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := login("admin", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for bad password, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr := login("admin", "admin-password")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	adminToken := rr.Header().Get("X-Auth-Token")
+	adminSession := rr.Header().Get("Location")
+	if adminToken == "" || adminSession == "" {
+		t.Fatal("Expected X-Auth-Token and Location headers")
+	}
+
+	rr = login("viewer", "viewer-password")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	viewerToken := rr.Header().Get("X-Auth-Token")
+	viewerSession := rr.Header().Get("Location")
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		expectCode int
+	}{
+		{"Token grants access", adminToken, "GET", "/redfish/v1/Systems", http.StatusOK},
+		{"Unknown token", "bogus", "GET", "/redfish/v1/Systems", http.StatusUnauthorized},
+		{"Session collection", viewerToken, "GET", sessionServicePath + "/Sessions", http.StatusOK},
+		{"Cannot end another user's session", viewerToken, "DELETE", adminSession, http.StatusForbidden},
+		{"Log out", viewerToken, "DELETE", viewerSession, http.StatusNoContent},
+		{"Token is gone after logout", viewerToken, "GET", "/redfish/v1/Systems", http.StatusUnauthorized},
+		{"Administrator can end any session", adminToken, "DELETE", adminSession, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Auth-Token", tt.token)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestExpiredSessionUnauthorized(t *testing.T) {
+	store := setupAccountStore(t)
+	if _, err := store.Create("admin", "admin-password", "Administrator", true); err != nil {
+		t.Fatal(err)
+	}
+	sessions := setupSessionStore(t)
+
+	oldConfig := currentConfig
+	currentConfig.RequireAuth = true
+	currentConfig.Sessions.IdleTimeout = 60
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+	defer func() {
+		currentConfig = oldConfig
+		timeNow = time.Now
+	}()
+
+	session, err := sessions.Create(&Principal{Username: "admin", RoleID: "Administrator", Backend: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(61 * time.Second)
+
+	req, err := http.NewRequest("GET", "/redfish/v1/Systems", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Auth-Token", session.Token)
+	rr := httptest.NewRecorder()
+	newHandler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// settingsApplyTimes are the @Redfish.SettingsApplyTime values a Settings
+// object accepts. OnReset, the default, waits for the next
+// ComputerSystem.Reset that starts the host; Immediate applies the staged
+// settings straight away, as a PATCH of the system itself does.
+var settingsApplyTimes = []string{"OnReset", "Immediate"}
+
+// Settings is the @Redfish.Settings annotation of a ComputerSystem. It
+// points clients at the Settings object where changes for the next reset
+// are staged, and reports when staged changes last took effect.
+type Settings struct {
+	ODataType           string        `json:"@odata.type"`
+	SettingsObject      Link          `json:"SettingsObject"`
+	SupportedApplyTimes []string      `json:"SupportedApplyTimes"`
+	Time                string        `json:"Time,omitempty"`
+	ETag                string        `json:"ETag,omitempty"`
+	Messages            []MessageInfo `json:"Messages,omitempty"`
+}
+
+// PreferredApplyTime is the @Redfish.SettingsApplyTime annotation.
+type PreferredApplyTime struct {
+	ODataType                string   `json:"@odata.type,omitempty"`
+	ApplyTime                string   `json:"ApplyTime,omitempty"`
+	ApplyTimeAllowableValues []string `json:"ApplyTime@Redfish.AllowableValues,omitempty"`
+}
+
+type SettingsPatchRequest struct {
+	Boot              *Boot               `json:"Boot,omitempty"`
+	SettingsApplyTime *PreferredApplyTime `json:"@Redfish.SettingsApplyTime,omitempty"`
+}
+
+// settingsState is a system's Settings object: the Boot settings staged
+// for the next reset, if any, and the outcome of the last time staged
+// settings were applied.
+type settingsState struct {
+	pending  *Boot
+	applied  string
+	etag     string
+	messages []MessageInfo
+}
+
+func (s *hostSystem) settingsPath() string {
+	return s.path() + "/Settings"
+}
+
+func (s *hostSystem) settingsAnnotation() *Settings {
+	return &Settings{
+		ODataType:           odataTypeOf("Settings", "Settings"),
+		SettingsObject:      Link{ODataID: s.settingsPath()},
+		SupportedApplyTimes: settingsApplyTimes,
+		Time:                s.settings.applied,
+		ETag:                s.settings.etag,
+		Messages:            s.settings.messages,
+	}
+}
+
+// pendingBoot returns the Boot settings the system will have after the
+// next reset that starts it.
+func (s *hostSystem) pendingBoot() Boot {
+	if s.settings.pending != nil {
+		return *s.settings.pending
+	}
+	return *s.boot
+}
+
+// stageSettings keeps next on the Settings object until the next reset.
+func (s *hostSystem) stageSettings(next Boot) error {
+	previous := s.settings.pending
+	s.settings.pending = &next
+	if err := s.saveBootState(); err != nil {
+		s.settings.pending = previous
+		return err
+	}
+	emitEvent("OK", fmt.Sprintf("Boot override to %s (%s) staged for the next reset",
+		next.BootSourceOverrideTarget, next.BootSourceOverrideEnabled),
+		resourceEventPrefix+"ResourceChanged", s.settingsPath())
+	return nil
+}
+
+// applySettings makes next the system's Boot settings, drops whatever was
+// staged and records the outcome for @Redfish.Settings.
+func (s *hostSystem) applySettings(next Boot) error {
+	previous := s.settings.pending
+	s.settings.pending = nil
+	if err := s.setBoot(next); err != nil {
+		s.settings.pending = previous
+		return err
+	}
+	s.settings.applied = newTimestamp().String()
+	s.settings.etag = systemETag(s)
+	s.settings.messages = []MessageInfo{newMessage("Success")}
+	return nil
+}
+
+func systemSettingsResource(s *hostSystem) map[string]interface{} {
+	return map[string]interface{}{
+		"@odata.type": odataType("ComputerSystem"),
+		"@odata.id":   s.settingsPath(),
+		"Id":          "Settings",
+		"Name":        s.Name + " Pending Settings",
+		"Boot":        s.pendingBoot(),
+		"@Redfish.SettingsApplyTime": PreferredApplyTime{
+			ODataType:                odataTypeOf("Settings", "PreferredApplyTime"),
+			ApplyTime:                "OnReset",
+			ApplyTimeAllowableValues: settingsApplyTimes,
+		},
+	}
+}
+
+// handleSystemSettings serves the Settings object of a system, where Boot
+// changes are staged to take effect on the next reset, the way BMCs stage
+// changes that the host firmware only picks up when it boots.
+func handleSystemSettings(w http.ResponseWriter, r *http.Request, s *hostSystem) {
+	switch r.Method {
+	case http.MethodGet:
+		handleSystemSettingsGet(w, r, s)
+	case http.MethodPatch:
+		handleSystemSettingsPatch(w, r, s)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
+	}
+}
+
+func handleSystemSettingsGet(w http.ResponseWriter, r *http.Request, s *hostSystem) {
+	settings := systemSettingsResource(s)
+	etag := resourceETag(settings)
+	if notModified(w, r, etag) {
+		return
+	}
+	settings["@odata.etag"] = etag
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(settings)
+}
+
+func handleSystemSettingsPatch(w http.ResponseWriter, r *http.Request, s *hostSystem) {
+	var req SettingsPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+
+	applyTime := "OnReset"
+	if req.SettingsApplyTime != nil && req.SettingsApplyTime.ApplyTime != "" {
+		applyTime = req.SettingsApplyTime.ApplyTime
+	}
+	if !containsString(settingsApplyTimes, applyTime) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueNotInList", applyTime, "ApplyTime").
+				withProperty("#/@Redfish.SettingsApplyTime/ApplyTime"))
+		return
+	}
+	if !checkPreconditions(w, r, resourceETag(systemSettingsResource(s)), false) {
+		return
+	}
+	get := func(w http.ResponseWriter, r *http.Request) { handleSystemSettingsGet(w, r, s) }
+	ignored, ok := checkPatchProperties(w, r, body, &req, get)
+	if !ok {
+		return
+	}
+
+	next := s.pendingBoot()
+	if req.Boot != nil {
+		if next, ok = mergeBootPatch(w, next, req.Boot); !ok {
+			return
+		}
+	}
+	// An Immediate PATCH with no Boot applies what was staged before.
+	switch {
+	case applyTime == "Immediate" && (req.Boot != nil || s.settings.pending != nil):
+		err = s.applySettings(next)
+	case applyTime == "OnReset" && req.Boot != nil:
+		err = s.stageSettings(next)
+	}
+	if err != nil {
+		writeInternalError(w, "save boot settings", err)
+		return
+	}
+
+	writePatchResult(w, r, ignored, get)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSystemSettings(t *testing.T) {
+	host := newHostSystem(SystemConfig{ID: "Host2"})
+	host.backend = newMockBackend(true)
+	stateFile := filepath.Join(t.TempDir(), "boot.json")
+	if err := host.loadBootState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		if path == host.settingsPath() {
+			handleSystemSettings(rr, req, host)
+		} else {
+			handleReset(rr, req, host)
+		}
+		return rr
+	}
+	pending := func() Boot {
+		t.Helper()
+		rr := do("GET", host.settingsPath(), "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var settings struct{ Boot Boot }
+		json.Unmarshal(rr.Body.Bytes(), &settings)
+		return settings.Boot
+	}
+
+	rr := do("PATCH", host.settingsPath(), `{"Boot": {"BootSourceOverrideEnabled": "Continuous", "BootSourceOverrideTarget": "Pxe"}}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if host.boot.BootSourceOverrideTarget != "None" {
+		t.Errorf("Expected the override to wait for a reset, got %s", host.boot.BootSourceOverrideTarget)
+	}
+	if got := pending(); got.BootSourceOverrideEnabled != "Continuous" || got.BootSourceOverrideTarget != "Pxe" {
+		t.Errorf("Expected Continuous/Pxe pending, got %s/%s", got.BootSourceOverrideEnabled, got.BootSourceOverrideTarget)
+	}
+
+	// The staged settings survive a restart.
+	restarted := newHostSystem(SystemConfig{ID: "Host2"})
+	if err := restarted.loadBootState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.settings.pending == nil || restarted.settings.pending.BootSourceOverrideTarget != "Pxe" {
+		t.Errorf("Expected the pending override restored, got %+v", restarted.settings.pending)
+	}
+
+	rr = do("PATCH", host.settingsPath(), `{"@Redfish.SettingsApplyTime": {"ApplyTime": "AtMaintenanceWindowStart"}}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsupported apply time, got %d", rr.Code)
+	}
+
+	rr = do("POST", host.path()+"/Actions/ComputerSystem.Reset", `{"ResetType": "ForceRestart"}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if host.boot.BootSourceOverrideEnabled != "Continuous" || host.boot.BootSourceOverrideTarget != "Pxe" {
+		t.Errorf("Expected the reset to apply Continuous/Pxe, got %s/%s",
+			host.boot.BootSourceOverrideEnabled, host.boot.BootSourceOverrideTarget)
+	}
+	annotation := host.settingsAnnotation()
+	if host.settings.pending != nil || annotation.Time == "" || annotation.ETag != systemETag(host) {
+		t.Errorf("Expected the settings recorded as applied, got %+v", annotation)
+	}
+
+	rr = do("PATCH", host.settingsPath(), `{"Boot": {"BootSourceOverrideTarget": "Hdd"},
+		"@Redfish.SettingsApplyTime": {"ApplyTime": "Immediate"}}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if host.boot.BootSourceOverrideTarget != "Hdd" || host.settings.pending != nil {
+		t.Errorf("Expected Hdd applied straight away, got %s", host.boot.BootSourceOverrideTarget)
+	}
+}
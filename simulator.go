@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// simulatedHardware is the board in -mock mode. Its host is a MockBackend
+// and boot override keystrokes go nowhere.
+var simulatedHardware = Hardware{
+	Version:     HWVersionSimulated,
+	HIDKeyboard: os.DevNull,
+}
+
+// simulateDevice points cfg at a stand-in for the NanoKVM under dir, so the
+// whole API can run on a development machine or in CI: the USB mass
+// storage LUN is a directory of plain files, local images are read from
+// its "local" subdirectory, the auxiliary GPIOs and intrusion switch are
+// plain files in its "gpio" subdirectory, and the state files are kept
+// there too rather than in the device's system directories. The device's
+// own sensors are left out.
+func simulateDevice(cfg *Config, dir string) error {
+	lunDir, localDir, gpioDir := filepath.Join(dir, "lun.0"), filepath.Join(dir, "local"), filepath.Join(dir, "gpio")
+	for _, d := range []string{lunDir, localDir, gpioDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	for name, value := range map[string]string{"file": "\n", "cdrom": "0\n", "ro": "0\n"} {
+		if err := os.WriteFile(filepath.Join(lunDir, name), []byte(value), 0o644); err != nil {
+			return err
+		}
+	}
+
+	for i, g := range cfg.AuxGPIOs {
+		value, err := simulateGPIO(gpioDir, g.Name, 0)
+		if err != nil {
+			return err
+		}
+		cfg.AuxGPIOs[i].GPIO = value
+	}
+	if cfg.ChassisIntrusion.GPIO != "" {
+		// The chassis starts closed.
+		closed := 0
+		if cfg.ChassisIntrusion.ActiveLow {
+			closed = 1
+		}
+		value, err := simulateGPIO(gpioDir, "intrusion", closed)
+		if err != nil {
+			return err
+		}
+		cfg.ChassisIntrusion.GPIO = value
+	}
+
+	cfg.VirtualMedia.LUNDir = lunDir
+	cfg.VirtualMedia.ImageDir = filepath.Join(dir, "images")
+	cfg.VirtualMedia.MountDir = filepath.Join(dir, "mnt")
+	cfg.VirtualMedia.GadgetLockFile = ""
+	cfg.VirtualMedia.LocalImageDirs = []string{localDir}
+	cfg.HostInterface.Enabled = false
+	cfg.SoCThermalZone = ""
+	cfg.PowerMeter.Chip = ""
+	cfg.AccountsFile = filepath.Join(dir, "accounts.json")
+	cfg.AuditLogFile = filepath.Join(dir, "audit.log")
+	cfg.Events.SubscriptionsFile = filepath.Join(dir, "subscriptions.json")
+	cfg.Events.BufferDir = filepath.Join(dir, "event-buffer")
+	cfg.BootStateFile = filepath.Join(dir, "boot.json")
+	for i, system := range cfg.Systems {
+		cfg.Systems[i].BootStateFile = filepath.Join(dir, "boot-"+system.ID+".json")
+	}
+	cfg.PowerStateFile = filepath.Join(dir, "power.json")
+	cfg.ServiceUUIDFile = filepath.Join(dir, "uuid")
+	cfg.NTP = NTPConfig{ConfigFile: filepath.Join(dir, "ntp.conf"), StateFile: filepath.Join(dir, "ntp.json")}
+	staticFiles := map[string]string{}
+	for name := range cfg.Network.StaticFiles {
+		staticFiles[name] = filepath.Join(dir, name+".nodhcp")
+	}
+	cfg.Network.StaticFiles = staticFiles
+	cfg.Network.InitScript = ""
+	cfg.Network.StateFile = filepath.Join(dir, "network.json")
+	cfg.Network.IPCommand = ""
+	cfg.Network.VLANFile = filepath.Join(dir, "vlans.json")
+	cfg.Network.ResolvConf = filepath.Join(dir, "resolv.conf")
+	cfg.Network.DNSFile = filepath.Join(dir, "dns.json")
+	return nil
+}
+
+// simulateGPIO returns a plain file under dir standing in for a GPIO,
+// reading value unless an earlier run left it otherwise.
+func simulateGPIO(dir, name string, value int) (string, error) {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	return path, os.WriteFile(path, []byte(fmt.Sprintf("%d\n", value)), 0o644)
+}
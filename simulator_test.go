@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSimulateDevice(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	if err := simulateDevice(&cfg, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+	for _, path := range append([]string{
+		cfg.VirtualMedia.LUNDir, cfg.VirtualMedia.ImageDir, cfg.VirtualMedia.MountDir,
+		cfg.AccountsFile, cfg.AuditLogFile, cfg.Events.SubscriptionsFile, cfg.Events.BufferDir, cfg.BootStateFile,
+	}, cfg.VirtualMedia.LocalImageDirs...) {
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			t.Errorf("Expected %s under %s", path, dir)
+		}
+	}
+
+	setupTaskStore(t)
+	oldConfig, oldHardware, oldBackend, oldBoot := currentConfig, currentHardware, hardwareBackend, currentBootConfig
+	oldBootStateFile := bootStateFile
+	t.Cleanup(func() {
+		stopBootKeys()
+		currentConfig, currentHardware, hardwareBackend, currentBootConfig = oldConfig, oldHardware, oldBackend, oldBoot
+		bootStateFile = oldBootStateFile
+		setInsertion(nil)
+		primarySystem.setPowerTransition("")
+	})
+	// The power state is checked straight after the reset.
+	cfg.SynchronousReset = true
+	currentConfig, currentHardware, hardwareBackend = cfg, &simulatedHardware, newMockBackend(false)
+	if err := primarySystem.loadBootState(cfg.BootStateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(newHandler())
+	defer server.Close()
+	c := &ironicClient{t: t, base: server.URL}
+
+	c.expect(http.StatusNoContent, "PATCH", "/redfish/v1/Systems/System.1",
+		map[string]interface{}{"Boot": map[string]string{"BootSourceOverrideEnabled": "Once", "BootSourceOverrideTarget": "Cd"}}, nil)
+	c.expect(http.StatusNoContent, "POST", "/redfish/v1/Systems/System.1/Actions/ComputerSystem.Reset",
+		map[string]string{"ResetType": "On"}, nil)
+	var system ComputerSystem
+	c.expect(http.StatusOK, "GET", "/redfish/v1/Systems/System.1", nil, &system)
+	if system.PowerState != "On" {
+		t.Errorf("Expected the simulated host on, got %s", system.PowerState)
+	}
+	if _, err := os.Stat(cfg.BootStateFile); err != nil {
+		t.Errorf("Expected the boot settings saved in the simulated device: %v", err)
+	}
+
+	image := filepath.Join(cfg.VirtualMedia.LocalImageDirs[0], "installer.iso")
+	if err := os.WriteFile(image, []byte("ISO image contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(http.StatusNoContent, "POST", virtualMediaPath+"/CD1/Actions/VirtualMedia.InsertMedia",
+		map[string]string{"Image": "file://" + image}, nil)
+	if state, _ := currentLUN().State(); state.File != image || !state.CDROM {
+		t.Errorf("Expected %s attached as a CD, got %+v", image, state)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// hostSystem is one ComputerSystem: a host whose power and reset buttons
+// and power LED the service drives. System.1 is the host the NanoKVM is
+// plugged into, and the only one it has a keyboard and virtual media for;
+// its state is kept in the package's globals, which the power monitor and
+// power restore policy use directly. Further systems, such as hosts on a
+// relay board, come from Config.Systems.
+type hostSystem struct {
+	ID   string
+	Name string
+
+	// hardware and backend are nil for System.1, which uses
+	// currentHardware and hardwareBackend.
+	hardware *Hardware
+	backend  HardwareBackend
+
+	boot          *Boot
+	bootStateFile *string
+	// settings holds the Boot changes staged for the next reset.
+	settings settingsState
+	// actionMu is held for the whole of a reset; see powerActionMu.
+	actionMu   *sync.Mutex
+	transition *powerTransition
+}
+
+var primarySystem = &hostSystem{
+	ID:            "System.1",
+	Name:          "NanoKVM System",
+	boot:          &currentBootConfig,
+	bootStateFile: &bootStateFile,
+	actionMu:      &powerActionMu,
+	transition:    &primaryTransition,
+}
+
+// extraSystems are the systems from Config.Systems, in order.
+var extraSystems []*hostSystem
+
+// newHostSystem returns a system driving the GPIOs in cfg. Its boot
+// settings start out as System.1's defaults.
+func newHostSystem(cfg SystemConfig) *hostSystem {
+	hw := cfg.GPIO.apply(Hardware{Version: HWVersionCustom})
+	boot := newBootConfig()
+	name := cfg.Name
+	if name == "" {
+		name = cfg.ID
+	}
+	return &hostSystem{
+		ID:            cfg.ID,
+		Name:          name,
+		hardware:      &hw,
+		backend:       gpioBackend{hw: &hw},
+		boot:          &boot,
+		bootStateFile: new(string),
+		actionMu:      new(sync.Mutex),
+		transition:    new(powerTransition),
+	}
+}
+
+func allSystems() []*hostSystem {
+	return append([]*hostSystem{primarySystem}, extraSystems...)
+}
+
+// findSystem returns the system with the given Id, or nil.
+func findSystem(id string) *hostSystem {
+	for _, s := range allSystems() {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// managedSystemLinks links every system, for the manager's
+// ManagerForServers.
+func managedSystemLinks() []Link {
+	var links []Link
+	for _, s := range allSystems() {
+		links = append(links, Link{ODataID: s.path()})
+	}
+	return links
+}
+
+func (s *hostSystem) path() string {
+	return "/redfish/v1/Systems/" + s.ID
+}
+
+func (s *hostSystem) hw() *Hardware {
+	if s.hardware != nil {
+		return s.hardware
+	}
+	return currentHardware
+}
+
+func (s *hostSystem) powerBackend() HardwareBackend {
+	if s.backend != nil {
+		return s.backend
+	}
+	return hardwareBackend
+}
+
+func (s *hostSystem) getPowerState() (string, error) {
+	return s.powerBackend().GetPowerState()
+}
+
+func (s *hostSystem) pressPowerButton(ms int) error {
+	return s.powerBackend().PressPower(time.Duration(ms) * time.Millisecond)
+}
+
+func (s *hostSystem) performReset(ms int) error {
+	return s.powerBackend().PressReset(time.Duration(ms) * time.Millisecond)
+}
+
+func (s *hostSystem) sendNMI() error {
+	backend, ok := s.powerBackend().(nmiBackend)
+	if !ok {
+		return &HardwareError{Kind: errNotSupported, Op: "send NMI"}
+	}
+	return backend.PressNMI(nmiPulse)
+}
+
+// capabilities reports which of the power LED, power button and reset
+// button the system's board has wired up.
+func (s *hostSystem) capabilities() (powerLED, powerButton, resetButton bool) {
+	panel, ok := s.powerBackend().(panelCapabilities)
+	if !ok {
+		return true, true, true
+	}
+	return panel.SupportsPowerState(), panel.SupportsPowerButton(), panel.SupportsReset()
+}
+
+func (s *hostSystem) nmiSupported() bool {
+	backend, ok := s.powerBackend().(nmiBackend)
+	return ok && backend.SupportsNMI()
+}
+
+// pressDurations returns the board's power, long power and reset press
+// lengths in milliseconds.
+func (s *hostSystem) pressDurations() (power, long, reset int) {
+	power, long, reset = 800, 1000, 800
+	if hw := s.hw(); hw != nil {
+		if hw.PowerPressMs > 0 {
+			power = hw.PowerPressMs
+		}
+		if hw.LongPressMs > 0 {
+			long = hw.LongPressMs
+		}
+		if hw.ResetPressMs > 0 {
+			reset = hw.ResetPressMs
+		}
+	}
+	return power, long, reset
+}
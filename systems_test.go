@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtraSystems(t *testing.T) {
+	setupGPIOChips(t, nil, nil)
+	primary := setupMockBackend(t, true)
+	dir := t.TempDir()
+	powerLED := filepath.Join(dir, "power_led")
+	os.WriteFile(powerLED, []byte("1\n"), 0644)
+
+	oldConfig, oldSystems := currentConfig, extraSystems
+	defer func() { currentConfig, extraSystems = oldConfig, oldSystems }()
+	currentConfig.RateLimit = RateLimitConfig{}
+	host2 := newHostSystem(SystemConfig{
+		ID:   "Host2",
+		Name: "Build server",
+		GPIO: GPIOConfig{Reset: filepath.Join(dir, "reset"), Power: filepath.Join(dir, "power"), PowerLED: powerLED},
+	})
+	if err := host2.loadBootState(filepath.Join(dir, "boot-host2.json")); err != nil {
+		t.Fatal(err)
+	}
+	extraSystems = []*hostSystem{host2}
+
+	handler := newHandler()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(path string) map[string]interface{} {
+		t.Helper()
+		rr := do("GET", path, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		var resource map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resource)
+		return resource
+	}
+
+	var collection SystemCollection
+	json.Unmarshal(do("GET", "/redfish/v1/Systems", "").Body.Bytes(), &collection)
+	if len(collection.Members) != 2 || collection.Members[1]["@odata.id"] != "/redfish/v1/Systems/Host2" {
+		t.Errorf("Expected System.1 and Host2 listed, got %v", collection.Members)
+	}
+	if rr := do("GET", "/redfish/v1/Systems/Host3", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown system, got %d", rr.Code)
+	}
+
+	// Host2's own power LED is read, not System.1's.
+	system := get("/redfish/v1/Systems/Host2")
+	if system["Id"] != "Host2" || system["Name"] != "Build server" || system["PowerState"] != "Off" {
+		t.Errorf("Expected Host2 to be off, got %v", system)
+	}
+	if _, ok := system["PowerRestorePolicy"]; ok {
+		t.Errorf("Expected no PowerRestorePolicy on Host2, got %v", system["PowerRestorePolicy"])
+	}
+	reset := system["Actions"].(map[string]interface{})["#ComputerSystem.Reset"].(map[string]interface{})
+	if reset["target"] != "/redfish/v1/Systems/Host2/Actions/ComputerSystem.Reset" {
+		t.Errorf("Expected Host2's own reset target, got %v", reset["target"])
+	}
+
+	rr := do("PATCH", "/redfish/v1/Systems/Host2",
+		`{"Boot": {"BootSourceOverrideEnabled": "Continuous", "BootSourceOverrideTarget": "Pxe"}}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for Host2's boot override, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if currentBootConfig.BootSourceOverrideTarget != "None" {
+		t.Errorf("Expected System.1's boot override untouched, got %s", currentBootConfig.BootSourceOverrideTarget)
+	}
+	var saved savedBoot
+	content, _ := os.ReadFile(filepath.Join(dir, "boot-host2.json"))
+	if json.Unmarshal(content, &saved); saved.BootSourceOverrideTarget != "Pxe" {
+		t.Errorf("Expected Host2's boot override saved, got %s", content)
+	}
+	if rr := do("PATCH", "/redfish/v1/Systems/Host2", `{"PowerRestorePolicy": "AlwaysOn"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for Host2's PowerRestorePolicy, got %d", rr.Code)
+	}
+
+	mock := newMockBackend(false)
+	host2.backend = mock
+	eventLog.Clear()
+	rr = do("POST", "/redfish/v1/Systems/Host2/Actions/ComputerSystem.Reset", `{"ResetType": "On"}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for Host2's reset, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if power, _ := mock.Presses(); power != 1 {
+		t.Errorf("Expected Host2's power button pressed once, got %d", power)
+	}
+	if power, _ := primary.Presses(); power != 0 {
+		t.Errorf("Expected System.1's buttons left alone, got %d presses", power)
+	}
+	// Keystrokes only reach System.1, so the override is reported unapplied.
+	entries := eventLog.Entries()
+	if len(entries) != 2 || entries[0].Severity != "Warning" || entries[1].MessageArgs[0] != "/redfish/v1/Systems/Host2" {
+		t.Errorf("Expected the unapplied override and Host2's reset logged, got %+v", entries)
+	}
+
+	manager := get("/redfish/v1/Managers/BMC")
+	if servers := manager["Links"].(map[string]interface{})["ManagerForServers"].([]interface{}); len(servers) != 2 {
+		t.Errorf("Expected the manager to manage both systems, got %v", servers)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const taskServicePath = "/redfish/v1/TaskService"
+
+// maxTasks bounds how many tasks are kept. The oldest finished task is
+// dropped to make room, so a client has to fetch its result reasonably
+// soon after completion.
+const maxTasks = 16
+
+// task tracks one long-running operation started by an action that
+// answered 202 Accepted.
+type task struct {
+	mu       sync.Mutex
+	id       string
+	name     string
+	state    string
+	percent  int
+	started  Timestamp
+	ended    Timestamp
+	messages []MessageInfo
+	// statusCode is what the action would have returned had it run
+	// synchronously; the task monitor returns it once the task is done.
+	statusCode int
+}
+
+type TaskResource struct {
+	ODataType       string        `json:"@odata.type"`
+	ODataID         string        `json:"@odata.id"`
+	ID              string        `json:"Id"`
+	Name            string        `json:"Name"`
+	TaskState       string        `json:"TaskState"`
+	TaskStatus      string        `json:"TaskStatus"`
+	StartTime       string        `json:"StartTime"`
+	EndTime         string        `json:"EndTime,omitempty"`
+	PercentComplete int           `json:"PercentComplete"`
+	TaskMonitor     string        `json:"TaskMonitor"`
+	Messages        []MessageInfo `json:"Messages"`
+}
+
+func taskPath(id string) string {
+	return taskServicePath + "/Tasks/" + id
+}
+
+func taskMonitorPath(id string) string {
+	return taskServicePath + "/TaskMonitors/" + id
+}
+
+func (t *task) done() bool {
+	return t.state == "Completed" || t.state == "Exception"
+}
+
+// SetPercent records progress; it never goes backwards.
+func (t *task) SetPercent(percent int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if percent > t.percent && percent <= 100 {
+		t.percent = percent
+	}
+}
+
+// Finish ends the task with the status the action would have returned.
+// A nil msg means success.
+func (t *task) Finish(statusCode int, msg *MessageInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.statusCode = statusCode
+	t.ended = newTimestamp()
+	if msg == nil {
+		t.state = "Completed"
+		t.percent = 100
+		t.messages = []MessageInfo{newMessage("Success")}
+	} else {
+		t.state = "Exception"
+		t.messages = []MessageInfo{*msg}
+	}
+}
+
+func (t *task) resource() TaskResource {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := "OK"
+	if t.state == "Exception" {
+		status = "Critical"
+	}
+	res := TaskResource{
+		ODataType:       odataType("Task"),
+		ODataID:         taskPath(t.id),
+		ID:              t.id,
+		Name:            t.name,
+		TaskState:       t.state,
+		TaskStatus:      status,
+		StartTime:       t.started.String(),
+		PercentComplete: t.percent,
+		TaskMonitor:     taskMonitorPath(t.id),
+		Messages:        append([]MessageInfo{}, t.messages...),
+	}
+	if t.done() {
+		res.EndTime = t.ended.String()
+	}
+	return res
+}
+
+type TaskStore struct {
+	mu     sync.Mutex
+	nextID int
+	tasks  []*task
+}
+
+var taskStore = &TaskStore{}
+
+// Start registers a task and runs fn in the background. fn must call
+// Finish on the task it is given.
+func (s *TaskStore) Start(name string, fn func(t *task)) *task {
+	s.mu.Lock()
+	s.nextID++
+	t := &task{
+		id:      strconv.Itoa(s.nextID),
+		name:    name,
+		state:   "Running",
+		started: newTimestamp(),
+	}
+	s.tasks = append(s.tasks, t)
+	s.prune()
+	s.mu.Unlock()
+
+	go fn(t)
+	return t
+}
+
+// prune drops the oldest finished tasks beyond maxTasks. Running tasks are
+// always kept. The caller holds s.mu.
+func (s *TaskStore) prune() {
+	excess := len(s.tasks) - maxTasks
+	kept := s.tasks[:0]
+	for _, t := range s.tasks {
+		t.mu.Lock()
+		finished := t.done()
+		t.mu.Unlock()
+		if excess > 0 && finished {
+			excess--
+			continue
+		}
+		kept = append(kept, t)
+	}
+	s.tasks = kept
+}
+
+func (s *TaskStore) Get(id string) (*task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.id == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (s *TaskStore) List() []*task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*task{}, s.tasks...)
+}
+
+// writeTaskAccepted answers an action that continues in the background:
+// 202 with the task monitor in Location and the task as the body.
+func writeTaskAccepted(w http.ResponseWriter, t *task) {
+	w.Header().Set("Location", taskMonitorPath(t.id))
+	w.Header().Set("Retry-After", "5")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(t.resource())
+}
+
+// respondAsync reports whether the client asked for an asynchronous
+// response with "Prefer: respond-async".
+func respondAsync(r *http.Request) bool {
+	for _, prefer := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func handleTaskService(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, taskServicePath), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "":
+		handleTaskServiceRoot(w, r)
+	case len(parts) == 1 && parts[0] == "Tasks":
+		handleTasks(w, r)
+	case len(parts) == 2 && parts[0] == "Tasks":
+		handleTask(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "TaskMonitors":
+		handleTaskMonitor(w, r, parts[1])
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleTaskServiceRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	service := map[string]interface{}{
+		"@odata.type":                     odataType("TaskService"),
+		"@odata.id":                       taskServicePath,
+		"Id":                              "TaskService",
+		"Name":                            "Task Service",
+		"ServiceEnabled":                  true,
+		"CompletedTaskOverWritePolicy":    "Oldest",
+		"LifeCycleEventOnTaskStateChange": false,
+		"DateTime":                        newTimestamp().String(),
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+		"Tasks": map[string]string{
+			"@odata.id": taskServicePath + "/Tasks",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service)
+}
+
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	tasks := taskStore.List()
+	ids := make([]string, len(tasks))
+	for i, t := range tasks {
+		ids[i] = taskPath(t.id)
+	}
+	members, ok := filterMembers(w, r, ids, func(i int) interface{} { return tasks[i].resource() })
+	if !ok {
+		return
+	}
+
+	collection := SystemCollection{
+		ODataType: "#TaskCollection.TaskCollection",
+		ODataID:   taskServicePath + "/Tasks",
+		Name:      "Task Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleTask(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	t, ok := taskStore.Get(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.resource())
+}
+
+// handleTaskMonitor answers 202 with the task while it runs, then the
+// response the action would have given: 204 on success or its error.
+func handleTaskMonitor(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	t, ok := taskStore.Get(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	t.mu.Lock()
+	state, statusCode, messages := t.state, t.statusCode, t.messages
+	t.mu.Unlock()
+
+	switch state {
+	case "Running":
+		writeTaskAccepted(w, t)
+	case "Exception":
+		writeRedfishError(w, statusCode, messages...)
+	default:
+		w.WriteHeader(statusCode)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func setupTaskStore(t *testing.T) *TaskStore {
+	t.Helper()
+
+	old := taskStore
+	taskStore = &TaskStore{}
+	t.Cleanup(func() { taskStore = old })
+	return taskStore
+}
+
+func TestTaskMonitor(t *testing.T) {
+	store := setupTaskStore(t)
+
+	release := make(chan struct{})
+	running := store.Start("Slow operation", func(task *task) {
+		task.SetPercent(40)
+		<-release
+		task.Finish(http.StatusNoContent, nil)
+	})
+	failing := store.Start("Failing operation", func(task *task) {
+		msg := newMessage("ResourceMissingAtURI", "http://images.example/missing.iso")
+		task.Finish(http.StatusBadRequest, &msg)
+	})
+	waitFor(t, "failing task", func() bool { return failing.resource().TaskState == "Exception" })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		handleTaskService(rr, req)
+		return rr
+	}
+
+	rr := get(taskMonitorPath(running.id))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d while running, got %d", http.StatusAccepted, rr.Code)
+	}
+	if loc := rr.Header().Get("Location"); loc != taskMonitorPath(running.id) {
+		t.Errorf("Expected Location %s, got %q", taskMonitorPath(running.id), loc)
+	}
+	var res TaskResource
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.TaskState != "Running" || res.PercentComplete != 40 || res.EndTime != "" {
+		t.Errorf("Unexpected running task: %+v", res)
+	}
+
+	rr = get(taskMonitorPath(failing.id))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected the failed action's status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var body map[string]redfishErrorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["error"].Code != "Base.1.8.ResourceMissingAtURI" {
+		t.Errorf("Expected ResourceMissingAtURI, got %s", body["error"].Code)
+	}
+	if res := failing.resource(); res.TaskStatus != "Critical" || res.EndTime == "" {
+		t.Errorf("Unexpected failed task: %+v", res)
+	}
+
+	close(release)
+	waitFor(t, "slow task", func() bool { return running.resource().TaskState == "Completed" })
+	if rr := get(taskMonitorPath(running.id)); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d once complete, got %d", http.StatusNoContent, rr.Code)
+	}
+	if res := running.resource(); res.PercentComplete != 100 || res.Messages[0].MessageID != "Base.1.8.Success" {
+		t.Errorf("Unexpected completed task: %+v", res)
+	}
+
+	if rr := get(taskServicePath + "/TaskMonitors/99"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown task, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestTaskStorePrune(t *testing.T) {
+	store := setupTaskStore(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	running := store.Start("Still running", func(task *task) {
+		<-release
+		task.Finish(http.StatusNoContent, nil)
+	})
+	for i := 0; i < maxTasks+4; i++ {
+		done := store.Start("Task "+strconv.Itoa(i), func(task *task) {
+			task.Finish(http.StatusNoContent, nil)
+		})
+		waitFor(t, "task to finish", func() bool { return done.resource().TaskState == "Completed" })
+	}
+
+	tasks := store.List()
+	if len(tasks) != maxTasks {
+		t.Fatalf("Expected %d tasks kept, got %d", maxTasks, len(tasks))
+	}
+	if tasks[0] != running {
+		t.Error("Running task was pruned")
+	}
+	if _, ok := store.Get("2"); ok {
+		t.Error("Expected the oldest finished task to be pruned")
+	}
+}
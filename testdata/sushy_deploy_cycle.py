@@ -0,0 +1,75 @@
+"""Drive a NanoKVM Redfish service through an Ironic deploy cycle with sushy.
+
+Usage: sushy_deploy_cycle.py URL USERNAME PASSWORD IMAGE_URL
+
+Uses the same sushy calls as Ironic's redfish power and management
+interfaces and its redfish-virtual-media boot interface. Exits non-zero
+on the first step that fails.
+"""
+
+import sys
+import time
+
+import sushy
+from sushy import auth
+
+
+def wait_for_power(system, state, timeout=30):
+    deadline = time.time() + timeout
+    while time.time() < deadline:
+        system.refresh()
+        if system.power_state == state:
+            return
+        time.sleep(0.5)
+    raise SystemExit('timed out waiting for power state %s, got %s'
+                     % (state, system.power_state))
+
+
+def main(url, username, password, image):
+    session = auth.SessionAuth(username=username, password=password)
+    root = sushy.Sushy(url + '/redfish/v1', auth=session)
+
+    system = root.get_system(root.get_system_collection().members_identities[0])
+    print('System %s is %s' % (system.identity, system.power_state))
+
+    cd = None
+    for manager in system.managers:
+        for vmedia in manager.virtual_media.get_members():
+            if (sushy.VIRTUAL_MEDIA_CD in vmedia.media_types
+                    or sushy.VIRTUAL_MEDIA_DVD in vmedia.media_types):
+                cd = vmedia
+                break
+    if cd is None:
+        raise SystemExit('no virtual CD found')
+
+    if cd.inserted:
+        cd.eject_media()
+    cd.insert_media(image, inserted=True, write_protected=True)
+    cd.refresh()
+    if not cd.inserted or cd.image != image:
+        raise SystemExit('image not inserted: %s' % cd.image)
+    print('Inserted %s into %s' % (image, cd.identity))
+
+    system.set_system_boot_options(sushy.BOOT_SOURCE_TARGET_CD,
+                                   enabled=sushy.BOOT_SOURCE_ENABLED_ONCE,
+                                   mode=sushy.BOOT_SOURCE_MODE_UEFI)
+    system.reset_system(sushy.RESET_ON)
+    wait_for_power(system, sushy.POWER_STATE_ON)
+    if system.boot.enabled != sushy.BOOT_SOURCE_ENABLED_DISABLED:
+        raise SystemExit('Once boot override not cleared: %s'
+                         % system.boot.enabled)
+    print('Booted from the virtual CD')
+
+    system.reset_system(sushy.RESET_FORCE_OFF)
+    wait_for_power(system, sushy.POWER_STATE_OFF)
+    cd.eject_media()
+    cd.refresh()
+    if cd.inserted:
+        raise SystemExit('image still inserted after eject')
+    print('Deploy cycle complete')
+
+
+if __name__ == '__main__':
+    if len(sys.argv) != 5:
+        raise SystemExit(__doc__)
+    main(*sys.argv[1:])
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The SoC's temperature is read from its thermal zone in sysfs, in
+// millidegrees Celsius, along with the zone's trip points: the kernel
+// throttles the SoC at a passive trip point and shuts it down at a
+// critical one.
+
+func socThermalZonePresent() bool {
+	zone := currentConfig.SoCThermalZone
+	if zone == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(zone, "temp"))
+	return err == nil
+}
+
+func readMillidegrees(path string) (float64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, err
+	}
+	return float64(value) / 1000, nil
+}
+
+func readSoCTemperature() (sensorReading, error) {
+	zone := currentConfig.SoCThermalZone
+	temp, err := readMillidegrees(filepath.Join(zone, "temp"))
+	if err != nil {
+		return sensorReading{}, &HardwareError{Kind: errIOFailure, Op: "read thermal zone", Err: err}
+	}
+
+	reading := sensorReading{Reading: temp, Thresholds: map[string]float64{}}
+	types, _ := filepath.Glob(filepath.Join(zone, "trip_point_*_type"))
+	for _, typeFile := range types {
+		kind, err := os.ReadFile(typeFile)
+		if err != nil {
+			continue
+		}
+		limit, err := readMillidegrees(strings.TrimSuffix(typeFile, "_type") + "_temp")
+		if err != nil {
+			continue
+		}
+		threshold := "UpperCaution"
+		switch strings.TrimSpace(string(kind)) {
+		case "critical":
+			threshold = "UpperCritical"
+		case "passive", "hot":
+		default:
+			// Active trip points only switch on cooling.
+			continue
+		}
+		if current, ok := reading.Thresholds[threshold]; !ok || limit < current {
+			reading.Thresholds[threshold] = limit
+		}
+	}
+	return reading, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	// The NanoKVM root filesystem ships without zoneinfo, so bundle it to
+	// make named timezones in the config work on the device.
+	_ "time/tzdata"
+)
+
+// displayLocation is the timezone used when rendering timestamps. The
+// instant recorded never changes; only its presentation does.
+var displayLocation = time.UTC
+
+var sequenceCounter uint64
+
+// Timestamp records when something happened together with a process-wide
+// sequence number. The sequence keeps records ordered even when the device
+// clock is stepped by NTP or set by hand after boot.
+type Timestamp struct {
+	Time     time.Time
+	Sequence uint64
+}
+
+func newTimestamp() Timestamp {
+	return Timestamp{
+		Time:     timeNow(),
+		Sequence: atomic.AddUint64(&sequenceCounter, 1),
+	}
+}
+
+func (ts Timestamp) String() string {
+	return ts.Time.In(displayLocation).Format(time.RFC3339)
+}
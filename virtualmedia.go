@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const virtualMediaPath = "/redfish/v1/Managers/BMC/VirtualMedia"
+
+// virtualMediaSlot is one VirtualMedia member. Both slots share the single
+// mass storage LUN; which one is inserted follows the LUN's cdrom flag.
+type virtualMediaSlot struct {
+	ID         string
+	Name       string
+	MediaTypes []string
+	CDROM      bool
+}
+
+var virtualMediaSlots = []virtualMediaSlot{
+	{ID: "CD1", Name: "Virtual CD", MediaTypes: []string{"CD", "DVD"}, CDROM: true},
+	{ID: "USB1", Name: "Virtual USB Drive", MediaTypes: []string{"USBStick"}, CDROM: false},
+}
+
+func findVirtualMediaSlot(id string) (virtualMediaSlot, bool) {
+	for _, slot := range virtualMediaSlots {
+		if slot.ID == id {
+			return slot, true
+		}
+	}
+	return virtualMediaSlot{}, false
+}
+
+func (slot virtualMediaSlot) odataID() string {
+	return virtualMediaPath + "/" + slot.ID
+}
+
+// inserted reports whether the LUN currently presents a medium of this
+// slot's kind.
+func (slot virtualMediaSlot) inserted(state lunState) bool {
+	return state.File != "" && state.CDROM == slot.CDROM
+}
+
+// mediaInsertion remembers what InsertMedia attached, so its image can be
+// reported by URL and told apart from one mounted by the web UI.
+// MountPoint is set for images streamed from an NFS or CIFS share.
+type mediaInsertion struct {
+	Slot                 string
+	Image                string
+	Path                 string
+	TransferProtocolType string
+	TransferMethod       string
+	MountPoint           string
+}
+
+// imageProtocols maps the URL schemes InsertMedia accepts to their
+// TransferProtocolType. HTTP images are downloaded to the SD card, which
+// is too small for some installers; share images are streamed instead.
+var imageProtocols = map[string]string{
+	"http":  "HTTP",
+	"https": "HTTPS",
+	"nfs":   "NFS",
+	"smb":   "CIFS",
+	"cifs":  "CIFS",
+	"file":  "OEM",
+}
+
+func isShare(protocol string) bool {
+	return protocol == "NFS" || protocol == "CIFS"
+}
+
+// transferMethod is Upload for images copied to the SD card and Stream for
+// ones the gadget reads in place.
+func transferMethod(protocol string) string {
+	if isShare(protocol) || protocol == "OEM" {
+		return "Stream"
+	}
+	return "Upload"
+}
+
+var (
+	// virtualMediaMu serialises InsertMedia and EjectMedia; a second call
+	// while a download is running is refused rather than queued.
+	virtualMediaMu sync.Mutex
+
+	insertedMu    sync.Mutex
+	insertedMedia *mediaInsertion
+)
+
+func currentInsertion() *mediaInsertion {
+	insertedMu.Lock()
+	defer insertedMu.Unlock()
+	return insertedMedia
+}
+
+func setInsertion(ins *mediaInsertion) {
+	insertedMu.Lock()
+	defer insertedMu.Unlock()
+	insertedMedia = ins
+}
+
+type VirtualMedia struct {
+	ODataType            string                 `json:"@odata.type"`
+	ODataID              string                 `json:"@odata.id"`
+	ODataEtag            string                 `json:"@odata.etag,omitempty"`
+	ID                   string                 `json:"Id"`
+	Name                 string                 `json:"Name"`
+	MediaTypes           []string               `json:"MediaTypes"`
+	Image                *string                `json:"Image"`
+	ImageName            *string                `json:"ImageName"`
+	Inserted             bool                   `json:"Inserted"`
+	ConnectedVia         string                 `json:"ConnectedVia"`
+	WriteProtected       bool                   `json:"WriteProtected"`
+	TransferProtocolType *string                `json:"TransferProtocolType"`
+	TransferMethod       *string                `json:"TransferMethod"`
+	Actions              map[string]interface{} `json:"Actions"`
+}
+
+type InsertMediaRequest struct {
+	Image                *string    `json:"Image"`
+	Inserted             *bool      `json:"Inserted"`
+	WriteProtected       *bool      `json:"WriteProtected"`
+	TransferProtocolType *string    `json:"TransferProtocolType"`
+	TransferMethod       *string    `json:"TransferMethod"`
+	UserName             string     `json:"UserName"`
+	Password             string     `json:"Password"`
+	Oem                  *ActionOem `json:"Oem,omitempty"`
+}
+
+func toVirtualMedia(slot virtualMediaSlot, state lunState, ins *mediaInsertion) VirtualMedia {
+	media := VirtualMedia{
+		ODataType:      odataType("VirtualMedia"),
+		ODataID:        slot.odataID(),
+		ID:             slot.ID,
+		Name:           slot.Name,
+		MediaTypes:     slot.MediaTypes,
+		ConnectedVia:   "NotConnected",
+		WriteProtected: true,
+		Actions: map[string]interface{}{
+			"#VirtualMedia.InsertMedia": map[string]string{
+				"target": slot.odataID() + "/Actions/VirtualMedia.InsertMedia",
+			},
+			"#VirtualMedia.EjectMedia": map[string]string{
+				"target": slot.odataID() + "/Actions/VirtualMedia.EjectMedia",
+			},
+		},
+	}
+	if !slot.inserted(state) {
+		return media
+	}
+
+	if ins != nil && ins.Slot == slot.ID && ins.Path == state.File {
+		image := ins.Image
+		name := path.Base(image)
+		if u, err := url.Parse(image); err == nil {
+			name = path.Base(u.Path)
+		}
+		protocol, method := ins.TransferProtocolType, ins.TransferMethod
+		media.Image = &image
+		media.ImageName = &name
+		media.Inserted = true
+		media.ConnectedVia = "URI"
+		media.WriteProtected = state.ReadOnly
+		media.TransferProtocolType = &protocol
+		media.TransferMethod = &method
+		return media
+	}
+
+	// An image attached outside Redfish, e.g. from the NanoKVM web UI, is
+	// reported by its path on the device.
+	image := state.File
+	name := filepath.Base(state.File)
+	media.Image = &image
+	media.ImageName = &name
+	media.Inserted = true
+	media.ConnectedVia = "Oem"
+	media.WriteProtected = state.ReadOnly
+	return media
+}
+
+func handleVirtualMedia(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, virtualMediaPath), "/")
+	if rest == "" {
+		handleVirtualMediaCollection(w, r)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	slot, ok := findVirtualMediaSlot(parts[0])
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		handleVirtualMediaItem(w, r, slot)
+	case len(parts) == 3 && parts[1] == "Actions" && parts[2] == "VirtualMedia.InsertMedia":
+		handleInsertMedia(w, r, slot)
+	case len(parts) == 3 && parts[1] == "Actions" && parts[2] == "VirtualMedia.EjectMedia":
+		handleEjectMedia(w, r, slot)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+func handleVirtualMediaCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	members := []map[string]string{}
+	for _, slot := range virtualMediaSlots {
+		members = append(members, map[string]string{"@odata.id": slot.odataID()})
+	}
+
+	collection := SystemCollection{
+		ODataType: "#VirtualMediaCollection.VirtualMediaCollection",
+		ODataID:   virtualMediaPath,
+		Name:      "Virtual Media Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+func handleVirtualMediaItem(w http.ResponseWriter, r *http.Request, slot virtualMediaSlot) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		handleVirtualMediaPatch(w, r, slot)
+		return
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH")
+		return
+	}
+
+	state, err := currentLUN().State()
+	if err != nil {
+		writeHardwareError(w, err, "VirtualMedia")
+		return
+	}
+
+	media := toVirtualMedia(slot, state, currentInsertion())
+	etag := resourceETag(media)
+	if notModified(w, r, etag) {
+		return
+	}
+	media.ODataEtag = etag
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(media)
+}
+
+type VirtualMediaPatchRequest struct {
+	WriteProtected *bool `json:"WriteProtected"`
+}
+
+// writableImage reports whether the host may be allowed to write to the
+// inserted image: only a USB drive backed by an image from the SD card
+// that InsertMedia attached. CDs are read-only by nature, and downloads
+// and share mounts are discarded or read-only anyway.
+func writableImage(slot virtualMediaSlot, state lunState, ins *mediaInsertion) bool {
+	return !slot.CDROM && slot.inserted(state) &&
+		ins != nil && ins.Slot == slot.ID && ins.Path == state.File && ins.TransferProtocolType == "OEM"
+}
+
+// handleVirtualMediaPatch toggles WriteProtected on the inserted image.
+// The kernel only changes ro on an empty LUN, so the image is detached and
+// reattached, which the host sees as a media change.
+func handleVirtualMediaPatch(w http.ResponseWriter, r *http.Request, slot virtualMediaSlot) {
+	var req VirtualMediaPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+
+	lun := currentLUN()
+	state, err := lun.State()
+	if err != nil {
+		writeHardwareError(w, err, "VirtualMedia")
+		return
+	}
+	if !checkPreconditions(w, r, resourceETag(toVirtualMedia(slot, state, currentInsertion())), false) {
+		return
+	}
+	get := func(w http.ResponseWriter, r *http.Request) { handleVirtualMediaItem(w, r, slot) }
+	ignored, ok := checkPatchProperties(w, r, body, &req, get)
+	if !ok {
+		return
+	}
+	if req.WriteProtected == nil {
+		writePatchResult(w, r, ignored, get)
+		return
+	}
+	want := *req.WriteProtected
+	if !want && !writableImage(slot, state, currentInsertion()) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueNotInList", "false", "WriteProtected").withProperty("#/WriteProtected"))
+		return
+	}
+	if !slot.inserted(state) || state.ReadOnly == want {
+		writePatchResult(w, r, ignored, get)
+		return
+	}
+
+	if !virtualMediaMu.TryLock() {
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return
+	}
+	defer virtualMediaMu.Unlock()
+
+	if err := lun.Detach(); err != nil {
+		writeHardwareError(w, err, "VirtualMedia")
+		return
+	}
+	if err := lun.Attach(state.File, state.CDROM, want); err != nil {
+		// Put the image back as it was rather than leave the slot empty.
+		if restoreErr := lun.Attach(state.File, state.CDROM, state.ReadOnly); restoreErr != nil {
+			log.Printf("Failed to restore %s: %v", state.File, restoreErr)
+		}
+		writeHardwareError(w, err, "VirtualMedia")
+		return
+	}
+
+	emitEvent("OK", fmt.Sprintf("%s write protection set to %v", slot.ID, want),
+		resourceEventPrefix+"ResourceChanged", slot.odataID())
+	writePatchResult(w, r, ignored, get)
+}
+
+func handleInsertMedia(w http.ResponseWriter, r *http.Request, slot virtualMediaSlot) {
+	const action = "VirtualMedia.InsertMedia"
+
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var req InsertMediaRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+
+	// Oem.NanoKVM.LocalPath is shorthand for a file:// Image.
+	if req.Oem != nil && req.Oem.NanoKVM.LocalPath != "" {
+		if req.Image != nil {
+			writeRedfishError(w, http.StatusBadRequest, newMessage("ActionParameterNotSupported", "LocalPath", action))
+			return
+		}
+		local := (&url.URL{Scheme: "file", Path: req.Oem.NanoKVM.LocalPath}).String()
+		req.Image = &local
+	}
+
+	if req.Image == nil || *req.Image == "" {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("ActionParameterMissing", action, "Image"))
+		return
+	}
+	image, err := url.Parse(*req.Image)
+	if err != nil || !validImageHost(image) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueFormatError", *req.Image, "Image", action))
+		return
+	}
+	protocol, ok := imageProtocols[strings.ToLower(image.Scheme)]
+	if !ok {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", image.Scheme, "Image", action))
+		return
+	}
+	method := transferMethod(protocol)
+	if req.TransferProtocolType != nil && *req.TransferProtocolType != protocol {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", *req.TransferProtocolType, "TransferProtocolType", action))
+		return
+	}
+	if req.TransferMethod != nil && *req.TransferMethod != method {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", *req.TransferMethod, "TransferMethod", action))
+		return
+	}
+	if isShare(protocol) && !validShareImage(image, protocol) {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueFormatError", image.Redacted(), "Image", action))
+		return
+	}
+	if protocol == "CIFS" && strings.ContainsAny(req.UserName, ",=") {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueFormatError", req.UserName, "UserName", action))
+		return
+	}
+	var checksum *imageChecksum
+	if req.Oem != nil && req.Oem.NanoKVM.Checksum != "" {
+		algorithm := strings.ToUpper(req.Oem.NanoKVM.ChecksumAlgorithm)
+		if algorithm == "" {
+			algorithm = "SHA256"
+		}
+		if _, ok := checksumAlgorithms[algorithm]; !ok {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("ActionParameterValueNotInList", req.Oem.NanoKVM.ChecksumAlgorithm, "ChecksumAlgorithm", action))
+			return
+		}
+		if checksum, err = newImageChecksum(algorithm, req.Oem.NanoKVM.Checksum); err != nil {
+			writeRedfishError(w, http.StatusBadRequest,
+				newMessage("ActionParameterValueFormatError", req.Oem.NanoKVM.Checksum, "Checksum", action))
+			return
+		}
+	}
+	if req.Inserted != nil && !*req.Inserted {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("ActionParameterNotSupported", "Inserted", action))
+		return
+	}
+	// Only a USB drive backed by an image on the SD card can be writable;
+	// see writableImage.
+	writeProtected := req.WriteProtected == nil || *req.WriteProtected
+	if !writeProtected && (slot.CDROM || protocol != "OEM") {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ActionParameterValueNotInList", "false", "WriteProtected", action))
+		return
+	}
+
+	lun := currentLUN()
+	state, err := lun.State()
+	if err != nil {
+		writeHardwareError(w, err, action)
+		return
+	}
+	if state.File != "" {
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return
+	}
+
+	var dest, mountPoint string
+	var ops []string
+	switch {
+	case isShare(protocol):
+		mountPoint = filepath.Join(currentConfig.VirtualMedia.MountDir, slot.ID)
+		dest = filepath.Join(mountPoint, path.Base(image.Path))
+		ops = append(ops, fmt.Sprintf("Mount %s share %s at %s", protocol, path.Dir(image.Path), mountPoint))
+	case protocol == "OEM":
+		if dest, err = resolveLocalImage(image.Path); err != nil {
+			writeImageError(w, err, image.String())
+			return
+		}
+	default:
+		dest = filepath.Join(currentConfig.VirtualMedia.ImageDir, imageFileName(image))
+		ops = append(ops, fmt.Sprintf("Download %s to %s", image.Redacted(), dest))
+	}
+	if checksum != nil {
+		ops = append(ops, fmt.Sprintf("Verify the %s checksum of %s", checksum.algorithm, dest))
+	}
+	attach := fmt.Sprintf("Attach %s to the USB mass storage gadget as %s", dest, slot.Name)
+	if !writeProtected {
+		attach += ", writable"
+	}
+	ops = append(ops, attach)
+
+	if dryRunRequested(r, req.Oem) {
+		writeDryRunReport(w, DryRunReport{
+			Action:     action,
+			Parameters: map[string]string{"Image": image.Redacted(), "Slot": slot.ID},
+			CurrentState: map[string]string{
+				"Inserted": fmt.Sprint(slot.inserted(state)),
+				"Image":    state.File,
+			},
+			WouldPerform: ops,
+		})
+		return
+	}
+
+	if !virtualMediaMu.TryLock() {
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return
+	}
+
+	insert := mediaInsert{
+		slot:       slot,
+		image:      image,
+		protocol:   protocol,
+		method:     method,
+		dest:       dest,
+		mountPoint: mountPoint,
+		username:   req.UserName,
+		password:   req.Password,
+		checksum:   checksum,
+		writable:   !writeProtected,
+	}
+
+	// Downloads can take many minutes, so a client that prefers it gets a
+	// task to poll instead of a request held open for the whole transfer.
+	if method == "Upload" && (respondAsync(r) || metal3Compatible()) {
+		finished := startPendingInsert()
+		t := taskStore.Start(fmt.Sprintf("Insert %s into %s", image.Redacted(), slot.ID), func(t *task) {
+			defer finished()
+			defer virtualMediaMu.Unlock()
+			status, msg := insert.run(t.SetPercent)
+			t.Finish(status, msg)
+		})
+		writeTaskAccepted(w, t)
+		return
+	}
+
+	defer virtualMediaMu.Unlock()
+	if status, msg := insert.run(nil); msg != nil {
+		writeRedfishError(w, status, *msg)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mediaInsert is a validated InsertMedia request. run is called with
+// virtualMediaMu held.
+type mediaInsert struct {
+	slot       virtualMediaSlot
+	image      *url.URL
+	protocol   string
+	method     string
+	dest       string
+	mountPoint string
+	username   string
+	password   string
+	checksum   *imageChecksum
+	writable   bool
+}
+
+// run fetches and attaches the image. It returns the action's status and,
+// on failure, the message to report. progress may be nil.
+func (m mediaInsert) run(progress func(percent int)) (int, *MessageInfo) {
+	const action = "VirtualMedia.InsertMedia"
+
+	// A share whose image was ejected from the web UI is still mounted.
+	if ins := currentInsertion(); ins != nil && ins.MountPoint != "" {
+		unmountImage(ins.MountPoint)
+		setInsertion(nil)
+	}
+
+	local := m.dest
+	var err error
+	switch {
+	case isShare(m.protocol):
+		log.Printf("Mounting %s for %s", m.image.Redacted(), m.slot.ID)
+		local, err = mountImage(m.image, m.protocol, m.username, m.password, m.mountPoint)
+	case m.protocol != "OEM":
+		log.Printf("Downloading %s for %s", m.image.Redacted(), m.slot.ID)
+		local, err = downloadImage(m.image, m.username, m.password, currentConfig.VirtualMedia.ImageDir, m.checksum, progress)
+	}
+	// Downloads are verified as they arrive; anything else is read here.
+	if err == nil && m.checksum != nil && m.method == "Stream" {
+		if err = m.checksum.verifyFile(local); err != nil && m.mountPoint != "" {
+			unmountImage(m.mountPoint)
+		}
+	}
+	if err != nil {
+		status, msg := imageErrorMessage(err, m.image.Redacted())
+		return status, &msg
+	}
+	if err := currentLUN().Attach(local, m.slot.CDROM, !m.writable); err != nil {
+		if m.mountPoint != "" {
+			unmountImage(m.mountPoint)
+		}
+		status, msg := hardwareErrorMessage(err, action)
+		return status, &msg
+	}
+
+	setInsertion(&mediaInsertion{
+		Slot:                 m.slot.ID,
+		Image:                m.image.Redacted(),
+		Path:                 local,
+		TransferProtocolType: m.protocol,
+		TransferMethod:       m.method,
+		MountPoint:           m.mountPoint,
+	})
+	emitEvent("OK", fmt.Sprintf("Inserted %s into %s", m.image.Redacted(), m.slot.ID),
+		resourceEventPrefix+"ResourceChanged", m.slot.odataID())
+	return http.StatusNoContent, nil
+}
+
+type EjectMediaRequest struct {
+	Oem *ActionOem `json:"Oem,omitempty"`
+}
+
+func handleEjectMedia(w http.ResponseWriter, r *http.Request, slot virtualMediaSlot) {
+	const action = "VirtualMedia.EjectMedia"
+
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	// EjectMedia has no parameters, so an empty body is fine.
+	var req EjectMediaRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+			return
+		}
+	}
+
+	lun := currentLUN()
+	state, err := lun.State()
+	if err != nil {
+		writeHardwareError(w, err, action)
+		return
+	}
+
+	// Only images InsertMedia downloaded are deleted, and only when the
+	// image cache is disabled. One mounted from the web UI or inserted
+	// from a local path belongs to the user, and one on a share is
+	// unmounted instead.
+	ins := currentInsertion()
+	owned := ins != nil && ins.Slot == slot.ID && ins.Path == state.File
+	unmount := owned && ins.MountPoint != ""
+	deleteImage := owned && ins.TransferMethod == "Upload" && currentConfig.VirtualMedia.CacheSizeMB == 0
+
+	if dryRunRequested(r, req.Oem) {
+		var ops []string
+		if slot.inserted(state) {
+			ops = append(ops, fmt.Sprintf("Detach %s from the USB mass storage gadget", state.File))
+			if unmount {
+				ops = append(ops, fmt.Sprintf("Unmount %s", ins.MountPoint))
+			}
+			if deleteImage {
+				ops = append(ops, fmt.Sprintf("Delete %s", state.File))
+			}
+		}
+		writeDryRunReport(w, DryRunReport{
+			Action:     action,
+			Parameters: map[string]string{"Slot": slot.ID},
+			CurrentState: map[string]string{
+				"Inserted": fmt.Sprint(slot.inserted(state)),
+				"Image":    state.File,
+			},
+			WouldPerform: ops,
+		})
+		return
+	}
+
+	// Ejecting an empty slot succeeds so teardown scripts can run it
+	// unconditionally.
+	if !slot.inserted(state) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !virtualMediaMu.TryLock() {
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return
+	}
+	defer virtualMediaMu.Unlock()
+
+	if err := lun.Detach(); err != nil {
+		writeHardwareError(w, err, action)
+		return
+	}
+	if owned {
+		setInsertion(nil)
+	}
+	if unmount {
+		unmountImage(ins.MountPoint)
+	}
+	if deleteImage {
+		removeCacheEntry(state.File)
+	}
+
+	emitEvent("OK", fmt.Sprintf("Ejected %s from %s", filepath.Base(state.File), slot.ID),
+		resourceEventPrefix+"ResourceChanged", slot.odataID())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validImageHost reports whether the image URL has the host its scheme
+// needs: a server, or none for a local file.
+func validImageHost(u *url.URL) bool {
+	if strings.EqualFold(u.Scheme, "file") {
+		return u.Host == "" || u.Host == "localhost"
+	}
+	return u.Host != ""
+}
+
+// validShareImage reports whether a share URL names an image file, and
+// for CIFS a share to find it in.
+func validShareImage(u *url.URL, protocol string) bool {
+	dir, file := path.Split(u.Path)
+	if file == "" {
+		return false
+	}
+	return protocol != "CIFS" || strings.Trim(dir, "/") != ""
+}
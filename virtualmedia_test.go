@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVirtualMediaState(t *testing.T) {
+	lun := setupLUN(t)
+
+	get := func(id string) VirtualMedia {
+		t.Helper()
+		req := httptest.NewRequest("GET", virtualMediaPath+"/"+id, nil)
+		rr := httptest.NewRecorder()
+		handleVirtualMedia(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var media VirtualMedia
+		if err := json.NewDecoder(rr.Body).Decode(&media); err != nil {
+			t.Fatal(err)
+		}
+		return media
+	}
+
+	if cd := get("CD1"); cd.Inserted || cd.Image != nil || cd.ConnectedVia != "NotConnected" {
+		t.Errorf("Expected empty CD, got %+v", cd)
+	}
+
+	if err := lun.Attach("/data/installer.iso", true, true); err != nil {
+		t.Fatal(err)
+	}
+	cd := get("CD1")
+	if !cd.Inserted || cd.Image == nil || *cd.Image != "/data/installer.iso" || *cd.ImageName != "installer.iso" {
+		t.Errorf("Expected installer.iso in the CD, got %+v", cd)
+	}
+	if cd.ConnectedVia != "Oem" || !cd.WriteProtected {
+		t.Errorf("Unexpected CD connection: %+v", cd)
+	}
+	if usb := get("USB1"); usb.Inserted {
+		t.Errorf("Expected USB drive to be empty while the CD is in use, got %+v", usb)
+	}
+
+	req := httptest.NewRequest("GET", virtualMediaPath+"/Floppy1", nil)
+	rr := httptest.NewRecorder()
+	handleVirtualMedia(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown slot, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestInsertMedia(t *testing.T) {
+	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/installer.iso":
+			w.Write([]byte("ISO image contents"))
+		case "/private/installer.iso":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "deploy" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("private image"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer imageServer.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		slot       string
+		body       string
+		header     string
+		expectCode int
+		expectID   string
+		inserted   bool
+	}{
+		{"Missing image", "CD1", `{}`, "", http.StatusBadRequest, "Base.1.8.ActionParameterMissing", false},
+		{"Unsupported scheme", "CD1", `{"Image": "ftp://images.example/installer.iso"}`, "", http.StatusBadRequest, "Base.1.8.ActionParameterValueNotInList", false},
+		{"Protocol mismatch", "CD1", `{"Image": "` + imageServer.URL + `/images/installer.iso", "TransferProtocolType": "HTTPS"}`, "", http.StatusBadRequest, "Base.1.8.ActionParameterValueNotInList", false},
+		{"Missing on server", "CD1", `{"Image": "` + imageServer.URL + `/images/missing.iso"}`, "", http.StatusBadRequest, "Base.1.8.ResourceMissingAtURI", false},
+		{"Unreachable server", "CD1", `{"Image": "` + closed.URL + `/installer.iso"}`, "", http.StatusBadRequest, "Base.1.8.CouldNotEstablishConnection", false},
+		{"Wrong credentials", "CD1", `{"Image": "` + imageServer.URL + `/private/installer.iso", "UserName": "deploy", "Password": "guess"}`, "", http.StatusBadRequest, "Base.1.8.ResourceAtUriUnauthorized", false},
+		{"Dry run", "CD1", `{"Image": "` + imageServer.URL + `/images/installer.iso"}`, "true", http.StatusOK, "", false},
+		{"Insert", "CD1", `{"Image": "` + imageServer.URL + `/images/installer.iso", "TransferProtocolType": "HTTP"}`, "", http.StatusNoContent, "", true},
+		{"Already inserted", "USB1", `{"Image": "` + imageServer.URL + `/images/installer.iso"}`, "", http.StatusConflict, "Base.1.8.ResourceInUse", true},
+	}
+
+	lun := setupLUN(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", virtualMediaPath+"/"+tt.slot+"/Actions/VirtualMedia.InsertMedia", strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set(dryRunHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handleVirtualMedia(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectID != "" {
+				var body map[string]redfishErrorBody
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body["error"].Code != tt.expectID {
+					t.Errorf("Expected %s, got %s", tt.expectID, body["error"].Code)
+				}
+			}
+			if state, _ := lun.State(); (state.File != "") != tt.inserted {
+				t.Errorf("Expected inserted %v, LUN has %q", tt.inserted, state.File)
+			}
+		})
+	}
+
+	state, _ := lun.State()
+	if content, err := os.ReadFile(state.File); err != nil || string(content) != "ISO image contents" {
+		t.Errorf("Expected the downloaded image at %s, got %q (%v)", state.File, content, err)
+	}
+	if !state.CDROM || !state.ReadOnly {
+		t.Errorf("Expected a read-only CD, got %+v", state)
+	}
+
+	req := httptest.NewRequest("GET", virtualMediaPath+"/CD1", nil)
+	rr := httptest.NewRecorder()
+	handleVirtualMedia(rr, req)
+	var cd VirtualMedia
+	if err := json.NewDecoder(rr.Body).Decode(&cd); err != nil {
+		t.Fatal(err)
+	}
+	if cd.ConnectedVia != "URI" || *cd.Image != imageServer.URL+"/images/installer.iso" || *cd.ImageName != "installer.iso" {
+		t.Errorf("Unexpected CD after insert: %+v", cd)
+	}
+	if cd.TransferProtocolType == nil || *cd.TransferProtocolType != "HTTP" {
+		t.Errorf("Expected TransferProtocolType HTTP, got %v", cd.TransferProtocolType)
+	}
+}
+
+func TestEjectMedia(t *testing.T) {
+	tests := []struct {
+		name         string
+		slot         string
+		cacheSizeMB  int
+		webUI        bool
+		expectCode   int
+		expectFile   string
+		expectDelete bool
+	}{
+		{"Eject downloaded image without cache", "CD1", 0, false, http.StatusNoContent, "", true},
+		{"Eject cached image", "CD1", 2048, false, http.StatusNoContent, "", false},
+		{"Eject web UI image", "CD1", 0, true, http.StatusNoContent, "", false},
+		{"Eject empty slot", "USB1", 0, false, http.StatusNoContent, "installer.iso", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lun := setupLUN(t)
+			currentConfig.VirtualMedia.CacheSizeMB = tt.cacheSizeMB
+
+			image := filepath.Join(t.TempDir(), "installer.iso")
+			if err := os.WriteFile(image, []byte("ISO image contents"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := lun.Attach(image, true, true); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.webUI {
+				setInsertion(&mediaInsertion{Slot: "CD1", Image: "http://images.example/installer.iso", Path: image, TransferProtocolType: "HTTP", TransferMethod: "Upload"})
+			}
+
+			req := httptest.NewRequest("POST", virtualMediaPath+"/"+tt.slot+"/Actions/VirtualMedia.EjectMedia", nil)
+			rr := httptest.NewRecorder()
+			handleVirtualMedia(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			state, _ := lun.State()
+			if filepath.Base(state.File) != tt.expectFile && state.File != tt.expectFile {
+				t.Errorf("Expected LUN file %q, got %q", tt.expectFile, state.File)
+			}
+			if _, err := os.Stat(image); os.IsNotExist(err) != tt.expectDelete {
+				t.Errorf("Expected image deleted %v, stat returned %v", tt.expectDelete, err)
+			}
+			if state.File == "" && currentInsertion() != nil {
+				t.Error("Insertion still recorded after eject")
+			}
+		})
+	}
+}
+
+func TestInsertMediaFromShare(t *testing.T) {
+	lun := setupLUN(t)
+	mount := &fakeMount{files: []string{"installer.iso"}}
+	mount.install(t)
+
+	post := func(action, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", virtualMediaPath+"/CD1/Actions/VirtualMedia."+action, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleVirtualMedia(rr, req)
+		return rr
+	}
+
+	for _, body := range []string{
+		`{"Image": "nfs://files.example/installer.iso", "TransferMethod": "Upload"}`,
+		`{"Image": "smb://files.example/installer.iso"}`,
+		`{"Image": "nfs://files.example/export/"}`,
+	} {
+		if rr := post("InsertMedia", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, body, rr.Code)
+		}
+	}
+	if len(mount.calls) != 0 {
+		t.Fatalf("Rejected requests ran %v", mount.calls)
+	}
+
+	rr := post("InsertMedia", `{"Image": "nfs://files.example/export/installer.iso", "TransferProtocolType": "NFS", "TransferMethod": "Stream"}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	mountPoint := filepath.Join(currentConfig.VirtualMedia.MountDir, "CD1")
+	state, _ := lun.State()
+	if state.File != filepath.Join(mountPoint, "installer.iso") {
+		t.Errorf("Expected the LUN to read from the share, got %q", state.File)
+	}
+	if entries, _ := os.ReadDir(currentConfig.VirtualMedia.ImageDir); len(entries) != 0 {
+		t.Errorf("Expected nothing written to the image directory, found %d entries", len(entries))
+	}
+
+	req := httptest.NewRequest("GET", virtualMediaPath+"/CD1", nil)
+	rr = httptest.NewRecorder()
+	handleVirtualMedia(rr, req)
+	var cd VirtualMedia
+	if err := json.NewDecoder(rr.Body).Decode(&cd); err != nil {
+		t.Fatal(err)
+	}
+	if cd.TransferMethod == nil || *cd.TransferMethod != "Stream" || *cd.TransferProtocolType != "NFS" {
+		t.Errorf("Unexpected transfer for a share image: %+v", cd)
+	}
+
+	if rr := post("EjectMedia", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if last := mount.calls[len(mount.calls)-1]; last != "umount "+mountPoint {
+		t.Errorf("Expected the share to be unmounted, last command %q", last)
+	}
+	if _, err := os.Stat(filepath.Join(mountPoint, "installer.iso")); err != nil {
+		t.Errorf("Eject must not delete images on a share: %v", err)
+	}
+}
+
+func TestInsertMediaFromLocalPath(t *testing.T) {
+	lun := setupLUN(t)
+	dir := t.TempDir()
+	image := filepath.Join(dir, "installer.iso")
+	if err := os.WriteFile(image, []byte("ISO image contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	currentConfig.VirtualMedia.LocalImageDirs = []string{dir}
+
+	post := func(action, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", virtualMediaPath+"/USB1/Actions/VirtualMedia."+action, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleVirtualMedia(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		expectCode int
+	}{
+		{"Outside local directories", `{"Image": "file:///etc/shadow"}`, http.StatusBadRequest},
+		{"Remote file host", `{"Image": "file://files.example` + image + `"}`, http.StatusBadRequest},
+		{"Both Image and LocalPath", `{"Image": "file://` + image + `", "Oem": {"NanoKVM": {"LocalPath": "` + image + `"}}}`, http.StatusBadRequest},
+		{"Missing file", `{"Oem": {"NanoKVM": {"LocalPath": "` + filepath.Join(dir, "missing.iso") + `"}}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rr := post("InsertMedia", tt.body); rr.Code != tt.expectCode {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectCode, rr.Code)
+		}
+	}
+
+	for _, body := range []string{
+		`{"Image": "file://` + image + `", "TransferProtocolType": "OEM"}`,
+		`{"Oem": {"NanoKVM": {"LocalPath": "` + image + `"}}}`,
+	} {
+		if rr := post("InsertMedia", body); rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d for %s, got %d: %s", http.StatusNoContent, body, rr.Code, rr.Body.String())
+		}
+		state, _ := lun.State()
+		if state.File != image || state.CDROM {
+			t.Errorf("Expected %s attached as a USB drive, got %+v", image, state)
+		}
+		if entries, _ := os.ReadDir(currentConfig.VirtualMedia.ImageDir); len(entries) != 0 {
+			t.Errorf("Expected nothing copied to the image directory, found %d entries", len(entries))
+		}
+
+		if rr := post("EjectMedia", ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if _, err := os.Stat(image); err != nil {
+			t.Fatalf("Eject must not delete a local image: %v", err)
+		}
+	}
+}
+
+func TestInsertMediaAsync(t *testing.T) {
+	lun := setupLUN(t)
+	setupTaskStore(t)
+
+	release := make(chan struct{})
+	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "20")
+		w.Write([]byte("ISO image "))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("contents\n\n"))
+	}))
+	defer imageServer.Close()
+
+	body := `{"Image": "` + imageServer.URL + `/installer.iso"}`
+	req := httptest.NewRequest("POST", virtualMediaPath+"/CD1/Actions/VirtualMedia.InsertMedia", strings.NewReader(body))
+	req.Header.Set("Prefer", "respond-async")
+	rr := httptest.NewRecorder()
+	handleVirtualMedia(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var res TaskResource
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	task, ok := taskStore.Get(res.ID)
+	if !ok || rr.Header().Get("Location") != res.TaskMonitor {
+		t.Fatalf("Expected a task monitor in Location, got %q for %+v", rr.Header().Get("Location"), res)
+	}
+
+	waitFor(t, "download progress", func() bool { return task.resource().PercentComplete == 50 })
+	req = httptest.NewRequest("POST", virtualMediaPath+"/USB1/Actions/VirtualMedia.InsertMedia", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleVirtualMedia(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d during the download, got %d", http.StatusConflict, rr.Code)
+	}
+
+	close(release)
+	waitFor(t, "download to finish", func() bool { return task.resource().TaskState == "Completed" })
+	if state, _ := lun.State(); !strings.HasSuffix(state.File, "-installer.iso") {
+		t.Errorf("Expected the image attached after the task, got %q", state.File)
+	}
+}
+
+func TestInsertMediaChecksum(t *testing.T) {
+	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ISO image contents"))
+	}))
+	defer imageServer.Close()
+
+	const sha256sum = "d56781ab226a124b583488849697968211ba81745ccf98295e46314eeeb965a2"
+	tests := []struct {
+		name       string
+		oem        string
+		expectCode int
+		expectID   string
+	}{
+		{"SHA256 match", `{"Checksum": "` + sha256sum + `"}`, http.StatusNoContent, ""},
+		{"MD5 match", `{"Checksum": "b4d6e01dee9f2fad4ff4247b2e0c5587", "ChecksumAlgorithm": "md5"}`, http.StatusNoContent, ""},
+		{"Mismatch", `{"Checksum": "` + strings.Repeat("0", 64) + `"}`, http.StatusBadRequest, "Base.1.8.InvalidObject"},
+		{"Unknown algorithm", `{"Checksum": "` + sha256sum + `", "ChecksumAlgorithm": "CRC32"}`, http.StatusBadRequest, "Base.1.8.ActionParameterValueNotInList"},
+		{"Digest too short", `{"Checksum": "b4d6e01dee9f2fad4ff4247b2e0c5587"}`, http.StatusBadRequest, "Base.1.8.ActionParameterValueFormatError"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lun := setupLUN(t)
+			body := `{"Image": "` + imageServer.URL + `/installer.iso", "Oem": {"NanoKVM": ` + tt.oem + `}}`
+			req := httptest.NewRequest("POST", virtualMediaPath+"/CD1/Actions/VirtualMedia.InsertMedia", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			handleVirtualMedia(rr, req)
+
+			if rr.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectID == "" {
+				return
+			}
+			var errBody map[string]redfishErrorBody
+			if err := json.Unmarshal(rr.Body.Bytes(), &errBody); err != nil {
+				t.Fatal(err)
+			}
+			if errBody["error"].Code != tt.expectID {
+				t.Errorf("Expected %s, got %s", tt.expectID, errBody["error"].Code)
+			}
+			if state, _ := lun.State(); state.File != "" {
+				t.Errorf("Expected nothing attached, got %q", state.File)
+			}
+			if entries, _ := os.ReadDir(currentConfig.VirtualMedia.ImageDir); len(entries) != 0 {
+				t.Errorf("Expected no image left behind, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestVirtualMediaWriteProtected(t *testing.T) {
+	lun := setupLUN(t)
+	dir := t.TempDir()
+	image := filepath.Join(dir, "disk.img")
+	if err := os.WriteFile(image, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	currentConfig.VirtualMedia.LocalImageDirs = []string{dir}
+
+	send := func(method, path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, virtualMediaPath+path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleVirtualMedia(rr, req)
+		return rr.Code
+	}
+	readOnly := func() bool {
+		t.Helper()
+		state, err := lun.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state.ReadOnly
+	}
+
+	if code := send("PATCH", "/USB1", `{"WriteProtected": false}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d making an empty slot writable, got %d", http.StatusBadRequest, code)
+	}
+	if code := send("PATCH", "/USB1", `{"WriteProtected": true}`); code != http.StatusNoContent {
+		t.Errorf("Expected status %d for a no-op, got %d", http.StatusNoContent, code)
+	}
+	if code := send("POST", "/CD1/Actions/VirtualMedia.InsertMedia",
+		`{"Image": "file://`+image+`", "WriteProtected": false}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a writable CD, got %d", http.StatusBadRequest, code)
+	}
+	if code := send("POST", "/USB1/Actions/VirtualMedia.InsertMedia",
+		`{"Image": "http://images.example/disk.img", "WriteProtected": false}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a writable download, got %d", http.StatusBadRequest, code)
+	}
+
+	if code := send("POST", "/USB1/Actions/VirtualMedia.InsertMedia",
+		`{"Image": "file://`+image+`", "WriteProtected": false}`); code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+	}
+	if readOnly() {
+		t.Error("Expected a writable LUN")
+	}
+
+	if code := send("PATCH", "/USB1", `{"WriteProtected": true}`); code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+	}
+	if !readOnly() {
+		t.Error("Expected the LUN to be read-only after PATCH")
+	}
+	if code := send("PATCH", "/USB1", `{"WriteProtected": false}`); code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+	}
+	if readOnly() {
+		t.Error("Expected the LUN to be writable again after PATCH")
+	}
+	if state, _ := lun.State(); state.File != image {
+		t.Errorf("Expected %s still attached, got %q", image, state.File)
+	}
+
+	// An image mounted from the web UI is not ours to make writable.
+	send("POST", "/USB1/Actions/VirtualMedia.EjectMedia", "")
+	if err := lun.Attach(image, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if code := send("PATCH", "/USB1", `{"WriteProtected": false}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a web UI image, got %d", http.StatusBadRequest, code)
+	}
+}
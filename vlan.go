@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A VLAN ID is from 1 to 4094; 0 and 4095 are reserved.
+const (
+	minVLANID = 1
+	maxVLANID = 4094
+)
+
+// savedVLAN is a tagged interface on one of the manager's interfaces, as
+// NetworkConfig.VLANFile keeps it. The service creates it and sets its
+// addresses itself, so they are static: there is no DHCP client for it.
+type savedVLAN struct {
+	Parent     string       `json:"Parent"`
+	VLANId     int          `json:"VLANId"`
+	VLANEnable bool         `json:"VLANEnable"`
+	IPv4       ipv4Settings `json:"IPv4"`
+}
+
+// name is the name of the tagged interface, as vconfig and ip name them.
+func (v savedVLAN) name() string {
+	return fmt.Sprintf("%s.%d", v.Parent, v.VLANId)
+}
+
+func (v savedVLAN) path() string {
+	return vlansPath(v.Parent) + "/" + strconv.Itoa(v.VLANId)
+}
+
+func vlansPath(parent string) string {
+	return ethernetInterfacesPath + "/" + parent + "/VLANs"
+}
+
+var (
+	vlanMu sync.Mutex
+	vlans  []savedVLAN
+)
+
+// loadVLANs restores the VLANs saved in cfg.VLANFile.
+func loadVLANs(cfg NetworkConfig) error {
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	vlans = nil
+	if cfg.VLANFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(cfg.VLANFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", cfg.VLANFile, err)
+	}
+	if err := json.Unmarshal(content, &vlans); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", cfg.VLANFile, err)
+	}
+	return nil
+}
+
+// saveVLANs is called with vlanMu held.
+func saveVLANs() error {
+	path := currentConfig.Network.VLANFile
+	if path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(vlans, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content, 0o600)
+}
+
+// findVLAN returns the index of the VLAN with the given parent and ID, or
+// -1. It is called with vlanMu held.
+func findVLAN(parent string, id int) int {
+	for i, v := range vlans {
+		if v.Parent == parent && v.VLANId == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookupVLAN returns the VLAN whose tagged interface is name.
+func lookupVLAN(name string) (savedVLAN, bool) {
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	for _, v := range vlans {
+		if v.name() == name {
+			return v, true
+		}
+	}
+	return savedVLAN{}, false
+}
+
+// setVLANAddresses saves new addressing for the VLAN whose tagged interface
+// is name.
+func setVLANAddresses(name string, settings ipv4Settings) error {
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	for i, v := range vlans {
+		if v.name() == name {
+			previous := v.IPv4
+			vlans[i].IPv4 = settings
+			if err := saveVLANs(); err != nil {
+				vlans[i].IPv4 = previous
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no VLAN interface %s", name)
+}
+
+// runIP runs the ip command, if one is configured.
+func runIP(args ...string) error {
+	command := currentConfig.Network.IPCommand
+	if command == "" {
+		return nil
+	}
+	if output, err := runCommand(nil, command, args...); err != nil {
+		return fmt.Errorf("ip %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// createVLAN adds the tagged interface of v to the kernel, unless it is
+// there already, and configures it.
+func createVLAN(v savedVLAN) error {
+	if readNetAttr(v.name(), "ifindex") == "" {
+		if err := runIP("link", "add", "link", v.Parent, "name", v.name(), "type", "vlan", "id", strconv.Itoa(v.VLANId)); err != nil {
+			return err
+		}
+	}
+	return configureVLAN(v)
+}
+
+// configureVLAN brings the tagged interface of v up or down and gives it
+// its static addresses. Its default route has a higher metric than the
+// untagged one's, so that it only carries traffic for its own subnets
+// while the untagged interface has a gateway.
+func configureVLAN(v savedVLAN) error {
+	state := "down"
+	if v.VLANEnable {
+		state = "up"
+	}
+	if err := runIP("link", "set", "dev", v.name(), state); err != nil {
+		return err
+	}
+	if err := runIP("-4", "addr", "flush", "dev", v.name()); err != nil {
+		return err
+	}
+	if !v.VLANEnable {
+		return nil
+	}
+	var gateway string
+	for _, address := range v.IPv4.StaticAddresses {
+		if err := runIP("addr", "add", ipv4CIDR(address), "dev", v.name()); err != nil {
+			return err
+		}
+		if gateway == "" {
+			gateway = address.Gateway
+		}
+	}
+	if gateway != "" {
+		return runIP("route", "add", "default", "via", gateway, "dev", v.name(), "metric", strconv.Itoa(1000+v.VLANId))
+	}
+	return nil
+}
+
+// restoreVLANs recreates the saved VLANs when the service starts, since
+// tagged interfaces do not survive a reboot.
+func restoreVLANs() {
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	for _, v := range vlans {
+		if err := createVLAN(v); err != nil {
+			log.Printf("Failed to restore VLAN %s: %v", v.name(), err)
+		}
+	}
+}
+
+// addVLANLinks adds the VLAN details of a manager interface to its
+// resource: the link to its VLANs if it can carry them, or its VLAN ID
+// and the interface it is tagged on if it is one.
+func addVLANLinks(resource map[string]interface{}, name string) {
+	if _, ok := currentConfig.Network.StaticFiles[name]; ok {
+		resource["VLANs"] = map[string]string{"@odata.id": vlansPath(name)}
+	}
+	if v, ok := lookupVLAN(name); ok {
+		resource["VLAN"] = map[string]interface{}{"VLANEnable": v.VLANEnable, "VLANId": v.VLANId}
+		resource["Links"] = map[string]interface{}{
+			"RelatedInterfaces": []Link{{ODataID: ethernetInterfacesPath + "/" + v.Parent}},
+		}
+	}
+}
+
+func vlanResource(v savedVLAN) map[string]interface{} {
+	return map[string]interface{}{
+		"@odata.type": odataType("VLanNetworkInterface"),
+		"@odata.id":   v.path(),
+		"Id":          strconv.Itoa(v.VLANId),
+		"Name":        fmt.Sprintf("VLAN %d", v.VLANId),
+		"Description": fmt.Sprintf("Tagged interface %s, addressed at %s/%s", v.name(), ethernetInterfacesPath, v.name()),
+		"VLANEnable":  v.VLANEnable,
+		"VLANId":      v.VLANId,
+	}
+}
+
+// handleVLANs serves the VLANs of a manager interface, parent, under
+// rest, the path below its VLANs collection.
+func handleVLANs(w http.ResponseWriter, r *http.Request, parent, rest string) {
+	if _, ok := currentConfig.Network.StaticFiles[parent]; !ok {
+		writeNotFound(w, r)
+		return
+	}
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			handleVLANCollectionGet(w, r, parent)
+		case http.MethodPost:
+			handleVLANCollectionPost(w, r, parent)
+		default:
+			writeMethodNotAllowed(w, r, "GET", "POST")
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(rest)
+	vlanMu.Lock()
+	found := err == nil && findVLAN(parent, id) >= 0
+	vlanMu.Unlock()
+	if !found {
+		writeNotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		handleVLANGet(w, r, parent, id)
+	case http.MethodPatch:
+		handleVLANPatch(w, r, parent, id)
+	case http.MethodDelete:
+		handleVLANDelete(w, r, parent, id)
+	default:
+		writeMethodNotAllowed(w, r, "GET", "PATCH", "DELETE")
+	}
+}
+
+func handleVLANCollectionGet(w http.ResponseWriter, r *http.Request, parent string) {
+	members := []map[string]string{}
+	vlanMu.Lock()
+	for _, v := range vlans {
+		if v.Parent == parent {
+			members = append(members, map[string]string{"@odata.id": v.path()})
+		}
+	}
+	vlanMu.Unlock()
+
+	collection := SystemCollection{
+		ODataType: "#VLanNetworkInterfaceCollection.VLanNetworkInterfaceCollection",
+		ODataID:   vlansPath(parent),
+		Name:      "VLAN Network Interface Collection",
+		Members:   members,
+	}
+
+	writeCollection(w, r, collection)
+}
+
+type VLANRequest struct {
+	VLANEnable *bool `json:"VLANEnable,omitempty"`
+	VLANId     *int  `json:"VLANId,omitempty"`
+}
+
+type VLANPatchRequest struct {
+	VLANEnable *bool `json:"VLANEnable,omitempty"`
+}
+
+// handleVLANCollectionPost tags a new VLAN on parent. It starts enabled
+// unless VLANEnable says otherwise, without addresses until its
+// EthernetInterface is given some.
+func handleVLANCollectionPost(w http.ResponseWriter, r *http.Request, parent string) {
+	var req VLANRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if req.VLANId == nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("PropertyMissing", "VLANId").withProperty("#/VLANId"))
+		return
+	}
+	if *req.VLANId < minVLANID || *req.VLANId > maxVLANID {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("PropertyValueIncorrect", "VLANId", strconv.Itoa(*req.VLANId)).withProperty("#/VLANId"))
+		return
+	}
+
+	v := savedVLAN{
+		Parent:     parent,
+		VLANId:     *req.VLANId,
+		VLANEnable: req.VLANEnable == nil || *req.VLANEnable,
+		IPv4:       ipv4Settings{StaticAddresses: []IPv4Address{}},
+	}
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	if findVLAN(parent, v.VLANId) >= 0 {
+		writeRedfishError(w, http.StatusBadRequest,
+			newMessage("ResourceAlreadyExists", "VLanNetworkInterface", "VLANId", strconv.Itoa(v.VLANId)).withProperty("#/VLANId"))
+		return
+	}
+	if err := createVLAN(v); err != nil {
+		runIP("link", "delete", "dev", v.name())
+		writeInternalError(w, "create VLAN", err)
+		return
+	}
+	vlans = append(vlans, v)
+	if err := saveVLANs(); err != nil {
+		log.Printf("Failed to save VLANs: %v", err)
+	}
+	log.Printf("Created VLAN %s", v.name())
+	emitEvent("OK", fmt.Sprintf("VLAN %s created", v.name()), resourceEventPrefix+"ResourceCreated", v.path())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", v.path())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(vlanResource(v))
+}
+
+func handleVLANGet(w http.ResponseWriter, r *http.Request, parent string, id int) {
+	vlanMu.Lock()
+	i := findVLAN(parent, id)
+	var v savedVLAN
+	if i >= 0 {
+		v = vlans[i]
+	}
+	vlanMu.Unlock()
+	if i < 0 {
+		writeNotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vlanResource(v))
+}
+
+// handleVLANPatch turns a VLAN on or off. Its ID cannot change; delete it
+// and create another instead.
+func handleVLANPatch(w http.ResponseWriter, r *http.Request, parent string, id int) {
+	var req VLANPatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRedfishError(w, http.StatusBadRequest, newMessage("MalformedJSON"))
+		return
+	}
+	get := func(w http.ResponseWriter, r *http.Request) { handleVLANGet(w, r, parent, id) }
+	if !checkPreconditions(w, r, contentETag(fetchResource(r, get).body.Bytes()), false) {
+		return
+	}
+	ignored, ok := checkPatchProperties(w, r, body, &req, get)
+	if !ok {
+		return
+	}
+
+	if req.VLANEnable != nil && !setVLANEnable(w, parent, id, *req.VLANEnable) {
+		return
+	}
+
+	writePatchResult(w, r, ignored, get)
+}
+
+// setVLANEnable brings a VLAN up or down. It writes an error and returns
+// false if it cannot.
+func setVLANEnable(w http.ResponseWriter, parent string, id int, enable bool) bool {
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	i := findVLAN(parent, id)
+	if i < 0 {
+		// Deleted since the request was routed.
+		writeRedfishError(w, http.StatusNotFound, newMessage("ResourceMissingAtURI", vlansPath(parent)+"/"+strconv.Itoa(id)))
+		return false
+	}
+	if vlans[i].VLANEnable == enable {
+		return true
+	}
+	next := vlans[i]
+	next.VLANEnable = enable
+	if err := configureVLAN(next); err != nil {
+		writeInternalError(w, "configure VLAN", err)
+		return false
+	}
+	vlans[i] = next
+	if err := saveVLANs(); err != nil {
+		log.Printf("Failed to save VLANs: %v", err)
+	}
+	state := "disabled"
+	if enable {
+		state = "enabled"
+	}
+	emitEvent("OK", fmt.Sprintf("VLAN %s %s", next.name(), state), resourceEventPrefix+"ResourceChanged", next.path())
+	return true
+}
+
+func handleVLANDelete(w http.ResponseWriter, r *http.Request, parent string, id int) {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	vlanMu.Lock()
+	defer vlanMu.Unlock()
+	i := findVLAN(parent, id)
+	if i < 0 {
+		writeNotFound(w, r)
+		return
+	}
+	v := vlans[i]
+	if networkPending != nil && networkPending.Interface == v.name() {
+		writeRedfishError(w, http.StatusConflict, newMessage("ResourceInUse"))
+		return
+	}
+	if err := runIP("link", "delete", "dev", v.name()); err != nil {
+		writeInternalError(w, "delete VLAN", err)
+		return
+	}
+	vlans = append(vlans[:i:i], vlans[i+1:]...)
+	if err := saveVLANs(); err != nil {
+		log.Printf("Failed to save VLANs: %v", err)
+	}
+	log.Printf("Deleted VLAN %s", v.name())
+	emitEvent("OK", fmt.Sprintf("VLAN %s deleted", v.name()), resourceEventPrefix+"ResourceRemoved", v.path())
+	w.WriteHeader(http.StatusNoContent)
+}
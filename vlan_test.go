@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManagerVLANs(t *testing.T) {
+	fakeNetSysfs(t, map[string]map[string]string{
+		"eth0": {"type": "1", "ifindex": "2", "flags": "0x1003", "carrier": "1"},
+	})
+	dir := t.TempDir()
+	currentConfig.Network = NetworkConfig{
+		StaticFiles:    map[string]string{"eth0": filepath.Join(dir, "eth.nodhcp")},
+		ConfirmTimeout: 60,
+		IPCommand:      "/sbin/ip",
+		VLANFile:       filepath.Join(dir, "vlans.json"),
+	}
+
+	oldAddresses, oldRun, oldSchedule := readInterfaceAddresses, runCommand, scheduleNetworkApply
+	defer func() {
+		readInterfaceAddresses, runCommand, scheduleNetworkApply = oldAddresses, oldRun, oldSchedule
+		networkPending = nil
+		vlans = nil
+	}()
+	addresses := map[int][]interfaceAddress{}
+	readInterfaceAddresses = func() (map[int][]interfaceAddress, error) { return addresses, nil }
+	var calls []string
+	runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return nil, nil
+	}
+	var apply func()
+	scheduleNetworkApply = func(f func()) { apply = f }
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey,
+			&net.TCPAddr{IP: net.ParseIP("10.0.100.5"), Port: 8080}))
+		rr := httptest.NewRecorder()
+		handleEthernetInterfaces(rr, req)
+		return rr
+	}
+	collection := ethernetInterfacesPath + "/eth0/VLANs"
+
+	for _, body := range []string{`{}`, `{"VLANId": 4095}`} {
+		if rr := do("POST", collection, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: expected 400, got %d", body, rr.Code)
+		}
+	}
+	rr := do("POST", collection, `{"VLANId": 100}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != collection+"/100" {
+		t.Fatalf("Expected 201 with a Location, got %d: %s", rr.Code, rr.Body.String())
+	}
+	expected := []string{"link add link eth0 name eth0.100 type vlan id 100", "link set dev eth0.100 up", "-4 addr flush dev eth0.100"}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the VLAN created and brought up, got %v", calls)
+	}
+	if rr := do("POST", collection, `{"VLANId": 100}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a VLAN that exists, got %d", rr.Code)
+	}
+
+	// The kernel now has the tagged interface, which takes static addresses.
+	os.MkdirAll(filepath.Join(netSysfsDir, "eth0.100"), 0755)
+	for attr, value := range map[string]string{"type": "1", "ifindex": "4", "flags": "0x1003"} {
+		os.WriteFile(filepath.Join(netSysfsDir, "eth0.100", attr), []byte(value), 0644)
+	}
+	vlanInterface := ethernetInterfacesPath + "/eth0.100"
+	if rr := do("GET", vlanInterface, ""); !strings.Contains(rr.Body.String(), `"VLANId":100`) ||
+		!strings.Contains(rr.Body.String(), `"RelatedInterfaces":[{"@odata.id":"`+ethernetInterfacesPath+`/eth0"}]`) {
+		t.Errorf("Expected the tagged interface to show its VLAN, got %s", rr.Body.String())
+	}
+	if rr := do("PATCH", vlanInterface, `{"DHCPv4": {"DHCPEnabled": true}}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for DHCP on a VLAN, got %d", rr.Code)
+	}
+	calls = nil
+	rr = do("PATCH", vlanInterface, `{"IPv4StaticAddresses": [{"Address": "10.0.100.5", "SubnetMask": "255.255.255.0", "Gateway": "10.0.100.1"}]}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	apply()
+	expected = []string{"link set dev eth0.100 up", "-4 addr flush dev eth0.100", "addr add 10.0.100.5/24 dev eth0.100",
+		"route add default via 10.0.100.1 dev eth0.100 metric 1100"}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the VLAN addressed, got %v", calls)
+	}
+	if rr := do("DELETE", collection+"/100", ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while its addresses are unconfirmed, got %d", rr.Code)
+	}
+	addresses[4] = []interfaceAddress{{IP: net.ParseIP("10.0.100.5"), PrefixLength: 24, Permanent: true}}
+	do("GET", vlanInterface, "")
+	if networkPending != nil {
+		t.Fatal("Expected the addresses confirmed through the VLAN")
+	}
+
+	calls = nil
+	if rr := do("PATCH", collection+"/100", `{"VLANEnable": false}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(calls) != 2 || calls[0] != "link set dev eth0.100 down" {
+		t.Errorf("Expected the VLAN brought down, got %v", calls)
+	}
+	if err := loadVLANs(currentConfig.Network); err != nil {
+		t.Fatal(err)
+	}
+	if len(vlans) != 1 || vlans[0].VLANEnable || len(vlans[0].IPv4.StaticAddresses) != 1 {
+		t.Errorf("Expected the disabled VLAN and its address saved, got %+v", vlans)
+	}
+
+	calls = nil
+	if rr := do("DELETE", collection+"/100", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(calls) != 1 || calls[0] != "link delete dev eth0.100" || len(vlans) != 0 {
+		t.Errorf("Expected the VLAN deleted, got %v", calls)
+	}
+	if rr := do("GET", collection+"/100", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after the delete, got %d", rr.Code)
+	}
+}